@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+type apiTokenKey struct{}
+
+// apiTokenFromContext returns the API token a request was authenticated
+// with
+func apiTokenFromContext(ctx context.Context) (client.APIToken, bool) {
+	t, ok := ctx.Value(apiTokenKey{}).(client.APIToken)
+	return t, ok
+}
+
+// apiTokenValidator accepts requests that were authenticated with an API
+// token, and otherwise falls back to the wrapped validator
+type apiTokenValidator struct {
+	RequestValidator
+}
+
+func (v apiTokenValidator) Valid(req *http.Request) (bool, string) {
+	if t, ok := apiTokenFromContext(req.Context()); ok {
+		return true, t.Parent
+	}
+	return v.RequestValidator.Valid(req)
+}
+
+// apiTokenSubtreeFields are request body fields with node IDs that must be
+// in the subtree of a restricted token
+var apiTokenSubtreeFields = []string{"parent", "oldParent", "newParent"}
+
+// checkAPIToken authenticates requests with an API token. Other requests
+// (JWT, auth token) are passed through unchanged and are authenticated by
+// the handlers. The token scope must allow the operation, node IDs in the
+// request must be in the token subtree, and points can only be sent to nodes
+// allowed by APIToken.AllowsPoints. The token is added to the request
+// context.
+func checkAPIToken(nc *nats.Conn, authToken string, res http.ResponseWriter,
+	req *http.Request, op *apiOperation) (*http.Request, bool) {
+	if op.Public {
+		return req, true
+	}
+
+	auth := req.Header.Get("Authorization")
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if auth == "" {
+		// browsers can't set headers on WebSocket requests
+		token = req.URL.Query().Get("token")
+	}
+
+	// JWTs have 3 dot separated parts
+	if token == "" || token == authToken || strings.Count(token, ".") == 2 {
+		return req, true
+	}
+
+	t, err := client.CheckAPIToken(nc, token)
+	if err != nil {
+		if errors.Is(err, client.ErrAPITokenInvalid) {
+			writeError(res, http.StatusUnauthorized, err.Error())
+		} else {
+			writeError(res, http.StatusInternalServerError, err.Error())
+		}
+		return nil, false
+	}
+
+	if !t.Allows(op.Scope) {
+		writeError(res, http.StatusForbidden, "token scope does not allow this request")
+		return nil, false
+	}
+
+	ids, err := apiTokenRequestIDs(req, op)
+	if err != nil {
+		writeError(res, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	if t.NodeID != "" && len(ids) > 0 {
+		subtree, err := client.GetSubtreeIDs(nc, t.NodeID)
+		if err != nil {
+			writeError(res, http.StatusInternalServerError, err.Error())
+			return nil, false
+		}
+
+		for _, id := range ids {
+			if !subtree[id] {
+				writeError(res, http.StatusForbidden, "node is not accessible with this token")
+				return nil, false
+			}
+		}
+	}
+
+	if op.Scope == data.PointValueWrite {
+		for _, id := range ids {
+			nodes, err := client.GetNodes(nc, "all", id, "", false)
+			if err != nil {
+				writeError(res, http.StatusInternalServerError, err.Error())
+				return nil, false
+			}
+
+			for _, n := range nodes {
+				if !t.AllowsPoints(n.Type) {
+					writeError(res, http.StatusForbidden,
+						"only admin tokens can send points to "+n.Type+" nodes")
+					return nil, false
+				}
+			}
+		}
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), apiTokenKey{}, t)), true
+}
+
+// apiTokenRequestIDs returns the node IDs in the request path and body
+func apiTokenRequestIDs(req *http.Request, op *apiOperation) ([]string, error) {
+	var ret []string
+
+	pattern := strings.Split(strings.Trim(op.Path, "/"), "/")
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for i := range pattern {
+		if pattern[i] == "{id}" && i < len(segments) {
+			ret = append(ret, segments[i])
+		}
+	}
+
+	// bodies have already been validated
+	if op.Body == "" || op.BodyContentType != "" || req.Body == nil {
+		return ret, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var fields map[string]any
+	if json.Unmarshal(body, &fields) != nil {
+		// not an object
+		return ret, nil
+	}
+
+	for k, v := range fields {
+		for _, f := range apiTokenSubtreeFields {
+			if id, ok := v.(string); ok && id != "" && strings.EqualFold(k, f) {
+				ret = append(ret, id)
+			}
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,124 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/api"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestAPIToken(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	users, err := client.GetNodes(nc, root.ID, "all", data.NodeTypeUser, false)
+	if err != nil || len(users) < 1 {
+		t.Fatal("Error getting user: ", err)
+	}
+
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "ID-var",
+		Type:   data.NodeTypeVariable,
+		Parent: root.ID,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	for _, tok := range []client.APIToken{
+		{ID: "ID-read", Parent: users[0].ID, Token: "read-token",
+			Scope: data.PointValueRead},
+		{ID: "ID-write", Parent: users[0].ID, Token: "write-token",
+			Scope: data.PointValueWrite, NodeID: "ID-var"},
+		{ID: "ID-write-all", Parent: users[0].ID, Token: "write-all-token",
+			Scope: data.PointValueWrite},
+		{ID: "ID-disabled", Parent: users[0].ID, Token: "disabled-token",
+			Scope: data.PointValueAdmin, Disabled: true},
+	} {
+		err = client.SendNodeType(nc, tok, "test")
+		if err != nil {
+			t.Fatal("Error sending token: ", err)
+		}
+	}
+
+	// tokens are stored as a hash
+	tokens, err := client.GetNodes(nc, users[0].ID, "ID-read", "", false)
+	if err != nil || len(tokens) < 1 {
+		t.Fatal("Error getting token node: ", err)
+	}
+
+	if _, ok := tokens[0].Points.Find(data.PointTypeToken, ""); ok {
+		t.Fatal("Token point was stored")
+	}
+
+	hash, _ := tokens[0].Points.Find(data.PointTypeTokenHash, "")
+	if hash.Text != client.HashToken("read-token") {
+		t.Fatalf("Wrong token hash: %v", hash.Text)
+	}
+
+	key, _ := api.NewKey([]byte("test key"))
+	h := api.NewV1Handler(api.ServerArgs{JwtAuth: key, AuthToken: "secret", Nc: nc})
+
+	do := func(method, url, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, "/v1")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	points := `[{"type":"value","value":1}]`
+
+	tests := []struct {
+		method, url, token, body string
+		code                     int
+	}{
+		{http.MethodGet, "/v1/nodes", "bad-token", "", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/nodes", "disabled-token", "", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/nodes", "read-token", "", http.StatusOK},
+		{http.MethodPost, "/v1/nodes/ID-var/points", "read-token", points, http.StatusForbidden},
+		{http.MethodPost, "/v1/nodes/ID-var/points", "write-token", points, http.StatusOK},
+		{http.MethodPost, "/v1/nodes/" + root.ID + "/points", "write-token", points,
+			http.StatusForbidden},
+		{http.MethodPost, "/v1/nodes/ID-var/points", "write-all-token", points, http.StatusOK},
+		// write tokens can't change users or tokens
+		{http.MethodPost, "/v1/nodes/ID-write-all/points", "write-all-token",
+			`[{"type":"scope","text":"admin"}]`, http.StatusForbidden},
+		{http.MethodPost, "/v1/nodes/" + users[0].ID + "/points", "write-all-token",
+			`[{"type":"pass","text":"hacked"}]`, http.StatusForbidden},
+		{http.MethodPost, "/v1/nodes/ID-var/parents", "write-token",
+			`{"id":"ID-var","oldParent":"` + root.ID + `","newParent":"ID-var"}`,
+			http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		res := do(test.method, test.url, test.token, test.body)
+		if res.Code != test.code {
+			t.Errorf("%v %v %v: expected status %v, got %v: %v", test.method,
+				test.url, test.token, test.code, res.Code, res.Body.String())
+		}
+	}
+
+	// nodes are limited to the token subtree
+	res := do(http.MethodGet, "/v1/nodes", "write-token", "")
+	var nodes []data.NodeEdge
+	err = json.Unmarshal(res.Body.Bytes(), &nodes)
+	if err != nil {
+		t.Fatal("Error decoding nodes: ", err)
+	}
+
+	if len(nodes) != 1 || nodes[0].ID != "ID-var" {
+		t.Fatalf("Wrong nodes for subtree token: %+v", nodes)
+	}
+}
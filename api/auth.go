@@ -11,18 +11,27 @@ import (
 
 // Auth handles user authentication requests.
 type Auth struct {
-	nc *nats.Conn
+	nc   *nats.Conn
+	oidc *OIDC
 }
 
-// NewAuthHandler returns a new authentication handler using the given key.
-func NewAuthHandler(nc *nats.Conn) Auth {
-	return Auth{nc: nc}
+// NewAuthHandler returns a new authentication handler. jwtAuth is used to
+// create tokens for OIDC logins.
+func NewAuthHandler(nc *nats.Conn, jwtAuth Authorizer) Auth {
+	return Auth{nc: nc, oidc: NewOIDCHandler(nc, jwtAuth)}
 }
 
 // ServeHTTP serves requests to authenticate.
 func (auth Auth) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	head, tail := ShiftPath(req.URL.Path)
+	if head == "oidc" {
+		req.URL.Path = tail
+		auth.oidc.ServeHTTP(res, req)
+		return
+	}
+
 	if req.Method != http.MethodPost {
-		http.Error(res, "only POST allowed", http.StatusMethodNotAllowed)
+		writeError(res, http.StatusMethodNotAllowed, "only POST allowed")
 		return
 	}
 
@@ -31,12 +40,12 @@ func (auth Auth) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 
 	nodes, err := client.UserCheck(auth.nc, email, password)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		writeError(res, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	if len(nodes) == 0 {
-		http.Error(res, "invalid login", http.StatusForbidden)
+		writeError(res, http.StatusUnauthorized, "invalid login")
 		return
 	}
 
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// parseHistoryTime parses an RFC3339 time or a duration relative to now
+// (ex: -24h)
+func parseHistoryTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %v", s)
+	}
+
+	return now.Add(d), nil
+}
+
+// historyQuery maps the query parameters of a history request to a
+// data.HistoryQuery for node id:
+//   - start, stop: RFC3339 time or duration relative to now, defaults to the
+//     last 24h
+//   - aggregateWindow: Go duration (ex: 15m)
+//   - type, key: point type and key, can be repeated
+//   - tag.<name>: Influx tag filter (ex: tag.node.description=tank), can be
+//     repeated
+func historyQuery(id string, q url.Values) (data.HistoryQuery, error) {
+	now := time.Now()
+	ret := data.HistoryQuery{
+		Start:      now.Add(-24 * time.Hour),
+		Stop:       now,
+		TagFilters: data.TagFilters{"node.id": id},
+	}
+
+	var err error
+
+	if s := q.Get("start"); s != "" {
+		ret.Start, err = parseHistoryTime(s, now)
+		if err != nil {
+			return ret, err
+		}
+	}
+
+	if s := q.Get("stop"); s != "" {
+		ret.Stop, err = parseHistoryTime(s, now)
+		if err != nil {
+			return ret, err
+		}
+	}
+
+	if !ret.Start.Before(ret.Stop) {
+		return ret, errors.New("start must be before stop")
+	}
+
+	if s := q.Get("aggregateWindow"); s != "" {
+		w, err := time.ParseDuration(s)
+		if err != nil || w < time.Second {
+			return ret, fmt.Errorf("invalid aggregateWindow: %v", s)
+		}
+		ret.AggregateWindow = &w
+	}
+
+	for k, v := range q {
+		switch {
+		case k == "type" || k == "key":
+			ret.TagFilters[k] = v
+		case strings.HasPrefix(k, "tag."):
+			tag := strings.TrimPrefix(k, "tag.")
+			if tag == "node.id" {
+				return ret, errors.New("node.id tag filter is not allowed")
+			}
+			ret.TagFilters[tag] = v
+		}
+	}
+
+	return ret, nil
+}
+
+// historyDb returns the ID of the DB node used for history queries. If id
+// is not set, the first DB node under the root node is used.
+func historyDb(nc *nats.Conn, id string) (string, error) {
+	if id != "" {
+		return id, nil
+	}
+
+	root, err := client.GetRootNode(nc)
+	if err != nil {
+		return "", err
+	}
+
+	dbs, err := client.GetNodes(nc, root.ID, "all", data.NodeTypeDb, false)
+	if err != nil {
+		return "", err
+	}
+
+	if len(dbs) < 1 {
+		return "", errors.New("no db node found")
+	}
+
+	return dbs[0].ID, nil
+}
+
+// userHasNode returns true if the user has access to node id
+func userHasNode(nc *nats.Conn, userID, id string) (bool, error) {
+	nodes, err := client.GetNodesForUser(nc, userID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, n := range nodes {
+		if n.ID == id {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// historyAccess returns true if the caller has access to the node and the
+// DB node of a history request. The node ID in the path is already checked
+// against the subtree of restricted API tokens, so only the DB node is
+// checked here.
+func historyAccess(nc *nats.Conn, req *http.Request, id, dbID, userID string) (bool, error) {
+	// userID is empty for the auth token and if auth is disabled
+	if userID != "" {
+		for _, n := range []string{id, dbID} {
+			if n == "" {
+				continue
+			}
+			ok, err := userHasNode(nc, userID, n)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+
+	if t, ok := apiTokenFromContext(req.Context()); ok && t.NodeID != "" && dbID != "" {
+		subtree, err := client.GetSubtreeIDs(nc, t.NodeID)
+		if err != nil {
+			return false, err
+		}
+		return subtree[dbID], nil
+	}
+
+	return true, nil
+}
+
+func (h *Nodes) history(res http.ResponseWriter, req *http.Request, id, userID string) {
+	if req.Method != http.MethodGet {
+		writeError(res, http.StatusMethodNotAllowed, "only GET allowed")
+		return
+	}
+
+	q := req.URL.Query()
+
+	ok, err := historyAccess(h.nc, req, id, q.Get("db"), userID)
+	if err != nil {
+		writeError(res, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !ok {
+		writeError(res, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	query, err := historyQuery(id, q)
+	if err != nil {
+		writeError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dbID, err := historyDb(h.nc, q.Get("db"))
+	if err != nil {
+		writeError(res, http.StatusNotFound, err.Error())
+		return
+	}
+
+	results, err := client.GetHistory(h.nc, dbID, query)
+	if err != nil {
+		log.Println("History query error:", err)
+		writeError(res, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	if q.Get("format") == "csv" || strings.Contains(req.Header.Get("Accept"), "text/csv") {
+		res.Header().Set("Content-Type", "text/csv")
+		err = writeHistoryCSV(res, results)
+	} else {
+		res.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(res).Encode(results)
+	}
+
+	if err != nil {
+		log.Println("History: error encoding results:", err)
+	}
+}
+
+// writeHistoryCSV writes history results as CSV with one column per node
+// tag
+func writeHistoryCSV(res http.ResponseWriter, results data.HistoryResults) error {
+	tagSet := make(map[string]bool)
+	for _, p := range results.Points {
+		for k := range p.NodeTags {
+			tagSet[k] = true
+		}
+	}
+	for _, p := range results.AggregatedPoints {
+		for k := range p.NodeTags {
+			tagSet[k] = true
+		}
+	}
+
+	tags := make([]string, 0, len(tagSet))
+	for k := range tagSet {
+		tags = append(tags, k)
+	}
+	sort.Strings(tags)
+
+	w := csv.NewWriter(res)
+
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	row := func(t time.Time, typ, key string, nodeTags map[string]string,
+		values ...string) error {
+		r := append([]string{t.Format(time.RFC3339Nano), typ, key}, values...)
+		for _, k := range tags {
+			r = append(r, nodeTags[k])
+		}
+		return w.Write(r)
+	}
+
+	var err error
+	if len(results.AggregatedPoints) > 0 {
+		err = w.Write(append([]string{"time", "type", "key", "mean", "min",
+			"max", "count"}, tags...))
+		for _, p := range results.AggregatedPoints {
+			if err != nil {
+				break
+			}
+			err = row(p.Time, p.Type, p.Key, p.NodeTags, format(p.Mean),
+				format(p.Min), format(p.Max), strconv.FormatInt(p.Count, 10))
+		}
+	} else {
+		err = w.Write(append([]string{"time", "type", "key", "value", "text"},
+			tags...))
+		for _, p := range results.Points {
+			if err != nil {
+				break
+			}
+			err = row(p.Time, p.Type, p.Key, p.NodeTags, format(p.Value), p.Text)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,186 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/api"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestHistory(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "ID-var",
+		Type:   data.NodeTypeVariable,
+		Parent: root.ID,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// fake DB client
+	queries := make(chan data.HistoryQuery, 10)
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sub, err := nc.Subscribe(client.SubjectHistory("ID-db"), func(msg *nats.Msg) {
+		var q data.HistoryQuery
+		_ = json.Unmarshal(msg.Data, &q)
+		queries <- q
+		res, _ := json.Marshal(data.HistoryResults{
+			Points: []data.HistoryPoint{{
+				Time:     ts,
+				NodeTags: map[string]string{"node.id": "ID-var"},
+				Type:     data.PointTypeValue,
+				Key:      "0",
+				Value:    12.5,
+			}},
+		})
+		_ = msg.Respond(res)
+	})
+	if err != nil {
+		t.Fatal("Error subscribing: ", err)
+	}
+	defer sub.Unsubscribe()
+
+	key, _ := api.NewKey([]byte("test key"))
+	h := api.NewNodesHandler(key, "secret", nc)
+
+	get := func(url, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", auth)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	res := get("/ID-var/history?db=ID-db&start=2024-01-01T00:00:00Z&stop=-1h"+
+		"&type=value&tag.node.description=tank", "secret")
+	if res.Code != http.StatusOK {
+		t.Fatal("Wrong status: ", res.Code, res.Body.String())
+	}
+
+	q := <-queries
+	if !q.Start.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) ||
+		time.Since(q.Stop) < 59*time.Minute || q.AggregateWindow != nil {
+		t.Fatalf("Wrong query times: %+v", q)
+	}
+
+	if q.TagFilters["node.id"] != "ID-var" ||
+		q.TagFilters["type"].([]any)[0] != data.PointTypeValue ||
+		q.TagFilters["node.description"].([]any)[0] != "tank" {
+		t.Fatalf("Wrong tag filters: %+v", q.TagFilters)
+	}
+
+	var results data.HistoryResults
+	err = json.Unmarshal(res.Body.Bytes(), &results)
+	if err != nil || len(results.Points) != 1 || results.Points[0].Value != 12.5 {
+		t.Fatalf("Wrong results: %v", res.Body.String())
+	}
+
+	// CSV
+	res = get("/ID-var/history?db=ID-db&aggregateWindow=10m&format=csv", "secret")
+	if res.Code != http.StatusOK {
+		t.Fatal("Wrong status: ", res.Code, res.Body.String())
+	}
+
+	q = <-queries
+	if q.AggregateWindow == nil || *q.AggregateWindow != 10*time.Minute {
+		t.Fatalf("Wrong aggregate window: %+v", q)
+	}
+
+	exp := "time,type,key,value,text,node.id\n" +
+		"2024-01-02T03:04:05Z,value,0,12.5,,ID-var\n"
+	if res.Body.String() != exp {
+		t.Fatalf("Wrong CSV: %q", res.Body.String())
+	}
+
+	// invalid parameters
+	res = get("/ID-var/history?db=ID-db&start=yesterday", "secret")
+	if res.Code != http.StatusBadRequest {
+		t.Fatal("Expected bad request: ", res.Code)
+	}
+
+	// users can only query nodes they have access to
+	token, _ := key.NewToken("ID-unknown-user")
+	res = get("/ID-var/history?db=ID-db", "Bearer "+token)
+	if res.Code != http.StatusForbidden {
+		t.Fatal("Expected forbidden: ", res.Code)
+	}
+
+	// a group with a user and a DB node, and a DB node outside the group.
+	// Variable nodes stand in for the DB nodes so the test server doesn't
+	// start DB clients that answer the queries instead of the fake client.
+	for _, n := range []data.NodeEdge{
+		{ID: "ID-group", Type: data.NodeTypeGroup, Parent: root.ID},
+		{ID: "ID-user", Type: data.NodeTypeUser, Parent: "ID-group"},
+		{ID: "ID-group-var", Type: data.NodeTypeVariable, Parent: "ID-group"},
+		{ID: "ID-db", Type: data.NodeTypeVariable, Parent: "ID-group"},
+		{ID: "ID-other-db", Type: data.NodeTypeVariable, Parent: root.ID},
+	} {
+		err = client.SendNode(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	admins, err := client.GetNodes(nc, root.ID, "all", data.NodeTypeUser, false)
+	if err != nil || len(admins) < 1 {
+		t.Fatal("Error getting admin user: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.APIToken{ID: "ID-token", Parent: admins[0].ID,
+		Token: "group-token", NodeID: "ID-group"}, "test")
+	if err != nil {
+		t.Fatal("Error sending token: ", err)
+	}
+
+	v1 := api.NewV1Handler(api.ServerArgs{JwtAuth: key, AuthToken: "secret", Nc: nc})
+
+	getV1 := func(url, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", auth)
+		res := httptest.NewRecorder()
+		v1.ServeHTTP(res, req)
+		return res
+	}
+
+	// the db parameter is checked against the user nodes and the token
+	// subtree
+	token, _ = key.NewToken("ID-user")
+
+	tests := []struct {
+		name string
+		res  *httptest.ResponseRecorder
+		code int
+	}{
+		{"user", get("/ID-group-var/history?db=ID-db", "Bearer "+token), http.StatusOK},
+		{"user other db", get("/ID-group-var/history?db=ID-other-db", "Bearer "+token),
+			http.StatusForbidden},
+		{"token", getV1("/nodes/ID-group-var/history?db=ID-db", "Bearer group-token"),
+			http.StatusOK},
+		{"token other db", getV1("/nodes/ID-group-var/history?db=ID-other-db",
+			"Bearer group-token"), http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		if test.res.Code != test.code {
+			t.Errorf("%v: expected %v, got %v: %v", test.name, test.code,
+				test.res.Code, test.res.Body.String())
+		}
+		if test.res.Code == http.StatusOK {
+			<-queries
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// Ingest handles Influx line protocol and JSON samples pushed by devices
+// that can't run NATS. Requests are authenticated with the token of an
+// ingest node.
+type Ingest struct {
+	nc *nats.Conn
+}
+
+// NewIngestHandler returns a new ingest handler
+func NewIngestHandler(nc *nats.Conn) http.Handler {
+	return &Ingest{nc: nc}
+}
+
+// ingestToken extracts the token from the request. The following are
+// supported so that Telegraf and Influx client libraries can be used:
+//   - Authorization: Token <token>, Bearer <token>, or <token>
+//   - basic auth password (Influx v1)
+//   - token or p query parameters
+func ingestToken(req *http.Request) string {
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		if _, pass, ok := req.BasicAuth(); ok {
+			return pass
+		}
+
+		for _, prefix := range []string{"Token ", "Bearer "} {
+			if strings.HasPrefix(auth, prefix) {
+				return strings.TrimPrefix(auth, prefix)
+			}
+		}
+
+		return auth
+	}
+
+	q := req.URL.Query()
+	if t := q.Get("token"); t != "" {
+		return t
+	}
+
+	return q.Get("p")
+}
+
+func (h *Ingest) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	// accept /v1/ingest as well as the Influx v1 and v2 write paths
+	switch req.URL.Path {
+	case "/", "", "/write", "/api/v2/write":
+	default:
+		writeError(res, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	if req.Method != http.MethodPost {
+		writeError(res, http.StatusMethodNotAllowed, "only POST allowed")
+		return
+	}
+
+	token := ingestToken(req)
+	if token == "" {
+		writeError(res, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// samples are sent to the ingest client in a single NATS message, and
+	// the JSON encoding of samples is several times larger than line
+	// protocol, so the body is limited to a fraction of the max payload.
+	// The limit applies before and after decompression.
+	limit := h.nc.MaxPayload() / 4
+
+	var reader io.Reader = http.MaxBytesReader(res, req.Body, limit)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		// Telegraf compresses data by default
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			writeBodyError(res, err)
+			return
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		writeBodyError(res, err)
+		return
+	}
+
+	if int64(len(body)) > limit {
+		writeError(res, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
+	var samples []client.IngestSample
+
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if contentType == "application/json" {
+		samples, err = client.ParseIngestJSON(body)
+	} else {
+		samples, err = client.ParseLineProtocol(body, req.URL.Query().Get("precision"))
+	}
+
+	if err != nil {
+		writeError(res, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = client.IngestSamples(h.nc, token, samples)
+	if err != nil {
+		if errors.Is(err, client.ErrIngestUnauthorized) {
+			writeError(res, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		if errors.Is(err, nats.ErrMaxPayload) {
+			writeError(res, http.StatusRequestEntityTooLarge, "too many samples")
+			return
+		}
+		log.Println("Ingest error:", err)
+		writeError(res, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// writeBodyError returns 413 if the request body is over the size limit,
+// otherwise 400
+func writeBodyError(res http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		writeError(res, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+	writeError(res, http.StatusBadRequest, err.Error())
+}
@@ -0,0 +1,162 @@
+package api_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/api"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestIngest(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	ingest := client.Ingest{
+		ID:           "ID-ingest",
+		Parent:       root.ID,
+		Description:  "telegraf",
+		Token:        "secret",
+		NodeTemplate: "{{.Measurement}} {{.Tags.host}}",
+		NodeRules:    map[string]string{"mem*": "memory"},
+	}
+
+	err = client.SendNodeType(nc, ingest, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	h := api.NewIngestHandler(nc)
+
+	post := func(path, token, contentType, body string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		req.Header.Set("Content-Type", contentType)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	// wait for the ingest client to start
+	start := time.Now()
+	for {
+		code := post("/write", "secret", "text/plain", "cpu,host=a usage=12.5")
+		if code == http.StatusNoContent {
+			break
+		}
+		if code != http.StatusUnauthorized || time.Since(start) > 5*time.Second {
+			t.Fatal("Error posting line protocol: ", code)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	code := post("/", "secret", "application/json",
+		`[{"measurement":"cpu","tags":{"host":"a"},"fields":{"load":1.5}},
+		{"measurement":"cpu","tags":{"host":"b"},"fields":{"usage":3}},
+		{"measurement":"mem","tags":{"host":"a"},"fields":{"value":4,"disabled":true}}]`)
+	if code != http.StatusNoContent {
+		t.Fatal("Error posting JSON: ", code)
+	}
+
+	if code := post("/", "wrong", "text/plain", "cpu usage=1"); code != http.StatusUnauthorized {
+		t.Fatal("Expected unauthorized, got: ", code)
+	}
+
+	if code := post("/", "secret", "text/plain", "cpu usage="); code != http.StatusBadRequest {
+		t.Fatal("Expected bad request, got: ", code)
+	}
+
+	// bodies are limited before and after decompression
+	large := strings.Repeat("cpu,host=a usage=12.5\n", 20000)
+	if code := post("/", "secret", "text/plain", large); code != http.StatusRequestEntityTooLarge {
+		t.Fatal("Expected too large, got: ", code)
+	}
+
+	var gzBody bytes.Buffer
+	gz := gzip.NewWriter(&gzBody)
+	_, _ = gz.Write([]byte(large))
+	_ = gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &gzBody)
+	req.Header.Set("Authorization", "Token secret")
+	req.Header.Set("Content-Encoding", "gzip")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusRequestEntityTooLarge {
+		t.Fatal("Expected compressed body too large, got: ", res.Code)
+	}
+
+	var nodes []data.NodeEdge
+
+	start = time.Now()
+	for {
+		nodes, err = client.GetNodes(nc, ingest.ID, "all", "", false)
+		if err != nil {
+			t.Fatal("Error getting nodes: ", err)
+		}
+
+		if len(nodes) == 3 {
+			values := make(map[string]float64)
+			for _, n := range nodes {
+				for _, k := range []string{"load", "usage", "0"} {
+					if v, ok := n.Points.Value(data.PointTypeValue, k); ok {
+						values[n.Desc()+" "+k] = v
+					}
+				}
+			}
+			if values["cpu a load"] == 1.5 && values["cpu b usage"] == 3 &&
+				values["memory 0"] == 4 {
+				break
+			}
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Nodes not created correctly: %+v", nodes)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for _, n := range nodes {
+		if n.Type != data.NodeTypeVariable {
+			t.Error("Wrong node type: ", n.Type)
+		}
+
+		// field names can't set point types
+		if _, ok := n.Points.Find(data.PointTypeDisabled, ""); ok {
+			t.Errorf("Node %v has a disabled point", n.Desc())
+		}
+
+		if n.Desc() == "memory" {
+			disabled, _ := n.Points.Value(data.PointTypeValue, "disabled")
+			if disabled != 1 {
+				t.Error("Wrong disabled field: ", disabled)
+			}
+			continue
+		}
+
+		host, _ := n.Points.Text(data.PointTypeTag, "host")
+		if "cpu "+host != n.Desc() {
+			t.Errorf("Wrong tag for node %v: %v", n.Desc(), host)
+		}
+
+		if n.Desc() == "cpu a" {
+			usage, _ := n.Points.Value(data.PointTypeValue, "usage")
+			if usage != 12.5 {
+				t.Error("Wrong usage: ", usage)
+			}
+		}
+	}
+}
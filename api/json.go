@@ -3,6 +3,9 @@ package api
 import (
 	"encoding/json"
 	"io"
+	"net/http"
+
+	"github.com/simpleiot/simpleiot/data"
 )
 
 func decode(r io.Reader, v interface{}) error {
@@ -12,3 +15,12 @@ func decode(r io.Reader, v interface{}) error {
 func encode(w io.Writer, v interface{}) error {
 	return json.NewEncoder(w).Encode(v)
 }
+
+// writeError writes a JSON encoded data.StandardResponse with the error and
+// HTTP status code
+func writeError(res http.ResponseWriter, code int, msg string) {
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(code)
+	_ = encode(res, data.StandardResponse{Error: msg})
+}
@@ -0,0 +1,474 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Metrics exports node points and internal metrics in the Prometheus text
+// exposition format. Requests authenticated with the auth token get all
+// nodes, users and API tokens the nodes they have access to.
+type Metrics struct {
+	check         RequestValidator
+	nc            *nats.Conn
+	authToken     string
+	pointTypes    map[string]bool
+	tagPointTypes map[string]bool
+
+	lock sync.Mutex
+	tree *metricsTree
+}
+
+// metricsTree caches the node tree, so scrapes don't need a NATS request
+// for every node. Node points are updated from the up.root.> subjects. Edge
+// points (added, moved, or deleted nodes) mark the tree stale, and it is
+// walked again on the next scrape.
+type metricsTree struct {
+	// nodes by ID. Mirrored nodes are only included once.
+	nodes    map[string]*data.NodeEdge
+	children map[string][]string
+	parents  map[string][]string
+	stale    bool
+	// walking is set while the tree is walked. Points received during
+	// the walk are applied to the new tree after the walk.
+	walking bool
+	pending []metricsUpdate
+}
+
+type metricsUpdate struct {
+	id     string
+	points data.Points
+}
+
+// NewMetricsHandler returns a new Prometheus metrics handler. Points with a
+// type in pointTypes are exported as gauges. Points with a type in
+// tagPointTypes are added as labels to all metrics of the node. Points with
+// a type starting with "metric" (internal store and system metrics) are
+// always exported.
+func NewMetricsHandler(v RequestValidator, authToken string, nc *nats.Conn,
+	pointTypes, tagPointTypes []string) http.Handler {
+	h := &Metrics{
+		check:         v,
+		nc:            nc,
+		authToken:     authToken,
+		pointTypes:    make(map[string]bool),
+		tagPointTypes: make(map[string]bool),
+	}
+
+	for _, t := range pointTypes {
+		h.pointTypes[t] = true
+	}
+
+	for _, t := range tagPointTypes {
+		h.tagPointTypes[t] = true
+	}
+
+	return h
+}
+
+// metricSample is one sample of a metric
+type metricSample struct {
+	labels string
+	value  float64
+}
+
+type metricFamily struct {
+	typ     string
+	help    string
+	samples []metricSample
+}
+
+type metricSet map[string]*metricFamily
+
+func (ms metricSet) add(name, typ, help string, labels map[string]string, value float64) {
+	f, ok := ms[name]
+	if !ok {
+		f = &metricFamily{typ: typ, help: help}
+		ms[name] = f
+	}
+
+	f.samples = append(f.samples, metricSample{
+		labels: formatLabels(labels),
+		value:  value,
+	})
+}
+
+func (ms metricSet) write(w *strings.Builder) {
+	names := make([]string, 0, len(ms))
+	for n := range ms {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		f := ms[n]
+		fmt.Fprintf(w, "# HELP %v %v\n", n, f.help)
+		fmt.Fprintf(w, "# TYPE %v %v\n", n, f.typ)
+		for _, s := range f.samples {
+			fmt.Fprintf(w, "%v%v %v\n", n, s.labels,
+				strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+}
+
+func (h *Metrics) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	allNodes := false
+	var userID, tokenNodeID string
+
+	auth := req.Header.Get("Authorization")
+	if h.authToken != "" && (auth == h.authToken || auth == "Bearer "+h.authToken) {
+		allNodes = true
+	} else {
+		// /metrics is not part of the v1 API, so API tokens are checked
+		// here
+		var ok bool
+		req, ok = checkAPIToken(h.nc, h.authToken, res, req,
+			&apiOperation{Scope: data.PointValueRead})
+		if !ok {
+			return
+		}
+
+		var valid bool
+		valid, userID = apiTokenValidator{h.check}.Valid(req)
+		if !valid {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if t, ok := apiTokenFromContext(req.Context()); ok {
+			tokenNodeID = t.NodeID
+		}
+	}
+
+	err := h.update()
+	if err != nil {
+		log.Println("Metrics: error getting nodes:", err)
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	metrics := make(metricSet)
+
+	h.lock.Lock()
+	nodes := h.tree.scope(allNodes, userID, tokenNodeID)
+	for _, n := range nodes {
+		h.addNode(metrics, *n)
+	}
+	h.lock.Unlock()
+
+	metrics.add("siot_nodes", "gauge", "Number of nodes", nil, float64(len(nodes)))
+	h.natsMetrics(metrics)
+
+	var out strings.Builder
+	metrics.write(&out)
+
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = res.Write([]byte(out.String()))
+}
+
+// update subscribes to point updates on the first request, and walks the
+// node tree if it is stale
+func (h *Metrics) update() error {
+	h.lock.Lock()
+	if h.tree == nil {
+		_, err := h.nc.Subscribe("up.root.>", h.handleUp)
+		if err != nil {
+			h.lock.Unlock()
+			return err
+		}
+		h.tree = &metricsTree{stale: true}
+	}
+
+	if !h.tree.stale || h.tree.walking {
+		h.lock.Unlock()
+		return nil
+	}
+
+	h.tree.stale = false
+	h.tree.walking = true
+	h.lock.Unlock()
+
+	nodes, children, parents, err := h.walk()
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	t := h.tree
+	t.walking = false
+
+	if err != nil {
+		t.stale = true
+		t.pending = nil
+		return err
+	}
+
+	t.nodes, t.children, t.parents = nodes, children, parents
+	for _, u := range t.pending {
+		t.points(u.id, u.points)
+	}
+	t.pending = nil
+
+	return nil
+}
+
+// walk gets all nodes in the tree
+func (h *Metrics) walk() (map[string]*data.NodeEdge, map[string][]string,
+	map[string][]string, error) {
+	nodes := make(map[string]*data.NodeEdge)
+	children := make(map[string][]string)
+	parents := make(map[string][]string)
+
+	root, err := client.GetNodes(h.nc, "root", "all", "", false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var walk func(nodes []data.NodeEdge) error
+	walk = func(ne []data.NodeEdge) error {
+		for i, n := range ne {
+			parents[n.ID] = append(parents[n.ID], n.Parent)
+			children[n.Parent] = append(children[n.Parent], n.ID)
+
+			// mirrored nodes show up more than once in the tree
+			if _, ok := nodes[n.ID]; ok {
+				continue
+			}
+			nodes[n.ID] = &ne[i]
+
+			c, err := client.GetNodes(h.nc, n.ID, "all", "", false)
+			if err != nil {
+				return err
+			}
+
+			err = walk(c)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err = walk(root)
+
+	return nodes, children, parents, err
+}
+
+// handleUp updates the cached tree. It is called from a NATS callback, so
+// it must not block.
+func (h *Metrics) handleUp(msg *nats.Msg) {
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) != 3 && len(chunks) != 4 {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	t := h.tree
+	if t == nil {
+		return
+	}
+
+	if len(chunks) == 4 {
+		t.stale = true
+		return
+	}
+
+	points, err := data.PbDecodePoints(msg.Data)
+	if err != nil {
+		log.Println("Metrics: error decoding points:", err)
+		return
+	}
+
+	if t.walking {
+		t.pending = append(t.pending, metricsUpdate{chunks[2], points})
+		return
+	}
+
+	t.points(chunks[2], points)
+}
+
+// points updates the points of a cached node
+func (t *metricsTree) points(id string, points data.Points) {
+	n, ok := t.nodes[id]
+	if !ok {
+		return
+	}
+
+	for _, p := range points {
+		n.Points.Add(p)
+	}
+}
+
+// scope returns the nodes a request has access to. Users have access to
+// the nodes they are a child of, and the nodes below them (see
+// client.GetNodesForUser). API tokens can be restricted to a subtree.
+func (t *metricsTree) scope(allNodes bool, userID, tokenNodeID string) []*data.NodeEdge {
+	ids := make(map[string]bool)
+
+	var add func(id string)
+	add = func(id string) {
+		if ids[id] {
+			return
+		}
+		ids[id] = true
+		for _, c := range t.children[id] {
+			add(c)
+		}
+	}
+
+	if allNodes {
+		for id := range t.nodes {
+			ids[id] = true
+		}
+	} else {
+		for _, p := range t.parents[userID] {
+			add(p)
+		}
+	}
+
+	if tokenNodeID != "" {
+		user := ids
+		ids = make(map[string]bool)
+		add(tokenNodeID)
+		for id := range ids {
+			if !user[id] {
+				delete(ids, id)
+			}
+		}
+	}
+
+	ret := make([]*data.NodeEdge, 0, len(ids))
+	for id := range ids {
+		if n, ok := t.nodes[id]; ok {
+			ret = append(ret, n)
+		}
+	}
+
+	// sort for consistent output
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+
+	return ret
+}
+
+func (h *Metrics) addNode(metrics metricSet, n data.NodeEdge) {
+	labels := map[string]string{
+		"node_id":          n.ID,
+		"node_type":        n.Type,
+		"node_description": n.Desc(),
+	}
+
+	for _, p := range n.Points {
+		if p.Tombstone%2 == 1 || !h.tagPointTypes[p.Type] || p.Text == "" {
+			continue
+		}
+		// tags are usually keyed, but don't add a suffix for the
+		// default key
+		name := "node_" + p.Type
+		if p.Key != "" && p.Key != "0" {
+			name += "_" + p.Key
+		}
+		labels[metricName(name)] = p.Text
+	}
+
+	for _, p := range n.Points {
+		if p.Tombstone%2 == 1 {
+			continue
+		}
+
+		if !h.pointTypes[p.Type] && !strings.HasPrefix(p.Type, "metric") {
+			continue
+		}
+
+		sampleLabels := make(map[string]string, len(labels)+1)
+		for k, v := range labels {
+			sampleLabels[k] = v
+		}
+		sampleLabels["key"] = p.Key
+
+		metrics.add(metricName("siot_"+p.Type), "gauge",
+			fmt.Sprintf("SIOT %v point", p.Type), sampleLabels, p.Value)
+	}
+}
+
+// natsMetrics adds the statistics of the server NATS connection
+func (h *Metrics) natsMetrics(metrics metricSet) {
+	stats := h.nc.Stats()
+
+	metrics.add("siot_nats_in_msgs_total", "counter",
+		"Messages received by the server NATS connection", nil, float64(stats.InMsgs))
+	metrics.add("siot_nats_out_msgs_total", "counter",
+		"Messages sent by the server NATS connection", nil, float64(stats.OutMsgs))
+	metrics.add("siot_nats_in_bytes_total", "counter",
+		"Bytes received by the server NATS connection", nil, float64(stats.InBytes))
+	metrics.add("siot_nats_out_bytes_total", "counter",
+		"Bytes sent by the server NATS connection", nil, float64(stats.OutBytes))
+	metrics.add("siot_nats_reconnects_total", "counter",
+		"Reconnects of the server NATS connection", nil, float64(stats.Reconnects))
+	metrics.add("siot_nats_connected", "gauge",
+		"Server NATS connection state", nil, data.BoolToFloat(h.nc.IsConnected()))
+}
+
+// metricName converts a camel case SIOT name to a valid Prometheus
+// metric or label name, ex: metricNatsCycleNode -> metric_nats_cycle_node
+func metricName(s string) string {
+	var ret strings.Builder
+	r := []rune(s)
+	for i, c := range r {
+		switch {
+		case unicode.IsUpper(c):
+			// start a new word after a lower case letter or digit, or at
+			// the end of an acronym (CPUPercent -> cpu_percent)
+			if i > 0 && (unicode.IsLower(r[i-1]) || unicode.IsDigit(r[i-1]) ||
+				(unicode.IsUpper(r[i-1]) && i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+				ret.WriteRune('_')
+			}
+			ret.WriteRune(unicode.ToLower(c))
+		case c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c)):
+			ret.WriteRune(c)
+		default:
+			ret.WriteRune('_')
+		}
+	}
+	return ret.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for n := range labels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var ret strings.Builder
+	ret.WriteRune('{')
+	for i, n := range names {
+		if i > 0 {
+			ret.WriteRune(',')
+		}
+		fmt.Fprintf(&ret, `%v="%v"`, n, labelEscaper.Replace(labels[n]))
+	}
+	ret.WriteRune('}')
+	return ret.String()
+}
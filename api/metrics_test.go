@@ -0,0 +1,164 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/api"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestMetrics(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "ID-var",
+		Type:   data.NodeTypeVariable,
+		Parent: root.ID,
+		Points: data.Points{
+			{Type: data.PointTypeDescription, Key: "0", Text: `tank "A"`},
+			{Type: data.PointTypeValue, Key: "0", Value: 12.5},
+			{Type: data.PointTypeTag, Key: "site", Text: "north"},
+			{Type: data.PointTypeTag, Key: "0", Text: "pump"},
+			{Type: data.PointTypeMetricSysCPUPercent, Key: "0", Value: 3},
+		},
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// a group with a user that only has access to the group nodes
+	for _, n := range []data.NodeEdge{
+		{ID: "ID-group", Type: data.NodeTypeGroup, Parent: root.ID},
+		{ID: "ID-user", Type: data.NodeTypeUser, Parent: "ID-group"},
+		{ID: "ID-group-var", Type: data.NodeTypeVariable, Parent: "ID-group",
+			Points: data.Points{{Type: data.PointTypeValue, Key: "0", Value: 7}}},
+	} {
+		err = client.SendNode(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	admins, err := client.GetNodes(nc, root.ID, "all", data.NodeTypeUser, false)
+	if err != nil || len(admins) < 1 {
+		t.Fatal("Error getting admin user: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.APIToken{ID: "ID-token", Parent: admins[0].ID,
+		Token: "read-token", NodeID: "ID-group"}, "test")
+	if err != nil {
+		t.Fatal("Error sending token: ", err)
+	}
+
+	key, _ := api.NewKey([]byte("test key"))
+	handlers := make(map[string]http.Handler)
+
+	get := func(authToken, auth string) *httptest.ResponseRecorder {
+		h, ok := handlers[authToken]
+		if !ok {
+			h = api.NewMetricsHandler(key, authToken, nc, []string{data.PointTypeValue},
+				[]string{data.PointTypeTag})
+			handlers[authToken] = h
+		}
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	// requests without credentials are rejected, even if no auth token is
+	// configured
+	if res := get("", ""); res.Code != http.StatusUnauthorized {
+		t.Fatal("Expected unauthorized without auth token: ", res.Code)
+	}
+
+	if res := get("secret", ""); res.Code != http.StatusUnauthorized {
+		t.Fatal("Expected unauthorized: ", res.Code)
+	}
+
+	if res := get("secret", "Bearer wrong"); res.Code != http.StatusUnauthorized {
+		t.Fatal("Expected unauthorized with wrong token: ", res.Code)
+	}
+
+	res := get("secret", "Bearer secret")
+	if res.Code != http.StatusOK {
+		t.Fatal("Wrong status: ", res.Code)
+	}
+
+	body := res.Body.String()
+
+	exp := []string{
+		"# TYPE siot_value gauge\n",
+		`siot_value{key="0",node_description="tank \"A\"",node_id="ID-var",node_tag="pump",node_tag_site="north",node_type="variable"} 12.5` + "\n",
+		`siot_metric_sys_cpu_percent{key="0",`,
+		"# TYPE siot_nats_in_msgs_total counter\n",
+		// root device, admin user, variable, group, group user, group
+		// variable, and API token
+		"siot_nodes 7\n",
+	}
+
+	for _, e := range exp {
+		if !strings.Contains(body, e) {
+			t.Errorf("Metrics output does not contain %q:\n%v", e, body)
+		}
+	}
+
+	// point updates are applied to the cached nodes
+	err = client.SendNodePoint(nc, "ID-var", data.Point{Type: data.PointTypeValue,
+		Key: "0", Value: 13}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	start := time.Now()
+	for !strings.Contains(get("secret", "Bearer secret").Body.String(), `node_type="variable"} 13`) {
+		if time.Since(start) > time.Second {
+			t.Fatal("Point update not in metrics")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// new nodes are added on the next scrape
+	err = client.SendNode(nc, data.NodeEdge{ID: "ID-new", Type: data.NodeTypeVariable,
+		Parent: root.ID}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	start = time.Now()
+	for !strings.Contains(get("secret", "Bearer secret").Body.String(), "siot_nodes 8\n") {
+		if time.Since(start) > time.Second {
+			t.Fatal("New node not in metrics")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// users and API tokens only get the nodes they have access to
+	userToken, _ := key.NewToken("ID-user")
+
+	for _, auth := range []string{"Bearer " + userToken, "Bearer read-token"} {
+		res := get("secret", auth)
+		if res.Code != http.StatusOK {
+			t.Fatalf("%v: wrong status: %v", auth, res.Code)
+		}
+
+		body := res.Body.String()
+		if strings.Contains(body, "ID-var") || !strings.Contains(body, "ID-group-var") {
+			t.Errorf("%v: wrong nodes:\n%v", auth, body)
+		}
+	}
+}
@@ -14,21 +14,21 @@ import (
 
 // NodeMove is a data structure used in the /node/:id/parents api call
 type NodeMove struct {
-	ID        string
-	OldParent string
-	NewParent string
+	ID        string `json:"id"`
+	OldParent string `json:"oldParent"`
+	NewParent string `json:"newParent"`
 }
 
 // NodeCopy is a data structured used in the /node/:id/parents api call
 type NodeCopy struct {
-	ID        string
-	NewParent string
-	Duplicate bool
+	ID        string `json:"id"`
+	NewParent string `json:"newParent"`
+	Duplicate bool   `json:"duplicate"`
 }
 
 // NodeDelete is a data structure used with /node/:id DELETE call
 type NodeDelete struct {
-	Parent string
+	Parent string `json:"parent"`
 }
 
 // Nodes handles node requests
@@ -62,7 +62,7 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		validUser, userID = h.check.Valid(req)
 
 		if !validUser {
-			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			writeError(res, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
 	}
@@ -71,7 +71,7 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		switch req.Method {
 		case http.MethodGet:
 			if !validUser {
-				http.Error(res, "invalid user", http.StatusMethodNotAllowed)
+				writeError(res, http.StatusForbidden, "a user JWT is required")
 				return
 			}
 
@@ -80,15 +80,19 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 				log.Println("Error getting nodes for user:", err)
 			}
 
+			if t, ok := apiTokenFromContext(req.Context()); ok && err == nil && t.NodeID != "" {
+				nodes, err = h.filterSubtree(nodes, t.NodeID)
+			}
+
 			if err != nil {
-				http.Error(res, err.Error(), http.StatusNotFound)
+				writeError(res, http.StatusNotFound, err.Error())
 				return
 			}
 			if len(nodes) > 0 {
 				en := json.NewEncoder(res)
 				err := en.Encode(nodes)
 				if err != nil {
-					http.Error(res, "encoding error", http.StatusMethodNotAllowed)
+					writeError(res, http.StatusInternalServerError, "encoding error")
 				}
 				return
 			}
@@ -97,7 +101,7 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 			// create node
 			h.insertNode(res, req, userID)
 		default:
-			http.Error(res, "invalid method", http.StatusMethodNotAllowed)
+			writeError(res, http.StatusMethodNotAllowed, "invalid method")
 			return
 		}
 		return
@@ -110,7 +114,7 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		case http.MethodGet:
 			body, err := io.ReadAll(req.Body)
 			if err != nil {
-				http.Error(res, err.Error(), http.StatusNotFound)
+				writeError(res, http.StatusNotFound, err.Error())
 				return
 			}
 
@@ -118,37 +122,37 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 
 			node, err := client.GetNodes(h.nc, parent, id, "", false)
 			if err != nil {
-				http.Error(res, err.Error(), http.StatusNotFound)
+				writeError(res, http.StatusNotFound, err.Error())
 			} else {
 				en := json.NewEncoder(res)
 				err := en.Encode(node)
 				if err != nil {
-					http.Error(res, "encoding error", http.StatusMethodNotAllowed)
+					writeError(res, http.StatusInternalServerError, "encoding error")
 					return
 				}
 			}
 		case http.MethodDelete:
 			var nodeDelete NodeDelete
 			if err := decode(req.Body, &nodeDelete); err != nil {
-				http.Error(res, err.Error(), http.StatusBadRequest)
+				writeError(res, http.StatusBadRequest, err.Error())
 				return
 			}
 
 			err := client.DeleteNode(h.nc, id, nodeDelete.Parent, userID)
 
 			if err != nil {
-				http.Error(res, err.Error(), http.StatusNotFound)
+				writeError(res, http.StatusNotFound, err.Error())
 				return
 			}
 
 			en := json.NewEncoder(res)
 			err = en.Encode(data.StandardResponse{Success: true, ID: id})
 			if err != nil {
-				http.Error(res, "encoding error", http.StatusMethodNotAllowed)
+				writeError(res, http.StatusInternalServerError, "encoding error")
 
 			}
 		default:
-			http.Error(res, "invalid method", http.StatusMethodNotAllowed)
+			writeError(res, http.StatusMethodNotAllowed, "invalid method")
 			return
 		}
 
@@ -158,15 +162,18 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		http.Error(res, "only POST allowed", http.StatusMethodNotAllowed)
+		writeError(res, http.StatusMethodNotAllowed, "only POST allowed")
 		return
 
+	case "history":
+		h.history(res, req, id, userID)
+
 	case "parents":
 		switch req.Method {
 		case http.MethodPost:
 			var nodeMove NodeMove
 			if err := decode(req.Body, &nodeMove); err != nil {
-				http.Error(res, err.Error(), http.StatusBadRequest)
+				writeError(res, http.StatusBadRequest, err.Error())
 				return
 			}
 
@@ -175,20 +182,20 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 
 			if err != nil {
 				log.Println("Error moving node:", err)
-				http.Error(res, err.Error(), http.StatusNotFound)
+				writeError(res, http.StatusNotFound, err.Error())
 				return
 			}
 
 			en := json.NewEncoder(res)
 			err = en.Encode(data.StandardResponse{Success: true, ID: id})
 			if err != nil {
-				http.Error(res, "encoding error", http.StatusMethodNotAllowed)
+				writeError(res, http.StatusInternalServerError, "encoding error")
 			}
 
 		case http.MethodPut:
 			var nodeCopy NodeCopy
 			if err := decode(req.Body, &nodeCopy); err != nil {
-				http.Error(res, err.Error(), http.StatusBadRequest)
+				writeError(res, http.StatusBadRequest, err.Error())
 				return
 			}
 
@@ -197,7 +204,7 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 
 				if err != nil {
 					log.Println("Error mirroring node:", err)
-					http.Error(res, err.Error(), http.StatusNotFound)
+					writeError(res, http.StatusNotFound, err.Error())
 					return
 				}
 			} else {
@@ -205,7 +212,7 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 
 				if err != nil {
 					log.Println("Error duplicating node:", err)
-					http.Error(res, err.Error(), http.StatusNotFound)
+					writeError(res, http.StatusNotFound, err.Error())
 					return
 				}
 			}
@@ -213,13 +220,13 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 			en := json.NewEncoder(res)
 			err := en.Encode(data.StandardResponse{Success: true, ID: id})
 			if err != nil {
-				http.Error(res, "encoding error", http.StatusMethodNotAllowed)
+				writeError(res, http.StatusInternalServerError, "encoding error")
 			}
 
 			return
 
 		default:
-			http.Error(res, "invalid method", http.StatusMethodNotAllowed)
+			writeError(res, http.StatusMethodNotAllowed, "invalid method")
 		}
 
 	case "not":
@@ -227,7 +234,7 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		case http.MethodPost:
 			var not data.Notification
 			if err := decode(req.Body, &not); err != nil {
-				http.Error(res, err.Error(), http.StatusBadRequest)
+				writeError(res, http.StatusBadRequest, err.Error())
 				return
 			}
 
@@ -236,28 +243,45 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 			d, err := not.ToPb()
 
 			if err != nil {
-				http.Error(res, err.Error(), http.StatusBadRequest)
+				writeError(res, http.StatusBadRequest, err.Error())
 				return
 			}
 
 			err = h.nc.Publish("node."+id+".not", d)
 
 			if err != nil {
-				http.Error(res, err.Error(), http.StatusBadRequest)
+				writeError(res, http.StatusBadRequest, err.Error())
 				return
 			}
 
 			en := json.NewEncoder(res)
 			err = en.Encode(data.StandardResponse{Success: true, ID: id})
 			if err != nil {
-				http.Error(res, "encoding error", http.StatusMethodNotAllowed)
+				writeError(res, http.StatusInternalServerError, "encoding error")
 			}
 		default:
-			http.Error(res, "invalid method", http.StatusMethodNotAllowed)
+			writeError(res, http.StatusMethodNotAllowed, "invalid method")
 		}
 	}
 }
 
+// filterSubtree returns the nodes that are in the subtree of id
+func (h *Nodes) filterSubtree(nodes []data.NodeEdge, id string) ([]data.NodeEdge, error) {
+	subtree, err := client.GetSubtreeIDs(h.nc, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []data.NodeEdge
+	for _, n := range nodes {
+		if subtree[n.ID] {
+			ret = append(ret, n)
+		}
+	}
+
+	return ret, nil
+}
+
 // RequestValidator validates an HTTP request.
 type RequestValidator interface {
 	Valid(req *http.Request) (bool, string)
@@ -266,7 +290,7 @@ type RequestValidator interface {
 func (h *Nodes) insertNode(res http.ResponseWriter, req *http.Request, userID string) {
 	var node data.NodeEdge
 	if err := decode(req.Body, &node); err != nil {
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		writeError(res, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -282,13 +306,13 @@ func (h *Nodes) insertNode(res http.ResponseWriter, req *http.Request, userID st
 	err := client.SendNode(h.nc, node, userID)
 
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusNotFound)
+		writeError(res, http.StatusNotFound, err.Error())
 		return
 	}
 
 	err = encode(res, data.StandardResponse{Success: true, ID: node.ID})
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusNotFound)
+		writeError(res, http.StatusNotFound, err.Error())
 		return
 	}
 }
@@ -298,7 +322,7 @@ func (h *Nodes) processPoints(res http.ResponseWriter, req *http.Request, id, us
 	var points data.Points
 	err := decoder.Decode(&points)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		writeError(res, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -311,14 +335,14 @@ func (h *Nodes) processPoints(res http.ResponseWriter, req *http.Request, id, us
 	err = client.SendNodePoints(h.nc, id, points, true)
 
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		writeError(res, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	en := json.NewEncoder(res)
 	err = en.Encode(data.StandardResponse{Success: true, ID: id})
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		writeError(res, http.StatusInternalServerError, err.Error())
 		return
 	}
 }
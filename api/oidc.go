@@ -0,0 +1,601 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// oidcLoginTimeout is how long a user has to log in with the provider
+const oidcLoginTimeout = 10 * time.Minute
+
+// oidcMaxLogins limits the logins in progress. Login requests are not
+// authenticated, so this bounds the memory they can use.
+const oidcMaxLogins = 1000
+
+// oidcConfigCacheTime is how long provider configurations are cached
+const oidcConfigCacheTime = time.Hour
+
+// OIDCProvider describes an OIDC provider on the sign in page
+type OIDCProvider struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+}
+
+// OIDC handles OpenID Connect authorization code logins. Users are
+// redirected to the provider by /v1/auth/oidc/<id>/login, and the provider
+// redirects back to /v1/auth/oidc/<id>/callback. The ID token email is
+// mapped to a user node, and the user is redirected to the sign in page
+// with a SIOT JWT in the URL fragment.
+type OIDC struct {
+	nc     *nats.Conn
+	auth   Authorizer
+	client *http.Client
+
+	lock sync.Mutex
+	// logins in progress, indexed by state
+	logins map[string]oidcLogin
+	// provider configurations, indexed by issuer
+	configs map[string]oidcCachedConfig
+}
+
+type oidcLogin struct {
+	provider    string
+	nonce       string
+	verifier    string
+	redirectURI string
+	expires     time.Time
+}
+
+// oidcConfig is the subset of the provider configuration that is used
+type oidcConfig struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+type oidcCachedConfig struct {
+	config  oidcConfig
+	expires time.Time
+}
+
+type oidcKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewOIDCHandler returns a new OIDC login handler. auth is used to create
+// the JWT for users that log in.
+func NewOIDCHandler(nc *nats.Conn, auth Authorizer) *OIDC {
+	return &OIDC{
+		nc:      nc,
+		auth:    auth,
+		client:  &http.Client{Timeout: 20 * time.Second},
+		logins:  make(map[string]oidcLogin),
+		configs: make(map[string]oidcCachedConfig),
+	}
+}
+
+func (o *OIDC) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	id, tail := ShiftPath(req.URL.Path)
+	if id == "" {
+		o.list(res)
+		return
+	}
+
+	p, err := o.provider(id)
+	if err != nil {
+		writeError(res, http.StatusNotFound, err.Error())
+		return
+	}
+
+	action, _ := ShiftPath(tail)
+	switch action {
+	case "login":
+		o.login(res, req, p)
+	case "callback":
+		o.callback(res, req, p)
+	default:
+		writeError(res, http.StatusNotFound, "not found")
+	}
+}
+
+func (o *OIDC) providers() ([]client.OIDC, error) {
+	root, err := client.GetRootNode(o.nc)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.GetNodesType[client.OIDC](o.nc, root.ID, "all")
+}
+
+func (o *OIDC) provider(id string) (client.OIDC, error) {
+	providers, err := o.providers()
+	if err != nil {
+		return client.OIDC{}, err
+	}
+
+	for _, p := range providers {
+		if p.ID == id && p.Enabled() {
+			return p, nil
+		}
+	}
+
+	return client.OIDC{}, errors.New("unknown OIDC provider")
+}
+
+func (o *OIDC) list(res http.ResponseWriter) {
+	providers, err := o.providers()
+	if err != nil {
+		writeError(res, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ret := []OIDCProvider{}
+	for _, p := range providers {
+		if p.Enabled() {
+			ret = append(ret, OIDCProvider{ID: p.ID, Description: p.Description})
+		}
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	err = encode(res, ret)
+	if err != nil {
+		log.Println("Error encoding OIDC providers:", err)
+	}
+}
+
+func (o *OIDC) login(res http.ResponseWriter, req *http.Request, p client.OIDC) {
+	config, err := o.discover(p.Issuer)
+	if err != nil {
+		writeError(res, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	login := oidcLogin{
+		provider:    p.ID,
+		nonce:       oidcRandom(),
+		verifier:    oidcRandom(),
+		redirectURI: p.RedirectURI,
+		expires:     time.Now().Add(oidcLoginTimeout),
+	}
+
+	state := oidcRandom()
+
+	o.lock.Lock()
+	for k, l := range o.logins {
+		if time.Now().After(l.expires) {
+			delete(o.logins, k)
+		}
+	}
+	full := len(o.logins) >= oidcMaxLogins
+	if !full {
+		o.logins[state] = login
+	}
+	o.lock.Unlock()
+
+	if full {
+		writeError(res, http.StatusServiceUnavailable, "too many logins in progress, please try again later")
+		return
+	}
+
+	u, err := url.Parse(config.AuthorizationEndpoint)
+	if err != nil {
+		writeError(res, http.StatusBadGateway, "invalid authorization endpoint")
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(login.verifier))
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", login.redirectURI)
+	q.Set("scope", "openid email profile")
+	q.Set("state", state)
+	q.Set("nonce", login.nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	http.Redirect(res, req, u.String(), http.StatusFound)
+}
+
+func (o *OIDC) callback(res http.ResponseWriter, req *http.Request, p client.OIDC) {
+	q := req.URL.Query()
+
+	// errors are returned to the sign in page
+	fail := func(msg string) {
+		log.Printf("OIDC login with %v failed: %v", p.Description, msg)
+		v := url.Values{"error": {msg}}
+		http.Redirect(res, req, "/sign-in#"+v.Encode(), http.StatusFound)
+	}
+
+	if e := q.Get("error"); e != "" {
+		fail("login failed: " + e)
+		return
+	}
+
+	state := q.Get("state")
+
+	o.lock.Lock()
+	login, ok := o.logins[state]
+	delete(o.logins, state)
+	o.lock.Unlock()
+
+	if !ok || login.provider != p.ID || time.Now().After(login.expires) {
+		fail("invalid or expired login, please try again")
+		return
+	}
+
+	config, err := o.discover(p.Issuer)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	idToken, err := o.exchange(config, p, login, q.Get("code"))
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	claims, err := o.verify(config, p, login, idToken)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	email, _ := claims["email"].(string)
+	email = strings.ToLower(email)
+	if email == "" {
+		fail("ID token does not contain an email")
+		return
+	}
+
+	// the email is used to find the user, so it must be verified by the
+	// provider, otherwise anyone could log in as an existing user
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		fail("email is not verified")
+		return
+	}
+
+	users, err := client.UserFindEmail(o.nc, email)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	var userID string
+
+	if len(users) > 0 {
+		userID = users[0].ID
+	} else if p.Provision {
+		userID, err = o.provision(p, email, claims)
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+	} else {
+		fail("no user for " + email)
+		return
+	}
+
+	token, err := o.auth.NewToken(userID)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	v := url.Values{"token": {token}, "email": {email}}
+	http.Redirect(res, req, "/sign-in#"+v.Encode(), http.StatusFound)
+}
+
+// provision creates a user for an ID token
+func (o *OIDC) provision(p client.OIDC, email string, claims jwt.MapClaims) (string, error) {
+	if p.NodeID == "" {
+		return "", errors.New("OIDC provider does not have a group for new users")
+	}
+
+	user := data.User{Email: email}
+	user.FirstName, _ = claims["given_name"].(string)
+	user.LastName, _ = claims["family_name"].(string)
+	if user.FirstName == "" && user.LastName == "" {
+		user.FirstName, _ = claims["name"].(string)
+	}
+
+	role := p.ProvisionRole
+	if role == "" {
+		role = data.PointValueRoleUser
+	}
+
+	node := data.NodeEdge{
+		ID:     uuid.New().String(),
+		Type:   data.NodeTypeUser,
+		Parent: p.NodeID,
+		EdgePoints: data.Points{
+			{Type: data.PointTypeRole, Text: role},
+		},
+	}
+
+	for _, pt := range user.ToPoints() {
+		if pt.Text != "" {
+			pt.Key = "0"
+			node.Points = append(node.Points, pt)
+		}
+	}
+
+	err := client.SendNode(o.nc, node, "")
+	if err != nil {
+		return "", fmt.Errorf("error creating user: %w", err)
+	}
+
+	log.Printf("OIDC: created user %v in %v", email, p.NodeID)
+
+	return node.ID, nil
+}
+
+func (o *OIDC) get(uri string, v any) error {
+	resp, err := o.client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v returned %v", uri, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discover gets the provider configuration. Configurations are cached for
+// oidcConfigCacheTime.
+func (o *OIDC) discover(issuer string) (oidcConfig, error) {
+	var ret oidcConfig
+
+	issuer = strings.TrimSuffix(issuer, "/")
+	if issuer == "" {
+		return ret, errors.New("OIDC provider issuer is not set")
+	}
+
+	o.lock.Lock()
+	cached, ok := o.configs[issuer]
+	o.lock.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.config, nil
+	}
+
+	err := o.get(issuer+"/.well-known/openid-configuration", &ret)
+	if err != nil {
+		return ret, fmt.Errorf("error getting OIDC configuration: %w", err)
+	}
+
+	if strings.TrimSuffix(ret.Issuer, "/") != issuer {
+		return ret, fmt.Errorf("OIDC configuration issuer %v does not match %v",
+			ret.Issuer, issuer)
+	}
+
+	o.lock.Lock()
+	for k, c := range o.configs {
+		if time.Now().After(c.expires) {
+			delete(o.configs, k)
+		}
+	}
+	o.configs[issuer] = oidcCachedConfig{ret, time.Now().Add(oidcConfigCacheTime)}
+	o.lock.Unlock()
+
+	return ret, nil
+}
+
+// exchange gets the ID token for an authorization code
+func (o *OIDC) exchange(config oidcConfig, p client.OIDC, login oidcLogin, code string) (string, error) {
+	if code == "" {
+		return "", errors.New("no authorization code")
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {login.redirectURI},
+		"code_verifier": {login.verifier},
+	}
+
+	// client_secret_basic is the default, but some providers only support
+	// sending the secret in the form
+	basic := p.ClientSecret != ""
+	if basic && len(config.TokenAuthMethods) > 0 {
+		basic = false
+		for _, m := range config.TokenAuthMethods {
+			if m == "client_secret_basic" {
+				basic = true
+			}
+		}
+	}
+
+	if !basic {
+		form.Set("client_id", p.ClientID)
+		if p.ClientSecret != "" {
+			form.Set("client_secret", p.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, config.TokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&tokens)
+	if err != nil {
+		return "", fmt.Errorf("error decoding token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %v %v %v", resp.Status,
+			tokens.Error, tokens.ErrorDescription)
+	}
+
+	if tokens.IDToken == "" {
+		return "", errors.New("token response does not contain an ID token")
+	}
+
+	return tokens.IDToken, nil
+}
+
+// verify checks the ID token signature and claims
+func (o *OIDC) verify(config oidcConfig, p client.OIDC, login oidcLogin, idToken string) (jwt.MapClaims, error) {
+	var keySet struct {
+		Keys []oidcKey `json:"keys"`
+	}
+
+	err := o.get(config.JWKSURI, &keySet)
+	if err != nil {
+		return nil, fmt.Errorf("error getting OIDC keys: %w", err)
+	}
+
+	parser := jwt.Parser{ValidMethods: []string{
+		"RS256", "RS384", "RS512", "PS256", "PS384", "PS512",
+		"ES256", "ES384", "ES512",
+	}}
+
+	claims := jwt.MapClaims{}
+
+	_, err = parser.ParseWithClaims(idToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		kty := "RSA"
+		if strings.HasPrefix(t.Method.Alg(), "ES") {
+			kty = "EC"
+		}
+
+		for _, k := range keySet.Keys {
+			if k.Kty == kty && (kid == "" || k.Kid == kid) {
+				return k.publicKey()
+			}
+		}
+
+		return nil, errors.New("no key for ID token")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	now := time.Now().Unix()
+
+	switch {
+	case !claims.VerifyExpiresAt(now, true):
+		return nil, errors.New("ID token is expired")
+	case !claims.VerifyIssuer(config.Issuer, true):
+		return nil, errors.New("ID token issuer does not match")
+	case !claims.VerifyAudience(p.ClientID, true):
+		return nil, errors.New("ID token audience does not match")
+	case claims["nonce"] != login.nonce:
+		return nil, errors.New("ID token nonce does not match")
+	}
+
+	return claims, nil
+}
+
+func (k oidcKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %v: %w", k.Kid, err)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %v", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type: %v", k.Kty)
+}
+
+// oidcRandom returns a random string for states, nonces, and PKCE verifiers
+func oidcRandom() string {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,276 @@
+package api_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/simpleiot/simpleiot/api"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+// mockIssuer is a minimal OIDC provider. Tests get an authorization code
+// for a set of claims with code instead of logging in.
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	lock  sync.Mutex
+	codes map[string]jwt.MapClaims
+	// discovery requests
+	configs int
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("Error generating key: ", err)
+	}
+
+	m := &mockIssuer{key: key, codes: make(map[string]jwt.MapClaims)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		m.lock.Lock()
+		m.configs++
+		m.lock.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		enc := base64.RawURLEncoding
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"n":   enc.EncodeToString(key.N.Bytes()),
+				"e":   enc.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		m.lock.Lock()
+		claims, ok := m.codes[r.FormValue("code")]
+		m.lock.Unlock()
+
+		if !ok || id != "siot" || secret != "secret" || r.FormValue("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = "test"
+		signed, _ := tok.SignedString(key)
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+// code returns a code for an ID token. The email_verified claim is only
+// included if verified is set.
+func (m *mockIssuer) code(nonce, email string, verified bool) string {
+	code := "code-" + email
+	claims := jwt.MapClaims{
+		"iss":         m.URL,
+		"aud":         "siot",
+		"sub":         email,
+		"exp":         time.Now().Add(time.Minute).Unix(),
+		"nonce":       nonce,
+		"email":       email,
+		"given_name":  "Jane",
+		"family_name": "Doe",
+	}
+	if verified {
+		claims["email_verified"] = true
+	}
+	m.lock.Lock()
+	m.codes[code] = claims
+	m.lock.Unlock()
+	return code
+}
+
+func TestOIDC(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	issuer := newMockIssuer(t)
+	defer issuer.Close()
+
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "ID-group",
+		Type:   data.NodeTypeGroup,
+		Parent: root.ID,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending group: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.OIDC{
+		ID:           "ID-oidc",
+		Parent:       root.ID,
+		Description:  "mock",
+		Issuer:       issuer.URL,
+		ClientID:     "siot",
+		ClientSecret: "secret",
+		RedirectURI:  "http://example.com/v1/auth/oidc/ID-oidc/callback",
+		Provision:    true,
+		NodeID:       "ID-group",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending oidc node: ", err)
+	}
+
+	// providers without a redirect URI can't be used
+	err = client.SendNodeType(nc, client.OIDC{
+		ID:          "ID-oidc-no-redirect",
+		Parent:      root.ID,
+		Description: "no redirect",
+		Issuer:      issuer.URL,
+		ClientID:    "siot",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending oidc node: ", err)
+	}
+
+	key, _ := api.NewKey([]byte("test key"))
+	h := api.NewV1Handler(api.ServerArgs{JwtAuth: key, AuthToken: "secret", Nc: nc})
+
+	get := func(u string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, u, nil)
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, "/v1")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	res := get("/v1/auth/oidc")
+	var providers []api.OIDCProvider
+	err = json.Unmarshal(res.Body.Bytes(), &providers)
+	if err != nil || len(providers) != 1 || providers[0].ID != "ID-oidc" {
+		t.Fatalf("Wrong providers: %v, %v", res.Body.String(), err)
+	}
+
+	res = get("/v1/auth/oidc/ID-oidc-no-redirect/login")
+	if res.Code != http.StatusNotFound {
+		t.Fatal("Login without redirect URI returned: ", res.Code)
+	}
+
+	// login returns the fragment of the sign in page redirect
+	login := func(email string, nonceOK, verified bool) url.Values {
+		t.Helper()
+		res := get("/v1/auth/oidc/ID-oidc/login")
+		if res.Code != http.StatusFound {
+			t.Fatalf("login returned %v: %v", res.Code, res.Body.String())
+		}
+
+		loc, _ := url.Parse(res.Header().Get("Location"))
+		q := loc.Query()
+		if !strings.HasPrefix(loc.String(), issuer.URL+"/authorize") ||
+			q.Get("redirect_uri") != "http://example.com/v1/auth/oidc/ID-oidc/callback" ||
+			q.Get("code_challenge_method") != "S256" {
+			t.Fatal("Wrong authorize redirect: ", loc)
+		}
+
+		nonce := q.Get("nonce")
+		if !nonceOK {
+			nonce = "bad"
+		}
+
+		res = get("/v1/auth/oidc/ID-oidc/callback?" + url.Values{
+			"state": {q.Get("state")},
+			"code":  {issuer.code(nonce, email, verified)},
+		}.Encode())
+
+		loc, _ = url.Parse(res.Header().Get("Location"))
+		if res.Code != http.StatusFound || loc.Path != "/sign-in" {
+			t.Fatalf("callback returned %v: %v", res.Code, loc)
+		}
+
+		ret, _ := url.ParseQuery(loc.Fragment)
+		return ret
+	}
+
+	// existing users are matched by email
+	v := login("Admin@admin.com", true, true)
+	ok, userID := key.ValidToken(v.Get("token"))
+	if !ok || v.Get("email") != "admin@admin.com" {
+		t.Fatal("Invalid login: ", v)
+	}
+
+	admins, err := client.GetNodes(nc, root.ID, "all", data.NodeTypeUser, false)
+	if err != nil || len(admins) < 1 || admins[0].ID != userID {
+		t.Fatal("Login is not for the admin user: ", userID)
+	}
+
+	// ID tokens must contain the login nonce
+	v = login("admin@admin.com", false, true)
+	if v.Get("token") != "" || v.Get("error") == "" {
+		t.Fatal("Expected nonce error: ", v)
+	}
+
+	// emails that are not verified by the provider are rejected
+	v = login("admin@admin.com", true, false)
+	if v.Get("token") != "" || v.Get("error") == "" {
+		t.Fatal("Expected email verification error: ", v)
+	}
+
+	// the provider configuration is cached
+	issuer.lock.Lock()
+	configs := issuer.configs
+	issuer.lock.Unlock()
+	if configs != 1 {
+		t.Fatal("Provider configuration fetched more than once: ", configs)
+	}
+
+	// new users are provisioned into the group
+	v = login("jane@example.com", true, true)
+	ok, userID = key.ValidToken(v.Get("token"))
+	if !ok {
+		t.Fatal("Invalid login for new user: ", v)
+	}
+
+	users, err := client.GetNodes(nc, "ID-group", userID, data.NodeTypeUser, false)
+	if err != nil || len(users) != 1 {
+		t.Fatal("User not provisioned: ", err)
+	}
+
+	node := users[0].ToNode()
+	user := node.ToUser()
+	if user.Email != "jane@example.com" || user.FirstName != "Jane" || user.Pass != "" {
+		t.Fatalf("Wrong user: %+v", user)
+	}
+
+	if role, _ := users[0].EdgePoints.Find(data.PointTypeRole, ""); role.Text != data.PointValueRoleUser {
+		t.Fatal("Wrong role: ", role.Text)
+	}
+
+	// provisioned users can't log in with a blank password
+	nodes, err := client.UserCheck(nc, "jane@example.com", "")
+	if err != nil || len(nodes) != 0 {
+		t.Fatal("User without password was able to log in")
+	}
+}
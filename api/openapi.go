@@ -0,0 +1,630 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// schema is the subset of JSON schema that is used to describe the v1 API
+// in the OpenAPI document and to validate requests
+type schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *schema            `json:"items,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	// AdditionalProperties describes the values of maps
+	AdditionalProperties *schema `json:"additionalProperties,omitempty"`
+}
+
+func ref(name string) *schema {
+	return &schema{Ref: "#/components/schemas/" + name}
+}
+
+func arrayOf(s *schema) *schema {
+	return &schema{Type: "array", Items: s}
+}
+
+var (
+	stringSchema   = &schema{Type: "string"}
+	numberSchema   = &schema{Type: "number"}
+	integerSchema  = &schema{Type: "integer"}
+	booleanSchema  = &schema{Type: "boolean"}
+	dateTimeSchema = &schema{Type: "string", Format: "date-time"}
+)
+
+// apiSchemas are the components of the OpenAPI document. They mirror the
+// JSON encoding of the Go types in the data and api packages.
+var apiSchemas = map[string]*schema{
+	"Point": {
+		Type:        "object",
+		Description: "data.Point",
+		Required:    []string{"type"},
+		Properties: map[string]*schema{
+			"type":      stringSchema,
+			"key":       stringSchema,
+			"time":      dateTimeSchema,
+			"value":     numberSchema,
+			"text":      stringSchema,
+			"data":      {Type: "string", Format: "byte"},
+			"tombstone": integerSchema,
+			"origin":    stringSchema,
+		},
+	},
+	"NodeEdge": {
+		Type:        "object",
+		Description: "data.NodeEdge",
+		Required:    []string{"type"},
+		Properties: map[string]*schema{
+			"id":         stringSchema,
+			"type":       stringSchema,
+			"hash":       integerSchema,
+			"parent":     stringSchema,
+			"points":     arrayOf(ref("Point")),
+			"edgePoints": arrayOf(ref("Point")),
+		},
+	},
+	"NodeMove": {
+		Type:        "object",
+		Description: "api.NodeMove",
+		Required:    []string{"oldParent", "newParent"},
+		Properties: map[string]*schema{
+			"id":        stringSchema,
+			"oldParent": stringSchema,
+			"newParent": stringSchema,
+		},
+	},
+	"NodeCopy": {
+		Type:        "object",
+		Description: "api.NodeCopy",
+		Required:    []string{"newParent"},
+		Properties: map[string]*schema{
+			"id":        stringSchema,
+			"newParent": stringSchema,
+			"duplicate": booleanSchema,
+		},
+	},
+	"NodeDelete": {
+		Type:        "object",
+		Description: "api.NodeDelete",
+		Required:    []string{"parent"},
+		Properties: map[string]*schema{
+			"parent": stringSchema,
+		},
+	},
+	"Notification": {
+		Type:        "object",
+		Description: "data.Notification",
+		Properties: map[string]*schema{
+			"id":         stringSchema,
+			"parent":     stringSchema,
+			"sourceNode": stringSchema,
+			"subject":    stringSchema,
+			"message":    stringSchema,
+		},
+	},
+	"StandardResponse": {
+		Type:        "object",
+		Description: "data.StandardResponse, also returned for all errors",
+		Properties: map[string]*schema{
+			"success": booleanSchema,
+			"error":   stringSchema,
+			"id":      stringSchema,
+		},
+	},
+	"AuthRequest": {
+		Type:     "object",
+		Required: []string{"email", "password"},
+		Properties: map[string]*schema{
+			"email":    stringSchema,
+			"password": {Type: "string", Format: "password"},
+		},
+	},
+	"Auth": {
+		Type:        "object",
+		Description: "data.Auth",
+		Properties: map[string]*schema{
+			"token": stringSchema,
+			"email": stringSchema,
+		},
+	},
+	"OIDCProviders": {
+		Type: "array",
+		Items: &schema{
+			Type:        "object",
+			Description: "api.OIDCProvider",
+			Properties: map[string]*schema{
+				"id":          stringSchema,
+				"description": stringSchema,
+			},
+		},
+	},
+	"HistoryResults": {
+		Type:        "object",
+		Description: "data.HistoryResults",
+		Properties: map[string]*schema{
+			"error":            stringSchema,
+			"points":           arrayOf(ref("HistoryPoint")),
+			"aggregatedPoints": arrayOf(ref("HistoryAggregatedPoint")),
+		},
+	},
+	"HistoryPoint": {
+		Type: "object",
+		Properties: map[string]*schema{
+			"time":     dateTimeSchema,
+			"nodeTags": {Type: "object", AdditionalProperties: stringSchema},
+			"type":     stringSchema,
+			"key":      stringSchema,
+			"value":    numberSchema,
+			"text":     stringSchema,
+		},
+	},
+	"HistoryAggregatedPoint": {
+		Type: "object",
+		Properties: map[string]*schema{
+			"time":     dateTimeSchema,
+			"nodeTags": {Type: "object", AdditionalProperties: stringSchema},
+			"type":     stringSchema,
+			"key":      stringSchema,
+			"mean":     numberSchema,
+			"min":      numberSchema,
+			"max":      numberSchema,
+			"count":    integerSchema,
+		},
+	},
+}
+
+// apiParam is a query parameter
+type apiParam struct {
+	Name        string
+	Description string
+	Schema      *schema
+}
+
+// apiOperation describes one method of a v1 API path. Path is relative to
+// /v1 and path parameters are written as {name}.
+type apiOperation struct {
+	Method  string
+	Path    string
+	Summary string
+	Tag     string
+	// Public operations don't require a JWT or the auth token
+	Public bool
+	// Scope is the API token scope required for the operation
+	Scope  string
+	Params []apiParam
+	// Body is the request schema name. Only JSON bodies are validated.
+	Body            string
+	BodyContentType string
+	// Response is the response schema name
+	Response            string
+	ResponseContentType string
+	// Status is the success status code, defaults to 200
+	Status int
+}
+
+var historyParams = []apiParam{
+	{"start", "RFC3339 time or duration relative to now (ex: -24h), defaults to -24h", stringSchema},
+	{"stop", "RFC3339 time or duration relative to now, defaults to now", stringSchema},
+	{"aggregateWindow", "aggregate window duration (ex: 15m)", stringSchema},
+	{"type", "point type, can be repeated", stringSchema},
+	{"key", "point key, can be repeated", stringSchema},
+	{"db", "DB node ID, defaults to the first DB node under the root node", stringSchema},
+	{"format", "response format", &schema{Type: "string", Enum: []string{"json", "csv"}}},
+}
+
+var ingestParams = []apiParam{
+	{"precision", "line protocol timestamp precision",
+		&schema{Type: "string", Enum: []string{"ns", "n", "us", "u", "ms", "s"}}},
+	{"token", "ingest node token", stringSchema},
+}
+
+var oidcCallbackParams = []apiParam{
+	{"code", "authorization code", stringSchema},
+	{"state", "login state", stringSchema},
+	{"error", "provider error", stringSchema},
+}
+
+// apiOperations describes all v1 API endpoints
+var apiOperations = []apiOperation{
+	{Method: http.MethodGet, Path: "/nodes", Tag: "nodes", Scope: data.PointValueRead,
+		Summary:  "get all nodes the user has access to",
+		Response: "NodeEdges"},
+	{Method: http.MethodPost, Path: "/nodes", Tag: "nodes", Scope: data.PointValueAdmin,
+		Summary: "insert a node", Body: "NodeEdge", Response: "StandardResponse"},
+	{Method: http.MethodGet, Path: "/nodes/{id}", Tag: "nodes", Scope: data.PointValueRead,
+		Summary: "get a node. The request body can optionally contain the " +
+			"parent ID to include edge points.",
+		Response: "NodeEdges"},
+	{Method: http.MethodDelete, Path: "/nodes/{id}", Tag: "nodes", Scope: data.PointValueAdmin,
+		Summary: "delete a node", Body: "NodeDelete", Response: "StandardResponse"},
+	{Method: http.MethodPost, Path: "/nodes/{id}/points", Tag: "points", Scope: data.PointValueWrite,
+		Summary: "send points to a node", Body: "Points", Response: "StandardResponse"},
+	{Method: http.MethodPost, Path: "/nodes/{id}/samples", Tag: "points", Scope: data.PointValueWrite,
+		Summary: "alias for /nodes/{id}/points", Body: "Points",
+		Response: "StandardResponse"},
+	{Method: http.MethodGet, Path: "/nodes/{id}/history", Tag: "points", Scope: data.PointValueRead,
+		Summary: "query point history from a DB client", Params: historyParams,
+		Response: "HistoryResults"},
+	{Method: http.MethodPost, Path: "/nodes/{id}/parents", Tag: "nodes", Scope: data.PointValueAdmin,
+		Summary: "move a node to a new parent", Body: "NodeMove",
+		Response: "StandardResponse"},
+	{Method: http.MethodPut, Path: "/nodes/{id}/parents", Tag: "nodes", Scope: data.PointValueAdmin,
+		Summary: "mirror or duplicate a node", Body: "NodeCopy",
+		Response: "StandardResponse"},
+	{Method: http.MethodPost, Path: "/nodes/{id}/not", Tag: "nodes", Scope: data.PointValueAdmin,
+		Summary: "send a notification to node users", Body: "Notification",
+		Response: "StandardResponse"},
+	{Method: http.MethodPost, Path: "/auth", Tag: "auth", Public: true,
+		Summary: "log in and get a JWT", Body: "AuthRequest",
+		BodyContentType: "application/x-www-form-urlencoded", Response: "Auth"},
+	{Method: http.MethodGet, Path: "/auth/oidc", Tag: "auth", Public: true,
+		Summary: "list OIDC providers", Response: "OIDCProviders"},
+	{Method: http.MethodGet, Path: "/auth/oidc/{id}/login", Tag: "auth", Public: true,
+		Summary: "redirect to the OIDC provider to log in",
+		Status:  http.StatusFound},
+	{Method: http.MethodGet, Path: "/auth/oidc/{id}/callback", Tag: "auth", Public: true,
+		Summary: "OIDC provider redirect. Redirects to the sign in page with " +
+			"a JWT or error in the URL fragment.",
+		Params: oidcCallbackParams, Status: http.StatusFound},
+	{Method: http.MethodPost, Path: "/ingest", Tag: "ingest", Public: true,
+		Summary: "write Influx line protocol or JSON samples, authenticated " +
+			"with an ingest node token",
+		Params: ingestParams, BodyContentType: "text/plain", Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/ingest/write", Tag: "ingest", Public: true,
+		Summary: "Influx v1 compatible alias for /ingest", Params: ingestParams,
+		BodyContentType: "text/plain", Status: http.StatusNoContent},
+	{Method: http.MethodPost, Path: "/ingest/api/v2/write", Tag: "ingest", Public: true,
+		Summary: "Influx v2 compatible alias for /ingest", Params: ingestParams,
+		BodyContentType: "text/plain", Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/stream", Tag: "stream", Scope: data.PointValueRead,
+		Summary: "WebSocket that streams points of node subtrees",
+		Params:  []apiParam{{"token", "JWT, for clients that can't set headers", stringSchema}},
+		Status:  http.StatusSwitchingProtocols},
+	{Method: http.MethodGet, Path: "/openapi.json", Tag: "meta", Public: true,
+		Summary: "this document", ResponseContentType: "application/json"},
+}
+
+func init() {
+	apiSchemas["Points"] = arrayOf(ref("Point"))
+	apiSchemas["NodeEdges"] = arrayOf(ref("NodeEdge"))
+}
+
+// OpenAPI returns the OpenAPI 3 document for the v1 API
+func OpenAPI() map[string]any {
+	paths := make(map[string]map[string]any)
+
+	for _, op := range apiOperations {
+		o := map[string]any{
+			"summary":     op.Summary,
+			"tags":        []string{op.Tag},
+			"operationId": operationID(op),
+		}
+
+		var params []map[string]any
+		for _, seg := range strings.Split(op.Path, "/") {
+			if strings.HasPrefix(seg, "{") {
+				params = append(params, map[string]any{
+					"name": strings.Trim(seg, "{}"), "in": "path",
+					"required": true, "schema": stringSchema,
+				})
+			}
+		}
+		for _, p := range op.Params {
+			params = append(params, map[string]any{
+				"name": p.Name, "in": "query", "description": p.Description,
+				"schema": p.Schema,
+			})
+		}
+		if len(params) > 0 {
+			o["parameters"] = params
+		}
+
+		if op.Body != "" || op.BodyContentType != "" {
+			contentType := op.BodyContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			content := map[string]any{}
+			if op.Body != "" {
+				content["schema"] = ref(op.Body)
+			}
+			o["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{contentType: content},
+			}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]any{"description": http.StatusText(status)}
+		if op.Response != "" {
+			success["content"] = map[string]any{
+				"application/json": map[string]any{"schema": ref(op.Response)},
+			}
+		} else if op.ResponseContentType != "" {
+			success["content"] = map[string]any{op.ResponseContentType: map[string]any{}}
+		}
+		o["responses"] = map[string]any{
+			strconv.Itoa(status): success,
+			"default": map[string]any{
+				"description": "error",
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": ref("StandardResponse")},
+				},
+			},
+		}
+
+		if op.Public {
+			o["security"] = []any{}
+		}
+
+		if op.Scope != "" {
+			// API token scope required for the operation
+			o["x-token-scope"] = op.Scope
+		}
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = make(map[string]any)
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = o
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Simple IoT API",
+			"version": "1",
+		},
+		"servers": []map[string]any{{"url": "/v1"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": apiSchemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type": "http", "scheme": "bearer", "bearerFormat": "JWT",
+				},
+			},
+		},
+		"security": []map[string]any{{"bearerAuth": []string{}}},
+	}
+}
+
+// operationID generates an ID from the method and path, ex:
+// POST /nodes/{id}/points -> postNodesIdPoints
+func operationID(op apiOperation) string {
+	var ret strings.Builder
+	ret.WriteString(strings.ToLower(op.Method))
+	for _, seg := range strings.FieldsFunc(op.Path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '.'
+	}) {
+		ret.WriteString(strings.ToUpper(seg[:1]) + seg[1:])
+	}
+	return ret.String()
+}
+
+// NewOpenAPIHandler returns a handler that serves the OpenAPI document
+func NewOpenAPIHandler() http.Handler {
+	doc, err := json.MarshalIndent(OpenAPI(), "", "  ")
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if err != nil {
+			writeError(res, http.StatusInternalServerError, err.Error())
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		_, _ = res.Write(doc)
+	})
+}
+
+// matchPath returns true if p matches the operation path pattern
+func matchPath(pattern, p string) bool {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	s := strings.Split(strings.Trim(p, "/"), "/")
+	if len(ps) != len(s) {
+		return false
+	}
+
+	for i := range ps {
+		if strings.HasPrefix(ps[i], "{") {
+			if s[i] == "" {
+				return false
+			}
+		} else if ps[i] != s[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validRequest checks a request against the API operations and writes an
+// error response if it is not valid. JSON bodies are read and replaced so
+// handlers can decode them again. The matching operation is returned.
+func validRequest(res http.ResponseWriter, req *http.Request) (*apiOperation, bool) {
+	p := path.Clean("/" + req.URL.Path)
+
+	var op *apiOperation
+	var allowed []string
+	for i := range apiOperations {
+		if !matchPath(apiOperations[i].Path, p) {
+			continue
+		}
+		allowed = append(allowed, apiOperations[i].Method)
+		if apiOperations[i].Method == req.Method {
+			op = &apiOperations[i]
+		}
+	}
+
+	if len(allowed) == 0 {
+		writeError(res, http.StatusNotFound, "not found")
+		return nil, false
+	}
+
+	if op == nil {
+		res.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(res, http.StatusMethodNotAllowed,
+			fmt.Sprintf("method %v not allowed", req.Method))
+		return nil, false
+	}
+
+	q := req.URL.Query()
+	for _, p := range op.Params {
+		for _, v := range q[p.Name] {
+			if err := validateParam(p.Schema, v); err != nil {
+				writeError(res, http.StatusBadRequest,
+					fmt.Sprintf("parameter %v: %v", p.Name, err))
+				return nil, false
+			}
+		}
+	}
+
+	if op.Body == "" || op.BodyContentType != "" || req.Body == nil {
+		return op, true
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeError(res, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var v any
+	err = json.Unmarshal(body, &v)
+	if err != nil {
+		writeError(res, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return nil, false
+	}
+
+	err = ref(op.Body).validate(v, "body")
+	if err != nil {
+		writeError(res, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	return op, true
+}
+
+func validateParam(s *schema, v string) error {
+	if len(s.Enum) > 0 {
+		for _, e := range s.Enum {
+			if v == e {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of: %v", strings.Join(s.Enum, ", "))
+	}
+	return nil
+}
+
+// validate checks that the decoded JSON value v matches the schema. Like
+// encoding/json, property names are matched case-insensitively and unknown
+// properties are ignored.
+func (s *schema) validate(v any, name string) error {
+	if s.Ref != "" {
+		r, ok := apiSchemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("%v: unknown schema %v", name, s.Ref)
+		}
+		return r.validate(v, name)
+	}
+
+	// Go encodes nil slices and maps as null
+	if v == nil && (s.Type == "array" || s.Type == "object") {
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%v: must be an object", name)
+		}
+
+		for _, r := range s.Required {
+			found := false
+			for k, pv := range obj {
+				if strings.EqualFold(k, r) && pv != nil {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%v.%v: is required", name, r)
+			}
+		}
+
+		for k, pv := range obj {
+			ps := s.AdditionalProperties
+			for pk, p := range s.Properties {
+				if strings.EqualFold(k, pk) {
+					ps = p
+					break
+				}
+			}
+			if ps == nil {
+				continue
+			}
+			if err := ps.validate(pv, name+"."+k); err != nil {
+				return err
+			}
+		}
+
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%v: must be an array", name)
+		}
+		for i, e := range arr {
+			if err := s.Items.validate(e, fmt.Sprintf("%v[%v]", name, i)); err != nil {
+				return err
+			}
+		}
+
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%v: must be a string", name)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%v: must be an RFC3339 time", name)
+			}
+		}
+		if err := validateParam(s, str); err != nil {
+			return fmt.Errorf("%v: %w", name, err)
+		}
+
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%v: must be a number", name)
+		}
+
+	case "integer":
+		f, ok := v.(float64)
+		if !ok || f != float64(int64(f)) {
+			return fmt.Errorf("%v: must be an integer", name)
+		}
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%v: must be a boolean", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/api"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestOpenAPI(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	key, _ := api.NewKey([]byte("test key"))
+	h := api.NewV1Handler(api.ServerArgs{JwtAuth: key, AuthToken: "secret", Nc: nc})
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "secret")
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, "/v1")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	res := do(http.MethodGet, "/v1/openapi.json", "")
+	if res.Code != http.StatusOK {
+		t.Fatal("Wrong status: ", res.Code)
+	}
+
+	var doc struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+
+	err = json.Unmarshal(res.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatal("Error decoding document: ", err)
+	}
+
+	if doc.OpenAPI == "" || doc.Paths["/nodes/{id}/points"]["post"] == nil ||
+		doc.Paths["/auth"]["post"] == nil {
+		t.Fatal("Document missing paths: ", res.Body.String())
+	}
+
+	errorMsg := func(res *httptest.ResponseRecorder) string {
+		var r data.StandardResponse
+		err := json.Unmarshal(res.Body.Bytes(), &r)
+		if err != nil {
+			t.Fatal("Error response is not JSON: ", res.Body.String())
+		}
+		return r.Error
+	}
+
+	tests := []struct {
+		method, url, body string
+		code              int
+		err               string
+	}{
+		{http.MethodGet, "/v1/bogus", "", http.StatusNotFound, "not found"},
+		{http.MethodPut, "/v1/nodes", "", http.StatusMethodNotAllowed, "method PUT not allowed"},
+		{http.MethodPost, "/v1/nodes/" + root.ID + "/points", `{"type":"value"}`,
+			http.StatusBadRequest, "body: must be an array"},
+		{http.MethodPost, "/v1/nodes/" + root.ID + "/points", `[{"value":1}]`,
+			http.StatusBadRequest, "body[0].type: is required"},
+		{http.MethodPost, "/v1/nodes/" + root.ID + "/points", `[{"type":"value","value":"1"}]`,
+			http.StatusBadRequest, "body[0].value: must be a number"},
+		{http.MethodPost, "/v1/nodes/" + root.ID + "/points", `[{"type":"value","time":"now"}]`,
+			http.StatusBadRequest, "body[0].time: must be an RFC3339 time"},
+		{http.MethodPost, "/v1/nodes/" + root.ID + "/parents", `{"id":"x"}`,
+			http.StatusBadRequest, "body.oldParent: is required"},
+		{http.MethodPost, "/v1/nodes", `{"type":`, http.StatusBadRequest, "invalid JSON"},
+		{http.MethodGet, "/v1/nodes/" + root.ID + "/history?format=xml", "",
+			http.StatusBadRequest, "parameter format: must be one of: json, csv"},
+	}
+
+	for _, test := range tests {
+		res := do(test.method, test.url, test.body)
+		if res.Code != test.code {
+			t.Errorf("%v %v: expected status %v, got %v", test.method, test.url,
+				test.code, res.Code)
+		}
+
+		if msg := errorMsg(res); !strings.HasPrefix(msg, test.err) {
+			t.Errorf("%v %v: expected error %q, got %q", test.method, test.url,
+				test.err, msg)
+		}
+	}
+
+	res = do(http.MethodPut, "/v1/nodes", "")
+	if res.Header().Get("Allow") != "GET, POST" {
+		t.Error("Wrong Allow header: ", res.Header().Get("Allow"))
+	}
+
+	// valid request
+	res = do(http.MethodPost, "/v1/nodes/"+root.ID+"/points",
+		`[{"Type":"description","Key":"0","text":"dev","time":"2024-01-02T03:04:05.123Z"}]`)
+	if res.Code != http.StatusOK {
+		t.Fatal("Wrong status: ", res.Code, res.Body.String())
+	}
+}
@@ -15,6 +15,7 @@ import (
 type App struct {
 	PublicHandler  http.Handler
 	V1ApiHandler   http.Handler
+	MetricsHandler http.Handler
 	WebsocketProxy http.Handler
 }
 
@@ -32,6 +33,9 @@ func (h *App) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		req.URL.Path = "/"
 		h.PublicHandler.ServeHTTP(res, req)
 
+	case "/metrics":
+		h.MetricsHandler.ServeHTTP(res, req)
+
 	default:
 		head, path := ShiftPath(req.URL.Path)
 		switch head {
@@ -64,9 +68,13 @@ func NewAppHandler(args ServerArgs) http.Handler {
 		}
 	}
 
+	metrics := NewMetricsHandler(args.JwtAuth, args.AuthToken, args.Nc,
+		args.MetricsPointTypes, args.MetricsTagPointTypes)
+
 	return &App{
 		PublicHandler:  http.FileServer(args.Filesystem),
 		V1ApiHandler:   v1,
+		MetricsHandler: metrics,
 		WebsocketProxy: wsProxy,
 	}
 }
@@ -80,6 +88,10 @@ type ServerArgs struct {
 	AuthToken  string
 	NatsWSPort int
 	Nc         *nats.Conn
+	// MetricsPointTypes are the point types exported by /metrics
+	MetricsPointTypes []string
+	// MetricsTagPointTypes are point types added as labels to /metrics
+	MetricsTagPointTypes []string
 }
 
 // Server represents the HTTP API server
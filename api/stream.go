@@ -0,0 +1,478 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// StreamRequest is sent by a WebSocket stream client. Type is subscribe or
+// unsubscribe. ID is the root of the node subtree. If PointTypes is set,
+// only points of these types are sent.
+type StreamRequest struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	PointTypes []string `json:"pointTypes,omitempty"`
+}
+
+// StreamMsg is sent to WebSocket stream clients. Type is one of:
+//   - nodes: all nodes in a subtree, sent after subscribing
+//   - points: node points
+//   - edgePoints: edge points, Parent is set
+//   - error: Error is set
+//
+// Sub is the ID of the subscription root node.
+type StreamMsg struct {
+	Type   string          `json:"type"`
+	Sub    string          `json:"sub,omitempty"`
+	ID     string          `json:"id,omitempty"`
+	Parent string          `json:"parent,omitempty"`
+	Points data.Points     `json:"points,omitempty"`
+	Nodes  []data.NodeEdge `json:"nodes,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+const (
+	streamPingPeriod = 30 * time.Second
+	streamPongWait   = 60 * time.Second
+	streamWriteWait  = 10 * time.Second
+)
+
+// Stream is a WebSocket handler that streams point and edge point updates
+// for node subtrees.
+type Stream struct {
+	check     RequestValidator
+	nc        *nats.Conn
+	authToken string
+	upgrader  websocket.Upgrader
+}
+
+// NewStreamHandler returns a new WebSocket stream handler. Clients
+// authenticate with a user JWT (Authorization header or token query
+// parameter) and can only subscribe to nodes the user has access to.
+func NewStreamHandler(v RequestValidator, authToken string, nc *nats.Conn) http.Handler {
+	return &Stream{
+		check:     v,
+		nc:        nc,
+		authToken: authToken,
+		upgrader: websocket.Upgrader{
+			// requests are authenticated with a token, so allow
+			// dashboards served from other origins
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+	}
+}
+
+func (h *Stream) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	// browsers can't set headers on WebSocket requests
+	if t := req.URL.Query().Get("token"); t != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+t)
+	}
+
+	// the auth token gives access to all nodes, a user JWT to the nodes
+	// of the user
+	allNodes := false
+	var userID string
+
+	auth := req.Header.Get("Authorization")
+	if h.authToken != "" && (auth == h.authToken || auth == "Bearer "+h.authToken) {
+		allNodes = true
+	} else {
+		var valid bool
+		valid, userID = h.check.Valid(req)
+		if !valid {
+			writeError(res, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+	}
+
+	// API tokens can be restricted to a subtree
+	var tokenNodeID string
+	if t, ok := apiTokenFromContext(req.Context()); ok {
+		tokenNodeID = t.NodeID
+	}
+
+	conn, err := h.upgrader.Upgrade(res, req, nil)
+	if err != nil {
+		log.Println("Stream: error upgrading connection:", err)
+		return
+	}
+
+	s := &streamConn{
+		nc:          h.nc,
+		conn:        conn,
+		allNodes:    allNodes,
+		userID:      userID,
+		subs:        make(map[string]*streamSub),
+		tokenNodeID: tokenNodeID,
+		send:        make(chan StreamMsg, 100),
+		fetch:       make(chan streamFetch, 100),
+		done:        make(chan struct{}),
+	}
+
+	s.run()
+}
+
+// streamSub is a subscription to a node subtree. The store rebroadcasts
+// points on up.<id>.> subjects for every node above the node that changed,
+// so updates for the subtree are received on up.<root>.>. Deleted nodes
+// are not rebroadcast upstream.
+type streamSub struct {
+	natsSub    *nats.Subscription
+	pointTypes map[string]bool
+}
+
+// streamFetch requests the nodes at and below a node that was added to a
+// subscription
+type streamFetch struct {
+	sub    string
+	id     string
+	parent string
+}
+
+type streamConn struct {
+	nc       *nats.Conn
+	conn     *websocket.Conn
+	allNodes bool
+	userID   string
+	// tokenNodeID restricts subscriptions to a subtree
+	tokenNodeID string
+
+	lock sync.Mutex
+	subs map[string]*streamSub
+
+	send chan StreamMsg
+	// nodes are fetched on their own goroutine, as NATS callbacks must not
+	// block
+	fetch chan streamFetch
+	done  chan struct{}
+	// closeSlow closes the connection once if the client does not keep up
+	closeSlow sync.Once
+}
+
+func (s *streamConn) run() {
+	defer s.conn.Close()
+
+	defer func() {
+		s.lock.Lock()
+		for id, sub := range s.subs {
+			_ = sub.natsSub.Unsubscribe()
+			delete(s.subs, id)
+		}
+		s.lock.Unlock()
+	}()
+
+	go s.writer()
+	go s.fetcher()
+	defer close(s.done)
+
+	_ = s.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+
+	for {
+		var req StreamRequest
+		err := s.conn.ReadJSON(&req)
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure,
+				websocket.CloseGoingAway) && !strings.Contains(err.Error(), "timeout") {
+				log.Println("Stream: read error:", err)
+			}
+			return
+		}
+
+		switch req.Type {
+		case "subscribe":
+			err = s.subscribe(req)
+		case "unsubscribe":
+			s.unsubscribe(req.ID)
+		default:
+			err = fmt.Errorf("invalid request type: %v", req.Type)
+		}
+
+		if err != nil {
+			s.write(StreamMsg{Type: "error", Sub: req.ID, Error: err.Error()})
+		}
+	}
+}
+
+// writer serializes all writes to the WebSocket connection
+func (s *streamConn) writer() {
+	ticker := time.NewTicker(streamPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-s.send:
+			_ = s.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			err := s.conn.WriteJSON(msg)
+			if err != nil {
+				s.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			_ = s.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			err := s.conn.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				s.conn.Close()
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// fetcher sends the nodes that are added to subscriptions
+func (s *streamConn) fetcher() {
+	for {
+		select {
+		case f := <-s.fetch:
+			// node points of new nodes are sent before the edge
+			// points, so send the complete node and any nodes below
+			// it (if it was undeleted)
+			nodes, err := client.GetNodes(s.nc, f.parent, f.id, "", false)
+			if err != nil {
+				log.Println("Stream: error getting new node:", err)
+				continue
+			}
+
+			children, err := s.descendants(f.id)
+			if err != nil {
+				log.Println("Stream: error getting new node children:", err)
+				continue
+			}
+
+			s.lock.Lock()
+			_, ok := s.subs[f.sub]
+			s.lock.Unlock()
+
+			if ok {
+				s.write(StreamMsg{Type: "nodes", Sub: f.sub, ID: f.id,
+					Nodes: append(nodes, children...)})
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// slow closes the connection if the client does not keep up
+func (s *streamConn) slow(reason string) {
+	s.closeSlow.Do(func() {
+		log.Printf("Stream: %v, closing connection", reason)
+		_ = s.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, reason),
+			time.Now().Add(streamWriteWait))
+		s.conn.Close()
+	})
+}
+
+// write queues a message for the writer. This is called from NATS
+// callbacks, so it must not block. If the client does not keep up and the
+// send buffer is full, the connection is closed.
+func (s *streamConn) write(msg StreamMsg) {
+	select {
+	case s.send <- msg:
+	case <-s.done:
+	default:
+		s.slow("send buffer full")
+	}
+}
+
+// descendants returns all nodes below a node
+func (s *streamConn) descendants(id string) ([]data.NodeEdge, error) {
+	var ret []data.NodeEdge
+	found := map[string]bool{id: true}
+
+	var walk func(id string) error
+	walk = func(id string) error {
+		children, err := client.GetNodes(s.nc, id, "all", "", false)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range children {
+			if found[c.ID] {
+				continue
+			}
+			found[c.ID] = true
+			ret = append(ret, c)
+			err := walk(c.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := walk(id)
+	return ret, err
+}
+
+func (s *streamConn) subscribe(req StreamRequest) error {
+	if req.ID == "" {
+		return errors.New("id is required")
+	}
+
+	if s.tokenNodeID != "" {
+		subtree, err := client.GetSubtreeIDs(s.nc, s.tokenNodeID)
+		if err != nil {
+			return err
+		}
+
+		if !subtree[req.ID] {
+			return errors.New("not authorized")
+		}
+	}
+
+	if !s.allNodes {
+		userNodes, err := client.GetNodesForUser(s.nc, s.userID)
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, n := range userNodes {
+			if n.ID == req.ID {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return errors.New("not authorized")
+		}
+	}
+
+	nodes, err := client.GetNodes(s.nc, "all", req.ID, "", false)
+	if err != nil {
+		return err
+	}
+
+	if len(nodes) < 1 {
+		return data.ErrDocumentNotFound
+	}
+
+	children, err := s.descendants(req.ID)
+	if err != nil {
+		return err
+	}
+
+	nodes = append(nodes, children...)
+
+	sub := &streamSub{pointTypes: make(map[string]bool)}
+
+	for _, t := range req.PointTypes {
+		sub.pointTypes[t] = true
+	}
+
+	s.unsubscribe(req.ID)
+
+	// the subscription is added before the NATS subscription, so the
+	// handler always finds it
+	s.lock.Lock()
+	s.subs[req.ID] = sub
+	s.lock.Unlock()
+
+	sub.natsSub, err = s.nc.Subscribe(fmt.Sprintf("up.%v.>", req.ID),
+		func(msg *nats.Msg) {
+			s.handleUp(req.ID, sub, msg)
+		})
+	if err != nil {
+		s.lock.Lock()
+		delete(s.subs, req.ID)
+		s.lock.Unlock()
+		return err
+	}
+
+	s.write(StreamMsg{Type: "nodes", Sub: req.ID, ID: req.ID, Nodes: nodes})
+
+	return nil
+}
+
+func (s *streamConn) unsubscribe(id string) {
+	s.lock.Lock()
+	sub, ok := s.subs[id]
+	delete(s.subs, id)
+	s.lock.Unlock()
+
+	if ok && sub.natsSub != nil {
+		_ = sub.natsSub.Unsubscribe()
+	}
+}
+
+// filter returns the points that match the subscription point types.
+// Tombstone points are always included so clients see deleted nodes.
+func (sub *streamSub) filter(points data.Points) data.Points {
+	if len(sub.pointTypes) <= 0 {
+		return points
+	}
+
+	var ret data.Points
+	for _, p := range points {
+		if sub.pointTypes[p.Type] || p.Type == data.PointTypeTombstone {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// handleUp handles the points in a subscription subtree:
+//   - up.<root>.<id>: node points
+//   - up.<root>.<id>.<parent>: edge points
+func (s *streamConn) handleUp(root string, sub *streamSub, msg *nats.Msg) {
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) != 3 && len(chunks) != 4 {
+		return
+	}
+
+	id := chunks[2]
+
+	points, err := data.PbDecodePoints(msg.Data)
+	if err != nil {
+		log.Println("Stream: error decoding points:", err)
+		return
+	}
+
+	if len(chunks) == 3 {
+		if pts := sub.filter(points); len(pts) > 0 {
+			s.write(StreamMsg{Type: "points", Sub: root, ID: id, Points: pts})
+		}
+		return
+	}
+
+	parent := chunks[3]
+
+	if pts := sub.filter(points); len(pts) > 0 {
+		s.write(StreamMsg{Type: "edgePoints", Sub: root, ID: id,
+			Parent: parent, Points: pts})
+	}
+
+	if id == root {
+		return
+	}
+
+	for _, p := range points {
+		if p.Type == data.PointTypeTombstone && p.Value == 0 {
+			// node was added to the subtree
+			select {
+			case s.fetch <- streamFetch{sub: root, id: id, parent: parent}:
+			case <-s.done:
+			default:
+				s.slow("fetch queue full")
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/simpleiot/simpleiot/api"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestStream(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "ID-var",
+		Type:   data.NodeTypeVariable,
+		Parent: root.ID,
+		Points: data.Points{
+			{Type: data.PointTypeDescription, Key: "0", Text: "tank"},
+		},
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	key, _ := api.NewKey([]byte("test key"))
+	ts := httptest.NewServer(api.NewStreamHandler(key, "secret", nc))
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	_, res, err := websocket.DefaultDialer.Dial(url+"?token=wrong", nil)
+	if err == nil || res.StatusCode != http.StatusUnauthorized {
+		t.Fatal("Expected unauthorized error")
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url,
+		http.Header{"Authorization": []string{"secret"}})
+	if err != nil {
+		t.Fatal("Error connecting: ", err)
+	}
+	defer conn.Close()
+
+	read := func(typ string) api.StreamMsg {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var msg api.StreamMsg
+			err := conn.ReadJSON(&msg)
+			if err != nil {
+				t.Fatalf("Error reading %v msg: %v", typ, err)
+			}
+			if msg.Type == "error" {
+				t.Fatal("Stream error: ", msg.Error)
+			}
+			if msg.Type == typ {
+				return msg
+			}
+		}
+	}
+
+	err = conn.WriteJSON(api.StreamRequest{Type: "subscribe", ID: root.ID,
+		PointTypes: []string{data.PointTypeValue}})
+	if err != nil {
+		t.Fatal("Error subscribing: ", err)
+	}
+
+	msg := read("nodes")
+	found := false
+	for _, n := range msg.Nodes {
+		if n.ID == "ID-var" {
+			found = true
+		}
+	}
+
+	if msg.Sub != root.ID || !found {
+		t.Fatalf("Wrong nodes msg: %+v", msg)
+	}
+
+	err = client.SendNodePoints(nc, "ID-var", data.Points{
+		{Type: data.PointTypeDescription, Key: "0", Text: "tank 2"},
+		{Type: data.PointTypeValue, Key: "0", Value: 12.5},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending points: ", err)
+	}
+
+	msg = read("points")
+	if msg.ID != "ID-var" || len(msg.Points) != 1 || msg.Points[0].Value != 12.5 {
+		t.Fatalf("Wrong points msg: %+v", msg)
+	}
+
+	// nodes added to the subtree are streamed
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "ID-child",
+		Type:   data.NodeTypeVariable,
+		Parent: "ID-var",
+		Points: data.Points{
+			{Type: data.PointTypeDescription, Key: "0", Text: "child"},
+		},
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	msg = read("nodes")
+	if msg.ID != "ID-child" || len(msg.Nodes) != 1 || msg.Nodes[0].Desc() != "child" {
+		t.Fatalf("Wrong nodes msg: %+v", msg)
+	}
+
+	err = client.SendNodePoint(nc, "ID-child", data.Point{
+		Type: data.PointTypeValue, Key: "0", Value: 3}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	msg = read("points")
+	if msg.ID != "ID-child" || msg.Points[0].Value != 3 {
+		t.Fatalf("Wrong points msg: %+v", msg)
+	}
+
+	// deleted nodes and the nodes below them are removed from the subtree
+	err = client.DeleteNode(nc, "ID-var", root.ID, "test")
+	if err != nil {
+		t.Fatal("Error deleting node: ", err)
+	}
+
+	msg = read("edgePoints")
+	if msg.ID != "ID-var" || msg.Points[0].Type != data.PointTypeTombstone {
+		t.Fatalf("Wrong edge points msg: %+v", msg)
+	}
+
+	err = client.SendNodePoint(nc, "ID-child", data.Point{
+		Type: data.PointTypeValue, Key: "0", Value: 4}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	err = client.SendNodePoint(nc, root.ID, data.Point{
+		Type: data.PointTypeValue, Key: "0", Value: 5}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	msg = read("points")
+	if msg.ID != root.ID || msg.Points[0].Value != 5 {
+		t.Fatalf("Points streamed for deleted node: %+v", msg)
+	}
+}
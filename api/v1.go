@@ -2,19 +2,39 @@ package api
 
 import (
 	"net/http"
+
+	"github.com/nats-io/nats.go"
 )
 
 // V1 handles v1 api requests
 type V1 struct {
-	GroupsHandler http.Handler
-	UsersHandler  http.Handler
-	NodesHandler  http.Handler
-	AuthHandler   http.Handler
-	MsgHandler    http.Handler
+	GroupsHandler  http.Handler
+	UsersHandler   http.Handler
+	NodesHandler   http.Handler
+	AuthHandler    http.Handler
+	MsgHandler     http.Handler
+	IngestHandler  http.Handler
+	StreamHandler  http.Handler
+	OpenAPIHandler http.Handler
+
+	nc        *nats.Conn
+	authToken string
 }
 
 // Top level handler for http requests in the coap-server process
 func (h *V1) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	// requests are checked against the OpenAPI operations before they are
+	// passed to the handlers
+	op, ok := validRequest(res, req)
+	if !ok {
+		return
+	}
+
+	req, ok = checkAPIToken(h.nc, h.authToken, res, req, op)
+	if !ok {
+		return
+	}
+
 	var head string
 	head, req.URL.Path = ShiftPath(req.URL.Path)
 	switch head {
@@ -22,16 +42,30 @@ func (h *V1) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		h.NodesHandler.ServeHTTP(res, req)
 	case "auth":
 		h.AuthHandler.ServeHTTP(res, req)
+	case "ingest":
+		h.IngestHandler.ServeHTTP(res, req)
+	case "stream":
+		h.StreamHandler.ServeHTTP(res, req)
+	case "openapi.json":
+		h.OpenAPIHandler.ServeHTTP(res, req)
 	default:
-		http.Error(res, "Not Found", http.StatusNotFound)
+		writeError(res, http.StatusNotFound, "not found")
 	}
 }
 
 // NewV1Handler returns a handle for V1 API
 func NewV1Handler(args ServerArgs) http.Handler {
+	// requests authenticated with an API token are checked by the V1
+	// handler before they reach the other handlers
+	check := apiTokenValidator{args.JwtAuth}
+
 	return &V1{
-		NodesHandler: NewNodesHandler(args.JwtAuth,
-			args.AuthToken, args.Nc),
-		AuthHandler: NewAuthHandler(args.Nc),
+		NodesHandler:   NewNodesHandler(check, args.AuthToken, args.Nc),
+		AuthHandler:    NewAuthHandler(args.Nc, args.JwtAuth),
+		IngestHandler:  NewIngestHandler(args.Nc),
+		StreamHandler:  NewStreamHandler(check, args.AuthToken, args.Nc),
+		OpenAPIHandler: NewOpenAPIHandler(),
+		nc:             args.Nc,
+		authToken:      args.AuthToken,
 	}
 }
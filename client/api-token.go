@@ -0,0 +1,223 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// APIToken is a long lived token for integrations. API token nodes are
+// children of a user node. Requests made with the token act as the user,
+// limited by the token scope and optionally to a node subtree.
+type APIToken struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	// Token is hashed by the store and is never read back
+	Token     string `point:"token"`
+	TokenHash string `point:"tokenHash"`
+	// Scope is read, write (read and write points), or admin. Defaults to
+	// read.
+	Scope string `point:"scope"`
+	// NodeID restricts the token to a node and its descendants
+	NodeID string `point:"nodeID"`
+	// Expires is a RFC3339 time or a date (2006-01-02). Tokens without an
+	// expiry never expire.
+	Expires  string `point:"expires"`
+	Disabled bool   `point:"disabled"`
+}
+
+// ErrAPITokenInvalid is returned if an API token does not exist, is
+// disabled, or has expired
+var ErrAPITokenInvalid = errors.New("invalid api token")
+
+var apiTokenScopes = map[string]int{
+	"":                   1,
+	data.PointValueRead:  1,
+	data.PointValueWrite: 2,
+	data.PointValueAdmin: 3,
+}
+
+// ExpiresAt returns the token expiry time, or the zero time if the token
+// does not expire
+func (t APIToken) ExpiresAt() (time.Time, error) {
+	if t.Expires == "" {
+		return time.Time{}, nil
+	}
+
+	if ret, err := time.Parse(time.RFC3339, t.Expires); err == nil {
+		return ret, nil
+	}
+
+	ret, err := time.Parse("2006-01-02", t.Expires)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry: %v", t.Expires)
+	}
+
+	return ret, nil
+}
+
+// Valid returns an error if the token is disabled or expired
+func (t APIToken) Valid(now time.Time) error {
+	if t.Disabled {
+		return ErrAPITokenInvalid
+	}
+
+	exp, err := t.ExpiresAt()
+	if err != nil {
+		return err
+	}
+
+	if !exp.IsZero() && !now.Before(exp) {
+		return ErrAPITokenInvalid
+	}
+
+	if _, ok := apiTokenScopes[t.Scope]; !ok {
+		return fmt.Errorf("invalid scope: %v", t.Scope)
+	}
+
+	return nil
+}
+
+// Allows returns true if the token scope includes scope. Scopes are
+// ordered: read < write < admin.
+func (t APIToken) Allows(scope string) bool {
+	have, ok := apiTokenScopes[t.Scope]
+	return ok && have >= apiTokenScopes[scope]
+}
+
+// apiTokenAdminNodeTypes are node types that only admin tokens can send
+// points to. Users, API tokens, and OIDC nodes control access, so other
+// tokens could use them to raise their own scope.
+var apiTokenAdminNodeTypes = map[string]bool{
+	data.NodeTypeUser:     true,
+	data.NodeTypeAPIToken: true,
+	data.NodeTypeOIDC:     true,
+}
+
+// AllowsPoints returns true if the token can send points to a node of type
+// typ
+func (t APIToken) AllowsPoints(typ string) bool {
+	if apiTokenAdminNodeTypes[typ] {
+		return t.Allows(data.PointValueAdmin)
+	}
+	return t.Allows(data.PointValueWrite)
+}
+
+// HashToken returns the hash that is stored in place of a token point
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// CheckTokenHash returns true if token matches a hash returned by
+// HashToken. Empty tokens never match.
+func CheckTokenHash(hash, token string) bool {
+	if hash == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(HashToken(token))) == 1
+}
+
+// CheckAPIToken looks up an API token and verifies it is valid
+func CheckAPIToken(nc *nats.Conn, token string) (APIToken, error) {
+	var ret APIToken
+
+	if token == "" {
+		return ret, ErrAPITokenInvalid
+	}
+
+	points := data.Points{
+		{Type: data.PointTypeToken, Text: token, Key: "0"},
+	}
+
+	pointsData, err := points.ToPb()
+	if err != nil {
+		return ret, err
+	}
+
+	msg, err := nc.Request("auth.apiToken", pointsData, time.Second*20)
+	if err != nil {
+		return ret, err
+	}
+
+	nodes, err := data.PbDecodeNodesRequest(msg.Data)
+	if err != nil {
+		return ret, err
+	}
+
+	if len(nodes) < 1 {
+		return ret, ErrAPITokenInvalid
+	}
+
+	err = data.Decode(data.NodeEdgeChildren{NodeEdge: nodes[0]}, &ret)
+	if err != nil {
+		return ret, err
+	}
+
+	return ret, ret.Valid(time.Now())
+}
+
+// GetSubtreeIDs returns the IDs of a node and all its descendants
+func GetSubtreeIDs(nc *nats.Conn, id string) (map[string]bool, error) {
+	ret := map[string]bool{id: true}
+
+	return ret, walkSubtree(nc, id, func(c data.NodeEdge) bool {
+		// mirrored nodes can show up more than once
+		if ret[c.ID] {
+			return false
+		}
+		ret[c.ID] = true
+		return true
+	})
+}
+
+// GetSubtreeTypes returns the IDs and types of a node and all its
+// descendants
+func GetSubtreeTypes(nc *nats.Conn, id string) (map[string]string, error) {
+	nodes, err := GetNodes(nc, "all", id, "", false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodes) < 1 {
+		return nil, data.ErrDocumentNotFound
+	}
+
+	ret := map[string]string{id: nodes[0].Type}
+
+	return ret, walkSubtree(nc, id, func(c data.NodeEdge) bool {
+		if _, ok := ret[c.ID]; ok {
+			return false
+		}
+		ret[c.ID] = c.Type
+		return true
+	})
+}
+
+// walkSubtree calls visit for the descendants of a node. The children of a
+// node are only walked if visit returns true.
+func walkSubtree(nc *nats.Conn, id string, visit func(data.NodeEdge) bool) error {
+	children, err := GetNodes(nc, id, "all", "", false)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range children {
+		if !visit(c) {
+			continue
+		}
+		err := walkSubtree(nc, c.ID, visit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -35,6 +35,26 @@ func UserCheck(nc *nats.Conn, email, pass string) ([]data.NodeEdge, error) {
 	return nodes, nil
 }
 
+// UserFindEmail returns the user nodes with an email. Unlike UserCheck, it
+// does not authenticate the user or return a JWT.
+func UserFindEmail(nc *nats.Conn, email string) ([]data.NodeEdge, error) {
+	points := data.Points{
+		{Type: data.PointTypeEmail, Text: email, Key: "0"},
+	}
+
+	pointsData, err := points.ToPb()
+	if err != nil {
+		return []data.NodeEdge{}, err
+	}
+
+	nodeMsg, err := nc.Request("auth.userEmail", pointsData, time.Second*20)
+	if err != nil {
+		return []data.NodeEdge{}, err
+	}
+
+	return data.PbDecodeNodesRequest(nodeMsg.Data)
+}
+
 // GetNatsURI returns the nats URI and auth token for the SIOT server
 // this can be used to set up new NATS connections with different requirements
 // (no echo, etc)
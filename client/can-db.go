@@ -0,0 +1,475 @@
+package client
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simpleiot/canparse"
+	"github.com/simpleiot/simpleiot/data"
+	"go.einride.tech/can"
+	"go.einride.tech/can/pkg/dbc"
+)
+
+// canDatabase contains the messages from the CAN database files of a CAN
+// bus. KCD and DBC files are supported.
+type canDatabase struct {
+	messages []canMessage
+	// kcdScale applies the slope and intercept of KCD signals. KCD signal
+	// values were always raw before DBC support was added, so this is off
+	// by default.
+	kcdScale bool
+}
+
+type canMessage struct {
+	Name       string
+	ID         uint32
+	IsExtended bool
+	// Length in bytes, 0 if unknown
+	Length  uint8
+	Signals []canSignal
+}
+
+type canSignal struct {
+	Name string
+	// Start bit, may be larger than 63 for J1939 transport messages
+	Start       uint16
+	Length      uint8
+	IsBigEndian bool
+	IsSigned    bool
+	// IsFloat signals are IEEE 754 single (32 bit) or double (64 bit) values
+	IsFloat bool
+	// The multiplexer signal selects which multiplexed signals are present
+	IsMultiplexer    bool
+	IsMultiplexed    bool
+	MultiplexerValue uint64
+	Scale            float64
+	Offset           float64
+	Min              float64
+	Max              float64
+	Unit             string
+	// ValueDescriptions map raw values to text (DBC value tables)
+	ValueDescriptions map[int64]string
+}
+
+// read parses a database file and adds the messages to the database. The
+// format is determined by the file extension.
+func (db *canDatabase) read(name string, contents []byte) error {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".kcd":
+		return db.readKcd(contents)
+	case ".dbc":
+		return db.readDbc(name, contents)
+	default:
+		return fmt.Errorf("invalid CAN database file extension: %v", name)
+	}
+}
+
+func (db *canDatabase) readKcd(contents []byte) error {
+	kcd := &canparse.Database{}
+	err := kcd.ReadKcd(contents)
+	if err != nil {
+		return err
+	}
+
+	// canparse does not keep the message format, so it is read from the
+	// XML to find extended messages with IDs that fit in 11 bits
+	var kcdXML canparse.KcdDatabase
+	err = xml.Unmarshal(contents, &kcdXML)
+	if err != nil {
+		return err
+	}
+
+	for i, b := range kcd.Busses {
+		for j, m := range b.Messages {
+			msg := canMessage{
+				Name:       m.Name,
+				ID:         m.Id,
+				IsExtended: m.Id > can.MaxID,
+				Length:     uint8(m.Length),
+			}
+			if i < len(kcdXML.KcdBusses) && j < len(kcdXML.KcdBusses[i].KcdMessages) &&
+				kcdXML.KcdBusses[i].KcdMessages[j].Format == "extended" {
+				msg.IsExtended = true
+			}
+			for _, s := range m.Signals {
+				// canparse does not read the KCD byte order, value
+				// type, or min/max, so KCD signals are always unsigned
+				// little endian values as they were before DBC support
+				sig := canSignal{
+					Name:   s.Name,
+					Start:  uint16(s.Start),
+					Length: uint8(s.Length),
+					Unit:   s.Unit,
+				}
+				if db.kcdScale {
+					sig.Scale = s.Scale
+					sig.Offset = s.Offset
+				}
+				msg.Signals = append(msg.Signals, sig)
+			}
+			db.messages = append(db.messages, msg)
+		}
+	}
+
+	return nil
+}
+
+func (db *canDatabase) readDbc(name string, contents []byte) error {
+	p := dbc.NewParser(name, contents)
+	if err := p.Parse(); err != nil {
+		return fmt.Errorf("error parsing DBC file: %w", err)
+	}
+
+	start := len(db.messages)
+
+	for _, def := range p.Defs() {
+		def, ok := def.(*dbc.MessageDef)
+		if !ok || def.MessageID == dbc.IndependentSignalsMessageID {
+			continue
+		}
+
+		msg := canMessage{
+			Name:       string(def.Name),
+			ID:         def.MessageID.ToCAN(),
+			IsExtended: def.MessageID.IsExtended(),
+			Length:     uint8(def.Size),
+		}
+
+		for _, s := range def.Signals {
+			msg.Signals = append(msg.Signals, canSignal{
+				Name:             string(s.Name),
+				Start:            uint16(s.StartBit),
+				Length:           uint8(s.Size),
+				IsBigEndian:      s.IsBigEndian,
+				IsSigned:         s.IsSigned,
+				IsMultiplexer:    s.IsMultiplexerSwitch,
+				IsMultiplexed:    s.IsMultiplexed,
+				MultiplexerValue: s.MultiplexerSwitch,
+				Scale:            s.Factor,
+				Offset:           s.Offset,
+				Min:              s.Minimum,
+				Max:              s.Maximum,
+				Unit:             s.Unit,
+			})
+		}
+
+		db.messages = append(db.messages, msg)
+	}
+
+	// signal value types and value descriptions are defined after the
+	// messages
+	signal := func(id dbc.MessageID, name dbc.Identifier) *canSignal {
+		for i := start; i < len(db.messages); i++ {
+			m := &db.messages[i]
+			if m.ID != id.ToCAN() || m.IsExtended != id.IsExtended() {
+				continue
+			}
+			for j := range m.Signals {
+				if m.Signals[j].Name == string(name) {
+					return &m.Signals[j]
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, def := range p.Defs() {
+		switch def := def.(type) {
+		case *dbc.SignalValueTypeDef:
+			if s := signal(def.MessageID, def.SignalName); s != nil {
+				s.IsFloat = def.SignalValueType == dbc.SignalValueTypeFloat32 ||
+					def.SignalValueType == dbc.SignalValueTypeFloat64
+			}
+		case *dbc.ValueDescriptionsDef:
+			if def.ObjectType != dbc.ObjectTypeSignal {
+				continue
+			}
+			if s := signal(def.MessageID, def.SignalName); s != nil {
+				s.ValueDescriptions = make(map[int64]string)
+				for _, vd := range def.ValueDescriptions {
+					s.ValueDescriptions[int64(vd.Value)] = vd.Description
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// signalCount returns the number of signals in the database
+func (db *canDatabase) signalCount() int {
+	ret := 0
+	for _, m := range db.messages {
+		ret += len(m.Signals)
+	}
+	return ret
+}
+
+// messageForFrame finds the message for a received frame
+func (db *canDatabase) messageForFrame(frame can.Frame) (canMessage, bool) {
+	for _, m := range db.messages {
+		if m.ID == frame.ID && m.IsExtended == frame.IsExtended {
+			return m, true
+		}
+	}
+	return canMessage{}, false
+}
+
+// messageForPGN finds a J1939 message by PGN. The priority and source
+// address in the database message ID are ignored.
+func (db *canDatabase) messageForPGN(pgn uint32) (canMessage, bool) {
+	for _, m := range db.messages {
+		if m.IsExtended && j1939PGN(m.ID) == pgn {
+			return m, true
+		}
+	}
+	return canMessage{}, false
+}
+
+// message finds a message by name or ID
+func (db *canDatabase) message(nameOrID string) (canMessage, error) {
+	var id uint64 = math.MaxUint64
+	s := strings.ToLower(strings.TrimSpace(nameOrID))
+	if strings.HasPrefix(s, "0x") {
+		if v, err := strconv.ParseUint(s[2:], 16, 32); err == nil {
+			id = v
+		}
+	} else if v, err := strconv.ParseUint(s, 10, 32); err == nil {
+		id = v
+	}
+
+	for _, m := range db.messages {
+		if m.Name == strings.TrimSpace(nameOrID) || uint64(m.ID) == id {
+			return m, nil
+		}
+	}
+
+	return canMessage{}, fmt.Errorf("message %v not found in database", nameOrID)
+}
+
+// scale returns the signal scale, KCD signals without a slope use 1
+func (s canSignal) scale() float64 {
+	if s.Scale == 0 {
+		return 1
+	}
+	return s.Scale
+}
+
+func (s canSignal) checkRange(length uint8) error {
+	if s.Length == 0 || s.Length > 64 || s.Start > 63 {
+		return fmt.Errorf("invalid signal %v", s.Name)
+	}
+
+	if s.IsFloat && s.Length != 32 && s.Length != 64 {
+		return fmt.Errorf("float signal %v must be 32 or 64 bits", s.Name)
+	}
+
+	if s.IsBigEndian {
+		return can.CheckBitRangeBigEndian(length, uint8(s.Start), s.Length)
+	}
+
+	return can.CheckBitRangeLittleEndian(length, uint8(s.Start), s.Length)
+}
+
+func (s canSignal) unsigned(d can.Data) uint64 {
+	if s.IsBigEndian {
+		return d.UnsignedBitsBigEndian(uint8(s.Start), s.Length)
+	}
+	return d.UnsignedBitsLittleEndian(uint8(s.Start), s.Length)
+}
+
+// raw returns the raw signal value in a frame
+func (s canSignal) raw(d can.Data) float64 {
+	switch {
+	case s.IsFloat && s.Length == 32:
+		return float64(math.Float32frombits(uint32(s.unsigned(d))))
+	case s.IsFloat:
+		return math.Float64frombits(s.unsigned(d))
+	case s.IsSigned:
+		if s.IsBigEndian {
+			return float64(d.SignedBitsBigEndian(uint8(s.Start), s.Length))
+		}
+		return float64(d.SignedBitsLittleEndian(uint8(s.Start), s.Length))
+	default:
+		return float64(s.unsigned(d))
+	}
+}
+
+// setRaw sets the raw signal value in a frame. Integer values are limited
+// to the signal range.
+func (s canSignal) setRaw(d *can.Data, raw float64) {
+	var u uint64
+
+	switch {
+	case s.IsFloat && s.Length == 32:
+		u = uint64(math.Float32bits(float32(raw)))
+	case s.IsFloat:
+		u = math.Float64bits(raw)
+	case s.IsSigned:
+		max := math.Ldexp(1, int(s.Length)-1)
+		raw = math.Max(-max, math.Min(max-1, math.Round(raw)))
+		if s.IsBigEndian {
+			d.SetSignedBitsBigEndian(uint8(s.Start), s.Length, int64(raw))
+		} else {
+			d.SetSignedBitsLittleEndian(uint8(s.Start), s.Length, int64(raw))
+		}
+		return
+	default:
+		max := math.Ldexp(1, int(s.Length)) - 1
+		raw = math.Max(0, math.Min(max, math.Round(raw)))
+		// float64 can't represent 2^64-1, so clamp 64 bit signals before
+		// converting
+		u = math.MaxUint64
+		if raw < math.Ldexp(1, 64) {
+			u = uint64(raw)
+		}
+	}
+
+	if s.IsBigEndian {
+		d.SetUnsignedBitsBigEndian(uint8(s.Start), s.Length, u)
+	} else {
+		d.SetUnsignedBitsLittleEndian(uint8(s.Start), s.Length, u)
+	}
+}
+
+// window returns the signal and up to 8 bytes of the payload that contain
+// the signal, so that signals in payloads longer than a CAN frame can be
+// decoded.
+func (s canSignal) window(payload []byte) (canSignal, can.Data, uint8) {
+	var d can.Data
+
+	if len(payload) <= can.MaxDataLength {
+		copy(d[:], payload)
+		return s, d, uint8(len(payload))
+	}
+
+	off := int(s.Start / 8)
+	if off >= len(payload) {
+		return s, d, 0
+	}
+
+	n := copy(d[:], payload[off:])
+	s.Start -= uint16(off * 8)
+	return s, d, uint8(n)
+}
+
+// multiplexer returns the multiplexer signal
+func (m canMessage) multiplexer() (canSignal, bool) {
+	for _, s := range m.Signals {
+		if s.IsMultiplexer {
+			return s, true
+		}
+	}
+	return canSignal{}, false
+}
+
+// decode returns a point for each signal in the frame. The point key is
+// <message>.<signal>[<unit>]. Signals with a value description also have
+// the description in the point text.
+func (m canMessage) decode(frame can.Frame) data.Points {
+	length := frame.Length
+	if length > can.MaxDataLength {
+		length = can.MaxDataLength
+	}
+	return m.decodePayload(frame.Data[:length])
+}
+
+// decodePayload decodes a payload that may be longer than a CAN frame
+// (J1939 transport messages)
+func (m canMessage) decodePayload(payload []byte) data.Points {
+	var mux uint64
+	muxSig, hasMux := m.multiplexer()
+	if hasMux {
+		s, d, length := muxSig.window(payload)
+		if s.checkRange(length) == nil {
+			mux = s.unsigned(d)
+		}
+	}
+
+	var ret data.Points
+
+	for _, s := range m.Signals {
+		if s.IsMultiplexed && (!hasMux || s.MultiplexerValue != mux) {
+			continue
+		}
+
+		s, d, length := s.window(payload)
+		if s.checkRange(length) != nil {
+			continue
+		}
+
+		raw := s.raw(d)
+		value := raw*s.scale() + s.Offset
+
+		p := data.Point{
+			Time:  time.Now(),
+			Type:  data.PointTypeValue,
+			Key:   fmt.Sprintf("%v.%v[%v]", m.Name, s.Name, s.Unit),
+			Value: value,
+		}
+
+		if desc, ok := s.ValueDescriptions[int64(raw)]; ok && !s.IsFloat {
+			p.Text = desc
+		}
+
+		ret = append(ret, p)
+	}
+
+	return ret
+}
+
+// encode encodes signal values into a frame. Values are physical values
+// that are converted to raw values using the signal scale and offset, and
+// limited to the signal min/max and bit length. Signals without a value
+// are sent as 0. Only multiplexed signals that match the multiplexer value
+// are encoded.
+func (m canMessage) encode(values map[string]float64) (can.Frame, error) {
+	frame := can.Frame{
+		ID:         m.ID,
+		Length:     m.Length,
+		IsExtended: m.IsExtended,
+	}
+
+	if frame.Length == 0 {
+		frame.Length = can.MaxDataLength
+	}
+
+	if frame.Length > can.MaxDataLength {
+		return frame, fmt.Errorf("message %v length %v is too long", m.Name, m.Length)
+	}
+
+	var mux uint64
+	if s, ok := m.multiplexer(); ok {
+		mux = uint64(math.Max(0, math.Round((values[s.Name]-s.Offset)/s.scale())))
+	}
+
+	for _, s := range m.Signals {
+		if s.IsMultiplexed && s.MultiplexerValue != mux {
+			continue
+		}
+
+		if err := s.checkRange(frame.Length); err != nil {
+			return frame, fmt.Errorf("signal %v does not fit in message %v: %w",
+				s.Name, m.Name, err)
+		}
+
+		v := values[s.Name]
+		if s.Min != 0 || s.Max != 0 {
+			v = math.Max(s.Min, math.Min(s.Max, v))
+		}
+
+		s.setRaw(&frame.Data, (v-s.Offset)/s.scale())
+	}
+
+	if err := frame.Validate(); err != nil {
+		return frame, errors.New("invalid frame: " + err.Error())
+	}
+
+	return frame, nil
+}
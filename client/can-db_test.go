@@ -0,0 +1,250 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+	"go.einride.tech/can"
+)
+
+var testKcd = `<NetworkDefinition xmlns="http://kayak.2codeornot2code.org/1.0">
+  <Bus name="test">
+    <Message id="0x123" name="Motor" length="8">
+      <Signal name="Speed" offset="0" length="16">
+        <Value slope="0.5" intercept="-100" unit="rpm"/>
+      </Signal>
+      <Signal name="Mode" offset="16" length="4"/>
+    </Message>
+    <Message id="0x12345678" name="Bms" length="8" format="extended">
+      <Signal name="State" offset="0" length="32"/>
+    </Message>
+    <Message id="0x7a" name="Aux" length="1" format="extended">
+      <Signal name="Level" offset="0" length="8"/>
+    </Message>
+  </Bus>
+</NetworkDefinition>
+`
+
+func TestCanEncode(t *testing.T) {
+	db := &canDatabase{kcdScale: true}
+	err := db.read("test.kcd", []byte(testKcd))
+	if err != nil {
+		t.Fatal("Error reading database: ", err)
+	}
+
+	msg, err := db.message("0x123")
+	if err != nil || msg.Name != "Motor" {
+		t.Fatal("Error finding message: ", err)
+	}
+
+	frame, err := msg.encode(map[string]float64{"Speed": 1500, "Mode": 20})
+	if err != nil {
+		t.Fatal("Error encoding: ", err)
+	}
+
+	if frame.ID != 0x123 || frame.IsExtended || frame.Length != 8 {
+		t.Fatal("Wrong frame header: ", frame)
+	}
+
+	// raw = (1500 - -100) / 0.5
+	if v := frame.Data.UnsignedBitsLittleEndian(0, 16); v != 3200 {
+		t.Error("Wrong speed: ", v)
+	}
+
+	// values are limited to the signal length
+	if v := frame.Data.UnsignedBitsLittleEndian(16, 4); v != 15 {
+		t.Error("Wrong mode: ", v)
+	}
+
+	msg, err = db.message("Bms")
+	if err != nil {
+		t.Fatal("Error finding message: ", err)
+	}
+
+	frame, err = msg.encode(map[string]float64{"State": 0xdeadbeef})
+	if err != nil {
+		t.Fatal("Error encoding: ", err)
+	}
+
+	if !frame.IsExtended || frame.Data.UnsignedBitsLittleEndian(0, 32) != 0xdeadbeef {
+		t.Error("Wrong extended frame: ", frame)
+	}
+
+	signed := canMessage{ID: 1, Length: 2, Signals: []canSignal{
+		{Name: "Temp", Start: 7, Length: 16, IsSigned: true,
+			IsBigEndian: true, Scale: 0.1},
+	}}
+
+	frame, err = signed.encode(map[string]float64{"Temp": -12.3})
+	if err != nil {
+		t.Fatal("Error encoding: ", err)
+	}
+
+	if v := frame.Data.SignedBitsBigEndian(7, 16); v != -123 || frame.Length != 2 {
+		t.Error("Wrong signed big endian value: ", v)
+	}
+
+	_, err = db.message("Unknown")
+	if err == nil {
+		t.Error("Expected error for unknown message")
+	}
+}
+
+func TestCanKcdDecode(t *testing.T) {
+	db := &canDatabase{}
+	err := db.read("test.kcd", []byte(testKcd))
+	if err != nil {
+		t.Fatal("Error reading database: ", err)
+	}
+
+	frame := can.Frame{ID: 0x123, Length: 8}
+	frame.Data.SetUnsignedBitsLittleEndian(0, 16, 3200)
+
+	msg, ok := db.messageForFrame(frame)
+	if !ok || msg.Name != "Motor" {
+		t.Fatal("Message not found for frame")
+	}
+
+	// KCD values are raw unless kcdScale is set
+	pts := msg.decode(frame)
+	speed, _ := pts.Value(data.PointTypeValue, "Motor.Speed[rpm]")
+	if speed != 3200 {
+		t.Error("Wrong raw speed: ", speed)
+	}
+
+	db = &canDatabase{kcdScale: true}
+	err = db.read("test.kcd", []byte(testKcd))
+	if err != nil {
+		t.Fatal("Error reading database: ", err)
+	}
+
+	msg, _ = db.messageForFrame(frame)
+	pts = msg.decode(frame)
+	speed, _ = pts.Value(data.PointTypeValue, "Motor.Speed[rpm]")
+	if speed != 1500 {
+		t.Error("Wrong scaled speed: ", speed)
+	}
+
+	// standard and extended frames with the same ID are different messages
+	if _, ok := db.messageForFrame(can.Frame{ID: 0x123, IsExtended: true}); ok {
+		t.Error("Extended frame matched standard message")
+	}
+
+	if msg, ok := db.messageForFrame(can.Frame{ID: 0x7a, IsExtended: true}); !ok || msg.Name != "Aux" {
+		t.Error("Extended frame with short ID did not match")
+	}
+
+	if _, ok := db.messageForFrame(can.Frame{ID: 0x7a}); ok {
+		t.Error("Standard frame matched extended message")
+	}
+}
+
+var testDbc = `VERSION ""
+
+NS_ :
+
+BS_:
+
+BU_: ECU
+
+BO_ 256 Engine: 8 ECU
+ SG_ Mux M : 0|8@1+ (1,0) [0|255] "" ECU
+ SG_ Rpm m0 : 8|16@1+ (0.25,0) [0|16000] "rpm" ECU
+ SG_ Temp m1 : 8|8@1- (1,-40) [-40|215] "degC" ECU
+ SG_ Gear : 56|8@1+ (1,0) [0|5] "" ECU
+
+BO_ 2566844672 Bms: 8 ECU
+ SG_ Voltage : 0|32@1- (1,0) [0|0] "V" ECU
+ SG_ Current : 39|16@0- (0.1,0) [-3276.8|3276.7] "A" ECU
+
+SIG_VALTYPE_ 2566844672 Voltage : 1;
+
+VAL_ 256 Gear 0 "Park" 1 "Drive" ;
+`
+
+func TestCanDbc(t *testing.T) {
+	db := &canDatabase{}
+	err := db.read("test.dbc", []byte(testDbc))
+	if err != nil {
+		t.Fatal("Error reading database: ", err)
+	}
+
+	if len(db.messages) != 2 || db.signalCount() != 6 {
+		t.Fatalf("Wrong database: %+v", db.messages)
+	}
+
+	engine, err := db.message("Engine")
+	if err != nil {
+		t.Fatal("Error finding message: ", err)
+	}
+
+	// multiplexed signals are only present for their multiplexer value
+	frame, err := engine.encode(map[string]float64{"Mux": 1, "Temp": -10, "Rpm": 3000, "Gear": 1})
+	if err != nil {
+		t.Fatal("Error encoding: ", err)
+	}
+
+	if v := frame.Data.SignedBitsLittleEndian(8, 8); v != 30 {
+		t.Error("Wrong temp: ", v)
+	}
+
+	pts := engine.decode(frame)
+	if len(pts) != 3 {
+		t.Fatal("Wrong points: ", pts)
+	}
+
+	for _, p := range pts {
+		switch p.Key {
+		case "Engine.Mux[]":
+			if p.Value != 1 {
+				t.Error("Wrong mux: ", p)
+			}
+		case "Engine.Temp[degC]":
+			if p.Value != -10 {
+				t.Error("Wrong temp: ", p)
+			}
+		case "Engine.Gear[]":
+			if p.Value != 1 || p.Text != "Drive" {
+				t.Error("Wrong gear: ", p)
+			}
+		default:
+			t.Error("Unexpected point: ", p)
+		}
+	}
+
+	frame, err = engine.encode(map[string]float64{"Mux": 0, "Rpm": 3000})
+	if err != nil {
+		t.Fatal("Error encoding: ", err)
+	}
+
+	pts = engine.decode(frame)
+	if p, ok := pts.Find(data.PointTypeValue, "Engine.Rpm[rpm]"); !ok || p.Value != 3000 {
+		t.Error("Wrong rpm: ", pts)
+	}
+
+	bms, ok := db.messageForFrame(can.Frame{ID: 0x18fef100, IsExtended: true})
+	if !ok || !bms.IsExtended {
+		t.Fatal("Extended message not found: ", bms)
+	}
+
+	frame, err = bms.encode(map[string]float64{"Voltage": 52.5, "Current": -12.3})
+	if err != nil {
+		t.Fatal("Error encoding: ", err)
+	}
+
+	if !frame.IsExtended || frame.ID != 0x18fef100 {
+		t.Error("Wrong extended frame: ", frame)
+	}
+
+	for _, p := range bms.decode(frame) {
+		if (p.Key == "Bms.Voltage[V]" && p.Value != 52.5) ||
+			(p.Key == "Bms.Current[A]" && p.Value != -12.3) {
+			t.Error("Wrong value: ", p)
+		}
+	}
+
+	err = db.read("test.dbc", []byte("BO_ invalid"))
+	if err == nil {
+		t.Error("Expected parse error")
+	}
+}
@@ -0,0 +1,246 @@
+package client
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+// CAN frames are recorded in the candump log format (candump -l), which can
+// be used with canplayer, cansniffer, etc:
+//
+//	(1436509052.249713) vcan0 123#DEADBEEF
+//	(1436509052.250713) vcan0 12345678#R
+
+// canLogFormat returns a log line for a frame
+func canLogFormat(t time.Time, device string, frame can.Frame) string {
+	id := fmt.Sprintf("%03X", frame.ID)
+	if frame.IsExtended {
+		id = fmt.Sprintf("%08X", frame.ID)
+	}
+
+	d := strings.ToUpper(hex.EncodeToString(frame.Data[:frame.Length]))
+	if frame.IsRemote {
+		d = "R"
+		if frame.Length > 0 {
+			d += strconv.Itoa(int(frame.Length))
+		}
+	}
+
+	return fmt.Sprintf("(%d.%06d) %v %v#%v\n", t.Unix(), t.Nanosecond()/1000,
+		device, id, d)
+}
+
+// canLogParse parses a log line
+func canLogParse(line string) (time.Time, can.Frame, error) {
+	var frame can.Frame
+
+	fields := strings.Fields(line)
+	if len(fields) != 3 || !strings.HasPrefix(fields[0], "(") ||
+		!strings.HasSuffix(fields[0], ")") {
+		return time.Time{}, frame, fmt.Errorf("invalid log line: %v", line)
+	}
+
+	sec, usec, _ := strings.Cut(strings.Trim(fields[0], "()"), ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, frame, fmt.Errorf("invalid timestamp: %v", fields[0])
+	}
+	// fractional seconds are typically microseconds, but allow any precision
+	usec = (usec + "000000000")[:9]
+	ns, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil {
+		return time.Time{}, frame, fmt.Errorf("invalid timestamp: %v", fields[0])
+	}
+	t := time.Unix(s, ns)
+
+	id, d, ok := strings.Cut(fields[2], "#")
+	if !ok || strings.HasPrefix(d, "#") {
+		// CAN FD frames use ##
+		return t, frame, fmt.Errorf("unsupported frame: %v", fields[2])
+	}
+
+	v, err := strconv.ParseUint(id, 16, 32)
+	if err != nil {
+		return t, frame, fmt.Errorf("invalid ID: %v", id)
+	}
+	frame.ID = uint32(v)
+	frame.IsExtended = len(id) > 3
+
+	if strings.HasPrefix(strings.ToUpper(d), "R") {
+		frame.IsRemote = true
+		if len(d) > 1 {
+			l, err := strconv.ParseUint(d[1:], 10, 8)
+			if err != nil {
+				return t, frame, fmt.Errorf("invalid remote frame length: %v", d)
+			}
+			frame.Length = uint8(l)
+		}
+	} else {
+		b, err := hex.DecodeString(strings.ReplaceAll(d, ".", ""))
+		if err != nil || len(b) > can.MaxDataLength {
+			return t, frame, fmt.Errorf("invalid data: %v", d)
+		}
+		frame.Length = uint8(copy(frame.Data[:], b))
+	}
+
+	if err := frame.Validate(); err != nil {
+		return t, frame, fmt.Errorf("invalid frame: %w", err)
+	}
+
+	return t, frame, nil
+}
+
+// canLogWriter writes frames to a log file. When the file is larger than
+// maxSize, it is renamed to <path>.1 (and <path>.1 to <path>.2, etc) and a
+// new file is started. maxFiles is the total number of files kept.
+type canLogWriter struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func newCanLogWriter(path string, maxSize int64, maxFiles int) (*canLogWriter, error) {
+	if maxFiles < 1 {
+		maxFiles = 1
+	}
+
+	w := &canLogWriter{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	err := w.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *canLogWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+func (w *canLogWriter) rotate() error {
+	err := w.file.Close()
+	if err != nil {
+		return err
+	}
+
+	name := func(i int) string {
+		if i == 0 {
+			return w.path
+		}
+		return fmt.Sprintf("%v.%v", w.path, i)
+	}
+
+	// the oldest file is overwritten by the rename
+	for i := w.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(name(i-1), name(i))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if w.maxFiles == 1 {
+		err := os.Remove(w.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return w.open()
+}
+
+func (w *canLogWriter) write(t time.Time, device string, frame can.Frame) error {
+	line := canLogFormat(t, device, frame)
+
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(line)) > w.maxSize {
+		err := w.rotate()
+		if err != nil {
+			return fmt.Errorf("error rotating CAN log: %w", err)
+		}
+	}
+
+	n, err := w.file.WriteString(line)
+	w.size += int64(n)
+	return err
+}
+
+func (w *canLogWriter) close() error {
+	return w.file.Close()
+}
+
+// canReplay reads frames from a log file and sends them to frames with the
+// timing in the log. speed is a multiplier for the replay rate (2 replays at
+// twice the original rate), and values <= 0 replay at the original rate.
+// Lines that can't be parsed are skipped.
+func canReplay(path string, speed float64, frames chan<- can.Frame, stop <-chan struct{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if speed <= 0 {
+		speed = 1
+	}
+
+	var first time.Time
+	start := time.Now()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		t, frame, err := canLogParse(line)
+		if err != nil {
+			continue
+		}
+
+		if first.IsZero() {
+			first = t
+		}
+
+		wait := time.Until(start.Add(time.Duration(float64(t.Sub(first)) / speed)))
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-stop:
+				timer.Stop()
+				return nil
+			}
+		}
+
+		select {
+		case frames <- frame:
+		case <-stop:
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
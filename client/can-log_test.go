@@ -0,0 +1,156 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+func TestCanLogFormat(t *testing.T) {
+	ts := time.Unix(1436509052, 249713000)
+
+	tests := []struct {
+		line  string
+		frame can.Frame
+	}{
+		{"(1436509052.249713) vcan0 123#DEADBEEF\n",
+			can.Frame{ID: 0x123, Length: 4, Data: can.Data{0xde, 0xad, 0xbe, 0xef}}},
+		{"(1436509052.249713) vcan0 12345678#01\n",
+			can.Frame{ID: 0x12345678, Length: 1, Data: can.Data{1}, IsExtended: true}},
+		{"(1436509052.249713) vcan0 7FF#\n",
+			can.Frame{ID: 0x7ff}},
+		{"(1436509052.249713) vcan0 123#R8\n",
+			can.Frame{ID: 0x123, Length: 8, IsRemote: true}},
+	}
+
+	for _, test := range tests {
+		line := canLogFormat(ts, "vcan0", test.frame)
+		if line != test.line {
+			t.Errorf("Wrong line: %q, expected %q", line, test.line)
+		}
+
+		pts, frame, err := canLogParse(line)
+		if err != nil {
+			t.Fatal("Error parsing line: ", err)
+		}
+
+		if !pts.Equal(ts) || frame != test.frame {
+			t.Errorf("Wrong frame for %q: %v %v", line, pts, frame)
+		}
+	}
+
+	for _, line := range []string{
+		"",
+		"123#00",
+		"(1436509052.249713) can0 123##100",
+		"(1436509052.249713) can0 XYZ#00",
+		"(1436509052.249713) can0 123#001122334455667788",
+	} {
+		_, _, err := canLogParse(line)
+		if err == nil {
+			t.Errorf("Expected error for %q", line)
+		}
+	}
+}
+
+func TestCanLogWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "can.log")
+	frame := can.Frame{ID: 0x123, Length: 8}
+	lineLen := int64(len(canLogFormat(time.Now(), "can0", frame)))
+
+	// each file holds 3 frames
+	w, err := newCanLogWriter(path, lineLen*3, 2)
+	if err != nil {
+		t.Fatal("Error creating writer: ", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		frame.Data[0] = byte(i)
+		err := w.write(time.Now(), "can0", frame)
+		if err != nil {
+			t.Fatal("Error writing frame: ", err)
+		}
+	}
+
+	err = w.close()
+	if err != nil {
+		t.Fatal("Error closing writer: ", err)
+	}
+
+	read := func(name string) []string {
+		d, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal("Error reading log: ", err)
+		}
+		return strings.Split(strings.TrimSpace(string(d)), "\n")
+	}
+
+	// frames 0-5 are rotated out, 6-8 are in the .1 file, and 9 is current
+	if lines := read(path); len(lines) != 1 || !strings.HasSuffix(lines[0], "#0900000000000000") {
+		t.Error("Wrong current log: ", lines)
+	}
+
+	if lines := read(path + ".1"); len(lines) != 3 || !strings.HasSuffix(lines[0], "#0600000000000000") {
+		t.Error("Wrong rotated log: ", lines)
+	}
+
+	if _, err := os.Stat(path + ".2"); err == nil {
+		t.Error("Too many log files")
+	}
+}
+
+func TestCanReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "can.log")
+	log := "# comment\n" +
+		"(100.000000) can0 001#01\n" +
+		"invalid line\n" +
+		"(100.200000) can0 002#02\n" +
+		"(100.400000) can0 003#03\n"
+
+	err := os.WriteFile(path, []byte(log), 0644)
+	if err != nil {
+		t.Fatal("Error writing log: ", err)
+	}
+
+	frames := make(chan can.Frame, 10)
+	stop := make(chan struct{})
+
+	// 0.4s of frames at 4x takes 0.1s
+	start := time.Now()
+	err = canReplay(path, 4, frames, stop)
+	if err != nil {
+		t.Fatal("Error replaying: ", err)
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < 90*time.Millisecond || elapsed > time.Second {
+		t.Error("Wrong replay time: ", elapsed)
+	}
+
+	if len(frames) != 3 {
+		t.Fatal("Wrong number of frames: ", len(frames))
+	}
+
+	for i := 1; i <= 3; i++ {
+		f := <-frames
+		if f.ID != uint32(i) || f.Data[0] != byte(i) {
+			t.Error("Wrong frame: ", f)
+		}
+	}
+
+	// replay stops when stop is closed
+	close(stop)
+	err = canReplay(path, 0.001, frames, stop)
+	if err != nil || len(frames) > 1 {
+		t.Error("Replay did not stop: ", err, len(frames))
+	}
+
+	err = canReplay(filepath.Join(t.TempDir(), "missing.log"), 1, frames, stop)
+	if err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
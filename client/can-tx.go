@@ -0,0 +1,21 @@
+package client
+
+// CanTx is a CAN message that is transmitted by the CAN bus client. The
+// message is looked up by name or ID in the CAN bus databases, and signal
+// values are set by value points with the signal name as the key (this is
+// typically done by a rule action).
+type CanTx struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	// Message is the message name or ID (ex: 0x123)
+	Message string `point:"message"`
+	// Period in ms the message is transmitted at. If 0, the message is only
+	// transmitted when a signal value changes.
+	Period int `point:"period"`
+	// OnChange transmits the message when a signal value changes, in addition
+	// to the periodic transmit
+	OnChange bool               `point:"onChange"`
+	Values   map[string]float64 `point:"value"`
+	Disabled bool               `point:"disabled"`
+}
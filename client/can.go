@@ -10,7 +10,6 @@ import (
 
 	"github.com/nats-io/nats.go"
 	"github.com/pkg/errors"
-	"github.com/simpleiot/canparse"
 	"github.com/simpleiot/simpleiot/data"
 	"go.einride.tech/can"
 	"go.einride.tech/can/pkg/socketcan"
@@ -18,19 +17,36 @@ import (
 
 // CanBus represents a CAN socket config. The name matches the front-end node type "canBus" to link the two so
 // that when a canBus node is created on the frontend the client manager knows to start a CanBus client.
+//
+// When Record is set, raw frames are recorded to RecordFile in candump log
+// format. The file is rotated when it is larger than RecordMaxSize (MB), and
+// RecordFiles files are kept. When Replay is set, frames from ReplayFile are
+// fed through the decoder at the original timing multiplied by ReplaySpeed.
 type CanBus struct {
-	ID                  string `node:"id"`
-	Parent              string `node:"parent"`
-	Description         string `point:"description"`
-	Device              string `point:"device"`
-	BitRate             string `point:"bitRate"`
-	MsgsInDb            int    `point:"msgsInDb"`
-	SignalsInDb         int    `point:"signalsInDb"`
-	MsgsRecvdDb         int    `point:"msgsRecvdDb"`
-	MsgsRecvdDbReset    bool   `point:"msgsRecvdDbReset"`
-	MsgsRecvdOther      int    `point:"msgsRecvdOther"`
-	MsgsRecvdOtherReset bool   `point:"msgsRecvdOtherReset"`
-	Databases           []File `child:"file"`
+	ID                  string  `node:"id"`
+	Parent              string  `node:"parent"`
+	Description         string  `point:"description"`
+	Device              string  `point:"device"`
+	BitRate             string  `point:"bitRate"`
+	J1939               bool    `point:"j1939"`
+	KcdScale            bool    `point:"kcdScale"`
+	MsgsInDb            int     `point:"msgsInDb"`
+	SignalsInDb         int     `point:"signalsInDb"`
+	MsgsRecvdDb         int     `point:"msgsRecvdDb"`
+	MsgsRecvdDbReset    bool    `point:"msgsRecvdDbReset"`
+	MsgsRecvdOther      int     `point:"msgsRecvdOther"`
+	MsgsRecvdOtherReset bool    `point:"msgsRecvdOtherReset"`
+	MsgsSent            int     `point:"msgsSent"`
+	MsgsSentReset       bool    `point:"msgsSentReset"`
+	Record              bool    `point:"record"`
+	RecordFile          string  `point:"recordFile"`
+	RecordMaxSize       float64 `point:"recordMaxSize"`
+	RecordFiles         int     `point:"recordFiles"`
+	Replay              bool    `point:"replay"`
+	ReplayFile          string  `point:"replayFile"`
+	ReplaySpeed         float64 `point:"replaySpeed"`
+	Databases           []File  `child:"file"`
+	TxMessages          []CanTx `child:"canTx"`
 }
 
 // CanBusClient is a SIOT client used to communicate on a CAN bus
@@ -66,13 +82,20 @@ func NewCanBusClient(nc *nats.Conn, config CanBus) Client {
 //     Linux SocketCAN socket and sends the frames out on the canMsgRx channel
 //
 //   - when a frame is recieved on the canMsgRx channel in the main loop, it is
-//     decoded and a point is sent out for each canparse.Signal in the frame.
+//     decoded and a point is sent out for each signal in the frame.
 //     The key of each point contains the message name, signal name, and signal
 //     units
+//
+//   - if J1939 is enabled, extended frames are matched to the database by PGN,
+//     transport protocol messages are reassembled, and DM1 DTCs and the VIN
+//     are sent as points
+//
+//   - CanTx child nodes are encoded with the database and transmitted
+//     periodically and/or when their signal values change
 func (cb *CanBusClient) Run() error {
 	log.Println("CanBusClient: Starting CAN bus client:", cb.config.Description)
 
-	var db *canparse.Database = &canparse.Database{}
+	db := &canDatabase{}
 
 	sendDbStats := func(msgs, signals int) {
 		points := data.Points{
@@ -97,27 +120,17 @@ func (cb *CanBusClient) Run() error {
 	readDb := func() {
 		cb.config.MsgsInDb = 0
 		cb.config.SignalsInDb = 0
-		db.Clean()
+		db = &canDatabase{kcdScale: cb.config.KcdScale}
 		for _, dbFile := range cb.config.Databases {
-			err := db.ReadBytes([]byte(dbFile.Data), dbFile.Name)
+			err := db.read(dbFile.Name, []byte(dbFile.Data))
 			if err != nil {
 				log.Println(errors.Wrap(err, "CanBusClient: Error parsing database file"))
 				sendDbStats(0, 0)
 				return
 			}
-			for _, b := range db.Busses {
-				cb.config.MsgsInDb += len(b.Messages)
-				for _, m := range b.Messages {
-					cb.config.SignalsInDb += len(m.Signals)
-					/*
-						for _, s := range m.Signals {
-							log.Printf("CanBusClient: read msg %X sig %v: start=%v len=%v scale=%v offset=%v unit=%v",
-								m.Id, s.Name, s.Start, s.Length, s.Scale, s.Offset, s.Unit)
-						}
-					*/
-				}
-			}
 		}
+		cb.config.MsgsInDb = len(db.messages)
+		cb.config.SignalsInDb = db.signalCount()
 		sendDbStats(cb.config.MsgsInDb, cb.config.SignalsInDb)
 	}
 
@@ -125,8 +138,67 @@ func (cb *CanBusClient) Run() error {
 
 	canMsgRx := make(chan can.Frame)
 
+	var recorder *canLogWriter
+
+	record := func(frame can.Frame) {
+		if recorder == nil {
+			return
+		}
+		err := recorder.write(time.Now(), cb.config.Device, frame)
+		if err != nil {
+			log.Println("CanBusClient: error recording frame:", err)
+		}
+	}
+
+	recordFile := func() string {
+		if cb.config.RecordFile != "" {
+			return cb.config.RecordFile
+		}
+		if cb.config.Device != "" {
+			return cb.config.Device + ".log"
+		}
+		return "can.log"
+	}
+
+	// updateRecord starts or stops recording when the record config changes
+	updateRecord := func() {
+		if recorder != nil {
+			err := recorder.close()
+			if err != nil {
+				log.Println("CanBusClient: error closing record file:", err)
+			}
+			recorder = nil
+		}
+
+		if !cb.config.Record {
+			return
+		}
+
+		maxSize := cb.config.RecordMaxSize
+		if maxSize <= 0 {
+			maxSize = 10
+		}
+
+		files := cb.config.RecordFiles
+		if files <= 0 {
+			files = 2
+		}
+
+		var err error
+		recorder, err = newCanLogWriter(recordFile(), int64(maxSize*1e6), files)
+		if err != nil {
+			log.Println("CanBusClient: error opening record file:", err)
+			return
+		}
+
+		log.Println("CanBusClient: recording frames to", recordFile())
+	}
+
+	updateRecord()
+
 	var ctx context.Context
 	var cancelContext context.CancelFunc
+	var transmitter *socketcan.Transmitter
 
 	// setupDev bringDownDev must be called before every call of setupDev //
 	// except for the first call
@@ -165,6 +237,7 @@ func (cb *CanBusClient) Run() error {
 			return
 		}
 		recv := socketcan.NewReceiver(conn)
+		transmitter = socketcan.NewTransmitter(conn)
 
 		// Listen on the socketCan interface
 		listener := func() {
@@ -182,55 +255,190 @@ func (cb *CanBusClient) Run() error {
 		if cancelContext != nil {
 			cancelContext()
 		}
+		transmitter = nil
 	}
 
+	sendTxStats := func() {
+		cb.lastSendStats = time.Now()
+		err := SendPoints(cb.nc, cb.natsSub, data.Points{{
+			Time:  time.Now(),
+			Type:  data.PointTypeMsgsSent,
+			Value: float64(cb.config.MsgsSent),
+		}}, false)
+		if err != nil {
+			log.Println("CanBusClient: error sending tx stats:", err)
+		}
+	}
+
+	transmit := func(t *CanTx) {
+		if t.Disabled || transmitter == nil {
+			return
+		}
+
+		msg, err := db.message(t.Message)
+		if err != nil {
+			log.Println("CanBusClient: tx:", err)
+			return
+		}
+
+		frame, err := msg.encode(t.Values)
+		if err != nil {
+			log.Println("CanBusClient: error encoding tx message:", err)
+			return
+		}
+
+		err = transmitter.TransmitFrame(ctx, frame)
+		if err != nil {
+			log.Println("CanBusClient: error transmitting frame:", err)
+			return
+		}
+
+		record(frame)
+
+		cb.config.MsgsSent++
+		// tx messages may be sent at a high rate, so limit stats updates
+		if time.Since(cb.lastSendStats) > time.Second {
+			sendTxStats()
+		}
+	}
+
+	// periodic messages are checked at the tx tick rate
+	txTicker := time.NewTicker(10 * time.Millisecond)
+	if len(cb.config.TxMessages) == 0 {
+		txTicker.Stop()
+	}
+	defer txTicker.Stop()
+	lastTx := make(map[string]time.Time)
+	j1939 := newJ1939Decoder()
+
+	// rx decodes a received or replayed frame and sends the points
+	rx := func(frame can.Frame) {
+		// Decode the can message based on database
+		var points data.Points
+		var ok bool
+		if cb.config.J1939 && frame.IsExtended {
+			points, ok = j1939.decode(db, frame)
+		} else {
+			var msg canMessage
+			msg, ok = db.messageForFrame(frame)
+			if ok {
+				points = msg.decode(frame)
+			}
+		}
+
+		if ok {
+			cb.config.MsgsRecvdDb++
+		} else {
+			cb.config.MsgsRecvdOther++
+		}
+
+		// Populate points to update CAN client stats
+		points = append(points,
+			data.Point{
+				Time:  time.Now(),
+				Type:  data.PointTypeMsgsRecvdDb,
+				Value: float64(cb.config.MsgsRecvdDb),
+			})
+		points = append(points,
+			data.Point{
+				Time:  time.Now(),
+				Type:  data.PointTypeMsgsRecvdOther,
+				Value: float64(cb.config.MsgsRecvdOther),
+			})
+
+		// Send the points
+		if len(points) > 0 {
+			err := SendPoints(cb.nc, cb.natsSub, points, false)
+			if err != nil {
+				log.Println(errors.Wrap(err, "CanBusClient: error sending points received from CAN bus: "))
+			}
+		}
+	}
+
+	replayRx := make(chan can.Frame)
+	var replayStop chan struct{}
+	var replayDone chan error
+
+	stopReplay := func() {
+		if replayStop != nil {
+			close(replayStop)
+			replayStop = nil
+			replayDone = nil
+		}
+	}
+
+	// updateReplay starts or stops replaying a log file through the decoder
+	updateReplay := func() {
+		stopReplay()
+
+		if !cb.config.Replay {
+			return
+		}
+
+		file := cb.config.ReplayFile
+		if file == "" {
+			file = recordFile()
+		}
+
+		log.Println("CanBusClient: replaying frames from", file)
+
+		stop := make(chan struct{})
+		done := make(chan error, 1)
+		go func(speed float64) {
+			done <- canReplay(file, speed, replayRx, stop)
+		}(cb.config.ReplaySpeed)
+
+		replayStop = stop
+		replayDone = done
+	}
+
+	updateReplay()
+
 	for {
 		select {
 		case <-cb.stop:
 			log.Println("CanBusClient: stopping CAN bus client:", cb.config.Description)
 			bringDownDev()
+			stopReplay()
+			if recorder != nil {
+				_ = recorder.close()
+			}
 			return nil
 
-		case frame := <-canMsgRx:
+		case <-txTicker.C:
+			for i := range cb.config.TxMessages {
+				t := &cb.config.TxMessages[i]
+				period := time.Duration(t.Period) * time.Millisecond
+				if period > 0 && time.Since(lastTx[t.ID]) >= period {
+					lastTx[t.ID] = time.Now()
+					transmit(t)
+				}
+			}
 
-			// Decode the can message based on database
-			msg, err := canparse.DecodeMessage(frame, db)
-			if err != nil {
-				cb.config.MsgsRecvdOther++
-			} else {
-				cb.config.MsgsRecvdDb++
+			if cb.config.MsgsSent > 0 && time.Since(cb.lastSendStats) > time.Second {
+				sendTxStats()
 			}
 
-			// Populate points representing the decoded CAN data
-			points := make(data.Points, len(msg.Signals))
-			for i, sig := range msg.Signals {
-				points[i].Type = data.PointTypeValue
-				points[i].Key = fmt.Sprintf("%v.%v[%v]",
-					msg.Name, sig.Name, sig.Unit)
-				points[i].Time = time.Now()
-				points[i].Value = float64(sig.Value)
+		case frame := <-canMsgRx:
+			record(frame)
+			rx(frame)
+
+		case frame := <-replayRx:
+			rx(frame)
+
+		case err := <-replayDone:
+			replayStop = nil
+			replayDone = nil
+			if err != nil {
+				log.Println("CanBusClient: error replaying frames:", err)
 			}
 
-			// Populate points to update CAN client stats
-			points = append(points,
-				data.Point{
-					Time:  time.Now(),
-					Type:  data.PointTypeMsgsRecvdDb,
-					Value: float64(cb.config.MsgsRecvdDb),
-				})
-			points = append(points,
-				data.Point{
-					Time:  time.Now(),
-					Type:  data.PointTypeMsgsRecvdOther,
-					Value: float64(cb.config.MsgsRecvdOther),
-				})
-
-			// Send the points
-			if len(points) > 0 {
-				err = SendPoints(cb.nc, cb.natsSub, points, false)
-				if err != nil {
-					log.Println(errors.Wrap(err, "CanBusClient: error sending points received from CAN bus: "))
-				}
+			cb.config.Replay = false
+			err = SendPoints(cb.nc, cb.natsSub, data.Points{
+				{Time: time.Now(), Type: data.PointTypeReplay, Value: 0},
+			}, false)
+			if err != nil {
+				log.Println("CanBusClient: error sending replay point:", err)
 			}
 
 		case pts := <-cb.newPoints:
@@ -239,18 +447,39 @@ func (cb *CanBusClient) Run() error {
 				log.Println("CanBusClient: error merging new points:", err)
 			}
 
+			// transmit tx messages when signal values change
+			for i := range cb.config.TxMessages {
+				t := &cb.config.TxMessages[i]
+				if t.ID != pts.ID || (t.Period > 0 && !t.OnChange) {
+					continue
+				}
+				for _, p := range pts.Points {
+					if p.Type == data.PointTypeValue {
+						lastTx[t.ID] = time.Now()
+						transmit(t)
+						break
+					}
+				}
+			}
+
 			// Update CAN devices and databases with new information
 			for _, p := range pts.Points {
 				switch p.Type {
 				case data.PointTypeDevice:
 					bringDownDev()
 					setupDev()
-				case data.PointTypeData:
+				case data.PointTypeData, data.PointTypeKcdScale:
 					readDb()
 				case data.PointTypeDisabled:
 					if p.Value == 0 {
 						bringDownDev()
 					}
+				case data.PointTypeRecord, data.PointTypeRecordFile,
+					data.PointTypeRecordMaxSize, data.PointTypeRecordFiles:
+					updateRecord()
+				case data.PointTypeReplay, data.PointTypeReplayFile,
+					data.PointTypeReplaySpeed:
+					updateReplay()
 				}
 			}
 
@@ -284,6 +513,21 @@ func (cb *CanBusClient) Run() error {
 				cb.config.MsgsRecvdOther = 0
 			}
 
+			// Reset sent msgs counter
+			if cb.config.MsgsSentReset {
+				points := data.Points{
+					{Time: time.Now(), Type: data.PointTypeMsgsSent, Value: 0},
+					{Time: time.Now(), Type: data.PointTypeMsgsSentReset, Value: 0},
+				}
+				err = SendPoints(cb.nc, cb.natsSub, points, false)
+				if err != nil {
+					log.Println("Error resetting CAN message sent count:", err)
+				}
+
+				cb.config.MsgsSentReset = false
+				cb.config.MsgsSent = 0
+			}
+
 		case pts := <-cb.newEdgePoints:
 			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &cb.config)
 			if err != nil {
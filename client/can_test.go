@@ -0,0 +1,178 @@
+package client_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+	"go.einride.tech/can"
+	"go.einride.tech/can/pkg/socketcan"
+)
+
+var canTestKcd = `<NetworkDefinition xmlns="http://kayak.2codeornot2code.org/1.0">
+  <Bus name="test">
+    <Message id="0x123" name="Motor" length="8">
+      <Signal name="Speed" offset="0" length="16">
+        <Value slope="0.5" intercept="-100" unit="rpm"/>
+      </Signal>
+    </Message>
+  </Bus>
+</NetworkDefinition>
+`
+
+// TestCanTx requires a vcan0 interface:
+//
+//	sudo modprobe vcan
+//	sudo ip link add dev vcan0 type vcan
+//	sudo ip link set up vcan0
+func TestCanTx(t *testing.T) {
+	if _, err := net.InterfaceByName("vcan0"); err != nil {
+		t.Skip("vcan0 not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := socketcan.DialContext(ctx, "can", "vcan0")
+	if err != nil {
+		t.Fatal("Error opening vcan0: ", err)
+	}
+	defer conn.Close()
+
+	frames := make(chan can.Frame, 10)
+	go func() {
+		recv := socketcan.NewReceiver(conn)
+		for recv.Receive() {
+			frames <- recv.Frame()
+		}
+	}()
+
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	err = client.SendNodeType(nc, client.CanBus{
+		ID:       "ID-can",
+		Parent:   root.ID,
+		Device:   "vcan0",
+		KcdScale: true,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending CAN node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.File{
+		ID: "ID-kcd", Parent: "ID-can", Name: "test.kcd", Data: canTestKcd,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending database: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.CanTx{
+		ID: "ID-tx", Parent: "ID-can", Message: "Motor",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending tx node: ", err)
+	}
+
+	// give the client time to start
+	time.Sleep(500 * time.Millisecond)
+
+	err = client.SendNodePoint(nc, "ID-tx", data.Point{
+		Type: data.PointTypeValue, Key: "Speed", Value: 0}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	select {
+	case f := <-frames:
+		if f.ID != 0x123 || f.Data.UnsignedBitsLittleEndian(0, 16) != 200 {
+			t.Fatal("Wrong frame: ", f)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timeout waiting for frame")
+	}
+}
+
+func TestCanBusReplay(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	// Speed raw 200 = 0 rpm with the test database scale and offset
+	replayFile := filepath.Join(t.TempDir(), "can.log")
+	err = os.WriteFile(replayFile, []byte(
+		"(100.000000) can0 123#C800000000000000\n"+
+			"(100.010000) can0 456#00\n"), 0644)
+	if err != nil {
+		t.Fatal("Error writing replay file: ", err)
+	}
+
+	// the device does not exist, frames only come from the replay file
+	err = client.SendNodeType(nc, client.CanBus{
+		ID:         "ID-can",
+		Parent:     root.ID,
+		Device:     "none",
+		ReplayFile: replayFile,
+		KcdScale:   true,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending CAN node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.File{
+		ID: "ID-kcd", Parent: "ID-can", Name: "test.kcd", Data: canTestKcd,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending database: ", err)
+	}
+
+	// give the client time to start
+	time.Sleep(500 * time.Millisecond)
+
+	err = client.SendNodePoint(nc, "ID-can", data.Point{
+		Type: data.PointTypeReplay, Value: 1, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	start := time.Now()
+	for {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Timeout waiting for replay")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+
+		nodes, err := client.GetNodes(nc, root.ID, "ID-can", data.NodeTypeCanBus, false)
+		if err != nil || len(nodes) != 1 {
+			t.Fatal("Error getting CAN node: ", err)
+		}
+
+		pts := nodes[0].Points
+		if replay, _ := pts.ValueBool(data.PointTypeReplay, ""); replay {
+			continue
+		}
+
+		speed, ok := pts.Find(data.PointTypeValue, "Motor.Speed[rpm]")
+		if !ok || speed.Value != 0 {
+			t.Fatal("Wrong speed point: ", pts)
+		}
+
+		if v, _ := pts.Value(data.PointTypeMsgsRecvdOther, ""); v != 1 {
+			t.Fatal("Wrong other msgs count: ", v)
+		}
+
+		break
+	}
+}
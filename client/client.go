@@ -33,6 +33,15 @@ func DefaultClients(nc *nats.Conn) (*Group, error) {
 	cb := NewManager(nc, NewCanBusClient, nil)
 	g.Add(cb)
 
+	mb := NewManager(nc, NewModbusClient, nil)
+	g.Add(mb)
+
+	ow := NewManager(nc, NewOneWireClient, nil)
+	g.Add(ow)
+
+	mbc := NewManager(nc, NewMBusClient, nil)
+	g.Add(mbc)
+
 	rc := NewManager(nc, NewRuleClient, nil)
 	g.Add(rc)
 
@@ -57,6 +66,12 @@ func DefaultClients(nc *nats.Conn) (*Group, error) {
 	shellyIO := NewManager(nc, NewShellyIOClient, []string{data.NodeTypeShelly})
 	g.Add(shellyIO)
 
+	mqtt := NewManager(nc, NewMQTTClient, nil)
+	g.Add(mqtt)
+
+	ingest := NewManager(nc, NewIngestClient, nil)
+	g.Add(ingest)
+
 	ntp := NewManager(nc, NewNTPClient, nil)
 	g.Add(ntp)
 
@@ -129,7 +129,7 @@ func (dbc *DbClient) Run() error {
 		return fmt.Errorf("subscribing to %v: %w", subjectHR, err)
 	}
 
-	subjectHistory := fmt.Sprintf("history.%v", dbc.config.ID)
+	subjectHistory := SubjectHistory(dbc.config.ID)
 	dbc.historySub, err = dbc.nc.Subscribe(subjectHistory, func(msg *nats.Msg) {
 		query := new(data.HistoryQuery)
 		results := new(data.HistoryResults)
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// GetHistory sends a history query to a DB client node and returns the
+// results
+func GetHistory(nc *nats.Conn, dbID string, query data.HistoryQuery) (data.HistoryResults, error) {
+	var ret data.HistoryResults
+
+	req, err := json.Marshal(query)
+	if err != nil {
+		return ret, err
+	}
+
+	msg, err := nc.Request(SubjectHistory(dbID), req, 20*time.Second)
+	if err != nil {
+		return ret, err
+	}
+
+	err = json.Unmarshal(msg.Data, &ret)
+	if err != nil {
+		return ret, fmt.Errorf("error decoding history results: %w", err)
+	}
+
+	if ret.ErrorMessage != "" {
+		return ret, errors.New(ret.ErrorMessage)
+	}
+
+	return ret, nil
+}
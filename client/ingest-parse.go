@@ -0,0 +1,227 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IngestSample is one measurement received by the ingest API. It mirrors
+// an Influx line protocol line.
+type IngestSample struct {
+	Measurement string            `json:"measurement"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Fields      map[string]any    `json:"fields"`
+	Time        time.Time         `json:"time,omitempty"`
+}
+
+// ParseLineProtocol parses Influx line protocol. Precision is the timestamp
+// precision (ns, us, ms, s, or the Influx v1 n, u forms) and defaults to ns.
+// Samples without a timestamp are set to now.
+func ParseLineProtocol(in []byte, precision string) ([]IngestSample, error) {
+	var mult int64
+	switch precision {
+	case "", "ns", "n":
+		mult = 1
+	case "us", "u":
+		mult = int64(time.Microsecond)
+	case "ms":
+		mult = int64(time.Millisecond)
+	case "s":
+		mult = int64(time.Second)
+	default:
+		return nil, fmt.Errorf("invalid precision: %v", precision)
+	}
+
+	now := time.Now()
+	var ret []IngestSample
+
+	for i, line := range bytes.Split(in, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		s, err := parseLine(string(line), mult)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", i+1, err)
+		}
+
+		if s.Time.IsZero() {
+			s.Time = now
+		}
+
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+// splitUnescaped splits s at the first unescaped sep outside of double
+// quotes (if quotes is true). It returns the part before sep, and the rest
+// after sep.
+func splitUnescaped(s string, sep byte, quotes bool) (string, string, bool) {
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && s[i] == sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+var lineUnescaper = strings.NewReplacer(`\,`, `,`, `\=`, `=`, `\ `, ` `, `\"`, `"`, `\\`, `\`)
+
+func parseLine(line string, mult int64) (IngestSample, error) {
+	var ret IngestSample
+
+	series, rest, ok := splitUnescaped(line, ' ', false)
+	if !ok {
+		return ret, errors.New("missing fields")
+	}
+
+	fieldSet, timestamp, _ := splitUnescaped(rest, ' ', true)
+
+	// measurement and tags
+	m, tags, hasTags := splitUnescaped(series, ',', false)
+	ret.Measurement = lineUnescaper.Replace(m)
+	if ret.Measurement == "" {
+		return ret, errors.New("missing measurement")
+	}
+
+	for hasTags {
+		var tag string
+		tag, tags, hasTags = splitUnescaped(tags, ',', false)
+		k, v, ok := splitUnescaped(tag, '=', false)
+		if !ok || k == "" {
+			return ret, fmt.Errorf("invalid tag: %v", tag)
+		}
+		if ret.Tags == nil {
+			ret.Tags = make(map[string]string)
+		}
+		ret.Tags[lineUnescaper.Replace(k)] = lineUnescaper.Replace(v)
+	}
+
+	// fields
+	ret.Fields = make(map[string]any)
+	more := true
+	for more {
+		var field string
+		field, fieldSet, more = splitUnescaped(fieldSet, ',', true)
+		k, v, ok := splitUnescaped(field, '=', false)
+		if !ok || k == "" || v == "" {
+			return ret, fmt.Errorf("invalid field: %v", field)
+		}
+
+		fv, err := parseFieldValue(v)
+		if err != nil {
+			return ret, fmt.Errorf("field %v: %w", k, err)
+		}
+
+		ret.Fields[lineUnescaper.Replace(k)] = fv
+	}
+
+	timestamp = strings.TrimSpace(timestamp)
+	if timestamp != "" {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return ret, fmt.Errorf("invalid timestamp: %v", timestamp)
+		}
+		ret.Time = time.Unix(0, ts*mult)
+	}
+
+	return ret, nil
+}
+
+func parseFieldValue(v string) (any, error) {
+	if v[0] == '"' {
+		if len(v) < 2 || v[len(v)-1] != '"' {
+			return nil, fmt.Errorf("unterminated string: %v", v)
+		}
+		return lineUnescaper.Replace(v[1 : len(v)-1]), nil
+	}
+
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+
+	last := v[len(v)-1]
+	if last == 'i' || last == 'u' {
+		i, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer: %v", v)
+		}
+		return float64(i), nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %v", v)
+	}
+
+	return f, nil
+}
+
+// ParseIngestJSON parses the JSON ingest format, which is a sample or an
+// array of samples:
+//
+//	[{"measurement": "cpu", "tags": {"host": "a"}, "fields": {"usage": 12.5},
+//	  "time": "2024-01-02T15:04:05Z"}]
+//
+// Samples without a time are set to now.
+func ParseIngestJSON(in []byte) ([]IngestSample, error) {
+	in = bytes.TrimSpace(in)
+
+	var ret []IngestSample
+	var err error
+
+	if len(in) > 0 && in[0] == '{' {
+		var s IngestSample
+		err = json.Unmarshal(in, &s)
+		ret = []IngestSample{s}
+	} else {
+		err = json.Unmarshal(in, &ret)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	for i := range ret {
+		if ret[i].Measurement == "" {
+			return nil, fmt.Errorf("sample %v: missing measurement", i)
+		}
+
+		if len(ret[i].Fields) <= 0 {
+			return nil, fmt.Errorf("sample %v: missing fields", i)
+		}
+
+		for k, v := range ret[i].Fields {
+			switch v.(type) {
+			case float64, bool, string:
+			default:
+				return nil, fmt.Errorf("sample %v: field %v: invalid type", i, k)
+			}
+		}
+
+		if ret[i].Time.IsZero() {
+			ret[i].Time = now
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLineProtocol(t *testing.T) {
+	in := `# comment
+cpu,host=server\ 1,region=us-west usage_idle=92.5,cores=4i,ok=t 1700000000
+weather temp=21.5,station="north \"A\"",raining=false
+`
+
+	samples, err := ParseLineProtocol([]byte(in), "s")
+	if err != nil {
+		t.Fatal("Error parsing: ", err)
+	}
+
+	if len(samples) != 2 {
+		t.Fatal("Expected 2 samples, got: ", len(samples))
+	}
+
+	exp := IngestSample{
+		Measurement: "cpu",
+		Tags:        map[string]string{"host": "server 1", "region": "us-west"},
+		Fields:      map[string]any{"usage_idle": 92.5, "cores": 4.0, "ok": true},
+		Time:        time.Unix(1700000000, 0),
+	}
+
+	if !reflect.DeepEqual(samples[0], exp) {
+		t.Errorf("Wrong sample, got %+v, exp %+v", samples[0], exp)
+	}
+
+	expFields := map[string]any{"temp": 21.5, "station": `north "A"`, "raining": false}
+	if samples[1].Measurement != "weather" || samples[1].Tags != nil ||
+		!reflect.DeepEqual(samples[1].Fields, expFields) {
+		t.Errorf("Wrong sample: %+v", samples[1])
+	}
+
+	if time.Since(samples[1].Time) > time.Minute {
+		t.Error("Sample without timestamp should be set to now")
+	}
+
+	for _, bad := range []string{"cpu", "cpu usage=", "cpu usage=abc", "cpu,host usage=1",
+		`cpu name="abc`, "cpu usage=1 abc"} {
+		_, err := ParseLineProtocol([]byte(bad), "")
+		if err == nil {
+			t.Errorf("Expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestParseIngestJSON(t *testing.T) {
+	samples, err := ParseIngestJSON([]byte(
+		`{"measurement": "tank", "tags": {"site": "a"}, "fields": {"level": 12.5, "pump": true},
+		"time": "2024-01-02T15:04:05Z"}`))
+	if err != nil {
+		t.Fatal("Error parsing: ", err)
+	}
+
+	if len(samples) != 1 || samples[0].Fields["level"] != 12.5 ||
+		samples[0].Tags["site"] != "a" ||
+		!samples[0].Time.Equal(time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("Wrong samples: %+v", samples)
+	}
+
+	samples, err = ParseIngestJSON([]byte(
+		`[{"measurement": "a", "fields": {"v": 1}}, {"measurement": "b", "fields": {"v": "x"}}]`))
+	if err != nil {
+		t.Fatal("Error parsing: ", err)
+	}
+
+	if len(samples) != 2 || samples[1].Fields["v"] != "x" || samples[0].Time.IsZero() {
+		t.Errorf("Wrong samples: %+v", samples)
+	}
+
+	for _, bad := range []string{`{"fields": {"v": 1}}`, `{"measurement": "a"}`,
+		`{"measurement": "a", "fields": {"v": [1]}}`} {
+		_, err := ParseIngestJSON([]byte(bad))
+		if err == nil {
+			t.Errorf("Expected error parsing %q", bad)
+		}
+	}
+}
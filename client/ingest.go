@@ -0,0 +1,391 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Ingest describes the config for an ingest node. Devices that can't run
+// NATS push Influx line protocol or JSON samples to the HTTP ingest API
+// using the ingest node token. Samples are mapped to child nodes of the
+// ingest node, which are created as needed.
+type Ingest struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	Disabled    bool   `point:"disabled"`
+	// Token is hashed by the store and is never read back
+	Token     string `point:"token"`
+	TokenHash string `point:"tokenHash"`
+	// NodeType is the type of created nodes, defaults to variable
+	NodeType string `point:"nodeType"`
+	// NodeTemplate is a Go template that maps a sample to the description
+	// of a child node. .Measurement and .Tags are available. Defaults to
+	// {{.Measurement}}.
+	NodeTemplate string `point:"nodeTemplate"`
+	// NodeRules map measurement patterns (path.Match syntax) to node
+	// templates. Samples that don't match a rule use NodeTemplate.
+	NodeRules map[string]string `point:"nodeRule"`
+}
+
+type ingestRule struct {
+	pattern  string
+	template *template.Template
+}
+
+// IngestRequest is sent over NATS from the HTTP API to the ingest client
+type IngestRequest struct {
+	Token   string         `json:"token"`
+	Samples []IngestSample `json:"samples"`
+}
+
+// IngestResponse is returned by the ingest client
+type IngestResponse struct {
+	Error string `json:"error"`
+}
+
+// ErrIngestUnauthorized is returned if there is no ingest node for a token
+var ErrIngestUnauthorized = errors.New("unauthorized")
+
+// IngestSamples sends samples to the ingest node that owns token
+func IngestSamples(nc *nats.Conn, token string, samples []IngestSample) error {
+	if token == "" {
+		return ErrIngestUnauthorized
+	}
+
+	req, err := json.Marshal(IngestRequest{Token: token, Samples: samples})
+	if err != nil {
+		return err
+	}
+
+	msg, err := nc.Request(SubjectIngest(HashToken(token)), req, 20*time.Second)
+	if err != nil {
+		if errors.Is(err, nats.ErrNoResponders) {
+			return ErrIngestUnauthorized
+		}
+		return err
+	}
+
+	var resp IngestResponse
+	err = json.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return fmt.Errorf("error decoding ingest response: %w", err)
+	}
+
+	switch resp.Error {
+	case "":
+		return nil
+	case ErrIngestUnauthorized.Error():
+		return ErrIngestUnauthorized
+	default:
+		return errors.New(resp.Error)
+	}
+}
+
+type ingestMsg struct {
+	req   IngestRequest
+	reply chan error
+}
+
+// IngestClient maps samples received by the ingest API to nodes
+type IngestClient struct {
+	nc            *nats.Conn
+	config        Ingest
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	chIngest      chan ingestMsg
+	sub           *nats.Subscription
+	template      *template.Template
+	rules         []ingestRule
+}
+
+// NewIngestClient ...
+func NewIngestClient(nc *nats.Conn, config Ingest) Client {
+	return &IngestClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		chIngest:      make(chan ingestMsg),
+	}
+}
+
+func (ic *IngestClient) subscribe() {
+	if ic.sub != nil {
+		_ = ic.sub.Unsubscribe()
+		ic.sub = nil
+	}
+
+	nodeTemplate := ic.config.NodeTemplate
+	if nodeTemplate == "" {
+		nodeTemplate = "{{.Measurement}}"
+	}
+
+	var err error
+	ic.template, err = template.New("node").Parse(nodeTemplate)
+	if err != nil {
+		log.Printf("Ingest %v: error parsing node template: %v\n",
+			ic.config.Description, err)
+		return
+	}
+
+	ic.rules = nil
+	for pattern, t := range ic.config.NodeRules {
+		if _, err := path.Match(pattern, ""); err != nil {
+			log.Printf("Ingest %v: invalid rule pattern %v: %v\n",
+				ic.config.Description, pattern, err)
+			continue
+		}
+
+		tmpl, err := template.New("node").Parse(t)
+		if err != nil {
+			log.Printf("Ingest %v: error parsing template for rule %v: %v\n",
+				ic.config.Description, pattern, err)
+			continue
+		}
+
+		ic.rules = append(ic.rules, ingestRule{pattern, tmpl})
+	}
+
+	// longer patterns are usually more specific, so they are tried first
+	sort.Slice(ic.rules, func(i, j int) bool {
+		a, b := ic.rules[i].pattern, ic.rules[j].pattern
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+
+	if ic.config.Disabled || ic.config.TokenHash == "" {
+		return
+	}
+
+	ic.sub, err = ic.nc.Subscribe(SubjectIngest(ic.config.TokenHash), func(msg *nats.Msg) {
+		var resp IngestResponse
+		var req IngestRequest
+
+		err := json.Unmarshal(msg.Data, &req)
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			reply := make(chan error)
+			select {
+			case ic.chIngest <- ingestMsg{req, reply}:
+				err = <-reply
+			case <-ic.stop:
+				err = errors.New("ingest client stopped")
+			}
+			if err != nil {
+				resp.Error = err.Error()
+			}
+		}
+
+		out, err := json.Marshal(resp)
+		if err != nil {
+			log.Println("Ingest: error encoding response:", err)
+		}
+
+		err = msg.Respond(out)
+		if err != nil {
+			log.Println("Ingest: error responding:", err)
+		}
+	})
+
+	if err != nil {
+		log.Println("Ingest: error subscribing:", err)
+	}
+}
+
+func (ic *IngestClient) ingest(req IngestRequest) error {
+	if !CheckTokenHash(ic.config.TokenHash, req.Token) {
+		return ErrIngestUnauthorized
+	}
+
+	if ic.template == nil {
+		return errors.New("invalid node template")
+	}
+
+	// fetch the children on every request so we pick up nodes that were
+	// renamed or deleted by the user
+	children, err := GetNodes(ic.nc, ic.config.ID, "all", "", false)
+	if err != nil {
+		return err
+	}
+
+	nodes := make(map[string]string)
+	for _, c := range children {
+		nodes[c.Desc()] = c.ID
+	}
+
+	points := make(map[string]data.Points)
+
+	for _, s := range req.Samples {
+		var desc bytes.Buffer
+		err := ic.nodeTemplate(s.Measurement).Execute(&desc, s)
+		if err != nil {
+			return fmt.Errorf("error executing node template: %w", err)
+		}
+
+		id, ok := nodes[desc.String()]
+		if !ok {
+			id, err = ic.createNode(desc.String(), s)
+			if err != nil {
+				return err
+			}
+			nodes[desc.String()] = id
+		}
+
+		for k, v := range s.Fields {
+			// field names come from devices, so they are only used as
+			// keys. Otherwise a device could set any point type,
+			// including types that configure the node.
+			p := data.Point{Time: s.Time, Type: data.PointTypeValue, Key: k}
+			if k == data.PointTypeValue {
+				p.Key = "0"
+			}
+			switch vt := v.(type) {
+			case float64:
+				p.Value = vt
+			case bool:
+				p.Value = data.BoolToFloat(vt)
+			case string:
+				p.Text = vt
+			}
+			points[id] = append(points[id], p)
+		}
+	}
+
+	for id, pts := range points {
+		err := SendNodePoints(ic.nc, id, pts, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nodeTemplate returns the template of the first rule that matches
+// measurement, or the node template
+func (ic *IngestClient) nodeTemplate(measurement string) *template.Template {
+	for _, r := range ic.rules {
+		if ok, _ := path.Match(r.pattern, measurement); ok {
+			return r.template
+		}
+	}
+	return ic.template
+}
+
+func (ic *IngestClient) createNode(desc string, s IngestSample) (string, error) {
+	typ := ic.config.NodeType
+	if typ == "" {
+		typ = data.NodeTypeVariable
+	}
+
+	node := data.NodeEdge{
+		ID:     uuid.New().String(),
+		Type:   typ,
+		Parent: ic.config.ID,
+		Points: data.Points{
+			{Time: s.Time, Type: data.PointTypeDescription, Key: "0", Text: desc},
+		},
+	}
+
+	for k, v := range s.Tags {
+		node.Points = append(node.Points, data.Point{
+			Time: s.Time, Type: data.PointTypeTag, Key: k, Text: v})
+	}
+
+	err := SendNode(ic.nc, node, ic.config.ID)
+	if err != nil {
+		return "", fmt.Errorf("error creating node: %w", err)
+	}
+
+	return node.ID, nil
+}
+
+// Run the main logic for this client and blocks until stopped
+func (ic *IngestClient) Run() error {
+	ic.subscribe()
+
+done:
+	for {
+		select {
+		case <-ic.stop:
+			break done
+
+		case pts := <-ic.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &ic.config)
+			if err != nil {
+				log.Println("error merging new points:", err)
+			}
+
+			resubscribe := false
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeToken:
+					// clients see the token before the store
+					// replaces it with a hash
+					ic.config.Token = ""
+					ic.config.TokenHash = ""
+					if p.Text != "" {
+						ic.config.TokenHash = HashToken(p.Text)
+					}
+					resubscribe = true
+				case data.PointTypeTokenHash, data.PointTypeDisabled,
+					data.PointTypeNodeTemplate, data.PointTypeNodeRule:
+					resubscribe = true
+				}
+			}
+
+			if resubscribe {
+				ic.subscribe()
+			}
+
+		case pts := <-ic.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &ic.config)
+			if err != nil {
+				log.Println("error merging new points:", err)
+			}
+
+		case msg := <-ic.chIngest:
+			msg.reply <- ic.ingest(msg.req)
+		}
+	}
+
+	if ic.sub != nil {
+		_ = ic.sub.Unsubscribe()
+	}
+
+	return nil
+}
+
+// Stop sends a signal to the Run function to exit
+func (ic *IngestClient) Stop(_ error) {
+	close(ic.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (ic *IngestClient) Points(nodeID string, points []data.Point) {
+	ic.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (ic *IngestClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	ic.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,311 @@
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+	"go.einride.tech/can"
+)
+
+// J1939 parameter group numbers (PGNs) handled by the CAN bus client
+const (
+	j1939PgnTpCm = 0xec00 // transport protocol connection management
+	j1939PgnTpDt = 0xeb00 // transport protocol data transfer
+	j1939PgnDm1  = 0xfeca // active diagnostic trouble codes
+	j1939PgnVin  = 0xfeec // vehicle identification
+)
+
+// J1939 transport protocol control bytes
+const (
+	j1939TpRts   = 16
+	j1939TpCts   = 17
+	j1939TpEoma  = 19
+	j1939TpBam   = 32
+	j1939TpAbort = 255
+)
+
+// j1939TpTimeout is the maximum time between transport protocol packets (T1
+// and T2 in J1939-21)
+const j1939TpTimeout = 1250 * time.Millisecond
+
+// j1939PGN returns the PGN of a 29-bit J1939 ID. The destination address is
+// removed for PDU1 (peer to peer) PGNs.
+func j1939PGN(id uint32) uint32 {
+	pgn := (id >> 8) & 0x3ffff
+	if (pgn>>8)&0xff < 240 {
+		pgn &^= 0xff
+	}
+	return pgn
+}
+
+// j1939SA returns the source address of a 29-bit J1939 ID
+func j1939SA(id uint32) uint8 {
+	return uint8(id)
+}
+
+// j1939DA returns the destination address of a 29-bit J1939 ID. PDU2
+// (broadcast) PGNs return the global address.
+func j1939DA(id uint32) uint8 {
+	if (id>>16)&0xff < 240 {
+		return uint8(id >> 8)
+	}
+	return 0xff
+}
+
+// j1939Message is a J1939 message that is received in a single frame or
+// reassembled from transport protocol packets
+type j1939Message struct {
+	PGN     uint32
+	SA      uint8
+	Payload []byte
+}
+
+type j1939Session struct {
+	pgn      uint32
+	size     int
+	packets  int
+	payload  []byte
+	received []bool
+	count    int
+	last     time.Time
+}
+
+// j1939Dtc is a diagnostic trouble code from a DM1 message
+type j1939Dtc struct {
+	SPN uint32
+	FMI uint8
+	OC  uint8
+}
+
+// j1939Lamps are the DM1 lamp names in the order they are in the first byte
+var j1939Lamps = []string{"mil", "rsl", "awl", "pl"}
+
+// j1939Decoder decodes J1939 messages. Messages are matched to the database
+// by PGN, transport protocol (BAM and RTS/CTS) messages are reassembled,
+// and active DTCs from DM1 messages are tracked per source address.
+//
+// The decoder only listens, so it does not send CTS for RTS/CTS sessions.
+// Sessions between other nodes are reassembled as the packets are seen.
+type j1939Decoder struct {
+	sessions map[uint16]*j1939Session
+	// active DTC point keys for each source address
+	active map[uint8]map[string]bool
+}
+
+func newJ1939Decoder() *j1939Decoder {
+	return &j1939Decoder{
+		sessions: make(map[uint16]*j1939Session),
+		active:   make(map[uint8]map[string]bool),
+	}
+}
+
+// decode returns points for a frame. ok is false if the frame is not known.
+func (j *j1939Decoder) decode(db *canDatabase, frame can.Frame) (data.Points, bool) {
+	length := frame.Length
+	if length > can.MaxDataLength {
+		length = can.MaxDataLength
+	}
+
+	msg := j1939Message{
+		PGN:     j1939PGN(frame.ID),
+		SA:      j1939SA(frame.ID),
+		Payload: frame.Data[:length],
+	}
+
+	if msg.PGN == j1939PgnTpCm || msg.PGN == j1939PgnTpDt {
+		tpMsg, ok := j.transport(frame)
+		if !ok {
+			// packets are part of a message that is not complete yet
+			return nil, true
+		}
+		msg = tpMsg
+	}
+
+	return j.points(db, msg)
+}
+
+// transport handles transport protocol frames and returns the message when
+// all packets are received
+func (j *j1939Decoder) transport(frame can.Frame) (j1939Message, bool) {
+	sa := j1939SA(frame.ID)
+	da := j1939DA(frame.ID)
+	key := uint16(sa)<<8 | uint16(da)
+	d := frame.Data
+
+	if j1939PGN(frame.ID) == j1939PgnTpCm {
+		switch d[0] {
+		case j1939TpBam, j1939TpRts:
+			size := int(binary.LittleEndian.Uint16(d[1:3]))
+			packets := int(d[3])
+			if size < 9 || size > 1785 || packets != (size+6)/7 {
+				delete(j.sessions, key)
+				return j1939Message{}, false
+			}
+			j.sessions[key] = &j1939Session{
+				pgn:      uint32(d[5]) | uint32(d[6])<<8 | uint32(d[7])<<16,
+				size:     size,
+				packets:  packets,
+				payload:  make([]byte, packets*7),
+				received: make([]bool, packets),
+				last:     time.Now(),
+			}
+		case j1939TpCts:
+			// CTS is sent by the receiver, so the session is keyed by the
+			// reverse direction
+			if s, ok := j.sessions[uint16(da)<<8|uint16(sa)]; ok {
+				s.last = time.Now()
+			}
+		case j1939TpEoma:
+			delete(j.sessions, uint16(da)<<8|uint16(sa))
+		case j1939TpAbort:
+			delete(j.sessions, key)
+			delete(j.sessions, uint16(da)<<8|uint16(sa))
+		}
+		return j1939Message{}, false
+	}
+
+	s, ok := j.sessions[key]
+	if !ok {
+		return j1939Message{}, false
+	}
+
+	if time.Since(s.last) > j1939TpTimeout {
+		delete(j.sessions, key)
+		return j1939Message{}, false
+	}
+
+	seq := int(d[0])
+	if seq < 1 || seq > s.packets {
+		return j1939Message{}, false
+	}
+
+	s.last = time.Now()
+	copy(s.payload[(seq-1)*7:seq*7], d[1:])
+	if !s.received[seq-1] {
+		s.received[seq-1] = true
+		s.count++
+	}
+
+	if s.count < s.packets {
+		return j1939Message{}, false
+	}
+
+	delete(j.sessions, key)
+
+	return j1939Message{
+		PGN:     s.pgn,
+		SA:      sa,
+		Payload: s.payload[:s.size],
+	}, true
+}
+
+// points returns the points for a complete message
+func (j *j1939Decoder) points(db *canDatabase, msg j1939Message) (data.Points, bool) {
+	var ret data.Points
+	known := false
+
+	switch msg.PGN {
+	case j1939PgnDm1:
+		ret = append(ret, j.dm1(msg)...)
+		known = true
+	case j1939PgnVin:
+		vin, _, _ := strings.Cut(string(msg.Payload), "*")
+		ret = append(ret, data.Point{
+			Time: time.Now(),
+			Type: data.PointTypeVIN,
+			Key:  strconv.Itoa(int(msg.SA)),
+			Text: strings.TrimSpace(vin),
+		})
+		known = true
+	}
+
+	if m, ok := db.messageForPGN(msg.PGN); ok {
+		ret = append(ret, m.decodePayload(msg.Payload)...)
+		known = true
+	}
+
+	return ret, known
+}
+
+// dm1 returns lamp and DTC points for a DM1 message. DTC point keys are
+// <source address>.<SPN>.<FMI> and the value is the occurrence count. DTCs
+// that are no longer active are deleted.
+func (j *j1939Decoder) dm1(msg j1939Message) data.Points {
+	now := time.Now()
+	sa := strconv.Itoa(int(msg.SA))
+	lamps, dtcs := j1939ParseDM1(msg.Payload)
+
+	var ret data.Points
+
+	for i, name := range j1939Lamps {
+		ret = append(ret, data.Point{
+			Time:  now,
+			Type:  data.PointTypeLamp,
+			Key:   sa + "." + name,
+			Value: float64(lamps[i]),
+		})
+	}
+
+	active := make(map[string]bool)
+	for _, dtc := range dtcs {
+		key := fmt.Sprintf("%v.%v.%v", sa, dtc.SPN, dtc.FMI)
+		active[key] = true
+		ret = append(ret, data.Point{
+			Time:  now,
+			Type:  data.PointTypeDtc,
+			Key:   key,
+			Value: float64(dtc.OC),
+		})
+	}
+
+	for key := range j.active[msg.SA] {
+		if !active[key] {
+			ret = append(ret, data.Point{
+				Time:      now,
+				Type:      data.PointTypeDtc,
+				Key:       key,
+				Tombstone: 1,
+			})
+		}
+	}
+
+	j.active[msg.SA] = active
+
+	return ret
+}
+
+// j1939ParseDM1 returns the lamp status (MIL, RSL, AWL, PL) and active DTCs
+// in a DM1 payload
+func j1939ParseDM1(payload []byte) ([4]uint8, []j1939Dtc) {
+	var lamps [4]uint8
+	var dtcs []j1939Dtc
+
+	if len(payload) < 2 {
+		return lamps, nil
+	}
+
+	for i := range lamps {
+		lamps[i] = (payload[0] >> (6 - 2*i)) & 0x3
+	}
+
+	for i := 2; i+4 <= len(payload); i += 4 {
+		b := payload[i : i+4]
+		dtc := j1939Dtc{
+			SPN: uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2]&0xe0)<<11,
+			FMI: b[2] & 0x1f,
+			OC:  b[3] & 0x7f,
+		}
+		// SPN 0 is sent when there are no active DTCs, and unused bytes
+		// are 0xff
+		if dtc.SPN == 0 || dtc.SPN == 0x7ffff {
+			continue
+		}
+		dtcs = append(dtcs, dtc)
+	}
+
+	return lamps, dtcs
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+	"go.einride.tech/can"
+)
+
+var testJ1939Dbc = `VERSION ""
+
+NS_ :
+
+BS_:
+
+BU_: ECU
+
+BO_ 2566844158 ET1: 8 ECU
+ SG_ EngCoolantTemp : 0|8@1+ (1,-40) [-40|210] "degC" ECU
+
+BO_ 2566848254 Big: 12 ECU
+ SG_ Last : 80|16@1+ (1,0) [0|65535] "" ECU
+`
+
+func TestJ1939PGN(t *testing.T) {
+	tests := []struct {
+		id  uint32
+		pgn uint32
+		sa  uint8
+		da  uint8
+	}{
+		{0x18feee00, 0xfeee, 0x00, 0xff},
+		{0x0cfeee17, 0xfeee, 0x17, 0xff},
+		{0x18ec0017, 0xec00, 0x17, 0x00},
+		{0x18eaff03, 0xea00, 0x03, 0xff},
+	}
+
+	for _, test := range tests {
+		if pgn := j1939PGN(test.id); pgn != test.pgn {
+			t.Errorf("%x: pgn %x, expected %x", test.id, pgn, test.pgn)
+		}
+		if sa := j1939SA(test.id); sa != test.sa {
+			t.Errorf("%x: sa %x, expected %x", test.id, sa, test.sa)
+		}
+		if da := j1939DA(test.id); da != test.da {
+			t.Errorf("%x: da %x, expected %x", test.id, da, test.da)
+		}
+	}
+}
+
+func testJ1939Frame(id uint32, d ...byte) can.Frame {
+	f := can.Frame{ID: id, Length: 8, IsExtended: true}
+	for i := range f.Data {
+		f.Data[i] = 0xff
+	}
+	copy(f.Data[:], d)
+	return f
+}
+
+// testJ1939Bam returns the frames for a BAM transfer
+func testJ1939Bam(sa uint8, pgn uint32, payload []byte) []can.Frame {
+	packets := (len(payload) + 6) / 7
+	ret := []can.Frame{testJ1939Frame(0x18ecff00|uint32(sa), j1939TpBam,
+		byte(len(payload)), byte(len(payload)>>8), byte(packets), 0xff,
+		byte(pgn), byte(pgn>>8), byte(pgn>>16))}
+
+	for i := 0; i < packets; i++ {
+		end := (i + 1) * 7
+		if end > len(payload) {
+			end = len(payload)
+		}
+		d := append([]byte{byte(i + 1)}, payload[i*7:end]...)
+		ret = append(ret, testJ1939Frame(0x18ebff00|uint32(sa), d...))
+	}
+
+	return ret
+}
+
+func TestJ1939Decode(t *testing.T) {
+	db := &canDatabase{}
+	err := db.read("j1939.dbc", []byte(testJ1939Dbc))
+	if err != nil {
+		t.Fatal("Error reading database: ", err)
+	}
+
+	j := newJ1939Decoder()
+
+	// PGNs match regardless of priority and source address
+	pts, ok := j.decode(db, testJ1939Frame(0x0cfeee17, 130))
+	if !ok || len(pts) != 1 || pts[0].Key != "ET1.EngCoolantTemp[degC]" || pts[0].Value != 90 {
+		t.Fatal("Wrong ET1 points: ", pts)
+	}
+
+	_, ok = j.decode(db, testJ1939Frame(0x18fef100))
+	if ok {
+		t.Error("Unknown PGN decoded")
+	}
+
+	// DM1 with two DTCs sent with BAM
+	dm1 := []byte{
+		0x05, 0xff, // AWL and PL on
+		0x6e, 0x00, 0x00, 0x02, // SPN 110, FMI 0, OC 2
+		0x64, 0x00, 0x01, 0x01, // SPN 100, FMI 1, OC 1
+	}
+
+	frames := testJ1939Bam(0x03, j1939PgnDm1, dm1)
+	for i, f := range frames {
+		pts, ok = j.decode(db, f)
+		if !ok {
+			t.Fatal("TP frame not known")
+		}
+		if i < len(frames)-1 && len(pts) != 0 {
+			t.Fatal("Points before the message is complete: ", pts)
+		}
+	}
+
+	dtcs := make(map[string]float64)
+	for _, p := range pts {
+		switch p.Type {
+		case data.PointTypeDtc:
+			dtcs[p.Key] = p.Value
+		case data.PointTypeLamp:
+			on := p.Key == "3.awl" || p.Key == "3.pl"
+			if (p.Value == 1) != on {
+				t.Error("Wrong lamp: ", p)
+			}
+		}
+	}
+
+	if len(dtcs) != 2 || dtcs["3.110.0"] != 2 || dtcs["3.100.1"] != 1 {
+		t.Fatal("Wrong DTCs: ", pts)
+	}
+
+	// single frame DM1 clears one DTC
+	pts, _ = j.decode(db, testJ1939Frame(0x18feca03, 0x00, 0xff, 0x6e, 0x00, 0x00, 0x03))
+	for _, p := range pts {
+		if p.Type != data.PointTypeDtc {
+			continue
+		}
+		switch {
+		case p.Key == "3.110.0" && p.Tombstone == 0 && p.Value == 3:
+		case p.Key == "3.100.1" && p.Tombstone == 1:
+		default:
+			t.Error("Wrong DTC point: ", p)
+		}
+	}
+
+	// VIN sent with RTS/CTS from 0x00 to 0xf9
+	vin := []byte("1M8GDM9AXKP042788*")
+	frames = testJ1939Bam(0x00, j1939PgnVin, vin)
+	frames[0].ID = 0x18ecf900
+	frames[0].Data[0] = j1939TpRts
+	for i := range frames[1:] {
+		frames[i+1].ID = 0x18ebf900
+	}
+
+	cts := testJ1939Frame(0x18ec00f9, j1939TpCts, 3, 1, 0xff, 0xff, 0xec, 0xfe, 0x00)
+	frames = append(frames[:1], append([]can.Frame{cts}, frames[1:]...)...)
+
+	for _, f := range frames {
+		pts, _ = j.decode(db, f)
+	}
+
+	if len(pts) != 1 || pts[0].Type != data.PointTypeVIN || pts[0].Key != "0" ||
+		pts[0].Text != "1M8GDM9AXKP042788" {
+		t.Fatal("Wrong VIN: ", pts)
+	}
+
+	// signals past the first 8 bytes of a transport message
+	big := make([]byte, 12)
+	big[10], big[11] = 0x34, 0x12
+	for _, f := range testJ1939Bam(0x05, 0xfefe, big) {
+		pts, _ = j.decode(db, f)
+	}
+
+	if len(pts) != 1 || pts[0].Key != "Big.Last[]" || pts[0].Value != 0x1234 {
+		t.Fatal("Wrong transport message signal: ", pts)
+	}
+
+	// aborted sessions are dropped
+	frames = testJ1939Bam(0x05, 0xfefe, big)
+	abort := testJ1939Frame(0x18ecff05, j1939TpAbort)
+	frames = append(frames[:2], append([]can.Frame{abort}, frames[2:]...)...)
+	for _, f := range frames {
+		pts, _ = j.decode(db, f)
+		if len(pts) != 0 {
+			t.Fatal("Aborted message decoded: ", pts)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/mbus"
+	"github.com/simpleiot/simpleiot/respreader"
+	"go.bug.st/serial"
+)
+
+// MBus describes a wired M-Bus (EN 13757) master on a serial port. Baud
+// defaults to 2400 and meters are read every PollPeriod ms (defaults to
+// 60s). Setting Scan probes all primary addresses and creates meter nodes
+// for the meters that respond.
+type MBus struct {
+	ID              string      `node:"id"`
+	Parent          string      `node:"parent"`
+	Description     string      `point:"description"`
+	Port            string      `point:"port"`
+	Baud            string      `point:"baud"`
+	PollPeriod      int         `point:"pollPeriod"`
+	Debug           int         `point:"debug"`
+	Disabled        bool        `point:"disabled"`
+	Scan            bool        `point:"scan"`
+	ErrorCount      int         `point:"errorCount"`
+	ErrorCountReset bool        `point:"errorCountReset"`
+	Meters          []MBusMeter `child:"mbusMeter"`
+}
+
+// MBusMeter describes a meter at a primary address. Each data record the
+// meter sends is written to a point with the record quantity as the type
+// (ex: energy, volume, flowTemp). The current value has a key of "0",
+// other records are keyed by storage, tariff, subunit, and function (ex:
+// s1, t2, max). The units of each quantity are written to units points
+// keyed by quantity. MeterID, Manufacturer, Medium, and Version are
+// read from the meter.
+type MBusMeter struct {
+	ID              string `node:"id"`
+	Parent          string `node:"parent"`
+	Description     string `point:"description"`
+	Address         int    `point:"address"`
+	Disabled        bool   `point:"disabled"`
+	MeterID         string `point:"id"`
+	Manufacturer    string `point:"manufacturer"`
+	Medium          string `point:"medium"`
+	Version         int    `point:"version"`
+	ErrorCount      int    `point:"errorCount"`
+	ErrorCountReset bool   `point:"errorCountReset"`
+}
+
+// MBusClient is a SIOT client that reads M-Bus meters
+type MBusClient struct {
+	nc            *nats.Conn
+	config        MBus
+	port          serial.Port
+	master        *mbus.Master
+	scanDone      chan []byte
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+}
+
+// NewMBusClient returns a new MBusClient with a NATS connection and a config
+func NewMBusClient(nc *nats.Conn, config MBus) Client {
+	return &MBusClient{
+		nc:            nc,
+		config:        config,
+		scanDone:      make(chan []byte),
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+	}
+}
+
+// Stop sends a signal to the Run function to exit
+func (mc *MBusClient) Stop(_ error) {
+	close(mc.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (mc *MBusClient) Points(nodeID string, points []data.Point) {
+	mc.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (mc *MBusClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	mc.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
+
+func (mc *MBusClient) closePort() {
+	if mc.port != nil {
+		err := mc.port.Close()
+		if err != nil {
+			log.Println("M-Bus: error closing port:", err)
+		}
+		mc.port = nil
+		mc.master = nil
+	}
+}
+
+// openPort opens the serial port. M-Bus uses 8 data bits with even parity.
+func (mc *MBusClient) openPort() error {
+	mc.closePort()
+
+	if mc.config.Port == "" {
+		return errors.New("port not set")
+	}
+
+	baud := 2400
+	if mc.config.Baud != "" {
+		var err error
+		baud, err = strconv.Atoi(mc.config.Baud)
+		if err != nil || baud <= 0 {
+			return fmt.Errorf("invalid baud: %v", mc.config.Baud)
+		}
+	}
+
+	var err error
+	mc.port, err = serial.Open(mc.config.Port, &serial.Mode{
+		BaudRate: baud,
+		DataBits: 8,
+		Parity:   serial.EvenParity,
+		StopBits: serial.OneStopBit,
+	})
+	if err != nil {
+		mc.port = nil
+		return fmt.Errorf("error opening serial port: %w", err)
+	}
+
+	// meters must start responding within 330 bit times + 50ms and
+	// characters must not be more than a few character times apart
+	bit := time.Second / time.Duration(baud)
+	port := respreader.NewReadWriteCloser(mc.port, 2*(330*bit+50*time.Millisecond),
+		50*bit+10*time.Millisecond)
+	mc.master = mbus.NewMaster(port, mc.config.Debug)
+
+	return nil
+}
+
+// Run the main logic for the bus and blocks until stopped
+func (mc *MBusClient) Run() error {
+	log.Println("Starting M-Bus client:", mc.config.Description)
+
+	pollTicker := time.NewTicker(24 * time.Hour)
+	defer pollTicker.Stop()
+
+	setPollTicker := func() {
+		pollPeriod := mc.config.PollPeriod
+		if pollPeriod <= 0 {
+			pollPeriod = 60000
+		}
+		pollTicker.Reset(time.Millisecond * time.Duration(pollPeriod))
+	}
+
+	setPollTicker()
+
+	// info points are sent on the first successful read of each meter
+	infoSent := make(map[string]bool)
+	scanning := false
+
+	openPort := func() bool {
+		if mc.master != nil {
+			return true
+		}
+		err := mc.openPort()
+		if err != nil {
+			log.Println("M-Bus:", err)
+			return false
+		}
+		return true
+	}
+
+	// scan runs in a goroutine as it takes minutes at low baud rates. Meters
+	// are not polled during a scan.
+	scan := func() {
+		if scanning || mc.config.Disabled || !openPort() {
+			return
+		}
+		scanning = true
+		log.Println("M-Bus: scanning bus:", mc.config.Description)
+		go func(m *mbus.Master) {
+			found, err := m.Scan(0, mbus.AddressMax, func(a byte) {
+				log.Println("M-Bus: found meter at address", a)
+			})
+			if err != nil {
+				log.Println("M-Bus: scan error:", err)
+			}
+			mc.scanDone <- found
+		}(mc.master)
+	}
+
+	if mc.config.Scan {
+		scan()
+	}
+
+	for {
+		select {
+		case <-mc.stop:
+			log.Println("Stopping M-Bus client:", mc.config.Description)
+			// closing the port ends a scan that is running
+			mc.closePort()
+			if scanning {
+				<-mc.scanDone
+			}
+			return nil
+
+		case pts := <-mc.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &mc.config)
+			if err != nil {
+				log.Println("M-Bus: error merging new points:", err)
+			}
+
+			if pts.ID == mc.config.ID {
+				for _, p := range pts.Points {
+					switch p.Type {
+					case data.PointTypePort, data.PointTypeBaud:
+						// the port is opened again on the next poll
+						mc.closePort()
+					case data.PointTypeDebug:
+						if mc.master != nil {
+							mc.master.SetDebugLevel(mc.config.Debug)
+						}
+					case data.PointTypePollPeriod:
+						setPollTicker()
+					case data.PointTypeScan:
+						if mc.config.Scan {
+							scan()
+						}
+					case data.PointTypeErrorCountReset:
+						if mc.config.ErrorCountReset {
+							mc.config.ErrorCount = 0
+							mc.config.ErrorCountReset = false
+							mc.resetErrorCount(mc.config.ID)
+						}
+					}
+				}
+				continue
+			}
+
+			m := mc.meter(pts.ID)
+			if m == nil {
+				continue
+			}
+
+			for _, p := range pts.Points {
+				if p.Type == data.PointTypeErrorCountReset && m.ErrorCountReset {
+					m.ErrorCount = 0
+					m.ErrorCountReset = false
+					mc.resetErrorCount(m.ID)
+				}
+			}
+
+		case <-mc.newEdgePoints:
+			// edge points are not used
+
+		case found := <-mc.scanDone:
+			scanning = false
+			// clear scan before adding meters as new nodes restart the
+			// client
+			mc.config.Scan = false
+			err := SendNodePoint(mc.nc, mc.config.ID, data.Point{
+				Type: data.PointTypeScan, Value: 0}, true)
+			if err != nil {
+				log.Println("M-Bus: error clearing scan:", err)
+			}
+			mc.addMeters(found)
+
+		case <-pollTicker.C:
+			if mc.config.Disabled || scanning || !openPort() {
+				continue
+			}
+
+			for i := range mc.config.Meters {
+				m := &mc.config.Meters[i]
+				if m.Disabled {
+					continue
+				}
+
+				err := mc.read(m, !infoSent[m.ID])
+				if err == nil {
+					infoSent[m.ID] = true
+					continue
+				}
+
+				if mc.config.Debug > 0 {
+					log.Printf("M-Bus: error reading meter %v: %v\n", m.Address, err)
+				}
+
+				mc.config.ErrorCount++
+				m.ErrorCount++
+				for id, count := range map[string]int{
+					mc.config.ID: mc.config.ErrorCount,
+					m.ID:         m.ErrorCount,
+				} {
+					err = SendNodePoint(mc.nc, id, data.Point{
+						Type:  data.PointTypeErrorCount,
+						Value: float64(count),
+					}, false)
+					if err != nil {
+						log.Println("M-Bus: error sending point:", err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (mc *MBusClient) meter(id string) *MBusMeter {
+	for i := range mc.config.Meters {
+		if mc.config.Meters[i].ID == id {
+			return &mc.config.Meters[i]
+		}
+	}
+	return nil
+}
+
+func (mc *MBusClient) resetErrorCount(id string) {
+	err := SendNodePoints(mc.nc, id, data.Points{
+		{Type: data.PointTypeErrorCount, Value: 0},
+		{Type: data.PointTypeErrorCountReset, Value: 0},
+	}, true)
+	if err != nil {
+		log.Println("M-Bus: send point error:", err)
+	}
+}
+
+// addMeters creates nodes for meters found in a scan that are not already
+// configured
+func (mc *MBusClient) addMeters(addresses []byte) {
+	for _, a := range addresses {
+		found := false
+		for _, m := range mc.config.Meters {
+			if m.Address == int(a) {
+				found = true
+				break
+			}
+		}
+
+		if found {
+			continue
+		}
+
+		log.Println("M-Bus: adding meter:", a)
+
+		n := data.NodeEdge{
+			Type:   data.NodeTypeMBusMeter,
+			Parent: mc.config.ID,
+			Points: data.Points{
+				{Type: data.PointTypeAddress, Value: float64(a)},
+				{Type: data.PointTypeDescription, Text: "New meter, please edit"},
+			},
+		}
+
+		err := SendNode(mc.nc, n, "")
+		if err != nil {
+			log.Println("M-Bus: error sending new meter:", err)
+		}
+	}
+}
+
+// read reads a meter and sends the records as points. If info is set, the
+// meter info and units are also sent.
+func (mc *MBusClient) read(m *MBusMeter, info bool) error {
+	r, err := mc.master.ReadData(byte(m.Address))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	pts := mbusRecordPoints(r.Records, now)
+
+	if info {
+		pts = append(pts,
+			data.Point{Time: now, Type: data.PointTypeID,
+				Text: strconv.FormatUint(uint64(r.ID), 10)},
+			data.Point{Time: now, Type: data.PointTypeManufacturer, Text: r.Manufacturer},
+			data.Point{Time: now, Type: data.PointTypeMedium, Text: r.Medium.String()},
+			data.Point{Time: now, Type: data.PointTypeVersion, Value: float64(r.Version)},
+		)
+
+		units := make(map[string]bool)
+		for _, rec := range r.Records {
+			u := mbus.Units(rec.Quantity)
+			if u == "" || units[rec.Quantity] {
+				continue
+			}
+			units[rec.Quantity] = true
+			pts = append(pts, data.Point{Time: now, Type: data.PointTypeUnits,
+				Key: rec.Quantity, Text: u})
+		}
+	}
+
+	if mc.config.Debug >= 2 {
+		log.Printf("M-Bus: meter %v: %v\n", m.Address, pts)
+	}
+
+	return SendNodePoints(mc.nc, m.ID, pts, false)
+}
+
+// mbusRecordPoints converts data records to points. Records that have the
+// same quantity and key (ex: several storage 0 volume records from a
+// meter with two water inputs) are numbered in the order they are received.
+func mbusRecordPoints(records []mbus.Record, t time.Time) data.Points {
+	ret := make(data.Points, 0, len(records))
+	count := make(map[string]int)
+
+	for _, rec := range records {
+		key := rec.Key()
+		id := rec.Quantity + ":" + key
+		if n := count[id]; n > 0 {
+			key += "." + strconv.Itoa(n)
+		}
+		count[id]++
+
+		ret = append(ret, data.Point{
+			Time:  t,
+			Type:  rec.Quantity,
+			Key:   key,
+			Value: rec.Value,
+			Text:  rec.Text,
+		})
+	}
+
+	return ret
+}
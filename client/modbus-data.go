@@ -0,0 +1,160 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/modbus"
+)
+
+// numeric returns true if the IO data format is a number that is scaled
+func (io *modbusIONode) numeric() bool {
+	return io.modbusDataType != data.PointValueASCII &&
+		io.modbusDataType != data.PointValueBit
+}
+
+// regCount returns the number of registers the IO occupies
+// modbusDataFormats are the supported register data formats
+var modbusDataFormats = map[string]bool{
+	data.PointValueUINT16:  true,
+	data.PointValueINT16:   true,
+	data.PointValueUINT32:  true,
+	data.PointValueINT32:   true,
+	data.PointValueFLOAT32: true,
+	data.PointValueUINT64:  true,
+	data.PointValueINT64:   true,
+	data.PointValueFLOAT64: true,
+	data.PointValueASCII:   true,
+	data.PointValueBit:     true,
+}
+
+func (io *modbusIONode) regCount() int {
+	switch io.modbusDataType {
+	case data.PointValueUINT16, data.PointValueINT16, data.PointValueBit:
+		return 1
+	case data.PointValueUINT32, data.PointValueINT32,
+		data.PointValueFLOAT32:
+		return 2
+	case data.PointValueUINT64, data.PointValueINT64,
+		data.PointValueFLOAT64:
+		return 4
+	case data.PointValueASCII:
+		return io.stringRegCount
+	default:
+		// be conservative
+		return 2
+	}
+}
+
+// order returns the byte order of the IO, defaulting to big endian
+func (io *modbusIONode) order() modbus.ByteOrder {
+	order := modbus.ByteOrder(io.byteOrder)
+
+	if io.modbusDataType == data.PointValueASCII {
+		// strings are always stored in register order, only the
+		// characters in each register may be swapped
+		switch order {
+		case modbus.ByteOrderCDAB:
+			order = modbus.ByteOrderABCD
+		case modbus.ByteOrderDCBA:
+			order = modbus.ByteOrderBADC
+		}
+	}
+
+	if order == "" {
+		return modbus.ByteOrderABCD
+	}
+
+	return order
+}
+
+// decodeRegs converts registers read from a device into a scaled value.
+// ASCII data is returned as text.
+func (io *modbusIONode) decodeRegs(regs []uint16) (float64, string, error) {
+	count := io.regCount()
+	if len(regs) < count {
+		return 0, "", errors.New("Did not receive enough data")
+	}
+
+	if io.modbusDataType == data.PointValueBit {
+		// byte order is not applied to bits, the index is the bit in
+		// the register as transmitted
+		return data.BoolToFloat(regs[0]&(1<<uint16(io.bitIndex)) != 0), "", nil
+	}
+
+	regs = modbus.ReorderRegs(regs[:count], io.order())
+
+	var valueUnscaled float64
+
+	switch io.modbusDataType {
+	case data.PointValueUINT16:
+		valueUnscaled = float64(regs[0])
+	case data.PointValueINT16:
+		valueUnscaled = float64(modbus.RegsToInt16(regs)[0])
+	case data.PointValueUINT32:
+		valueUnscaled = float64(modbus.RegsToUint32(regs)[0])
+	case data.PointValueINT32:
+		valueUnscaled = float64(modbus.RegsToInt32(regs)[0])
+	case data.PointValueFLOAT32:
+		valueUnscaled = float64(modbus.RegsToFloat32(regs)[0])
+	case data.PointValueUINT64:
+		valueUnscaled = float64(modbus.RegsToUint64(regs)[0])
+	case data.PointValueINT64:
+		valueUnscaled = float64(modbus.RegsToInt64(regs)[0])
+	case data.PointValueFLOAT64:
+		valueUnscaled = modbus.RegsToFloat64(regs)[0]
+	case data.PointValueASCII:
+		return 0, modbus.RegsToString(regs), nil
+	default:
+		return 0, "", fmt.Errorf("unhandled data type: %v",
+			io.modbusDataType)
+	}
+
+	return valueUnscaled*io.scale + io.offset, "", nil
+}
+
+// encodeRegs converts a value into registers to write to a device.
+// Bit values are not handled here as they require the current register
+// value.
+func (io *modbusIONode) encodeRegs(value float64, text string) ([]uint16, error) {
+	unscaledValue := (value - io.offset) / io.scale
+	// integer formats are rounded so that scaled values like 2.3/0.1 are
+	// not truncated to 22
+	intValue := int64(math.Round(unscaledValue))
+
+	var regs []uint16
+
+	switch io.modbusDataType {
+	case data.PointValueUINT16, data.PointValueINT16:
+		regs = []uint16{uint16(intValue)}
+	case data.PointValueUINT32:
+		regs = modbus.Uint32ToRegs([]uint32{uint32(intValue)})
+	case data.PointValueINT32:
+		regs = modbus.Int32ToRegs([]int32{int32(intValue)})
+	case data.PointValueFLOAT32:
+		regs = modbus.Float32ToRegs([]float32{float32(unscaledValue)})
+	case data.PointValueUINT64:
+		regs = modbus.Uint64ToRegs([]uint64{uint64(math.Round(unscaledValue))})
+	case data.PointValueINT64:
+		regs = modbus.Int64ToRegs([]int64{intValue})
+	case data.PointValueFLOAT64:
+		regs = modbus.Float64ToRegs([]float64{unscaledValue})
+	case data.PointValueASCII:
+		regs = modbus.StringToRegs(text, io.stringRegCount)
+	default:
+		return nil, fmt.Errorf("unhandled data type: %v",
+			io.modbusDataType)
+	}
+
+	return modbus.ReorderRegs(regs, io.order()), nil
+}
+
+// writePending returns true if valueSet differs from the last value read
+func (io *modbusIONode) writePending() bool {
+	if io.modbusDataType == data.PointValueASCII {
+		return io.valueSetText != io.valueText
+	}
+	return io.valueSet != io.value
+}
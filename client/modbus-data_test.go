@@ -0,0 +1,104 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestModbusIODecodeEncode(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		format string
+		order  string
+		scale  float64
+		value  float64
+		text   string
+		regs   []uint16
+	}{
+		{"int16", data.PointValueINT16, "", 0.1, -1.5, "", []uint16{0xfff1}},
+		{"int16 swapped", data.PointValueINT16, data.PointValueBADC, 1, -2, "", []uint16{0xfeff}},
+		{"uint32", data.PointValueUINT32, "", 1, 0x01020304, "", []uint16{0x0102, 0x0304}},
+		{"uint32 CDAB", data.PointValueUINT32, data.PointValueCDAB, 1, 0x01020304, "",
+			[]uint16{0x0304, 0x0102}},
+		{"int32 DCBA", data.PointValueINT32, data.PointValueDCBA, 1, -2, "",
+			[]uint16{0xfeff, 0xffff}},
+		{"float32 BADC", data.PointValueFLOAT32, data.PointValueBADC, 1, 1, "",
+			[]uint16{0x803f, 0x0000}},
+		{"uint64", data.PointValueUINT64, "", 1, 0x0102030405060000, "",
+			[]uint16{0x0102, 0x0304, 0x0506, 0}},
+		{"int64 CDAB", data.PointValueINT64, data.PointValueCDAB, 1, -2, "",
+			[]uint16{0xfffe, 0xffff, 0xffff, 0xffff}},
+		{"float64", data.PointValueFLOAT64, "", 1, 1, "",
+			[]uint16{0x3ff0, 0, 0, 0}},
+		{"ascii", data.PointValueASCII, "", 0, 0, "SIOT", []uint16{0x5349, 0x4f54, 0}},
+		{"ascii DCBA", data.PointValueASCII, data.PointValueDCBA, 0, 0, "SIOT",
+			[]uint16{0x4953, 0x544f, 0}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			io := &modbusIONode{
+				modbusDataType: test.format,
+				byteOrder:      test.order,
+				scale:          test.scale,
+				stringRegCount: 3,
+			}
+
+			regs, err := io.encodeRegs(test.value, test.text)
+			if err != nil {
+				t.Fatal("encode error: ", err)
+			}
+
+			if !reflect.DeepEqual(regs, test.regs) {
+				t.Errorf("encode: expected %x, got %x", test.regs, regs)
+			}
+
+			value, text, err := io.decodeRegs(test.regs)
+			if err != nil {
+				t.Fatal("decode error: ", err)
+			}
+
+			if value != test.value || text != test.text {
+				t.Errorf("decode: expected %v/%v, got %v/%v", test.value,
+					test.text, value, text)
+			}
+		})
+	}
+}
+
+func TestModbusIODecodeBit(t *testing.T) {
+	io := &modbusIONode{
+		modbusDataType: data.PointValueBit,
+		bitIndex:       9,
+	}
+
+	v, _, err := io.decodeRegs([]uint16{0x0200})
+	if err != nil || v != 1 {
+		t.Errorf("expected bit set, got %v, err: %v", v, err)
+	}
+
+	v, _, _ = io.decodeRegs([]uint16{0xfdff})
+	if v != 0 {
+		t.Errorf("expected bit clear, got %v", v)
+	}
+}
+
+func TestModbusIODataFormat(t *testing.T) {
+	c := ModbusIO{
+		ModbusIOType: data.PointValueModbusHoldingRegister,
+		Scale:        1,
+	}
+
+	for format := range modbusDataFormats {
+		c.DataFormat = format
+		c.RegCount = 1
+		if _, err := newModbusIONode(c); err != nil {
+			t.Errorf("%v: unexpected error: %v", format, err)
+		}
+	}
+
+	c.DataFormat = "uint17"
+	if _, err := newModbusIONode(c); err == nil {
+		t.Error("expected error for unknown data format")
+	}
+}
@@ -0,0 +1,228 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// modbusNode is the runtime state of a modbus bus
+type modbusNode struct {
+	nodeID              string
+	busType             string
+	protocol            string
+	uri                 string
+	id                  int // only used for server
+	portName            string
+	debugLevel          int
+	baud                int
+	pollPeriod          int
+	readMaxGap          int
+	gatewayPort         string
+	gatewayTimeout      int
+	gatewayUnitTimeouts map[byte]int
+	disabled            bool
+	errorCount          int
+	errorCountCRC       int
+	errorCountEOF       int
+	errorCountReset     bool
+	errorCountCRCReset  bool
+	errorCountEOFReset  bool
+}
+
+// newModbusNode converts a bus config to the modbusNode data structure
+func newModbusNode(c Modbus) (*modbusNode, error) {
+	ret := modbusNode{
+		nodeID:             c.ID,
+		busType:            c.ClientServer,
+		protocol:           c.Protocol,
+		pollPeriod:         c.PollPeriod,
+		readMaxGap:         c.ReadMaxGap,
+		debugLevel:         c.Debug,
+		disabled:           c.Disabled,
+		errorCount:         c.ErrorCount,
+		errorCountCRC:      c.ErrorCountCRC,
+		errorCountEOF:      c.ErrorCountEOF,
+		errorCountReset:    c.ErrorCountReset,
+		errorCountCRCReset: c.ErrorCountCRCReset,
+		errorCountEOFReset: c.ErrorCountEOFReset,
+	}
+
+	if ret.busType == "" {
+		return nil, errors.New("Must define modbus client/server")
+	}
+
+	if ret.protocol == "" {
+		return nil, errors.New("Must define modbus protocol")
+	}
+
+	if ret.protocol == data.PointValueRTU ||
+		ret.protocol == data.PointValueModbusASCII {
+		ret.portName = c.Port
+		if ret.portName == "" {
+			return nil, errors.New("Must define modbus port name")
+		}
+
+		if c.Baud == "" {
+			return nil, errors.New("Must define modbus baud")
+		}
+
+		var err error
+		ret.baud, err = strconv.Atoi(c.Baud)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid baud: %v", c.Baud)
+		}
+	}
+
+	if ret.protocol == data.PointValueTCP {
+		switch ret.busType {
+		case data.PointValueClient:
+			ret.uri = c.URI
+			if ret.uri == "" {
+				return nil, errors.New("Must define modbus URI")
+			}
+		case data.PointValueServer:
+			ret.portName = c.Port
+			if ret.portName == "" {
+				return nil, errors.New("Must define modbus port name")
+			}
+		default:
+			return nil, fmt.Errorf("Invalid bus type: %v", ret.busType)
+		}
+	}
+
+	if ret.busType == data.PointValueClient && ret.pollPeriod <= 0 {
+		return nil, errors.New("Must define modbus polling period for client devices")
+	}
+
+	if ret.busType == data.PointValueClient && ret.protocol != data.PointValueTCP {
+		ret.gatewayPort = c.GatewayPort
+		ret.gatewayTimeout = c.GatewayTimeout
+		if ret.gatewayTimeout <= 0 {
+			ret.gatewayTimeout = 1000
+		}
+
+		ret.gatewayUnitTimeouts = make(map[byte]int)
+		for k, v := range c.GatewayUnitTimeouts {
+			if v <= 0 {
+				// deleted or not set yet
+				continue
+			}
+			id, err := strconv.Atoi(k)
+			if err != nil || id < 1 || id > 247 {
+				log.Printf("Modbus %v: ignoring gateway timeout for invalid unit ID: %v\n",
+					c.Description, k)
+				continue
+			}
+			ret.gatewayUnitTimeouts[byte(id)] = v
+		}
+	}
+
+	if ret.busType == data.PointValueServer {
+		ret.id = c.ServerID
+		if ret.id <= 0 {
+			return nil, errors.New("Must define modbus ID for server bus")
+		}
+	}
+
+	return &ret, nil
+}
+
+// modbusIONode is the runtime state of a modbus IO
+type modbusIONode struct {
+	nodeID             string
+	description        string
+	id                 int
+	address            int
+	modbusIOType       string
+	modbusDataType     string
+	byteOrder          string
+	bitIndex           int
+	stringRegCount     int
+	readOnly           bool
+	scale              float64
+	offset             float64
+	value              float64
+	valueSet           float64
+	valueText          string
+	valueSetText       string
+	disabled           bool
+	errorCount         int
+	errorCountCRC      int
+	errorCountEOF      int
+	errorCountReset    bool
+	errorCountCRCReset bool
+	errorCountEOFReset bool
+	lastSent           time.Time
+}
+
+// keepLayout returns c with the register layout of io
+func (io *modbusIONode) keepLayout(c ModbusIO) ModbusIO {
+	c.ModbusIOType = io.modbusIOType
+	c.Address = io.address
+	c.DataFormat = io.modbusDataType
+	c.ByteOrder = io.byteOrder
+	c.BitIndex = io.bitIndex
+	c.RegCount = io.stringRegCount
+	c.Scale = io.scale
+	return c
+}
+
+// newModbusIONode converts an IO config to the modbusIONode data structure
+func newModbusIONode(c ModbusIO) (*modbusIONode, error) {
+	ret := modbusIONode{
+		nodeID:             c.ID,
+		description:        c.Description,
+		id:                 c.DeviceID,
+		address:            c.Address,
+		modbusIOType:       c.ModbusIOType,
+		readOnly:           c.ReadOnly,
+		value:              c.Value,
+		valueSet:           c.ValueSet,
+		valueText:          c.ValueText,
+		valueSetText:       c.ValueSetText,
+		disabled:           c.Disabled,
+		errorCount:         c.ErrorCount,
+		errorCountCRC:      c.ErrorCountCRC,
+		errorCountEOF:      c.ErrorCountEOF,
+		errorCountReset:    c.ErrorCountReset,
+		errorCountCRCReset: c.ErrorCountCRCReset,
+		errorCountEOFReset: c.ErrorCountEOFReset,
+	}
+
+	if ret.modbusIOType == "" {
+		return nil, errors.New("Must define modbus IO type")
+	}
+
+	if ret.modbusIOType == data.PointValueModbusInputRegister ||
+		ret.modbusIOType == data.PointValueModbusHoldingRegister {
+		ret.modbusDataType = c.DataFormat
+		if ret.modbusDataType == "" {
+			return nil, errors.New("Data format must be specified")
+		}
+		if !modbusDataFormats[ret.modbusDataType] {
+			return nil, fmt.Errorf("Invalid data format: %v", ret.modbusDataType)
+		}
+		ret.byteOrder = c.ByteOrder
+		ret.bitIndex = c.BitIndex
+		if ret.bitIndex < 0 || ret.bitIndex > 15 {
+			return nil, fmt.Errorf("Invalid bit index: %v", ret.bitIndex)
+		}
+		ret.stringRegCount = c.RegCount
+		if ret.modbusDataType == data.PointValueASCII && ret.stringRegCount < 1 {
+			return nil, errors.New("Must define register count for ASCII data")
+		}
+		ret.scale = c.Scale
+		if ret.scale == 0 && ret.numeric() {
+			return nil, errors.New("Must define modbus scale")
+		}
+		ret.offset = c.Offset
+	}
+
+	return &ret, nil
+}
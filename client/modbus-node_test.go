@@ -0,0 +1,46 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestModbusNodeGatewayTimeouts(t *testing.T) {
+	c := Modbus{
+		ClientServer:   data.PointValueClient,
+		Protocol:       data.PointValueRTU,
+		Port:           "/dev/ttyUSB0",
+		Baud:           "9600",
+		PollPeriod:     100,
+		GatewayPort:    "502",
+		GatewayTimeout: 500,
+		GatewayUnitTimeouts: map[string]int{
+			"1":   2000,
+			"0":   3000,
+			"248": 3000,
+			"abc": 3000,
+			"7":   0,
+		},
+	}
+
+	n, err := newModbusNode(c)
+	if err != nil {
+		t.Fatal("Error creating node: ", err)
+	}
+
+	if n.gatewayTimeout != 500 {
+		t.Error("Wrong default timeout: ", n.gatewayTimeout)
+	}
+
+	if exp := map[byte]int{1: 2000}; !reflect.DeepEqual(n.gatewayUnitTimeouts, exp) {
+		t.Error("Wrong unit timeouts: ", n.gatewayUnitTimeouts)
+	}
+
+	c.GatewayTimeout = 0
+	n, _ = newModbusNode(c)
+	if n.gatewayTimeout != 1000 {
+		t.Error("Wrong timeout when not set: ", n.gatewayTimeout)
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"sort"
+
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/modbus"
+)
+
+// modbusReadBlock is a group of IOs of the same type on one device
+// that can be read with a single modbus request.
+type modbusReadBlock struct {
+	id      int
+	ioType  string
+	address int
+	count   int
+	ios     []*modbusIONode
+}
+
+// modbusIOSize returns the number of bits or registers an IO occupies
+func modbusIOSize(io *modbusIONode) int {
+	switch io.modbusIOType {
+	case data.PointValueModbusCoil, data.PointValueModbusDiscreteInput:
+		return 1
+	default:
+		return io.regCount()
+	}
+}
+
+// modbusMaxReadCount returns the max number of bits or registers that
+// can be read in one request for an IO type
+func modbusMaxReadCount(ioType string) int {
+	switch ioType {
+	case data.PointValueModbusCoil, data.PointValueModbusDiscreteInput:
+		return modbus.MaxReadBits
+	default:
+		return modbus.MaxReadRegs
+	}
+}
+
+// planModbusReads groups IOs into blocks that can each be read in one
+// request. IOs are coalesced if they are on the same device, are the
+// same IO type, and there are no more than maxGap unused registers (or
+// bits) between them. If maxGap is negative, each IO is read separately.
+func planModbusReads(ios []*modbusIONode, maxGap int) []modbusReadBlock {
+	sorted := make([]*modbusIONode, len(ios))
+	copy(sorted, ios)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.id != b.id {
+			return a.id < b.id
+		}
+		if a.modbusIOType != b.modbusIOType {
+			return a.modbusIOType < b.modbusIOType
+		}
+		return a.address < b.address
+	})
+
+	var ret []modbusReadBlock
+
+	for _, n := range sorted {
+		size := modbusIOSize(n)
+
+		if maxGap >= 0 && len(ret) > 0 {
+			blk := &ret[len(ret)-1]
+			end := blk.address + blk.count
+			newEnd := n.address + size
+			if newEnd < end {
+				newEnd = end
+			}
+			if blk.id == n.id && blk.ioType == n.modbusIOType &&
+				n.address <= end+maxGap &&
+				newEnd-blk.address <= modbusMaxReadCount(n.modbusIOType) {
+				blk.count = newEnd - blk.address
+				blk.ios = append(blk.ios, n)
+				continue
+			}
+		}
+
+		ret = append(ret, modbusReadBlock{
+			id:      n.id,
+			ioType:  n.modbusIOType,
+			address: n.address,
+			count:   size,
+			ios:     []*modbusIONode{n},
+		})
+	}
+
+	return ret
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func newTestModbusIO(id, address int, ioType, dataFormat string) *modbusIONode {
+	return &modbusIONode{
+		id:             id,
+		address:        address,
+		modbusIOType:   ioType,
+		modbusDataType: dataFormat,
+	}
+}
+
+func TestPlanModbusReads(t *testing.T) {
+	hr := data.PointValueModbusHoldingRegister
+	ir := data.PointValueModbusInputRegister
+	coil := data.PointValueModbusCoil
+
+	ios := []*modbusIONode{
+		newTestModbusIO(1, 4, hr, data.PointValueFLOAT32),
+		newTestModbusIO(1, 0, hr, data.PointValueUINT16),
+		newTestModbusIO(1, 1, hr, data.PointValueUINT32),
+		newTestModbusIO(1, 10, hr, data.PointValueUINT16),
+		newTestModbusIO(1, 3, ir, data.PointValueINT16),
+		newTestModbusIO(2, 0, hr, data.PointValueUINT16),
+		newTestModbusIO(1, 20, coil, ""),
+		newTestModbusIO(1, 22, coil, ""),
+	}
+
+	type blk struct {
+		id, address, count, ioCount int
+		ioType                      string
+	}
+
+	for _, test := range []struct {
+		name   string
+		maxGap int
+		exp    []blk
+	}{
+		{"contiguous", 0, []blk{
+			{1, 20, 1, 1, coil},
+			{1, 22, 1, 1, coil},
+			{1, 0, 3, 2, hr},
+			{1, 4, 2, 1, hr},
+			{1, 10, 1, 1, hr},
+			{1, 3, 1, 1, ir},
+			{2, 0, 1, 1, hr},
+		}},
+		{"gap", 4, []blk{
+			{1, 20, 3, 2, coil},
+			{1, 0, 11, 4, hr},
+			{1, 3, 1, 1, ir},
+			{2, 0, 1, 1, hr},
+		}},
+		{"disabled", -1, []blk{
+			{1, 20, 1, 1, coil},
+			{1, 22, 1, 1, coil},
+			{1, 0, 1, 1, hr},
+			{1, 1, 2, 1, hr},
+			{1, 4, 2, 1, hr},
+			{1, 10, 1, 1, hr},
+			{1, 3, 1, 1, ir},
+			{2, 0, 1, 1, hr},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			blocks := planModbusReads(ios, test.maxGap)
+			if len(blocks) != len(test.exp) {
+				t.Fatalf("expected %v blocks, got %v: %+v", len(test.exp),
+					len(blocks), blocks)
+			}
+			for i, b := range blocks {
+				got := blk{b.id, b.address, b.count, len(b.ios), b.ioType}
+				if got != test.exp[i] {
+					t.Errorf("block %v: expected %+v, got %+v", i, test.exp[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanModbusReadsMaxCount(t *testing.T) {
+	var ios []*modbusIONode
+	for i := 0; i < 100; i++ {
+		ios = append(ios, newTestModbusIO(1, i*2, data.PointValueModbusInputRegister,
+			data.PointValueFLOAT32))
+	}
+
+	blocks := planModbusReads(ios, 0)
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %v", len(blocks))
+	}
+
+	if blocks[0].count != 124 || blocks[1].address != 124 || blocks[1].count != 76 {
+		t.Errorf("blocks not split correctly: %+v, %+v", blocks[0].count,
+			blocks[1].address)
+	}
+}
@@ -0,0 +1,507 @@
+package client
+
+import (
+	"bytes"
+	"embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+//go:embed modbus-profiles/*.yaml
+var modbusProfileFiles embed.FS
+
+// ModbusProfile describes the register map of a Modbus device. A profile
+// can be imported under a modbus bus node to create all the IO nodes for a
+// device at once.
+type ModbusProfile struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description,omitempty"`
+	IOs         []ModbusProfileIO `yaml:"ios"`
+}
+
+// ModbusProfileIO describes one IO in a Modbus device profile
+type ModbusProfileIO struct {
+	Name string `yaml:"name"`
+	// Address is the packet address (0 based)
+	Address int `yaml:"address"`
+	// Type is one of: coil, discrete, input, holding
+	Type string `yaml:"type"`
+	// Format is a modbus data format (uint16, float32, etc). Not used
+	// for coils and discrete inputs.
+	Format    string  `yaml:"format,omitempty"`
+	ByteOrder string  `yaml:"byteOrder,omitempty"`
+	RegCount  int     `yaml:"regCount,omitempty"`
+	Bit       int     `yaml:"bit,omitempty"`
+	Scale     float64 `yaml:"scale,omitempty"`
+	Offset    float64 `yaml:"offset,omitempty"`
+	Units     string  `yaml:"units,omitempty"`
+	// Access is r or rw
+	Access string `yaml:"access,omitempty"`
+}
+
+var modbusProfileIOTypes = map[string]string{
+	"coil":     data.PointValueModbusCoil,
+	"discrete": data.PointValueModbusDiscreteInput,
+	"input":    data.PointValueModbusInputRegister,
+	"holding":  data.PointValueModbusHoldingRegister,
+}
+
+// modbusProfileIOType returns the modbusIoType point value for a profile IO type.
+// Both the short names and the point values are accepted.
+func modbusProfileIOType(typ string) (string, error) {
+	if t, ok := modbusProfileIOTypes[typ]; ok {
+		return t, nil
+	}
+
+	for _, t := range modbusProfileIOTypes {
+		if t == typ {
+			return t, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid IO type: %v", typ)
+}
+
+func (io ModbusProfileIO) isRegister() bool {
+	t, _ := modbusProfileIOType(io.Type)
+	return t == data.PointValueModbusInputRegister ||
+		t == data.PointValueModbusHoldingRegister
+}
+
+// Validate checks that the profile is usable
+func (p ModbusProfile) Validate() error {
+	if len(p.IOs) < 1 {
+		return errors.New("profile does not contain any IOs")
+	}
+
+	for i, io := range p.IOs {
+		if io.Name == "" {
+			return fmt.Errorf("IO %v: name must be set", i)
+		}
+
+		if io.Address < 0 || io.Address > 0xffff {
+			return fmt.Errorf("IO %v: invalid address: %v", io.Name, io.Address)
+		}
+
+		if _, err := modbusProfileIOType(io.Type); err != nil {
+			return fmt.Errorf("IO %v: %w", io.Name, err)
+		}
+
+		switch io.Access {
+		case "", "r", "rw":
+		default:
+			return fmt.Errorf("IO %v: invalid access: %v", io.Name, io.Access)
+		}
+
+		if !io.isRegister() {
+			continue
+		}
+
+		ioNode := modbusIONode{
+			modbusDataType: io.Format,
+			stringRegCount: io.RegCount,
+			scale:          1,
+		}
+
+		// use the codec to check the data format is known
+		if io.Format != data.PointValueBit {
+			if _, err := ioNode.encodeRegs(0, ""); err != nil {
+				return fmt.Errorf("IO %v: %w", io.Name, err)
+			}
+		}
+
+		if io.Format == data.PointValueASCII && io.RegCount < 1 {
+			return fmt.Errorf("IO %v: regCount must be set for ascii", io.Name)
+		}
+
+		if io.Bit < 0 || io.Bit > 15 {
+			return fmt.Errorf("IO %v: invalid bit: %v", io.Name, io.Bit)
+		}
+
+		switch io.ByteOrder {
+		case "", data.PointValueABCD, data.PointValueCDAB,
+			data.PointValueBADC, data.PointValueDCBA:
+		default:
+			return fmt.Errorf("IO %v: invalid byte order: %v", io.Name, io.ByteOrder)
+		}
+	}
+
+	return nil
+}
+
+// ParseModbusProfileYAML parses a profile in YAML format
+func ParseModbusProfileYAML(in []byte) (ModbusProfile, error) {
+	var ret ModbusProfile
+	err := yaml.Unmarshal(in, &ret)
+	if err != nil {
+		return ModbusProfile{}, fmt.Errorf("Error parsing YAML: %w", err)
+	}
+
+	for i := range ret.IOs {
+		if ret.IOs[i].isRegister() && ret.IOs[i].Scale == 0 {
+			ret.IOs[i].Scale = 1
+		}
+	}
+
+	return ret, ret.Validate()
+}
+
+var modbusProfileCSVColumns = []string{"name", "address", "type", "format",
+	"scale", "units", "access", "offset", "byteOrder", "regCount", "bit"}
+
+// ParseModbusProfileCSV parses a profile in CSV format. The first line is
+// a header with the column names. name, address, and type are required,
+// and the following columns are optional: format, scale, units, access,
+// offset, byteOrder, regCount, bit.
+func ParseModbusProfileCSV(name string, in io.Reader) (ModbusProfile, error) {
+	ret := ModbusProfile{Name: name}
+
+	r := csv.NewReader(in)
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	// allow trailing optional columns to be left off
+	r.FieldsPerRecord = -1
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return ModbusProfile{}, fmt.Errorf("Error parsing CSV: %w", err)
+	}
+
+	if len(records) < 1 {
+		return ModbusProfile{}, errors.New("CSV does not contain a header")
+	}
+
+	cols := make(map[string]int)
+	for i, c := range records[0] {
+		cols[strings.TrimSpace(c)] = i
+	}
+
+	for _, c := range []string{"name", "address", "type"} {
+		if _, ok := cols[c]; !ok {
+			return ModbusProfile{}, fmt.Errorf("CSV header is missing %v column", c)
+		}
+	}
+
+	for line, rec := range records[1:] {
+		get := func(col string) string {
+			i, ok := cols[col]
+			if !ok || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+
+		getInt := func(col string) (int, error) {
+			v := get(col)
+			if v == "" {
+				return 0, nil
+			}
+			// allow hex addresses
+			i, err := strconv.ParseInt(v, 0, 32)
+			if err != nil {
+				return 0, fmt.Errorf("line %v: invalid %v: %v", line+2, col, v)
+			}
+			return int(i), nil
+		}
+
+		getFloat := func(col string, def float64) (float64, error) {
+			v := get(col)
+			if v == "" {
+				return def, nil
+			}
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return 0, fmt.Errorf("line %v: invalid %v: %v", line+2, col, v)
+			}
+			return f, nil
+		}
+
+		io := ModbusProfileIO{
+			Name:      get("name"),
+			Type:      get("type"),
+			Format:    get("format"),
+			ByteOrder: get("byteOrder"),
+			Units:     get("units"),
+			Access:    get("access"),
+		}
+
+		if io.Address, err = getInt("address"); err != nil {
+			return ModbusProfile{}, err
+		}
+		if io.RegCount, err = getInt("regCount"); err != nil {
+			return ModbusProfile{}, err
+		}
+		if io.Bit, err = getInt("bit"); err != nil {
+			return ModbusProfile{}, err
+		}
+
+		defScale := 0.0
+		if io.isRegister() {
+			defScale = 1
+		}
+		if io.Scale, err = getFloat("scale", defScale); err != nil {
+			return ModbusProfile{}, err
+		}
+		if io.Offset, err = getFloat("offset", 0); err != nil {
+			return ModbusProfile{}, err
+		}
+
+		ret.IOs = append(ret.IOs, io)
+	}
+
+	return ret, ret.Validate()
+}
+
+// ParseModbusProfile parses a profile file. The format is determined from
+// the file extension (.csv, .yaml, or .yml).
+func ParseModbusProfile(filename string, in []byte) (ModbusProfile, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		name := strings.TrimSuffix(path.Base(filename), path.Ext(filename))
+		return ParseModbusProfileCSV(name, bytes.NewReader(in))
+	case ".yaml", ".yml":
+		return ParseModbusProfileYAML(in)
+	default:
+		return ModbusProfile{}, fmt.Errorf("unknown profile format: %v", filename)
+	}
+}
+
+// YAML returns the profile in YAML format
+func (p ModbusProfile) YAML() ([]byte, error) {
+	return yaml.Marshal(p)
+}
+
+// CSV returns the profile in CSV format
+func (p ModbusProfile) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	err := w.Write(modbusProfileCSVColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	for _, io := range p.IOs {
+		rec := []string{io.Name, strconv.Itoa(io.Address), io.Type, io.Format,
+			"", io.Units, io.Access, "", io.ByteOrder, "", ""}
+		if io.isRegister() {
+			rec[4] = formatFloat(io.Scale)
+			rec[7] = formatFloat(io.Offset)
+		}
+		if io.RegCount != 0 {
+			rec[9] = strconv.Itoa(io.RegCount)
+		}
+		if io.Format == data.PointValueBit {
+			rec[10] = strconv.Itoa(io.Bit)
+		}
+		err := w.Write(rec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// Nodes returns the modbus IO nodes for the profile. Each node gets a new
+// ID and deviceID is used as the modbus ID of each IO.
+func (p ModbusProfile) Nodes(parent string, deviceID int) ([]data.NodeEdge, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	var ret []data.NodeEdge
+
+	for _, io := range p.IOs {
+		ioType, _ := modbusProfileIOType(io.Type)
+
+		readOnly := io.Access != "rw"
+
+		points := data.Points{
+			{Type: data.PointTypeDescription, Text: io.Name},
+			{Type: data.PointTypeID, Value: float64(deviceID)},
+			{Type: data.PointTypeAddress, Value: float64(io.Address)},
+			{Type: data.PointTypeModbusIOType, Text: ioType},
+			{Type: data.PointTypeReadOnly, Value: data.BoolToFloat(readOnly)},
+		}
+
+		if io.isRegister() {
+			points = append(points,
+				data.Point{Type: data.PointTypeDataFormat, Text: io.Format},
+				data.Point{Type: data.PointTypeScale, Value: io.Scale},
+				data.Point{Type: data.PointTypeOffset, Value: io.Offset},
+			)
+
+			if io.Units != "" {
+				points = append(points, data.Point{Type: data.PointTypeUnits, Text: io.Units})
+			}
+			if io.ByteOrder != "" {
+				points = append(points, data.Point{Type: data.PointTypeByteOrder, Text: io.ByteOrder})
+			}
+			if io.Format == data.PointValueASCII {
+				points = append(points, data.Point{Type: data.PointTypeRegCount,
+					Value: float64(io.RegCount)})
+			}
+			if io.Format == data.PointValueBit {
+				points = append(points, data.Point{Type: data.PointTypeBitIndex,
+					Value: float64(io.Bit)})
+			}
+		}
+
+		now := time.Now()
+		for i := range points {
+			points[i].Time = now
+			points[i].Key = "0"
+		}
+
+		ret = append(ret, data.NodeEdge{
+			ID:     uuid.New().String(),
+			Type:   data.NodeTypeModbusIO,
+			Parent: parent,
+			Points: points,
+		})
+	}
+
+	return ret, nil
+}
+
+// ModbusProfileFromNodes creates a profile from existing modbus IO nodes.
+func ModbusProfileFromNodes(name string, nodes []data.NodeEdge) ModbusProfile {
+	ret := ModbusProfile{Name: name}
+
+	for _, n := range nodes {
+		io := ModbusProfileIO{}
+		io.Name, _ = n.Points.Text(data.PointTypeDescription, "")
+		io.Address, _ = n.Points.ValueInt(data.PointTypeAddress, "")
+		ioType, _ := n.Points.Text(data.PointTypeModbusIOType, "")
+		for short, t := range modbusProfileIOTypes {
+			if t == ioType {
+				io.Type = short
+			}
+		}
+
+		io.Access = "r"
+		readOnly, _ := n.Points.ValueBool(data.PointTypeReadOnly, "")
+		if !readOnly && (ioType == data.PointValueModbusCoil ||
+			ioType == data.PointValueModbusHoldingRegister) {
+			io.Access = "rw"
+		}
+
+		if io.isRegister() {
+			io.Format, _ = n.Points.Text(data.PointTypeDataFormat, "")
+			io.ByteOrder, _ = n.Points.Text(data.PointTypeByteOrder, "")
+			io.Scale, _ = n.Points.Value(data.PointTypeScale, "")
+			io.Offset, _ = n.Points.Value(data.PointTypeOffset, "")
+			io.Units, _ = n.Points.Text(data.PointTypeUnits, "")
+			if io.Format == data.PointValueASCII {
+				io.RegCount, _ = n.Points.ValueInt(data.PointTypeRegCount, "")
+			}
+			if io.Format == data.PointValueBit {
+				io.Bit, _ = n.Points.ValueInt(data.PointTypeBitIndex, "")
+			}
+		}
+
+		ret.IOs = append(ret.IOs, io)
+	}
+
+	sort.SliceStable(ret.IOs, func(i, j int) bool {
+		if ret.IOs[i].Type != ret.IOs[j].Type {
+			return ret.IOs[i].Type < ret.IOs[j].Type
+		}
+		return ret.IOs[i].Address < ret.IOs[j].Address
+	})
+
+	return ret
+}
+
+// ModbusProfileNames returns the names of the profiles bundled with SIOT
+func ModbusProfileNames() ([]string, error) {
+	entries, err := modbusProfileFiles.ReadDir("modbus-profiles")
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for _, e := range entries {
+		ret = append(ret, strings.TrimSuffix(e.Name(), path.Ext(e.Name())))
+	}
+
+	return ret, nil
+}
+
+// BundledModbusProfile returns a profile bundled with SIOT by name
+func BundledModbusProfile(name string) (ModbusProfile, error) {
+	d, err := modbusProfileFiles.ReadFile(path.Join("modbus-profiles", name+".yaml"))
+	if err != nil {
+		return ModbusProfile{}, fmt.Errorf("profile %v not found", name)
+	}
+
+	return ParseModbusProfileYAML(d)
+}
+
+// ImportModbusProfile creates the IO nodes in a profile under a modbus bus
+// node. deviceID is the modbus ID of the device.
+func ImportModbusProfile(nc *nats.Conn, busID string, deviceID int, profile ModbusProfile) error {
+	buses, err := GetNodes(nc, "all", busID, data.NodeTypeModbus, false)
+	if err != nil {
+		return err
+	}
+
+	if len(buses) < 1 {
+		return fmt.Errorf("modbus node %v not found", busID)
+	}
+
+	nodes, err := profile.Nodes(busID, deviceID)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		err := SendNode(nc, n, "modbusProfile")
+		if err != nil {
+			return fmt.Errorf("Error creating IO node: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ExportModbusProfile creates a profile from the IO nodes for a device on a
+// modbus bus node.
+func ExportModbusProfile(nc *nats.Conn, busID string, deviceID int, name string) (ModbusProfile, error) {
+	nodes, err := GetNodes(nc, busID, "all", data.NodeTypeModbusIO, false)
+	if err != nil {
+		return ModbusProfile{}, err
+	}
+
+	var deviceNodes []data.NodeEdge
+	for _, n := range nodes {
+		id, _ := n.Points.ValueInt(data.PointTypeID, "")
+		if id == deviceID {
+			deviceNodes = append(deviceNodes, n)
+		}
+	}
+
+	if len(deviceNodes) < 1 {
+		return ModbusProfile{}, fmt.Errorf("no IOs found for device %v", deviceID)
+	}
+
+	return ModbusProfileFromNodes(name, deviceNodes), nil
+}
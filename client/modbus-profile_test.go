@@ -0,0 +1,135 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+const testModbusProfileCSV = `name,address,type,format,scale,units,access
+# comments are allowed
+Voltage,0x10,input,float32,1,V,r
+Setpoint,20,holding,int16,0.1,C,rw
+Relay,3,coil,,,,rw
+Serial,30,holding,ascii,,,r
+`
+
+func TestModbusProfileCSV(t *testing.T) {
+	_, err := ParseModbusProfileCSV("test", strings.NewReader(testModbusProfileCSV))
+	if err == nil {
+		t.Fatal("expected error for ascii IO without regCount")
+	}
+
+	csv := strings.Replace(testModbusProfileCSV, "access\n", "access,regCount\n", 1)
+	csv = strings.Replace(csv, "ascii,,,r", "ascii,,,r,8", 1)
+
+	p, err := ParseModbusProfileCSV("test", strings.NewReader(csv))
+	if err != nil {
+		t.Fatal("Error parsing CSV: ", err)
+	}
+
+	exp := []ModbusProfileIO{
+		{Name: "Voltage", Address: 16, Type: "input", Format: "float32", Scale: 1,
+			Units: "V", Access: "r"},
+		{Name: "Setpoint", Address: 20, Type: "holding", Format: "int16", Scale: 0.1,
+			Units: "C", Access: "rw"},
+		{Name: "Relay", Address: 3, Type: "coil", Access: "rw"},
+		{Name: "Serial", Address: 30, Type: "holding", Format: "ascii", Scale: 1,
+			Access: "r", RegCount: 8},
+	}
+
+	if !reflect.DeepEqual(p.IOs, exp) {
+		t.Fatalf("parsed profile not correct: %+v", p.IOs)
+	}
+
+	nodes, err := p.Nodes("bus", 3)
+	if err != nil {
+		t.Fatal("Error creating nodes: ", err)
+	}
+
+	if len(nodes) != 4 {
+		t.Fatal("expected 4 nodes")
+	}
+
+	// make sure the nodes work with the modbus IO code
+	for _, n := range nodes {
+		if n.Parent != "bus" || n.Type != data.NodeTypeModbusIO || n.ID == "" {
+			t.Errorf("node not set up correctly: %+v", n)
+		}
+		var c ModbusIO
+		err := data.Decode(data.NodeEdgeChildren{NodeEdge: n}, &c)
+		if err != nil {
+			t.Fatal("Error decoding node: ", err)
+		}
+		io, err := newModbusIONode(c)
+		if err != nil {
+			t.Fatal("Error converting node: ", err)
+		}
+		if io.id != 3 {
+			t.Error("device ID not set")
+		}
+	}
+
+	// export back to a profile
+	exported := ModbusProfileFromNodes("test", nodes)
+	if len(exported.IOs) != 4 || exported.IOs[0].Name != "Relay" ||
+		exported.IOs[1] != exp[1] || exported.IOs[3] != exp[0] {
+		t.Errorf("exported profile not correct: %+v", exported.IOs)
+	}
+
+	// CSV round trip
+	out, err := exported.CSV()
+	if err != nil {
+		t.Fatal("Error generating CSV: ", err)
+	}
+
+	p2, err := ParseModbusProfile("test.csv", out)
+	if err != nil {
+		t.Fatal("Error parsing exported CSV: ", err)
+	}
+
+	if !reflect.DeepEqual(p2, exported) {
+		t.Errorf("CSV round trip failed:\n%+v\n%+v", p2, exported)
+	}
+}
+
+func TestModbusProfileBundled(t *testing.T) {
+	names, err := ModbusProfileNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) < 1 {
+		t.Fatal("no bundled profiles")
+	}
+
+	for _, name := range names {
+		p, err := BundledModbusProfile(name)
+		if err != nil {
+			t.Errorf("Error loading profile %v: %v", name, err)
+			continue
+		}
+
+		// YAML round trip
+		y, err := p.YAML()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p2, err := ParseModbusProfile(name+".yaml", y)
+		if err != nil {
+			t.Errorf("Error parsing exported profile %v: %v", name, err)
+		}
+
+		if !reflect.DeepEqual(p, p2) {
+			t.Errorf("YAML round trip failed for %v", name)
+		}
+	}
+
+	p, _ := BundledModbusProfile("eastron-sdm120")
+	if p.IOs[len(p.IOs)-1].Address != 0x156 {
+		t.Error("hex address not parsed correctly")
+	}
+}
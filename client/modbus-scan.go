@@ -0,0 +1,266 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/modbus"
+	"github.com/simpleiot/simpleiot/respreader"
+	"go.bug.st/serial"
+)
+
+// ModbusScanRequest is sent to a modbus bus node to scan the bus for devices
+type ModbusScanRequest struct {
+	modbus.ScanConfig
+	// Timeout is the time (ms) to wait for each device to respond.
+	// Defaults to 100ms.
+	Timeout int `json:"timeout"`
+	// CreateNodes creates a placeholder IO node for each device found
+	// that does not already have IOs on the bus
+	CreateNodes bool `json:"createNodes"`
+}
+
+// ModbusScanResponse is returned from a modbus scan request
+type ModbusScanResponse struct {
+	Results      []modbus.ScanResult `json:"results"`
+	ErrorMessage string              `json:"error,omitempty"`
+}
+
+// MaxDuration returns how long a scan can take if no devices respond. Bauds
+// that are not set count as the bus baud.
+func (r ModbusScanRequest) MaxDuration() time.Duration {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = 100
+	}
+
+	settings := max(len(r.Bauds), 1) * max(len(r.Parities), 1)
+
+	start, end := max(r.StartID, 1), r.EndID
+	if end <= 0 || end > 247 {
+		end = 247
+	}
+	ids := max(end-start+1, 0)
+
+	// allow for the time to send each request and open the port
+	return time.Duration(settings*ids*(timeout+50))*time.Millisecond +
+		time.Duration(settings)*time.Second
+}
+
+// modbusScan is passed to the bus Run routine to start a scan. resp is
+// buffered so Run does not block if the requester has given up.
+type modbusScan struct {
+	req  ModbusScanRequest
+	resp chan ModbusScanResponse
+}
+
+// modbusScanDone is sent to the bus Run routine when a scan is complete
+type modbusScanDone struct {
+	scan    modbusScan
+	results []modbus.ScanResult
+	err     error
+}
+
+// ModbusSerialParity converts a N/E/O parity string to a serial parity
+func ModbusSerialParity(parity string) (serial.Parity, error) {
+	switch parity {
+	case "N", "":
+		return serial.NoParity, nil
+	case "E":
+		return serial.EvenParity, nil
+	case "O":
+		return serial.OddParity, nil
+	default:
+		return serial.NoParity, fmt.Errorf("invalid parity: %v", parity)
+	}
+}
+
+// startScan starts a scan of the bus for devices. The scan runs in its own
+// goroutine so the Run routine can still process points. The port is closed
+// during the scan, and scanDone is called with the results when it is
+// complete. The scan is stopped if it takes longer than
+// ModbusScanRequest.MaxDuration.
+func (b *ModbusClient) startScan(scan modbusScan) error {
+	if b.scanCancel != nil {
+		return errors.New("scan is already running")
+	}
+
+	if b.busNode == nil {
+		return errors.New("bus config is not valid")
+	}
+
+	if b.busNode.busType != data.PointValueClient {
+		return errors.New("scan is only supported on client buses")
+	}
+
+	if b.busNode.protocol != data.PointValueRTU &&
+		b.busNode.protocol != data.PointValueModbusASCII {
+		return errors.New("scan is only supported on serial buses")
+	}
+
+	timeout := time.Millisecond * time.Duration(scan.req.Timeout)
+	if timeout <= 0 {
+		timeout = 100 * time.Millisecond
+	}
+
+	if len(scan.req.Bauds) == 0 {
+		scan.req.Bauds = []int{b.busNode.baud}
+	}
+
+	// the scan goroutine can't use b.busNode as it may change
+	portName := b.busNode.portName
+	protocol := b.busNode.protocol
+	debugLevel := b.busNode.debugLevel
+
+	ctx, cancel := context.WithTimeout(context.Background(), scan.req.MaxDuration())
+	b.scanCancel = cancel
+
+	b.ClosePort()
+
+	open := func(baud int, parity string) (modbus.Transport, error) {
+		p, err := ModbusSerialParity(parity)
+		if err != nil {
+			return nil, err
+		}
+
+		port, err := serial.Open(portName, &serial.Mode{
+			BaudRate: baud,
+			Parity:   p,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Error opening serial port: %w", err)
+		}
+
+		rr := respreader.NewReadWriteCloser(port, timeout, time.Millisecond*20)
+
+		if protocol == data.PointValueModbusASCII {
+			return modbus.NewASCII(rr), nil
+		}
+
+		return modbus.NewRTU(rr), nil
+	}
+
+	go func() {
+		results, err := modbus.Scan(ctx, open, scan.req.ScanConfig, debugLevel,
+			func(r modbus.ScanResult) {
+				if debugLevel > 0 {
+					log.Println("Modbus scan found device:", r)
+				}
+			})
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = errors.New("scan timed out")
+		}
+
+		select {
+		case b.chScanDone <- modbusScanDone{scan, results, err}:
+		case <-b.stop:
+		}
+	}()
+
+	return nil
+}
+
+// scanDone is called by the Run routine when a scan is complete. The
+// caller must set up the port again.
+func (b *ModbusClient) scanDone(done modbusScanDone) {
+	b.scanCancel()
+	b.scanCancel = nil
+
+	resp := ModbusScanResponse{Results: done.results}
+
+	err := done.err
+	if err == nil && done.scan.req.CreateNodes && b.busNode != nil {
+		err = b.createScanNodes(done.scan.req.ScanConfig, done.results)
+	}
+
+	if err != nil {
+		resp.ErrorMessage = err.Error()
+	}
+
+	done.scan.resp <- resp
+}
+
+// createScanNodes creates a placeholder IO for each device found in a scan
+// that does not already have IOs on the bus
+func (b *ModbusClient) createScanNodes(config modbus.ScanConfig, results []modbus.ScanResult) error {
+	existing := make(map[int]bool)
+	for _, io := range b.ios {
+		existing[io.id] = true
+	}
+
+	ioType := "holding"
+	if config.Input {
+		ioType = "input"
+	}
+
+	for _, r := range results {
+		if existing[r.ID] {
+			continue
+		}
+		existing[r.ID] = true
+
+		name := fmt.Sprintf("Device %v (scan)", r.ID)
+		if r.Baud != b.busNode.baud || r.Parity != "N" {
+			name = fmt.Sprintf("Device %v (scan %v %v)", r.ID, r.Baud, r.Parity)
+		}
+
+		profile := ModbusProfile{
+			IOs: []ModbusProfileIO{{
+				Name:    name,
+				Address: config.Address,
+				Type:    ioType,
+				Format:  data.PointValueUINT16,
+				Scale:   1,
+			}},
+		}
+
+		nodes, err := profile.Nodes(b.busNode.nodeID, r.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range nodes {
+			err := SendNode(b.nc, n, "modbusScan")
+			if err != nil {
+				return fmt.Errorf("Error creating IO node: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ModbusScan sends a scan request to a modbus bus node and returns the
+// devices found. Scans can take a long time, so timeout should allow for
+// the number of IDs, bauds, and parities being scanned.
+func ModbusScan(nc *nats.Conn, busID string, req ModbusScanRequest,
+	timeout time.Duration) ([]modbus.ScanResult, error) {
+	reqData, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := nc.Request(SubjectModbusScan(busID), reqData, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ModbusScanResponse
+	err = json.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.ErrorMessage != "" {
+		return resp.Results, errors.New(resp.ErrorMessage)
+	}
+
+	return resp.Results, nil
+}
@@ -0,0 +1,1191 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/modbus"
+	"github.com/simpleiot/simpleiot/respreader"
+	"go.bug.st/serial"
+)
+
+// Modbus describes a modbus bus node. GatewayUnitTimeouts are keyed by unit
+// ID (1-247) and override GatewayTimeout for that unit.
+type Modbus struct {
+	ID                  string         `node:"id"`
+	Parent              string         `node:"parent"`
+	Description         string         `point:"description"`
+	ClientServer        string         `point:"clientServer"`
+	Protocol            string         `point:"protocol"`
+	Port                string         `point:"port"`
+	Baud                string         `point:"baud"`
+	URI                 string         `point:"uri"`
+	ServerID            int            `point:"id"`
+	PollPeriod          int            `point:"pollPeriod"`
+	ReadMaxGap          int            `point:"readMaxGap"`
+	GatewayPort         string         `point:"gatewayPort"`
+	GatewayTimeout      int            `point:"gatewayTimeout"`
+	GatewayUnitTimeouts map[string]int `point:"gatewayUnitTimeout"`
+	Debug               int            `point:"debug"`
+	Disabled            bool           `point:"disabled"`
+	ErrorCount          int            `point:"errorCount"`
+	ErrorCountCRC       int            `point:"errorCountCRC"`
+	ErrorCountEOF       int            `point:"errorCountEOF"`
+	ErrorCountReset     bool           `point:"errorCountReset"`
+	ErrorCountCRCReset  bool           `point:"errorCountCRCReset"`
+	ErrorCountEOFReset  bool           `point:"errorCountEOFReset"`
+	IOs                 []ModbusIO     `child:"modbusIo"`
+}
+
+// ModbusIO describes a modbus IO node. DeviceID is the modbus ID of the
+// device on a client bus.
+type ModbusIO struct {
+	ID                 string  `node:"id"`
+	Parent             string  `node:"parent"`
+	Description        string  `point:"description"`
+	DeviceID           int     `point:"id"`
+	Address            int     `point:"address"`
+	ModbusIOType       string  `point:"modbusIoType"`
+	DataFormat         string  `point:"dataFormat"`
+	ByteOrder          string  `point:"byteOrder"`
+	BitIndex           int     `point:"bitIndex"`
+	RegCount           int     `point:"regCount"`
+	ReadOnly           bool    `point:"readOnly"`
+	Scale              float64 `point:"scale"`
+	Offset             float64 `point:"offset"`
+	Value              float64 `point:"value"`
+	ValueText          string  `point:"value"`
+	ValueSet           float64 `point:"valueSet"`
+	ValueSetText       string  `point:"valueSet"`
+	Disabled           bool    `point:"disabled"`
+	ErrorCount         int     `point:"errorCount"`
+	ErrorCountCRC      int     `point:"errorCountCRC"`
+	ErrorCountEOF      int     `point:"errorCountEOF"`
+	ErrorCountReset    bool    `point:"errorCountReset"`
+	ErrorCountCRCReset bool    `point:"errorCountCRCReset"`
+	ErrorCountEOFReset bool    `point:"errorCountEOFReset"`
+}
+
+type server interface {
+	Close() error
+	Listen(func(error), func(), func())
+}
+
+// ModbusClient is a SIOT client that runs a modbus bus as a client (master)
+// or server (slave)
+type ModbusClient struct {
+	nc     *nats.Conn
+	config Modbus
+	// busNode is nil if the bus config is not valid
+	busNode *modbusNode
+	ios     map[string]*modbusIONode
+
+	// data associated with running the bus
+	scanSub      *nats.Subscription
+	regs         *modbus.Regs
+	client       *modbus.Client
+	server       server
+	gateway      *modbus.Gateway
+	gwServer     *modbus.TCPServer
+	serialPort   serial.Port
+	ioErrorCount int
+
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	chRegChange   chan bool
+	chScan        chan modbusScan
+	chScanDone    chan modbusScanDone
+	// scanCancel is set while a scan is running
+	scanCancel context.CancelFunc
+}
+
+// NewModbusClient returns a new ModbusClient with a NATS connection and a config
+func NewModbusClient(nc *nats.Conn, config Modbus) Client {
+	return &ModbusClient{
+		nc:            nc,
+		config:        config,
+		ios:           make(map[string]*modbusIONode),
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		chRegChange:   make(chan bool),
+		chScan:        make(chan modbusScan),
+		chScanDone:    make(chan modbusScanDone),
+	}
+}
+
+// Stop sends a signal to the Run function to exit
+func (b *ModbusClient) Stop(_ error) {
+	close(b.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (b *ModbusClient) Points(nodeID string, points []data.Point) {
+	b.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (b *ModbusClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	b.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
+
+// updateBusNode converts the bus config to the runtime bus state
+func (b *ModbusClient) updateBusNode() {
+	busNode, err := newModbusNode(b.config)
+	if err != nil {
+		log.Printf("Modbus %v config error: %v\n", b.config.Description, err)
+		b.busNode = nil
+		return
+	}
+	b.busNode = busNode
+}
+
+// addIO adds an IO from its config. IOs that are not fully configured are
+// added when their config is complete.
+func (b *ModbusClient) addIO(c ModbusIO) {
+	ioNode, err := newModbusIONode(c)
+	if err != nil {
+		if b.config.Debug > 0 {
+			log.Printf("Modbus IO %v: %v\n", c.Description, err)
+		}
+		return
+	}
+	b.ios[c.ID] = ioNode
+	b.InitRegs(ioNode)
+}
+
+// ioConfig returns the current config of an IO
+func (b *ModbusClient) ioConfig(id string) (ModbusIO, bool) {
+	for _, c := range b.config.IOs {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return ModbusIO{}, false
+}
+
+// subscribeScan handles scan requests. Scans are started by the Run routine
+// as they need the port.
+func (b *ModbusClient) subscribeScan() error {
+	var err error
+	b.scanSub, err = b.nc.Subscribe(SubjectModbusScan(b.config.ID),
+		func(msg *nats.Msg) {
+			var resp ModbusScanResponse
+			var req ModbusScanRequest
+
+			err := json.Unmarshal(msg.Data, &req)
+			if err != nil {
+				resp.ErrorMessage = "decoding scan request: " + err.Error()
+			} else {
+				scan := modbusScan{req: req, resp: make(chan ModbusScanResponse, 1)}
+				select {
+				case b.chScan <- scan:
+					// the scan is stopped after MaxDuration, so
+					// this only times out if the bus is stuck
+					select {
+					case resp = <-scan.resp:
+					case <-time.After(req.MaxDuration() + 10*time.Second):
+						resp.ErrorMessage = "timeout waiting for scan"
+					case <-b.stop:
+						resp.ErrorMessage = "bus stopped"
+					}
+				case <-time.After(10 * time.Second):
+					// bus is stopped or stuck
+					resp.ErrorMessage = "timeout waiting for bus"
+				}
+			}
+
+			respData, err := json.Marshal(resp)
+			if err != nil {
+				log.Println("Error encoding scan response:", err)
+				return
+			}
+
+			err = msg.Respond(respData)
+			if err != nil {
+				log.Println("Error responding to scan request:", err)
+			}
+		})
+
+	return err
+}
+
+// SendPoint sends a point over nats
+func (b *ModbusClient) SendPoint(nodeID, pointType string, value float64) error {
+	// send the point
+	p := data.Point{
+		Time:  time.Now(),
+		Type:  pointType,
+		Value: value,
+	}
+
+	return SendNodePoint(b.nc, nodeID, p, true)
+}
+
+// WriteBusHoldingReg used to write register values to bus
+// should only be used by client. Values that span multiple registers
+// are written in one transaction so the device sees the update atomically.
+func (b *ModbusClient) WriteBusHoldingReg(io *modbusIONode) error {
+	if io.modbusDataType == data.PointValueBit {
+		// mask write so the device changes the bit and we don't
+		// overwrite other bits that changed since the last read
+		bit := uint16(1) << uint16(io.bitIndex)
+		var orMask uint16
+		if data.FloatToBool(io.valueSet) {
+			orMask = bit
+		}
+
+		return b.client.MaskWriteReg(byte(io.id), uint16(io.address), ^bit, orMask)
+	}
+
+	regs, err := io.encodeRegs(io.valueSet, io.valueSetText)
+	if err != nil {
+		return err
+	}
+
+	if len(regs) == 1 {
+		return b.client.WriteSingleReg(byte(io.id), uint16(io.address), regs[0])
+	}
+
+	return b.client.WriteMultipleRegs(byte(io.id), uint16(io.address), regs)
+}
+
+// ReadBusReg reads an io value from a reg from bus
+// this function modifies io.value
+func (b *ModbusClient) ReadBusReg(io *modbusIONode) error {
+	readFunc := b.client.ReadHoldingRegs
+	switch io.modbusIOType {
+	case data.PointValueModbusHoldingRegister:
+	case data.PointValueModbusInputRegister:
+		readFunc = b.client.ReadInputRegs
+	default:
+		return fmt.Errorf("ReadBusReg: unsupported modbus IO type: %v",
+			io.modbusIOType)
+	}
+
+	regs, err := readFunc(byte(io.id), uint16(io.address),
+		uint16(io.regCount()))
+	if err != nil {
+		return err
+	}
+
+	return b.updateRegValue(io, regs)
+}
+
+// updateRegValue decodes register data read from the bus for an io
+// and sends the value if it changed.
+func (b *ModbusClient) updateRegValue(io *modbusIONode, regs []uint16) error {
+	value, text, err := io.decodeRegs(regs)
+	if err != nil {
+		return err
+	}
+
+	return b.updateValue(io, value, text)
+}
+
+// updateValue sends the io value if it changed, or periodically so
+// that history is populated even if the value is not changing.
+func (b *ModbusClient) updateValue(io *modbusIONode, value float64, text string) error {
+	if value != io.value || text != io.valueText ||
+		time.Since(io.lastSent) > time.Minute*10 {
+		io.value = value
+		io.valueText = text
+		err := b.sendValue(io.nodeID, value, text)
+		if err != nil {
+			return err
+		}
+		io.lastSent = time.Now()
+	}
+
+	return nil
+}
+
+// sendValue sends a value point. text is used for string data formats.
+func (b *ModbusClient) sendValue(nodeID string, value float64, text string) error {
+	p := data.Point{
+		Time:  time.Now(),
+		Type:  data.PointTypeValue,
+		Value: value,
+		Text:  text,
+	}
+
+	return SendNodePoint(b.nc, nodeID, p, true)
+}
+
+// ReadBusBit is used to read coil of discrete input values from bus
+// this function modifies io.value. This should only be called from client.
+func (b *ModbusClient) ReadBusBit(io *modbusIONode) error {
+	readFunc := b.client.ReadCoils
+	switch io.modbusIOType {
+	case data.PointValueModbusCoil:
+	case data.PointValueModbusDiscreteInput:
+		readFunc = b.client.ReadDiscreteInputs
+	default:
+		return fmt.Errorf("ReadBusBit: unhandled modbusIOType: %v",
+			io.modbusIOType)
+	}
+	bits, err := readFunc(byte(io.id), uint16(io.address), 1)
+	if err != nil {
+		return err
+	}
+	if len(bits) < 1 {
+		return errors.New("Did not receive enough data")
+	}
+
+	return b.updateValue(io, data.BoolToFloat(bits[0]), "")
+}
+
+// ReadBusBlock reads all IOs in a block with a single request. This
+// should only be called from client.
+func (b *ModbusClient) ReadBusBlock(blk modbusReadBlock) error {
+	switch blk.ioType {
+	case data.PointValueModbusCoil, data.PointValueModbusDiscreteInput:
+		readFunc := b.client.ReadCoils
+		if blk.ioType == data.PointValueModbusDiscreteInput {
+			readFunc = b.client.ReadDiscreteInputs
+		}
+
+		bits, err := readFunc(byte(blk.id), uint16(blk.address), uint16(blk.count))
+		if err != nil {
+			return err
+		}
+		if len(bits) < blk.count {
+			return errors.New("Did not receive enough data")
+		}
+
+		for _, io := range blk.ios {
+			err := b.updateValue(io,
+				data.BoolToFloat(bits[io.address-blk.address]), "")
+			if err != nil {
+				return err
+			}
+		}
+
+	case data.PointValueModbusHoldingRegister, data.PointValueModbusInputRegister:
+		readFunc := b.client.ReadHoldingRegs
+		if blk.ioType == data.PointValueModbusInputRegister {
+			readFunc = b.client.ReadInputRegs
+		}
+
+		regs, err := readFunc(byte(blk.id), uint16(blk.address), uint16(blk.count))
+		if err != nil {
+			return err
+		}
+		if len(regs) < blk.count {
+			return errors.New("Did not receive enough data")
+		}
+
+		for _, io := range blk.ios {
+			start := io.address - blk.address
+			end := start + io.regCount()
+			err := b.updateRegValue(io, regs[start:end])
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("ReadBusBlock: unhandled modbusIOType: %v", blk.ioType)
+	}
+
+	return nil
+}
+
+// ScanClientIOs reads all enabled IOs on a client bus, coalescing IOs that
+// are close together into block reads, and then writes any pending values.
+func (b *ModbusClient) ScanClientIOs() {
+	if b.client == nil {
+		return
+	}
+
+	var ios []*modbusIONode
+	for _, io := range b.ios {
+		if !io.disabled {
+			ios = append(ios, io)
+		}
+	}
+
+	for _, blk := range planModbusReads(ios, b.busNode.readMaxGap) {
+		err := b.ReadBusBlock(blk)
+		if err == nil {
+			continue
+		}
+
+		var excErr modbus.ExceptionCode
+		if len(blk.ios) > 1 && errors.As(err, &excErr) {
+			// the device rejected the block, possibly because it spans
+			// unmapped registers, so fall back to reading IOs one at a time
+			for _, io := range blk.ios {
+				err := b.clientRead(io)
+				if err != nil {
+					b.logClientError(io, err)
+				}
+			}
+			continue
+		}
+
+		for _, io := range blk.ios {
+			b.logClientError(io, err)
+		}
+	}
+
+	for _, io := range ios {
+		err := b.clientWrite(io)
+		if err != nil {
+			b.logClientError(io, err)
+		}
+	}
+}
+
+func (b *ModbusClient) logClientError(io *modbusIONode, err error) {
+	err = b.LogError(io, err)
+	if err != nil {
+		log.Println("Error logging modbus error:", err)
+	}
+}
+
+// ClientIO processes an IO on a client bus
+func (b *ModbusClient) ClientIO(io *modbusIONode) error {
+
+	if b.client == nil {
+		return errors.New("client is not set up")
+	}
+
+	// read value from remote device and update regs
+	err := b.clientRead(io)
+	if err != nil {
+		return err
+	}
+
+	return b.clientWrite(io)
+}
+
+// clientRead reads the value of a single IO from the remote device
+func (b *ModbusClient) clientRead(io *modbusIONode) error {
+	switch io.modbusIOType {
+	case data.PointValueModbusCoil, data.PointValueModbusDiscreteInput:
+		return b.ReadBusBit(io)
+	case data.PointValueModbusHoldingRegister, data.PointValueModbusInputRegister:
+		return b.ReadBusReg(io)
+	default:
+		return fmt.Errorf("unhandled modbus io type, io: %+v", io)
+	}
+}
+
+// clientWrite writes valueSet to the remote device if it differs from the
+// last value read.
+func (b *ModbusClient) clientWrite(io *modbusIONode) error {
+	if io.readOnly || !io.writePending() {
+		return nil
+	}
+
+	switch io.modbusIOType {
+	case data.PointValueModbusCoil:
+		vBool := data.FloatToBool(io.valueSet)
+		// we need set the remote value
+		err := b.client.WriteSingleCoil(byte(io.id), uint16(io.address),
+			vBool)
+
+		if err != nil {
+			return err
+		}
+
+	case data.PointValueModbusHoldingRegister:
+		// we need set the remote value
+		err := b.WriteBusHoldingReg(io)
+
+		if err != nil {
+			return err
+		}
+
+	default:
+		return nil
+	}
+
+	return b.sendValue(io.nodeID, io.valueSet, io.valueSetText)
+}
+
+// ServerIO processes an IO on a server bus
+func (b *ModbusClient) ServerIO(io *modbusIONode) error {
+	// update regs with db value
+	switch io.modbusIOType {
+	case data.PointValueModbusDiscreteInput:
+		err := b.regs.WriteCoil(io.address, data.FloatToBool(io.value))
+		if err != nil {
+			return err
+		}
+	case data.PointValueModbusCoil:
+		regValue, err := b.regs.ReadCoil(io.address)
+		if err != nil {
+			return err
+		}
+
+		dbValue := data.FloatToBool(io.value)
+
+		if regValue != dbValue {
+			err = b.SendPoint(io.nodeID, data.PointTypeValue, data.BoolToFloat(regValue))
+			if err != nil {
+				return err
+			}
+		}
+
+	case data.PointValueModbusInputRegister:
+		err := b.WriteReg(io)
+		if err != nil {
+			return err
+		}
+
+	case data.PointValueModbusHoldingRegister:
+		v, text, err := b.ReadReg(io)
+		if err != nil {
+			return err
+		}
+
+		if io.value != v || io.valueText != text {
+			err = b.sendValue(io.nodeID, v, text)
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("unhandled modbus io type: %v", io.modbusIOType)
+	}
+
+	return nil
+}
+
+// InitRegs is used in server mode to initilize the internal modbus regs when a IO changes
+func (b *ModbusClient) InitRegs(io *modbusIONode) {
+	if b.server == nil {
+		return
+	}
+
+	// we initialize all values from database, even if they are written from
+	// another device so that we preserve the last known state
+	switch io.modbusIOType {
+	case data.PointValueModbusDiscreteInput:
+		b.regs.AddCoil(io.address)
+		err := b.regs.WriteCoil(io.address, data.FloatToBool(io.value))
+		if err != nil {
+			log.Println("Error writing coil:", err)
+		}
+	case data.PointValueModbusCoil:
+		b.regs.AddCoil(io.address)
+		err := b.regs.WriteCoil(io.address, data.FloatToBool(io.value))
+		if err != nil {
+			log.Println("Error writing coil:", err)
+		}
+	case data.PointValueModbusInputRegister:
+		b.regs.AddReg(io.address, io.regCount())
+		err := b.WriteReg(io)
+		if err != nil {
+			log.Println("Error writing reg:", err)
+		}
+	case data.PointValueModbusHoldingRegister:
+		b.regs.AddReg(io.address, io.regCount())
+		err := b.WriteReg(io)
+		if err != nil {
+			log.Println("Error writing reg:", err)
+		}
+	}
+}
+
+// ReadReg reads an value from a reg (internal, not bus)
+// This should only be used on server
+func (b *ModbusClient) ReadReg(io *modbusIONode) (float64, string, error) {
+	regs, err := b.regs.ReadRegs(io.address, io.regCount())
+	if err != nil {
+		return 0, "", err
+	}
+
+	return io.decodeRegs(regs)
+}
+
+// WriteReg writes an io value to a reg
+// This should only be used on server
+func (b *ModbusClient) WriteReg(io *modbusIONode) error {
+	if io.modbusDataType == data.PointValueBit {
+		return b.regs.WriteRegBit(io.address, io.bitIndex,
+			data.FloatToBool(io.value))
+	}
+
+	regs, err := io.encodeRegs(io.value, io.valueText)
+	if err != nil {
+		return err
+	}
+
+	return b.regs.WriteRegs(io.address, regs)
+}
+
+// LogError ...
+func (b *ModbusClient) LogError(io *modbusIONode, err error) error {
+	busCount := 0
+	ioCount := 0
+
+	if b.busNode.debugLevel >= 1 {
+		log.Printf("Modbus %v:%v, error: %v\n",
+			b.busNode.portName, io.description, err)
+	}
+
+	// if broken pipe error then close connection
+	if errors.Is(err, syscall.EPIPE) {
+		if b.busNode.debugLevel >= 1 {
+			log.Printf("Broken pipe, closing connection")
+		}
+		b.ClosePort()
+	}
+
+	errType := modbusErrorToPointType(err)
+	switch errType {
+	case data.PointTypeErrorCountEOF:
+		busCount = b.busNode.errorCountEOF
+		ioCount = io.errorCountEOF
+		b.busNode.errorCountEOF++
+		io.errorCountEOF++
+	case data.PointTypeErrorCountCRC:
+		busCount = b.busNode.errorCountCRC
+		ioCount = io.errorCountCRC
+		b.busNode.errorCountCRC++
+		io.errorCountCRC++
+	default:
+		// probably a more general serial port error
+		b.ioErrorCount++
+		errType = data.PointTypeErrorCount
+		busCount = b.busNode.errorCount
+		ioCount = io.errorCount
+		b.busNode.errorCount++
+		io.errorCount++
+	}
+
+	busCount++
+	ioCount++
+
+	p := data.Point{
+		Type:  errType,
+		Value: float64(busCount),
+	}
+
+	err = b.sendBusPoints(data.Points{p}, false)
+	if err != nil {
+		return err
+	}
+
+	p.Value = float64(ioCount)
+	return SendNodePoint(b.nc, io.nodeID, p, false)
+}
+
+// sendBusPoints sends points to the bus node. The Manager does not send
+// points that originate from this client back to it, so they are also merged
+// into the bus config.
+func (b *ModbusClient) sendBusPoints(pts data.Points, ack bool) error {
+	err := data.MergePoints(b.config.ID, pts, &b.config)
+	if err != nil {
+		return err
+	}
+
+	return SendNodePoints(b.nc, b.config.ID, pts, ack)
+}
+
+// ClosePort closes both the server and client ports
+func (b *ModbusClient) ClosePort() {
+	if b.gwServer != nil {
+		err := b.gwServer.Close()
+		if err != nil {
+			log.Println("Error closing gateway server:", err)
+		}
+		b.gwServer = nil
+	}
+
+	if b.gateway != nil {
+		_ = b.gateway.Close()
+		b.gateway = nil
+	}
+
+	if b.server != nil {
+		err := b.server.Close()
+		if err != nil {
+			log.Println("Error closing server:", err)
+		}
+		b.server = nil
+	}
+
+	if b.client != nil {
+		err := b.client.Close()
+		if err != nil {
+			log.Println("Error closing client:", err)
+		}
+		b.client = nil
+	}
+}
+
+// SetupPort sets up io for the bus
+func (b *ModbusClient) SetupPort() error {
+	if b.busNode.debugLevel >= 1 {
+		log.Println("modbus: setting up modbus transport:", b.busNode.portName)
+	}
+
+	b.ClosePort()
+
+	var transport modbus.Transport
+
+	switch b.busNode.protocol {
+	case data.PointValueRTU, data.PointValueModbusASCII:
+		mode := &serial.Mode{
+			BaudRate: b.busNode.baud,
+		}
+
+		var err error
+		b.serialPort, err = serial.Open(b.busNode.portName, mode)
+		if err != nil {
+			b.serialPort = nil
+			return fmt.Errorf("Error opening serial port: %w", err)
+		}
+
+		if b.busNode.protocol == data.PointValueRTU {
+			port := respreader.NewReadWriteCloser(b.serialPort, time.Millisecond*100, time.Millisecond*20)
+			transport = modbus.NewRTU(port)
+		} else {
+			// ASCII frames are delimited, so the chunk timeout only
+			// needs to be long enough to not spin. ASCII allows up to 1s
+			// between characters and the devices tend to be slow.
+			port := respreader.NewReadWriteCloser(b.serialPort, time.Second, time.Millisecond*20)
+			transport = modbus.NewASCII(port)
+		}
+	case data.PointValueTCP:
+		switch b.busNode.busType {
+		case data.PointValueClient:
+			sock, err := net.DialTimeout("tcp", b.busNode.uri, 5*time.Second)
+			if err != nil {
+				return err
+			}
+			transport = modbus.NewTCP(sock, 500*time.Millisecond,
+				modbus.TransportClient)
+		case data.PointValueServer:
+			// TCPServer does all the setup
+		default:
+			log.Println("setting up modbus TCP, invalid bus type:", b.busNode.busType)
+		}
+
+	default:
+		return fmt.Errorf("Unsupported modbus protocol: %v", b.busNode.protocol)
+	}
+
+	if b.busNode.busType == data.PointValueServer {
+		b.regs = &modbus.Regs{}
+		if b.busNode.protocol == data.PointValueRTU ||
+			b.busNode.protocol == data.PointValueModbusASCII {
+			b.server = modbus.NewServer(byte(b.busNode.id), transport,
+				b.regs, b.busNode.debugLevel)
+		} else if b.busNode.protocol == data.PointValueTCP {
+			var err error
+			b.server, err = modbus.NewTCPServer(b.busNode.id, 5,
+				b.busNode.portName, b.regs, b.busNode.debugLevel)
+			if err != nil {
+				b.server = nil
+				return err
+			}
+		} else {
+			return errors.New("Modbus protocol not set")
+		}
+
+		go b.server.Listen(func(err error) {
+			log.Println("Modbus server error:", err)
+		}, func() {
+			if b.busNode.debugLevel > 0 {
+				log.Println("Modbus reg change")
+			}
+			b.chRegChange <- true
+		}, func() {
+			if b.busNode.debugLevel > 0 {
+				log.Println("Modbus Listener done")
+			}
+		})
+
+		for _, io := range b.ios {
+			b.InitRegs(io)
+		}
+	} else if b.busNode.busType == data.PointValueClient {
+		b.client = modbus.NewClient(transport, b.busNode.debugLevel)
+
+		if b.busNode.gatewayPort != "" {
+			return b.setupGateway()
+		}
+	}
+
+	return nil
+}
+
+// setupGateway starts a Modbus TCP server that forwards requests to devices
+// on this bus. The client is shared with IO polling.
+func (b *ModbusClient) setupGateway() error {
+	b.gateway = modbus.NewGateway(b.client,
+		time.Millisecond*time.Duration(b.busNode.gatewayTimeout), 32,
+		b.busNode.debugLevel)
+
+	for id, timeout := range b.busNode.gatewayUnitTimeouts {
+		b.gateway.SetUnitTimeout(id, time.Millisecond*time.Duration(timeout))
+	}
+
+	var err error
+	b.gwServer, err = modbus.NewTCPGateway(5, b.busNode.gatewayPort,
+		b.gateway, b.busNode.debugLevel)
+	if err != nil {
+		b.gwServer = nil
+		return fmt.Errorf("Error starting modbus gateway: %w", err)
+	}
+
+	go b.gwServer.Listen(func(err error) {
+		log.Println("Modbus gateway error:", err)
+	}, func() {}, func() {
+		if b.busNode.debugLevel > 0 {
+			log.Println("Modbus gateway listener done")
+		}
+	})
+
+	return nil
+}
+
+// Run the main logic for the bus and blocks until stopped. Bus and IO config
+// changes are received from the Manager and applied immediately. IOs that are
+// added or removed cause the Manager to restart the client.
+//
+// This routine may need to run fast scan times, so it should not be doing
+// slow things like reading the database.
+func (b *ModbusClient) Run() error {
+	log.Println("Starting modbus client:", b.config.Description)
+
+	b.updateBusNode()
+
+	for _, c := range b.config.IOs {
+		b.addIO(c)
+	}
+
+	err := b.subscribeScan()
+	if err != nil {
+		return fmt.Errorf("Error subscribing to modbus scan: %w", err)
+	}
+
+	defer func() {
+		err := b.scanSub.Unsubscribe()
+		if err != nil {
+			log.Println("Error unsubscribing from bus scan:", err)
+		}
+	}()
+
+	scanTimer := time.NewTicker(24 * time.Hour)
+	defer scanTimer.Stop()
+
+	setScanTimer := func() {
+		if b.busNode != nil && b.busNode.busType == data.PointValueClient {
+			scanTimer.Reset(time.Millisecond * time.Duration(b.busNode.pollPeriod))
+		} else {
+			scanTimer.Stop()
+		}
+	}
+
+	setScanTimer()
+
+	setupPort := func() {
+		if b.scanCancel != nil {
+			// the port is set up when the scan is done
+			return
+		}
+
+		b.ioErrorCount = 0
+		if b.busNode == nil || b.busNode.disabled {
+			b.ClosePort()
+			return
+		}
+
+		if err := b.SetupPort(); err != nil {
+			log.Println("SetupPort error:", err)
+		}
+	}
+
+	setupPort()
+
+	// the port is checked periodically as serial ports may be unplugged and
+	// plugged back in, or have too many errors
+	checkPortTicker := time.NewTicker(time.Second * 10)
+	defer checkPortTicker.Stop()
+
+	resetBusCount := func(countType, resetType string) {
+		err := b.sendBusPoints(data.Points{
+			{Type: countType, Value: 0},
+			{Type: resetType, Value: 0},
+		}, true)
+		if err != nil {
+			log.Println("Send point error:", err)
+		}
+		b.updateBusNode()
+	}
+
+	for {
+		select {
+		case <-b.stop:
+			log.Println("Stopping modbus client:", b.config.Description)
+			if b.scanCancel != nil {
+				b.scanCancel()
+			}
+			b.ClosePort()
+			return nil
+
+		case pts := <-b.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &b.config)
+			if err != nil {
+				log.Println("Modbus: error merging new points:", err)
+			}
+
+			if pts.ID == b.config.ID {
+				valid := b.busNode != nil
+				b.updateBusNode()
+				setup := valid != (b.busNode != nil)
+
+				for _, p := range pts.Points {
+					switch p.Type {
+					case data.PointTypeClientServer,
+						data.PointTypeProtocol,
+						data.PointTypeID,
+						data.PointTypeDebug,
+						data.PointTypePort,
+						data.PointTypeBaud,
+						data.PointTypeURI,
+						data.PointTypeGatewayPort,
+						data.PointTypeGatewayTimeout,
+						data.PointTypeGatewayUnitTimeout,
+						data.PointTypeDisabled:
+						setup = true
+					case data.PointTypeErrorCountReset:
+						if b.config.ErrorCountReset {
+							resetBusCount(data.PointTypeErrorCount,
+								data.PointTypeErrorCountReset)
+						}
+					case data.PointTypeErrorCountCRCReset:
+						if b.config.ErrorCountCRCReset {
+							resetBusCount(data.PointTypeErrorCountCRC,
+								data.PointTypeErrorCountCRCReset)
+						}
+					case data.PointTypeErrorCountEOFReset:
+						if b.config.ErrorCountEOFReset {
+							resetBusCount(data.PointTypeErrorCountEOF,
+								data.PointTypeErrorCountEOFReset)
+						}
+					}
+				}
+
+				if setup {
+					setupPort()
+				}
+
+				setScanTimer()
+				continue
+			}
+
+			io, ok := b.ios[pts.ID]
+			if !ok {
+				// IO may not have been fully configured yet
+				for _, c := range b.config.IOs {
+					if c.ID == pts.ID {
+						b.addIO(c)
+					}
+				}
+				continue
+			}
+
+			valueModified := false
+			valueSetModified := false
+			layoutModified := false
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeValue:
+					valueModified = true
+				case data.PointTypeValueSet:
+					valueSetModified = true
+				case data.PointTypeAddress, data.PointTypeModbusIOType,
+					data.PointTypeDataFormat, data.PointTypeRegCount,
+					data.PointTypeBitIndex, data.PointTypeByteOrder:
+					layoutModified = true
+				case data.PointTypeErrorCountReset:
+					io.errorCountReset = data.FloatToBool(p.Value)
+					if io.errorCountReset {
+						p := data.Point{Type: data.PointTypeErrorCount, Value: 0}
+						err := SendNodePoint(b.nc, io.nodeID, p, true)
+						if err != nil {
+							log.Println("Send point error:", err)
+						}
+
+						p = data.Point{Type: data.PointTypeErrorCountReset, Value: 0}
+						err = SendNodePoint(b.nc, io.nodeID, p, true)
+						if err != nil {
+							log.Println("Send point error:", err)
+						}
+					}
+
+				case data.PointTypeErrorCountEOFReset:
+					io.errorCountEOFReset = data.FloatToBool(p.Value)
+					if io.errorCountEOFReset {
+						p := data.Point{Type: data.PointTypeErrorCountEOF, Value: 0}
+						err := SendNodePoint(b.nc, io.nodeID, p, true)
+						if err != nil {
+							log.Println("Send point error:", err)
+						}
+
+						p = data.Point{Type: data.PointTypeErrorCountEOFReset, Value: 0}
+						err = SendNodePoint(b.nc, io.nodeID, p, true)
+						if err != nil {
+							log.Println("Send point error:", err)
+						}
+					}
+
+				case data.PointTypeErrorCountCRCReset:
+					io.errorCountCRCReset = data.FloatToBool(p.Value)
+					if io.errorCountCRCReset {
+						p := data.Point{Type: data.PointTypeErrorCountCRC, Value: 0}
+						err := SendNodePoint(b.nc, io.nodeID, p, true)
+						if err != nil {
+							log.Println("Send point error:", err)
+						}
+
+						p = data.Point{Type: data.PointTypeErrorCountCRCReset, Value: 0}
+						err = SendNodePoint(b.nc, io.nodeID, p, true)
+						if err != nil {
+							log.Println("Send point error:", err)
+						}
+					}
+				}
+			}
+
+			// the IO is rebuilt from its config so that all the points
+			// that change how registers are read and written are updated
+			// together. If the new register layout is not valid, the
+			// current layout is kept and the other points are applied.
+			c, ok := b.ioConfig(pts.ID)
+			if !ok {
+				continue
+			}
+			ioNode, err := newModbusIONode(c)
+			if err != nil {
+				if layoutModified {
+					log.Printf("Modbus IO %v: ignoring register layout change: %v\n",
+						io.description, err)
+				}
+				ioNode, err = newModbusIONode(io.keepLayout(c))
+				if err != nil {
+					log.Printf("Modbus IO %v: error applying config: %v\n",
+						io.description, err)
+					continue
+				}
+			}
+
+			ioNode.lastSent = io.lastSent
+			b.ios[pts.ID] = ioNode
+			io = ioNode
+			if layoutModified {
+				b.InitRegs(io)
+			}
+
+			if valueModified && b.busNode != nil && b.busNode.busType == data.PointValueServer {
+				err := b.ServerIO(io)
+				if err != nil {
+					err := b.LogError(io, err)
+					if err != nil {
+						log.Println("Error logging error:", err)
+					}
+				}
+			}
+
+			// writes during a scan are done by the first poll after it
+			if valueSetModified && b.busNode != nil && b.busNode.busType == data.PointValueClient &&
+				b.scanCancel == nil &&
+				(io.modbusIOType == data.PointValueModbusCoil ||
+					io.modbusIOType == data.PointValueModbusHoldingRegister) &&
+				io.writePending() {
+				err := b.ClientIO(io)
+				if err != nil {
+					err := b.LogError(io, err)
+					if err != nil {
+						log.Println("Error logging error:", err)
+					}
+				}
+			}
+
+		case <-b.newEdgePoints:
+			// edge points are not used
+
+		case <-b.chRegChange:
+			// this only happens on modbus servers
+			for _, io := range b.ios {
+				err := b.ServerIO(io)
+				if err != nil {
+					err := b.LogError(io, err)
+					if err != nil {
+						log.Println("Error logging modbus error:", err)
+					}
+				}
+			}
+
+		case <-checkPortTicker.C:
+			if b.busNode == nil || b.busNode.disabled || b.scanCancel != nil {
+				continue
+			}
+
+			var portError error
+			if b.serialPort != nil {
+				// the following handles cases where serial port
+				// may have been unplugged and plugged back in
+				_, portError = b.serialPort.GetModemStatusBits()
+			}
+
+			if (b.client == nil && b.server == nil) ||
+				b.ioErrorCount > 10 || portError != nil {
+				if b.busNode.debugLevel >= 1 {
+					log.Printf("Re-initializing modbus port, err cnt: %v, portError: %v\n", b.ioErrorCount, portError)
+				}
+				setupPort()
+			}
+
+		case <-scanTimer.C:
+			// polling is paused while the bus is scanned for devices
+			if b.busNode != nil && b.busNode.busType == data.PointValueClient &&
+				!b.busNode.disabled && b.scanCancel == nil {
+				// for scanning, we only need to process client ios
+				b.ScanClientIOs()
+			}
+
+		case scan := <-b.chScan:
+			err := b.startScan(scan)
+			if err != nil {
+				scan.resp <- ModbusScanResponse{ErrorMessage: err.Error()}
+			}
+
+		case done := <-b.chScanDone:
+			b.scanDone(done)
+			setupPort()
+		}
+	}
+}
+
+func modbusErrorToPointType(err error) string {
+	switch err {
+	case io.EOF:
+		return data.PointTypeErrorCountEOF
+	case modbus.ErrCRC:
+		return data.PointTypeErrorCountCRC
+	default:
+		return ""
+	}
+}
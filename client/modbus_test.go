@@ -0,0 +1,242 @@
+package client_test
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+// testModbusIO returns a uint16 holding register IO node
+func testModbusIO(id, parent string, value float64) data.NodeEdge {
+	return data.NodeEdge{
+		ID:     id,
+		Type:   data.NodeTypeModbusIO,
+		Parent: parent,
+		Points: data.Points{
+			{Type: data.PointTypeID, Value: 1},
+			{Type: data.PointTypeAddress, Value: 10},
+			{Type: data.PointTypeModbusIOType, Text: data.PointValueModbusHoldingRegister},
+			{Type: data.PointTypeDataFormat, Text: data.PointValueUINT16},
+			{Type: data.PointTypeScale, Value: 1},
+			{Type: data.PointTypeValue, Value: value},
+		},
+	}
+}
+
+// testWaitValue waits until check returns value
+func testWaitValue(t *testing.T, check func() (float64, error), value float64) {
+	t.Helper()
+	start := time.Now()
+	for {
+		v, err := check()
+		if err != nil {
+			t.Fatal("Error getting value: ", err)
+		}
+		if v == value {
+			return
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Timeout waiting for value %v, got %v", value, v)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestModbusTCP(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	// find a free port for the server bus
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	err = client.SendNodeType(nc, client.Modbus{
+		ID:           "ID-server",
+		Parent:       root.ID,
+		ClientServer: data.PointValueServer,
+		Protocol:     data.PointValueTCP,
+		Port:         port,
+		ServerID:     1,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending server bus: ", err)
+	}
+
+	err = client.SendNode(nc, testModbusIO("ID-server-io", "ID-server", 42), "test")
+	if err != nil {
+		t.Fatal("Error sending server IO: ", err)
+	}
+
+	// give the server time to start listening
+	time.Sleep(500 * time.Millisecond)
+
+	err = client.SendNodeType(nc, client.Modbus{
+		ID:           "ID-client",
+		Parent:       root.ID,
+		ClientServer: data.PointValueClient,
+		Protocol:     data.PointValueTCP,
+		URI:          "127.0.0.1:" + port,
+		PollPeriod:   100,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending client bus: ", err)
+	}
+
+	// the client IO is read only until valueSet is sent, otherwise the
+	// initial valueSet of 0 is written to the server
+	clientIO := testModbusIO("ID-client-io", "ID-client", 0)
+	clientIO.Points = append(clientIO.Points,
+		data.Point{Type: data.PointTypeReadOnly, Value: 1})
+
+	err = client.SendNode(nc, clientIO, "test")
+	if err != nil {
+		t.Fatal("Error sending client IO: ", err)
+	}
+
+	value := func(parent, id string) func() (float64, error) {
+		return func() (float64, error) {
+			nodes, err := client.GetNodes(nc, parent, id, "", false)
+			if err != nil || len(nodes) < 1 {
+				return 0, err
+			}
+			v, _ := nodes[0].Points.Value(data.PointTypeValue, "")
+			return v, nil
+		}
+	}
+
+	// client reads the server register
+	testWaitValue(t, value("ID-client", "ID-client-io"), 42)
+
+	// IO config changes are applied without restarting the bus
+	err = client.SendNodePoint(nc, "ID-client-io", data.Point{
+		Type: data.PointTypeScale, Value: 2, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending scale: ", err)
+	}
+
+	testWaitValue(t, value("ID-client", "ID-client-io"), 84)
+
+	// invalid IO config changes are ignored. ASCII data needs a register
+	// count, so the write below is still done as uint16.
+	err = client.SendNodePoint(nc, "ID-client-io", data.Point{
+		Type: data.PointTypeDataFormat, Text: data.PointValueASCII, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending data format: ", err)
+	}
+
+	// client writes to the server
+	err = client.SendNodePoints(nc, "ID-client-io", data.Points{
+		{Type: data.PointTypeValueSet, Value: 20, Origin: "test"},
+		{Type: data.PointTypeReadOnly, Value: 0, Origin: "test"},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending valueSet: ", err)
+	}
+
+	testWaitValue(t, value("ID-server", "ID-server-io"), 10)
+
+	// the IO config is fixed so the IO is still valid when the bus is
+	// restarted below, and it is made read only again so it does not
+	// write valueSet over the bit write
+	err = client.SendNodePoints(nc, "ID-client-io", data.Points{
+		{Type: data.PointTypeDataFormat, Text: data.PointValueUINT16, Origin: "test"},
+		{Type: data.PointTypeReadOnly, Value: 1, Origin: "test"},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending IO config: ", err)
+	}
+
+	// bits are written with a mask write, so the other bits in the
+	// register are not changed. Adding the IO restarts the bus.
+	bitIO := testModbusIO("ID-client-bit", "ID-client", 0)
+	bitIO.Points = append(bitIO.Points,
+		data.Point{Type: data.PointTypeDataFormat, Text: data.PointValueBit},
+		data.Point{Type: data.PointTypeBitIndex, Value: 0},
+		data.Point{Type: data.PointTypeValueSet, Value: 1})
+
+	err = client.SendNode(nc, bitIO, "test")
+	if err != nil {
+		t.Fatal("Error sending client bit IO: ", err)
+	}
+
+	testWaitValue(t, value("ID-server", "ID-server-io"), 11)
+	testWaitValue(t, value("ID-client", "ID-client-io"), 22)
+
+	// bus config changes are applied immediately
+	err = client.SendNodePoint(nc, "ID-client", data.Point{
+		Type: data.PointTypeDisabled, Value: 1, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending disabled: ", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	err = client.SendNodePoint(nc, "ID-server-io", data.Point{
+		Type: data.PointTypeValue, Value: 5, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending server value: ", err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	v, _ := value("ID-client", "ID-client-io")()
+	if v != 22 {
+		t.Error("Disabled bus read value: ", v)
+	}
+}
+
+func TestModbusScan(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	err = client.SendNodeType(nc, client.Modbus{
+		ID:           "ID-bus",
+		Parent:       root.ID,
+		ClientServer: data.PointValueClient,
+		Protocol:     data.PointValueRTU,
+		Port:         "/dev/siot-missing",
+		Baud:         "9600",
+		PollPeriod:   100,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending bus: ", err)
+	}
+
+	req := client.ModbusScanRequest{}
+	req.StartID, req.EndID = 1, 2
+
+	// scan errors are returned after the scan goroutine completes, and
+	// the bus can be scanned again
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		for {
+			_, err = client.ModbusScan(nc, "ID-bus", req, 5*time.Second)
+			if !errors.Is(err, nats.ErrNoResponders) || time.Since(start) > 5*time.Second {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		if err == nil || !strings.Contains(err.Error(), "opening serial port") {
+			t.Fatal("Expected error opening serial port, got: ", err)
+		}
+	}
+}
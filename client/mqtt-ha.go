@@ -0,0 +1,329 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// MQTTHomeAssistant publishes Home Assistant MQTT discovery config and
+// state for a SIOT node so that it shows up as an entity in Home Assistant.
+type MQTTHomeAssistant struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	Disabled    bool   `point:"disabled"`
+	// NodeID is the node exposed to Home Assistant
+	NodeID string `point:"nodeID"`
+	// Component is sensor or switch. If blank, it is determined from the
+	// node type: Shelly switch/light IOs and Modbus coils are switches,
+	// everything else is a sensor.
+	Component string `point:"component"`
+	// PointType is the state point. It defaults to switch or light for
+	// Shelly IOs and value for everything else.
+	PointType string `point:"pointType"`
+	// PointKey defaults to 0
+	PointKey string `point:"pointKey"`
+	// Units overrides the units point of the node
+	Units       string `point:"units"`
+	DeviceClass string `point:"deviceClass"`
+}
+
+const mqttHADefaultPrefix = "homeassistant"
+
+// Home Assistant component types
+const (
+	mqttHASensor = data.PointValueSensor
+	mqttHASwitch = data.PointValueSwitch
+)
+
+// mqttHABridgeTopic is the availability topic of the bridge itself. It is
+// set to offline by the broker (last will) if the bridge disconnects.
+func mqttHABridgeTopic(clientID string) string {
+	return "siot/" + clientID + "/availability"
+}
+
+func mqttHATopic(entityID, suffix string) string {
+	return "siot/" + entityID + "/" + suffix
+}
+
+// mqttHAEntity is the resolved config of a Home Assistant entity
+type mqttHAEntity struct {
+	config    MQTTHomeAssistant
+	component string
+	name      string
+	device    string
+	units     string
+	stateType string
+	setType   string
+}
+
+// resolve looks up the exposed node and fills in the defaults that depend
+// on the node type.
+func (e *mqttHAEntity) resolve(node data.NodeEdge) {
+	e.component = e.config.Component
+	e.stateType = e.config.PointType
+	e.units = e.config.Units
+	e.device = node.Desc()
+	e.name = e.config.Description
+	if e.name == "" {
+		e.name = e.device
+	}
+
+	if e.config.PointKey == "" {
+		e.config.PointKey = "0"
+	}
+
+	if e.units == "" {
+		e.units, _ = node.Points.Text(data.PointTypeUnits, "")
+	}
+
+	switch node.Type {
+	case data.NodeTypeShellyIo:
+		if e.stateType == "" {
+			if _, ok := node.Points.Find(data.PointTypeLight, ""); ok {
+				e.stateType = data.PointTypeLight
+			} else if _, ok := node.Points.Find(data.PointTypeSwitch, ""); ok {
+				e.stateType = data.PointTypeSwitch
+			}
+		}
+
+		if e.component == "" && (e.stateType == data.PointTypeLight ||
+			e.stateType == data.PointTypeSwitch) {
+			e.component = mqttHASwitch
+		}
+
+	case data.NodeTypeModbusIO:
+		ioType, _ := node.Points.Text(data.PointTypeModbusIOType, "")
+		if e.component == "" && ioType == data.PointValueModbusCoil {
+			e.component = mqttHASwitch
+		}
+	}
+
+	if e.component == "" {
+		e.component = mqttHASensor
+	}
+
+	if e.stateType == "" {
+		e.stateType = data.PointTypeValue
+	}
+
+	if e.component == mqttHASwitch {
+		e.setType = e.stateType + "Set"
+	}
+}
+
+// discovery returns the Home Assistant discovery config
+func (e *mqttHAEntity) discovery(clientID string) ([]byte, error) {
+	config := map[string]any{
+		"name":        e.name,
+		"unique_id":   "siot_" + e.config.ID,
+		"state_topic": mqttHATopic(e.config.ID, "state"),
+		"availability": []map[string]string{
+			{"topic": mqttHABridgeTopic(clientID)},
+			{"topic": mqttHATopic(e.config.ID, "availability")},
+		},
+		"availability_mode": "all",
+		"device": map[string]any{
+			"identifiers":  []string{"siot_" + e.config.NodeID},
+			"name":         e.device,
+			"manufacturer": "Simple IoT",
+		},
+	}
+
+	if e.config.DeviceClass != "" {
+		config["device_class"] = e.config.DeviceClass
+	}
+
+	switch e.component {
+	case mqttHASwitch:
+		config["command_topic"] = mqttHATopic(e.config.ID, "set")
+		config["payload_on"] = "ON"
+		config["payload_off"] = "OFF"
+	default:
+		if e.units != "" {
+			config["unit_of_measurement"] = e.units
+		}
+	}
+
+	return json.Marshal(config)
+}
+
+func (e *mqttHAEntity) discoveryTopic(prefix string) string {
+	if prefix == "" {
+		prefix = mqttHADefaultPrefix
+	}
+	return fmt.Sprintf("%v/%v/siot_%v/config", prefix, e.component, e.config.ID)
+}
+
+// state returns the state payload for a point
+func (e *mqttHAEntity) state(p data.Point) string {
+	if e.component == mqttHASwitch {
+		if p.Value != 0 {
+			return "ON"
+		}
+		return "OFF"
+	}
+
+	if p.Text != "" {
+		return p.Text
+	}
+
+	return strconv.FormatFloat(p.Value, 'f', -1, 64)
+}
+
+// command converts a Home Assistant command payload to a point
+func (e *mqttHAEntity) command(payload []byte) (data.Point, error) {
+	var v float64
+	switch strings.ToUpper(strings.TrimSpace(string(payload))) {
+	case "ON":
+		v = 1
+	case "OFF":
+		v = 0
+	default:
+		return data.Point{}, fmt.Errorf("invalid command: %v", string(payload))
+	}
+
+	return data.Point{
+		Time:  time.Now(),
+		Type:  e.setType,
+		Key:   e.config.PointKey,
+		Value: v,
+	}, nil
+}
+
+// setupHA publishes discovery config and starts forwarding state for all
+// Home Assistant entities
+func (mc *MQTTClient) setupHA() {
+	mc.stopHA()
+
+	if mc.client == nil || !mc.client.IsConnected() || len(mc.config.HAs) <= 0 {
+		return
+	}
+
+	client := mc.client
+	publish := func(topic string, payload any) {
+		token := client.Publish(topic, 1, true, payload)
+		if token.WaitTimeout(5*time.Second) && token.Error() != nil {
+			log.Printf("MQTT: error publishing to %v: %v\n", topic, token.Error())
+		}
+	}
+
+	publish(mqttHABridgeTopic(mc.config.ID), "online")
+
+	for _, ha := range mc.config.HAs {
+		e := &mqttHAEntity{config: ha}
+		if ha.Disabled || ha.NodeID == "" {
+			// remove the entity from Home Assistant
+			for _, c := range []string{mqttHASensor, mqttHASwitch} {
+				e.component = c
+				publish(e.discoveryTopic(mc.config.HADiscoveryPrefix), "")
+			}
+			continue
+		}
+
+		nodes, err := GetNodes(mc.nc, "all", ha.NodeID, "", false)
+		if err != nil || len(nodes) < 1 {
+			log.Printf("MQTT: error getting Home Assistant node %v: %v\n", ha.NodeID, err)
+			continue
+		}
+
+		node := nodes[0]
+		e.resolve(node)
+
+		discovery, err := e.discovery(mc.config.ID)
+		if err != nil {
+			log.Println("MQTT: error encoding Home Assistant discovery:", err)
+			continue
+		}
+
+		publish(e.discoveryTopic(mc.config.HADiscoveryPrefix), discovery)
+
+		stateTopic := mqttHATopic(ha.ID, "state")
+		availTopic := mqttHATopic(ha.ID, "availability")
+
+		offline, _ := node.Points.ValueBool(data.PointTypeOffline, "")
+		disabled, _ := node.Points.ValueBool(data.PointTypeDisabled, "")
+		online := !offline && !disabled
+
+		availability := func() string {
+			if online {
+				return "online"
+			}
+			return "offline"
+		}
+
+		publish(availTopic, availability())
+
+		if p, ok := node.Points.Find(e.stateType, e.config.PointKey); ok {
+			publish(stateTopic, e.state(p))
+		}
+
+		stop, err := SubscribePoints(mc.nc, ha.NodeID, func(points []data.Point) {
+			availChanged := false
+			for _, p := range points {
+				switch p.Type {
+				case e.stateType:
+					if p.Key == e.config.PointKey {
+						publish(stateTopic, e.state(p))
+					}
+				case data.PointTypeOffline:
+					offline = p.Value != 0
+					availChanged = true
+				case data.PointTypeDisabled:
+					disabled = p.Value != 0
+					availChanged = true
+				}
+			}
+
+			if availChanged && online != (!offline && !disabled) {
+				online = !offline && !disabled
+				publish(availTopic, availability())
+			}
+		})
+
+		if err != nil {
+			log.Println("MQTT: error subscribing to node points:", err)
+			continue
+		}
+
+		mc.haStops = append(mc.haStops, stop)
+
+		if e.component != mqttHASwitch {
+			continue
+		}
+
+		cmdTopic := mqttHATopic(ha.ID, "set")
+		origin := mc.config.ID
+		client.Subscribe(cmdTopic, 1, func(_ mqtt.Client, msg mqtt.Message) {
+			p, err := e.command(msg.Payload())
+			if err != nil {
+				log.Printf("MQTT: topic %v: %v\n", msg.Topic(), err)
+				return
+			}
+			// must set Origin because we are sending a point to another node
+			p.Origin = origin
+			err = SendNodePoint(mc.nc, e.config.NodeID, p, false)
+			if err != nil {
+				log.Println("MQTT: error sending Home Assistant command:", err)
+			}
+		})
+
+		mc.haStops = append(mc.haStops, func() {
+			client.Unsubscribe(cmdTopic)
+		})
+	}
+}
+
+func (mc *MQTTClient) stopHA() {
+	for _, stop := range mc.haStops {
+		stop()
+	}
+	mc.haStops = nil
+}
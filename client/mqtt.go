@@ -0,0 +1,569 @@
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// MQTT describes the config for a MQTT bridge client. The client connects
+// to an MQTT broker and uses the child MQTTSub and MQTTPub nodes to map
+// MQTT messages to and from SIOT points. MQTTHomeAssistant child nodes
+// expose SIOT nodes to Home Assistant using MQTT discovery under
+// HADiscoveryPrefix (defaults to homeassistant).
+type MQTT struct {
+	ID                string              `node:"id"`
+	Parent            string              `node:"parent"`
+	Description       string              `point:"description"`
+	Disabled          bool                `point:"disabled"`
+	URI               string              `point:"uri"`
+	ClientID          string              `point:"clientID"`
+	Username          string              `point:"username"`
+	Password          string              `point:"pass"`
+	TLSCACert         string              `point:"tlsCACert"`
+	TLSCert           string              `point:"tlsCert"`
+	TLSKey            string              `point:"tlsKey"`
+	TLSInsecure       bool                `point:"tlsInsecure"`
+	Connected         bool                `point:"connected"`
+	HADiscoveryPrefix string              `point:"haDiscoveryPrefix"`
+	Subs              []MQTTSub           `child:"mqttSub"`
+	Pubs              []MQTTPub           `child:"mqttPub"`
+	HAs               []MQTTHomeAssistant `child:"mqttHomeAssistant"`
+}
+
+// MQTTSub subscribes to an MQTT topic and converts received messages
+// to points that are written to the MQTTSub node.
+type MQTTSub struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	Disabled    bool   `point:"disabled"`
+	Topic       string `point:"topic"`
+	QOS         int    `point:"qos"`
+	// JSONPath selects a value in a JSON payload (ex: sensors[0].temp).
+	// If blank, the raw payload is used.
+	JSONPath string `point:"jsonPath"`
+	// PointType defaults to value
+	PointType string `point:"pointType"`
+	// PointKey defaults to the message topic if the subscription topic
+	// contains wildcards, otherwise 0
+	PointKey string `point:"pointKey"`
+}
+
+// MQTTPub publishes points from a node to an MQTT topic
+type MQTTPub struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	Disabled    bool   `point:"disabled"`
+	// NodeID is the node whose points are published
+	NodeID string `point:"nodeID"`
+	// PointType and PointKey filter the points that are published. Blank
+	// matches all points.
+	PointType string `point:"pointType"`
+	PointKey  string `point:"pointKey"`
+	// Topic is a Go template. The .NodeID, .Type, and .Key fields of the
+	// point are available, ex: siot/{{.NodeID}}/{{.Type}}
+	Topic string `point:"topic"`
+	// Format is raw (value or text) or json (entire point)
+	Format string `point:"format"`
+	QOS    int    `point:"qos"`
+	Retain bool   `point:"retain"`
+}
+
+// MQTTClient is a SIOT MQTT bridge client
+type MQTTClient struct {
+	nc            *nats.Conn
+	config        MQTT
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	chConnected   chan bool
+
+	client   mqtt.Client
+	subbed   []string
+	pubStops []func()
+	haStops  []func()
+}
+
+// NewMQTTClient ...
+func NewMQTTClient(nc *nats.Conn, config MQTT) Client {
+	return &MQTTClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		chConnected:   make(chan bool),
+	}
+}
+
+func (mc *MQTTClient) tlsConfig() (*tls.Config, error) {
+	ret := &tls.Config{
+		InsecureSkipVerify: mc.config.TLSInsecure,
+	}
+
+	if mc.config.TLSCACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(mc.config.TLSCACert)) {
+			return nil, errors.New("error parsing CA cert")
+		}
+		ret.RootCAs = pool
+	}
+
+	if mc.config.TLSCert != "" || mc.config.TLSKey != "" {
+		cert, err := tls.X509KeyPair([]byte(mc.config.TLSCert),
+			[]byte(mc.config.TLSKey))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing client cert: %w", err)
+		}
+		ret.Certificates = []tls.Certificate{cert}
+	}
+
+	return ret, nil
+}
+
+func (mc *MQTTClient) connect() {
+	if mc.config.Disabled || mc.config.URI == "" {
+		return
+	}
+
+	clientID := mc.config.ClientID
+	if clientID == "" {
+		clientID = "siot-" + mc.config.ID
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(mc.config.URI).
+		SetClientID(clientID).
+		SetUsername(mc.config.Username).
+		SetPassword(mc.config.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second)
+
+	tlsConfig, err := mc.tlsConfig()
+	if err != nil {
+		log.Printf("MQTT %v: %v\n", mc.config.Description, err)
+		return
+	}
+	opts.SetTLSConfig(tlsConfig)
+
+	if len(mc.config.HAs) > 0 {
+		// lets Home Assistant know when the bridge goes away
+		opts.SetWill(mqttHABridgeTopic(mc.config.ID), "offline", 1, true)
+	}
+
+	connected := func(c bool) {
+		select {
+		case mc.chConnected <- c:
+		case <-mc.stop:
+		}
+	}
+
+	opts.SetOnConnectHandler(func(_ mqtt.Client) {
+		connected(true)
+	})
+
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		log.Printf("MQTT %v: connection lost: %v\n", mc.config.Description, err)
+		connected(false)
+	})
+
+	mc.client = mqtt.NewClient(opts)
+	// with ConnectRetry set, this does not block and keeps retrying
+	// in the background
+	mc.client.Connect()
+	mc.setupPubs()
+}
+
+func (mc *MQTTClient) disconnect() {
+	mc.stopPubs()
+	mc.stopHA()
+
+	if mc.client != nil {
+		if len(mc.config.HAs) > 0 && mc.client.IsConnected() {
+			mc.client.Publish(mqttHABridgeTopic(mc.config.ID), 1, true,
+				"offline").WaitTimeout(time.Second)
+		}
+		mc.client.Disconnect(250)
+		mc.client = nil
+		mc.subbed = nil
+		mc.sendConnected(false)
+	}
+}
+
+func (mc *MQTTClient) sendConnected(c bool) {
+	if mc.config.Connected == c {
+		return
+	}
+	mc.config.Connected = c
+	err := SendNodePoint(mc.nc, mc.config.ID, data.Point{
+		Type:  data.PointTypeConnected,
+		Value: data.BoolToFloat(c),
+	}, false)
+	if err != nil {
+		log.Println("MQTT: error sending connected point:", err)
+	}
+}
+
+// subscribe (re)subscribes to all sub topics. This is called on every
+// connection as subscriptions are not persisted by the broker.
+func (mc *MQTTClient) subscribe() {
+	if mc.client == nil || !mc.client.IsConnected() {
+		return
+	}
+
+	if len(mc.subbed) > 0 {
+		mc.client.Unsubscribe(mc.subbed...)
+		mc.subbed = nil
+	}
+
+	for _, sub := range mc.config.Subs {
+		if sub.Disabled || sub.Topic == "" {
+			continue
+		}
+
+		// copy as the config may change while the handler is running
+		sub := sub
+		origin := mc.config.ID
+		token := mc.client.Subscribe(sub.Topic, byte(sub.QOS),
+			func(_ mqtt.Client, msg mqtt.Message) {
+				mc.handleMessage(origin, sub, msg)
+			})
+		mc.subbed = append(mc.subbed, sub.Topic)
+
+		go func() {
+			if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+				log.Printf("MQTT: error subscribing to %v: %v\n",
+					sub.Topic, token.Error())
+			}
+		}()
+	}
+}
+
+func (mc *MQTTClient) handleMessage(origin string, sub MQTTSub, msg mqtt.Message) {
+	p, err := mqttPayloadToPoint(msg.Payload(), sub.JSONPath)
+	if err != nil {
+		log.Printf("MQTT: topic %v: %v\n", msg.Topic(), err)
+		return
+	}
+
+	p.Type = sub.PointType
+	if p.Type == "" {
+		p.Type = data.PointTypeValue
+	}
+
+	p.Key = sub.PointKey
+	if p.Key == "" {
+		if strings.ContainsAny(sub.Topic, "+#") {
+			p.Key = msg.Topic()
+		} else {
+			p.Key = "0"
+		}
+	}
+
+	p.Time = time.Now()
+	// origin must be set, otherwise the point is sent back to this client
+	p.Origin = origin
+
+	err = SendNodePoint(mc.nc, sub.ID, p, false)
+	if err != nil {
+		log.Println("MQTT: error sending point:", err)
+	}
+}
+
+type mqttTopicData struct {
+	NodeID string
+	Type   string
+	Key    string
+}
+
+func (mc *MQTTClient) setupPubs() {
+	mc.stopPubs()
+
+	if mc.client == nil {
+		return
+	}
+
+	for _, pub := range mc.config.Pubs {
+		if pub.Disabled || pub.NodeID == "" || pub.Topic == "" {
+			continue
+		}
+
+		pub := pub
+		topicTemplate, err := template.New("topic").Parse(pub.Topic)
+		if err != nil {
+			log.Printf("MQTT: error parsing topic %v: %v\n", pub.Topic, err)
+			continue
+		}
+
+		client := mc.client
+
+		stop, err := SubscribePoints(mc.nc, pub.NodeID, func(points []data.Point) {
+			for _, p := range points {
+				if (pub.PointType != "" && p.Type != pub.PointType) ||
+					(pub.PointKey != "" && p.Key != pub.PointKey) {
+					continue
+				}
+
+				var topic bytes.Buffer
+				err := topicTemplate.Execute(&topic, mqttTopicData{
+					NodeID: pub.NodeID,
+					Type:   p.Type,
+					Key:    p.Key,
+				})
+				if err != nil {
+					log.Println("MQTT: error executing topic template:", err)
+					continue
+				}
+
+				payload, err := mqttPointPayload(p, pub.Format)
+				if err != nil {
+					log.Println("MQTT: error encoding payload:", err)
+					continue
+				}
+
+				token := client.Publish(topic.String(), byte(pub.QOS), pub.Retain, payload)
+				if token.WaitTimeout(5*time.Second) && token.Error() != nil {
+					log.Printf("MQTT: error publishing to %v: %v\n",
+						topic.String(), token.Error())
+				}
+			}
+		})
+
+		if err != nil {
+			log.Println("MQTT: error subscribing to node points:", err)
+			continue
+		}
+
+		mc.pubStops = append(mc.pubStops, stop)
+	}
+}
+
+func (mc *MQTTClient) stopPubs() {
+	for _, stop := range mc.pubStops {
+		stop()
+	}
+	mc.pubStops = nil
+}
+
+// Run the main logic for this client and blocks until stopped
+func (mc *MQTTClient) Run() error {
+	log.Println("Starting MQTT client:", mc.config.Description)
+
+	mc.connect()
+
+done:
+	for {
+		select {
+		case <-mc.stop:
+			log.Println("Stopping MQTT client:", mc.config.Description)
+			break done
+
+		case pts := <-mc.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &mc.config)
+			if err != nil {
+				log.Println("error merging new points:", err)
+			}
+
+			if pts.ID != mc.config.ID {
+				// a child node changed
+				mc.subscribe()
+				mc.setupPubs()
+				mc.setupHA()
+				continue
+			}
+
+			reconnect := false
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeDescription, data.PointTypeConnected:
+				default:
+					reconnect = true
+				}
+			}
+
+			if reconnect {
+				mc.disconnect()
+				mc.connect()
+			}
+
+		case pts := <-mc.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &mc.config)
+			if err != nil {
+				log.Println("error merging new points:", err)
+			}
+
+		case c := <-mc.chConnected:
+			if mc.client == nil {
+				// stale event from a client that has been disconnected
+				continue
+			}
+			mc.sendConnected(c)
+			if c {
+				log.Printf("MQTT %v: connected to %v\n", mc.config.Description, mc.config.URI)
+				mc.subscribe()
+				mc.setupHA()
+			} else {
+				mc.stopHA()
+			}
+		}
+	}
+
+	mc.disconnect()
+
+	return nil
+}
+
+// Stop sends a signal to the Run function to exit
+func (mc *MQTTClient) Stop(_ error) {
+	close(mc.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (mc *MQTTClient) Points(nodeID string, points []data.Point) {
+	mc.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (mc *MQTTClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	mc.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
+
+// mqttPayloadToPoint converts a MQTT payload to a point. If jsonPath is
+// set, the payload is decoded as JSON and the value at the path is used.
+// Numbers and bools are stored in the point value, other types in text.
+func mqttPayloadToPoint(payload []byte, jsonPath string) (data.Point, error) {
+	var v any
+
+	if jsonPath == "" {
+		s := strings.TrimSpace(string(payload))
+		f, err := strconv.ParseFloat(s, 64)
+		if err == nil {
+			return data.Point{Value: f}, nil
+		}
+		switch strings.ToLower(s) {
+		case "true", "on":
+			return data.Point{Value: 1}, nil
+		case "false", "off":
+			return data.Point{Value: 0}, nil
+		}
+		return data.Point{Text: string(payload)}, nil
+	}
+
+	err := json.Unmarshal(payload, &v)
+	if err != nil {
+		return data.Point{}, fmt.Errorf("error decoding JSON: %w", err)
+	}
+
+	v, err = jsonPathValue(v, jsonPath)
+	if err != nil {
+		return data.Point{}, err
+	}
+
+	switch vt := v.(type) {
+	case float64:
+		return data.Point{Value: vt}, nil
+	case bool:
+		return data.Point{Value: data.BoolToFloat(vt)}, nil
+	case string:
+		p := data.Point{Text: vt}
+		if f, err := strconv.ParseFloat(vt, 64); err == nil {
+			p.Value = f
+		}
+		return p, nil
+	case nil:
+		return data.Point{}, fmt.Errorf("null value at %v", jsonPath)
+	default:
+		// objects and arrays are stored as JSON text
+		t, err := json.Marshal(vt)
+		if err != nil {
+			return data.Point{}, err
+		}
+		return data.Point{Text: string(t)}, nil
+	}
+}
+
+// jsonPathValue returns the value in a decoded JSON document at path. The
+// path is a dot separated list of object keys, each with optional array
+// indexes, ex: sensors[1].temp. A leading $ is ignored.
+func jsonPathValue(doc any, path string) (any, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return doc, nil
+	}
+
+	v := doc
+
+	for _, seg := range strings.Split(path, ".") {
+		name := seg
+		var indexes []string
+		if i := strings.Index(seg, "["); i >= 0 {
+			name = seg[:i]
+			for _, idx := range strings.Split(seg[i+1:], "[") {
+				if !strings.HasSuffix(idx, "]") {
+					return nil, fmt.Errorf("invalid path segment: %v", seg)
+				}
+				indexes = append(indexes, strings.TrimSuffix(idx, "]"))
+			}
+		}
+
+		if name != "" {
+			m, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%v: not an object", name)
+			}
+			v, ok = m[name]
+			if !ok {
+				return nil, fmt.Errorf("%v: not found", name)
+			}
+		}
+
+		for _, idx := range indexes {
+			i, err := strconv.Atoi(idx)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index: %v", idx)
+			}
+			a, ok := v.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%v: not an array", seg)
+			}
+			if i < 0 || i >= len(a) {
+				return nil, fmt.Errorf("%v: index out of range", seg)
+			}
+			v = a[i]
+		}
+	}
+
+	return v, nil
+}
+
+// mqttPointPayload encodes a point for publishing
+func mqttPointPayload(p data.Point, format string) ([]byte, error) {
+	switch format {
+	case "", data.PointValueRaw:
+		if p.Text != "" {
+			return []byte(p.Text), nil
+		}
+		return []byte(strconv.FormatFloat(p.Value, 'f', -1, 64)), nil
+	case data.PointValueJSON:
+		return json.Marshal(p)
+	default:
+		return nil, fmt.Errorf("unknown format: %v", format)
+	}
+}
@@ -0,0 +1,309 @@
+package client_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func startTestBroker(t *testing.T) (string, func()) {
+	// find a free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error finding free port: ", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	broker := mserver.New(nil)
+	_ = broker.AddHook(new(auth.AllowHook), nil)
+	err = broker.AddListener(listeners.NewTCP(listeners.Config{ID: "t1", Address: addr}))
+	if err != nil {
+		t.Fatal("Error adding broker listener: ", err)
+	}
+
+	go func() {
+		_ = broker.Serve()
+	}()
+
+	return "tcp://" + addr, func() { broker.Close() }
+}
+
+func TestMQTT(t *testing.T) {
+	uri, stopBroker := startTestBroker(t)
+	defer stopBroker()
+
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	mqttConfig := client.MQTT{
+		ID:          "ID-mqtt",
+		Parent:      root.ID,
+		Description: "test mqtt",
+		URI:         uri,
+	}
+
+	err = client.SendNodeType(nc, mqttConfig, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	sub := client.MQTTSub{
+		ID:        "ID-mqtt-sub",
+		Parent:    mqttConfig.ID,
+		Topic:     "sensors/+/data",
+		JSONPath:  "temps[1]",
+		PointType: data.PointTypeTemperature,
+	}
+
+	err = client.SendNodeType(nc, sub, "test")
+	if err != nil {
+		t.Fatal("Error sending sub node: ", err)
+	}
+
+	// publish the points the sub node receives back out
+	pub := client.MQTTPub{
+		ID:        "ID-mqtt-pub",
+		Parent:    mqttConfig.ID,
+		NodeID:    sub.ID,
+		PointType: data.PointTypeTemperature,
+		Topic:     "siot/{{.NodeID}}/{{.Type}}",
+	}
+
+	err = client.SendNodeType(nc, pub, "test")
+	if err != nil {
+		t.Fatal("Error sending pub node: ", err)
+	}
+
+	// test device connected to the broker
+	received := make(chan mqtt.Message, 10)
+	dev := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(uri).SetClientID("test-dev"))
+	if token := dev.Connect(); token.WaitTimeout(time.Second) && token.Error() != nil {
+		t.Fatal("Error connecting test device: ", token.Error())
+	}
+	defer dev.Disconnect(100)
+
+	token := dev.Subscribe("siot/#", 0, func(_ mqtt.Client, msg mqtt.Message) {
+		received <- msg
+	})
+	if token.WaitTimeout(time.Second) && token.Error() != nil {
+		t.Fatal("Error subscribing: ", token.Error())
+	}
+
+	// keep publishing until the client has subscribed and the point makes
+	// it all the way through
+	var msg mqtt.Message
+	start := time.Now()
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+done:
+	for {
+		select {
+		case msg = <-received:
+			break done
+		case <-ticker.C:
+			if time.Since(start) > 10*time.Second {
+				t.Fatal("Timeout waiting for MQTT message")
+			}
+			dev.Publish("sensors/a/data", 0, false, `{"temps":[1.5,22.5]}`)
+		}
+	}
+
+	if msg.Topic() != "siot/ID-mqtt-sub/temp" {
+		t.Fatal("Wrong topic: ", msg.Topic())
+	}
+
+	if string(msg.Payload()) != "22.5" {
+		t.Fatal("Wrong payload: ", string(msg.Payload()))
+	}
+
+	// points are stored asynchronously, so poll until they show up
+	waitPoint := func(parent, id, typ, key string) float64 {
+		for i := 0; ; i++ {
+			nodes, err := client.GetNodes(nc, parent, id, "", false)
+			if err != nil || len(nodes) < 1 {
+				t.Fatal("Error getting node: ", err)
+			}
+
+			v, ok := nodes[0].Points.Value(typ, key)
+			if ok || i >= 50 {
+				return v
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	if temp := waitPoint(mqttConfig.ID, sub.ID, data.PointTypeTemperature,
+		"sensors/a/data"); temp != 22.5 {
+		t.Fatal("Sub node did not get temp point: ", temp)
+	}
+
+	if waitPoint(root.ID, mqttConfig.ID, data.PointTypeConnected, "") != 1 {
+		t.Fatal("MQTT node not connected")
+	}
+}
+
+func TestMQTTHomeAssistant(t *testing.T) {
+	uri, stopBroker := startTestBroker(t)
+	defer stopBroker()
+
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	// coil IO that should show up as a switch
+	io := data.NodeEdge{
+		ID:     "ID-coil",
+		Type:   data.NodeTypeModbusIO,
+		Parent: root.ID,
+		Points: data.Points{
+			{Type: data.PointTypeDescription, Key: "0", Text: "pump"},
+			{Type: data.PointTypeModbusIOType, Key: "0", Text: data.PointValueModbusCoil},
+			{Type: data.PointTypeValue, Key: "0", Value: 0},
+		},
+	}
+
+	err = client.SendNode(nc, io, "test")
+	if err != nil {
+		t.Fatal("Error sending io node: ", err)
+	}
+
+	// test device (Home Assistant) connected to the broker
+	received := make(chan mqtt.Message, 100)
+	dev := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(uri).SetClientID("test-ha"))
+	if token := dev.Connect(); token.WaitTimeout(time.Second) && token.Error() != nil {
+		t.Fatal("Error connecting test device: ", token.Error())
+	}
+	defer dev.Disconnect(100)
+
+	for _, topic := range []string{"homeassistant/#", "siot/#"} {
+		token := dev.Subscribe(topic, 1, func(_ mqtt.Client, msg mqtt.Message) {
+			received <- msg
+		})
+		if token.WaitTimeout(time.Second) && token.Error() != nil {
+			t.Fatal("Error subscribing: ", token.Error())
+		}
+	}
+
+	// messages are not always received in the order we check for them,
+	// so keep the last message for each topic
+	last := make(map[string]mqtt.Message)
+	waitMsg := func(topic, payload string) mqtt.Message {
+		timeout := time.After(5 * time.Second)
+		for {
+			msg, ok := last[topic]
+			if ok && (payload == "" || string(msg.Payload()) == payload) {
+				return msg
+			}
+
+			select {
+			case msg := <-received:
+				last[msg.Topic()] = msg
+			case <-timeout:
+				t.Fatalf("Timeout waiting for %v: %v", topic, payload)
+			}
+		}
+	}
+
+	mqttConfig := client.MQTT{
+		ID:          "ID-mqtt",
+		Parent:      root.ID,
+		Description: "test mqtt",
+		URI:         uri,
+	}
+
+	err = client.SendNodeType(nc, mqttConfig, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	ha := client.MQTTHomeAssistant{
+		ID:     "ID-ha",
+		Parent: mqttConfig.ID,
+		NodeID: io.ID,
+	}
+
+	err = client.SendNodeType(nc, ha, "test")
+	if err != nil {
+		t.Fatal("Error sending ha node: ", err)
+	}
+
+	msg := waitMsg("homeassistant/switch/siot_ID-ha/config", "")
+
+	var config struct {
+		Name         string `json:"name"`
+		StateTopic   string `json:"state_topic"`
+		CommandTopic string `json:"command_topic"`
+	}
+
+	err = json.Unmarshal(msg.Payload(), &config)
+	if err != nil {
+		t.Fatal("Error decoding discovery config: ", err)
+	}
+
+	if config.Name != "pump" || config.StateTopic != "siot/ID-ha/state" ||
+		config.CommandTopic != "siot/ID-ha/set" {
+		t.Fatal("Wrong discovery config: ", string(msg.Payload()))
+	}
+
+	waitMsg("siot/ID-mqtt/availability", "online")
+	waitMsg("siot/ID-ha/availability", "online")
+	waitMsg("siot/ID-ha/state", "OFF")
+
+	// turn switch on from Home Assistant
+	dev.Publish(config.CommandTopic, 1, false, "ON")
+
+	start := time.Now()
+	for {
+		nodes, err := client.GetNodes(nc, root.ID, io.ID, "", false)
+		if err != nil || len(nodes) < 1 {
+			t.Fatal("Error getting io node: ", err)
+		}
+
+		v, _ := nodes[0].Points.Value(data.PointTypeValueSet, "0")
+		if v == 1 {
+			break
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("valueSet not set by command")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// state change in SIOT is published back to Home Assistant
+	err = client.SendNodePoint(nc, io.ID, data.Point{
+		Type: data.PointTypeValue, Key: "0", Value: 1}, false)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	waitMsg("siot/ID-ha/state", "ON")
+
+	// availability follows the disabled point
+	err = client.SendNodePoint(nc, io.ID, data.Point{
+		Type: data.PointTypeDisabled, Key: "0", Value: 1}, false)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	waitMsg("siot/ID-ha/availability", "offline")
+}
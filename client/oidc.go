@@ -0,0 +1,29 @@
+package client
+
+// OIDC describes an OpenID Connect provider users can log in with. OIDC
+// nodes are children of the root node.
+type OIDC struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	// Issuer is the provider URL. The provider configuration is read from
+	// <issuer>/.well-known/openid-configuration.
+	Issuer       string `point:"issuer"`
+	ClientID     string `point:"clientID"`
+	ClientSecret string `point:"clientSecret"`
+	// RedirectURI is the callback URI sent to the provider,
+	// <public URL>/v1/auth/oidc/<id>/callback. It is required, as request
+	// headers can't be trusted to build it.
+	RedirectURI string `point:"redirectURI"`
+	// Provision creates a user under the NodeID group if there is no user
+	// with the email from the ID token
+	Provision     bool   `point:"provision"`
+	NodeID        string `point:"nodeID"`
+	ProvisionRole string `point:"provisionRole"`
+	Disabled      bool   `point:"disabled"`
+}
+
+// Enabled returns true if users can log in with the provider
+func (o OIDC) Enabled() bool {
+	return !o.Disabled && o.RedirectURI != ""
+}
@@ -0,0 +1,322 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	goio "io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 1-wire family codes are the first part of the device ID (ex: 28-xxxx)
+const (
+	oneWireFamilyDS18S20  = "10"
+	oneWireFamilyDS2450   = "20"
+	oneWireFamilyDS1822   = "22"
+	oneWireFamilyDS2438   = "26"
+	oneWireFamilyDS18B20  = "28"
+	oneWireFamilyDS2408   = "29"
+	oneWireFamilyDS2413   = "3a"
+	oneWireFamilyDS1825   = "3b"
+	oneWireFamilyDS28EA00 = "42"
+)
+
+// oneWireFamily returns the family code of a device ID
+func oneWireFamily(id string) string {
+	family, _, _ := strings.Cut(strings.ToLower(id), "-")
+	return family
+}
+
+// oneWireSupported returns true if the device family is supported
+func oneWireSupported(id string) bool {
+	switch oneWireFamily(id) {
+	case oneWireFamilyDS18S20, oneWireFamilyDS1822, oneWireFamilyDS18B20,
+		oneWireFamilyDS1825, oneWireFamilyDS28EA00, oneWireFamilyDS2408,
+		oneWireFamilyDS2413, oneWireFamilyDS2438, oneWireFamilyDS2450:
+		return true
+	}
+	return false
+}
+
+// oneWireOutputs returns the number of outputs for a device
+func oneWireOutputs(id string) int {
+	switch oneWireFamily(id) {
+	case oneWireFamilyDS2408:
+		return 8
+	case oneWireFamilyDS2413:
+		return 2
+	}
+	return 0
+}
+
+// oneWireTemperatureKey returns the value key of the device temperature, or
+// "" if the device does not measure temperature
+func oneWireTemperatureKey(id string) string {
+	switch oneWireFamily(id) {
+	case oneWireFamilyDS18S20, oneWireFamilyDS1822, oneWireFamilyDS18B20,
+		oneWireFamilyDS1825, oneWireFamilyDS28EA00:
+		return "0"
+	case oneWireFamilyDS2438:
+		return "temperature"
+	}
+	return ""
+}
+
+// oneWireRead reads a device and returns values by point key. Temperatures
+// are in °C. dir is the sysfs directory of the device.
+func oneWireRead(dir string) (map[string]float64, error) {
+	switch oneWireFamily(filepath.Base(dir)) {
+	case oneWireFamilyDS2408:
+		return oneWireReadDS2408(dir)
+	case oneWireFamilyDS2413:
+		return oneWireReadDS2413(dir)
+	case oneWireFamilyDS2438:
+		return oneWireReadDS2438(dir)
+	case oneWireFamilyDS2450:
+		return oneWireReadDS2450(oneWireSysfsTx(filepath.Join(dir, "rw")))
+	default:
+		// thermometers (w1_therm)
+		v, err := oneWireReadInt(filepath.Join(dir, "temperature"))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{"0": float64(v) / 1000}, nil
+	}
+}
+
+// oneWireWrite writes output states to a device. outputs[i] true turns on
+// output i (the PIO transistor is on and pulls the pin low).
+func oneWireWrite(dir string, outputs []bool) error {
+	var b byte = 0xff
+	for i, on := range outputs {
+		if on {
+			b &^= 1 << i
+		}
+	}
+
+	switch oneWireFamily(filepath.Base(dir)) {
+	case oneWireFamilyDS2408, oneWireFamilyDS2413:
+		return os.WriteFile(filepath.Join(dir, "output"), []byte{b}, 0644)
+	default:
+		return fmt.Errorf("1-wire device %v does not have outputs", filepath.Base(dir))
+	}
+}
+
+// oneWireReadOutputs returns the current output states of a device
+func oneWireReadOutputs(dir string) ([]bool, error) {
+	switch oneWireFamily(filepath.Base(dir)) {
+	case oneWireFamilyDS2408:
+		b, err := oneWireReadByte(filepath.Join(dir, "output"))
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]bool, 8)
+		for i := range ret {
+			ret[i] = b&(1<<i) == 0
+		}
+		return ret, nil
+	case oneWireFamilyDS2413:
+		// bits 1 and 3 are the output latches
+		b, err := oneWireReadByte(filepath.Join(dir, "state"))
+		if err != nil {
+			return nil, err
+		}
+		return []bool{b&0x02 == 0, b&0x08 == 0}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func oneWireReadByte(path string) (byte, error) {
+	d, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(d) <= 0 {
+		return 0, goio.EOF
+	}
+
+	return d[0], nil
+}
+
+func oneWireReadInt(path string) (int, error) {
+	d, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(d) <= 0 {
+		return 0, goio.EOF
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(d)))
+}
+
+// oneWireReadDS2408 returns the levels of the 8 PIO pins (1 is high)
+func oneWireReadDS2408(dir string) (map[string]float64, error) {
+	b, err := oneWireReadByte(filepath.Join(dir, "state"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]float64)
+	for i := 0; i < 8; i++ {
+		ret[strconv.Itoa(i)] = float64((b >> i) & 1)
+	}
+
+	return ret, nil
+}
+
+// oneWireReadDS2413 returns the levels of PIO A (0) and B (1)
+func oneWireReadDS2413(dir string) (map[string]float64, error) {
+	b, err := oneWireReadByte(filepath.Join(dir, "state"))
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]float64{
+		"0": float64(b & 1),
+		"1": float64((b >> 2) & 1),
+	}, nil
+}
+
+// oneWireReadDS2438 returns the temperature (°C), VAD and VDD voltages, and
+// the current sense voltage (VSENS). The current is VSENS/Rsens.
+func oneWireReadDS2438(dir string) (map[string]float64, error) {
+	temp, err := oneWireReadInt(filepath.Join(dir, "temperature"))
+	if err != nil {
+		return nil, err
+	}
+
+	// voltages are in 10mV units
+	vad, err := oneWireReadInt(filepath.Join(dir, "vad"))
+	if err != nil {
+		return nil, err
+	}
+
+	vdd, err := oneWireReadInt(filepath.Join(dir, "vdd"))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]float64{
+		"temperature": float64(temp) / 256,
+		"vad":         float64(vad) / 100,
+		"vdd":         float64(vdd) / 100,
+	}
+
+	// page 0 bytes 5-6 are the current register (0.2441mV units)
+	page0, err := os.ReadFile(filepath.Join(dir, "page0"))
+	if err == nil && len(page0) >= 7 {
+		raw := int16(uint16(page0[5]) | uint16(page0[6])<<8)
+		ret["vsens"] = float64(raw) * 0.2441e-3
+	}
+
+	return ret, nil
+}
+
+// oneWireTx writes w to a device and then reads n bytes. Each transaction
+// starts with a bus reset and device select.
+type oneWireTx func(w []byte, n int) ([]byte, error)
+
+// oneWireSysfsTx returns a transaction function for the sysfs rw file, which
+// is available for devices without a kernel family driver
+func oneWireSysfsTx(path string) oneWireTx {
+	return func(w []byte, n int) ([]byte, error) {
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		_, err = f.Write(w)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]byte, n)
+		_, err = goio.ReadFull(f, ret)
+		return ret, err
+	}
+}
+
+// oneWireCRC16 returns the 1-wire CRC16 of data. Devices send the inverted
+// CRC, least significant byte first.
+func oneWireCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// DS2450 commands
+const (
+	ds2450ReadMemory  = 0xaa
+	ds2450WriteMemory = 0x55
+	ds2450Convert     = 0x3c
+)
+
+// oneWireReadDS2450 configures the 4 DS2450 channels for 16 bits and the
+// 5.12V range, converts all channels, and returns the voltages of channels
+// A-D (keys 0-3). The DS2450 does not have a kernel driver, so it is accessed
+// through raw transactions.
+func oneWireReadDS2450(tx oneWireTx) (map[string]float64, error) {
+	// page 1 (0x08-0x0f) has 2 control bytes per channel. The first selects
+	// 16 bit resolution with the output disabled, and the second selects the
+	// 5.12V range and clears the power on reset flag. Write memory only writes
+	// one byte per transaction, as each transaction resets the bus.
+	config := []byte{0x00, 0x01}
+	for ch := 0; ch < 4; ch++ {
+		for i, c := range config {
+			addr := byte(0x08 + ch*2 + i)
+			r, err := tx([]byte{ds2450WriteMemory, addr, 0x00, c}, 3)
+			if err != nil {
+				return nil, err
+			}
+			// the device echos the byte after the CRC
+			if r[2] != c {
+				return nil, fmt.Errorf("DS2450 config write failed at %x", addr)
+			}
+		}
+	}
+
+	// convert all channels without presetting the results
+	_, err := tx([]byte{ds2450Convert, 0x0f, 0x00}, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4 channels * 16 bits * 80us + 160us
+	time.Sleep(10 * time.Millisecond)
+
+	cmd := []byte{ds2450ReadMemory, 0x00, 0x00}
+	r, err := tx(cmd, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	crc := uint16(r[8]) | uint16(r[9])<<8
+	if ^oneWireCRC16(append(cmd, r[:8]...)) != crc {
+		return nil, errors.New("DS2450 CRC error")
+	}
+
+	ret := make(map[string]float64)
+	for ch := 0; ch < 4; ch++ {
+		raw := uint16(r[ch*2]) | uint16(r[ch*2+1])<<8
+		ret[strconv.Itoa(ch)] = float64(raw) * 5.12 / 65536
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// oneWireFakeTree creates a fake w1 sysfs tree with one bus and a device of
+// each family with a kernel driver
+func oneWireFakeTree(t *testing.T) string {
+	root := t.TempDir()
+
+	files := map[string][]byte{
+		"w1_bus_master1/uevent":       nil,
+		"28-000000000001/temperature": []byte("21500\n"),
+		"10-000000000002/temperature": []byte("-1250\n"),
+		"29-000000000003/state":       {0xa5},
+		"29-000000000003/output":      {0xff},
+		"3a-000000000004/state":       {0x0f},
+		"3a-000000000004/output":      {0xff},
+		"26-000000000005/temperature": []byte("5760\n"),
+		"26-000000000005/vad":         []byte("512\n"),
+		"26-000000000005/vdd":         []byte("498\n"),
+		"26-000000000005/page0":       {0x09, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00},
+		// unsupported devices are ignored
+		"01-000000000006/id": nil,
+	}
+
+	for name, d := range files {
+		p := filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(p, d, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func TestOneWireRead(t *testing.T) {
+	root := oneWireFakeTree(t)
+
+	tests := []struct {
+		id     string
+		values map[string]float64
+	}{
+		{"28-000000000001", map[string]float64{"0": 21.5}},
+		{"10-000000000002", map[string]float64{"0": -1.25}},
+		{"29-000000000003", map[string]float64{
+			"0": 1, "1": 0, "2": 1, "3": 0, "4": 0, "5": 1, "6": 0, "7": 1}},
+		{"3a-000000000004", map[string]float64{"0": 1, "1": 1}},
+		{"26-000000000005", map[string]float64{
+			"temperature": 22.5, "vad": 5.12, "vdd": 4.98, "vsens": 256 * 0.2441e-3}},
+	}
+
+	for _, test := range tests {
+		values, err := oneWireRead(filepath.Join(root, test.id))
+		if err != nil {
+			t.Fatalf("Error reading %v: %v", test.id, err)
+		}
+
+		if len(values) != len(test.values) {
+			t.Fatalf("Wrong values for %v: %v", test.id, values)
+		}
+
+		for k, v := range test.values {
+			if values[k] != v {
+				t.Errorf("Wrong value for %v, key %v: %v, expected %v",
+					test.id, k, values[k], v)
+			}
+		}
+	}
+
+	_, err := oneWireRead(filepath.Join(root, "28-missing"))
+	if err == nil {
+		t.Error("Expected error for missing device")
+	}
+}
+
+func TestOneWireWrite(t *testing.T) {
+	root := oneWireFakeTree(t)
+
+	dir := filepath.Join(root, "29-000000000003")
+	err := oneWireWrite(dir, []bool{true, false, false, true, false, false, false, false})
+	if err != nil {
+		t.Fatal("Error writing outputs: ", err)
+	}
+
+	// outputs that are on have a 0 latch bit
+	d, _ := os.ReadFile(filepath.Join(dir, "output"))
+	if len(d) != 1 || d[0] != 0xf6 {
+		t.Errorf("Wrong output byte: %x", d)
+	}
+
+	outputs, err := oneWireReadOutputs(dir)
+	if err != nil || !outputs[0] || outputs[1] || !outputs[3] {
+		t.Error("Wrong outputs: ", outputs, err)
+	}
+
+	// state 0x0f has both DS2413 latches off
+	outputs, err = oneWireReadOutputs(filepath.Join(root, "3a-000000000004"))
+	if err != nil || len(outputs) != 2 || outputs[0] || outputs[1] {
+		t.Error("Wrong DS2413 outputs: ", outputs, err)
+	}
+
+	err = oneWireWrite(filepath.Join(root, "28-000000000001"), []bool{true})
+	if err == nil {
+		t.Error("Expected error writing to thermometer")
+	}
+}
+
+// ds2450Sim simulates DS2450 memory for raw transactions
+type ds2450Sim struct {
+	mem [0x20]byte
+}
+
+func (s *ds2450Sim) tx(w []byte, n int) ([]byte, error) {
+	switch w[0] {
+	case ds2450WriteMemory:
+		s.mem[w[1]] = w[3]
+		crc := ^oneWireCRC16(w)
+		return []byte{byte(crc), byte(crc >> 8), w[3]}, nil
+	case ds2450Convert:
+		// channel A-D results are 1/4 to 4/4 of full scale
+		for ch := 0; ch < 4; ch++ {
+			if s.mem[0x08+ch*2] != 0 || s.mem[0x09+ch*2] != 1 {
+				return nil, errors.New("channel not configured")
+			}
+			v := uint16(ch+1) * 0x4000
+			if ch == 3 {
+				v = 0xffff
+			}
+			s.mem[ch*2] = byte(v)
+			s.mem[ch*2+1] = byte(v >> 8)
+		}
+		return make([]byte, n), nil
+	case ds2450ReadMemory:
+		ret := append([]byte{}, s.mem[w[1]:w[1]+8]...)
+		crc := ^oneWireCRC16(append(append([]byte{}, w...), ret...))
+		return append(ret, byte(crc), byte(crc>>8)), nil
+	}
+	return nil, errors.New("unknown command")
+}
+
+func TestOneWireDS2450(t *testing.T) {
+	sim := &ds2450Sim{}
+
+	values, err := oneWireReadDS2450(sim.tx)
+	if err != nil {
+		t.Fatal("Error reading DS2450: ", err)
+	}
+
+	expected := []float64{1.28, 2.56, 3.84, 0xffff * 5.12 / 65536}
+	for ch, v := range expected {
+		if got := values[string(rune('0'+ch))]; got != v {
+			t.Errorf("Wrong channel %v: %v, expected %v", ch, got, v)
+		}
+	}
+
+	// CRC errors are detected
+	_, err = oneWireReadDS2450(func(w []byte, n int) ([]byte, error) {
+		r, err := sim.tx(w, n)
+		if w[0] == ds2450ReadMemory {
+			r[9]++
+		}
+		return r, err
+	})
+	if err == nil {
+		t.Error("Expected CRC error")
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func (ow *OneWireClient) dir(io *OneWireIO) string {
+	return filepath.Join(ow.root, io.DeviceID)
+}
+
+// outputs returns the output states from the valueSet points
+func (io *OneWireIO) outputs() []bool {
+	ret := make([]bool, oneWireOutputs(io.DeviceID))
+	for i := range ret {
+		ret[i] = data.FloatToBool(io.ValueSets[strconv.Itoa(i)])
+	}
+	return ret
+}
+
+// write sets the device outputs from the valueSet points
+func (ow *OneWireClient) write(io *OneWireIO) error {
+	if io.Disabled || oneWireOutputs(io.DeviceID) == 0 {
+		return nil
+	}
+
+	return oneWireWrite(ow.dir(io), io.outputs())
+}
+
+// read reads the device and sends values that changed
+func (ow *OneWireClient) read(io *OneWireIO) error {
+	if io.Disabled {
+		return nil
+	}
+
+	if io.DeviceID == "" {
+		return errors.New("Must define onewire ID")
+	}
+
+	values, err := oneWireRead(ow.dir(io))
+	if err != nil {
+		return err
+	}
+
+	if io.Units == "F" {
+		k := oneWireTemperatureKey(io.DeviceID)
+		if v, ok := values[k]; ok {
+			values[k] = v*1.8 + 32
+		}
+	}
+
+	// outputs are written again if they don't match, for example after the
+	// device loses power
+	if oneWireOutputs(io.DeviceID) > 0 {
+		current, err := oneWireReadOutputs(ow.dir(io))
+		if err != nil {
+			return err
+		}
+
+		if !slices.Equal(current, io.outputs()) {
+			err := ow.write(io)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if io.Values == nil {
+		io.Values = make(map[string]float64)
+	}
+
+	var pts data.Points
+	resend := time.Since(ow.lastSent[io.ID]) > time.Minute*10
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := values[k]
+		old, ok := io.Values[k]
+		if ok && v == old && !resend {
+			continue
+		}
+		io.Values[k] = v
+		pts = append(pts, data.Point{
+			Type:  data.PointTypeValue,
+			Key:   k,
+			Value: v,
+		})
+	}
+
+	if len(pts) > 0 {
+		err = SendNodePoints(ow.nc, io.ID, pts, false)
+		ow.lastSent[io.ID] = time.Now()
+	}
+
+	return err
+}
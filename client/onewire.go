@@ -0,0 +1,276 @@
+package client
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// OneWire describes a 1-wire bus node. Bus nodes are created when the node
+// manager detects a new bus master in sysfs.
+type OneWire struct {
+	ID              string      `node:"id"`
+	Parent          string      `node:"parent"`
+	Description     string      `point:"description"`
+	Index           int         `point:"index"`
+	Debug           int         `point:"debug"`
+	PollPeriod      int         `point:"pollPeriod"`
+	Disabled        bool        `point:"disabled"`
+	ErrorCount      int         `point:"errorCount"`
+	ErrorCountReset bool        `point:"errorCountReset"`
+	IOs             []OneWireIO `child:"oneWireIO"`
+}
+
+// OneWireIO describes a 1-wire device node. DeviceID is the sysfs device ID
+// (ex: 28-0000056a6e42). Values and ValueSets are keyed by the device
+// channel.
+type OneWireIO struct {
+	ID              string             `node:"id"`
+	Parent          string             `node:"parent"`
+	Description     string             `point:"description"`
+	DeviceID        string             `point:"id"`
+	Units           string             `point:"units"`
+	Values          map[string]float64 `point:"value"`
+	ValueSets       map[string]float64 `point:"valueSet"`
+	Disabled        bool               `point:"disabled"`
+	ErrorCount      int                `point:"errorCount"`
+	ErrorCountReset bool               `point:"errorCountReset"`
+}
+
+// oneWireRoot is the default location of 1-wire devices in sysfs
+const oneWireRoot = "/sys/bus/w1/devices"
+
+// OneWireRoot returns the sysfs directory that contains 1-wire buses and
+// devices. This is /sys/bus/w1/devices unless the SIOT_1WIRE_ROOT
+// environment variable is set.
+func OneWireRoot() string {
+	root := os.Getenv("SIOT_1WIRE_ROOT")
+	if root == "" {
+		return oneWireRoot
+	}
+	return root
+}
+
+// OneWireClient is a SIOT client that reads and writes 1-wire devices
+type OneWireClient struct {
+	nc            *nats.Conn
+	config        OneWire
+	root          string
+	lastSent      map[string]time.Time
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+}
+
+// NewOneWireClient returns a new OneWireClient with a NATS connection and a config
+func NewOneWireClient(nc *nats.Conn, config OneWire) Client {
+	return &OneWireClient{
+		nc:            nc,
+		config:        config,
+		root:          OneWireRoot(),
+		lastSent:      make(map[string]time.Time),
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+	}
+}
+
+// Stop sends a signal to the Run function to exit
+func (ow *OneWireClient) Stop(_ error) {
+	close(ow.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (ow *OneWireClient) Points(nodeID string, points []data.Point) {
+	ow.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (ow *OneWireClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	ow.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
+
+// detect creates IO nodes for devices that are not on the bus. New nodes
+// cause the Manager to restart the client with the new IOs.
+func (ow *OneWireClient) detect() {
+	dirs, _ := filepath.Glob(filepath.Join(ow.root, "*-*"))
+
+	for _, dir := range dirs {
+		f, err := os.Stat(dir)
+		if err != nil || !f.IsDir() || !oneWireSupported(path.Base(dir)) {
+			continue
+		}
+
+		id := path.Base(dir)
+		found := false
+		for _, io := range ow.config.IOs {
+			if io.DeviceID == id {
+				found = true
+				break
+			}
+		}
+
+		if found {
+			continue
+		}
+
+		log.Println("adding 1-wire IO:", id)
+
+		n := data.NodeEdge{
+			Type:   data.NodeTypeOneWireIO,
+			Parent: ow.config.ID,
+			Points: data.Points{
+				data.Point{
+					Type: data.PointTypeID,
+					Text: id,
+				},
+				data.Point{
+					Type: data.PointTypeDescription,
+					Text: "New IO, please edit",
+				},
+			},
+		}
+
+		err = SendNode(ow.nc, n, "")
+		if err != nil {
+			log.Println("Error sending new 1-wire IO:", err)
+		}
+	}
+}
+
+// Run the main logic for the bus and blocks until stopped
+func (ow *OneWireClient) Run() error {
+	log.Println("Starting 1-wire client:", ow.config.Description)
+
+	scanTimer := time.NewTicker(24 * time.Hour)
+	defer scanTimer.Stop()
+
+	setScanTimer := func() {
+		pollPeriod := ow.config.PollPeriod
+		if pollPeriod <= 0 {
+			pollPeriod = 3000
+		}
+		scanTimer.Reset(time.Millisecond * time.Duration(pollPeriod))
+	}
+
+	setScanTimer()
+
+	for {
+		select {
+		case <-ow.stop:
+			log.Println("Stopping 1-wire client:", ow.config.Description)
+			return nil
+
+		case pts := <-ow.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &ow.config)
+			if err != nil {
+				log.Println("1-wire: error merging new points:", err)
+			}
+
+			if pts.ID == ow.config.ID {
+				for _, p := range pts.Points {
+					switch p.Type {
+					case data.PointTypePollPeriod:
+						setScanTimer()
+					case data.PointTypeErrorCountReset:
+						if ow.config.ErrorCountReset {
+							ow.config.ErrorCount = 0
+							ow.config.ErrorCountReset = false
+							err := SendNodePoints(ow.nc, ow.config.ID, data.Points{
+								{Type: data.PointTypeErrorCount, Value: 0},
+								{Type: data.PointTypeErrorCountReset, Value: 0},
+							}, true)
+							if err != nil {
+								log.Println("Send point error:", err)
+							}
+						}
+					}
+				}
+				continue
+			}
+
+			io := ow.io(pts.ID)
+			if io == nil {
+				continue
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeValueSet:
+					err := ow.write(io)
+					if err != nil {
+						log.Printf("Error writing 1-wire io %v: %v\n",
+							io.DeviceID, err)
+					}
+				case data.PointTypeErrorCountReset:
+					if io.ErrorCountReset {
+						err := SendNodePoints(ow.nc, io.ID, data.Points{
+							{Type: data.PointTypeErrorCount, Value: 0},
+							{Type: data.PointTypeErrorCountReset, Value: 0},
+						}, true)
+						if err != nil {
+							log.Println("Send point error:", err)
+						}
+					}
+				}
+			}
+
+		case <-ow.newEdgePoints:
+			// edge points are not used
+
+		case <-scanTimer.C:
+			if ow.config.Disabled {
+				continue
+			}
+
+			ow.detect()
+
+			for i := range ow.config.IOs {
+				io := &ow.config.IOs[i]
+				err := ow.read(io)
+				if err == nil {
+					continue
+				}
+
+				if ow.config.Debug > 0 {
+					log.Printf("Error reading 1-wire io %v: %v\n",
+						io.DeviceID, err)
+				}
+
+				ow.config.ErrorCount++
+				err = SendNodePoint(ow.nc, ow.config.ID, data.Point{
+					Type:  data.PointTypeErrorCount,
+					Value: float64(ow.config.ErrorCount),
+				}, false)
+				if err != nil {
+					log.Println("Error sending point:", err)
+				}
+
+				err = SendNodePoint(ow.nc, io.ID, data.Point{
+					Type:  data.PointTypeErrorCount,
+					Value: float64(io.ErrorCount + 1),
+				}, false)
+				if err != nil {
+					log.Println("Error sending point:", err)
+				}
+			}
+		}
+	}
+}
+
+// io returns the config of an IO node, or nil if not found
+func (ow *OneWireClient) io(id string) *OneWireIO {
+	for i := range ow.config.IOs {
+		if ow.config.IOs[i].ID == id {
+			return &ow.config.IOs[i]
+		}
+	}
+	return nil
+}
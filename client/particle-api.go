@@ -0,0 +1,99 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Call Particle.io device functions and read variables. See:
+// https://docs.particle.io/reference/cloud-apis/api/#call-a-function
+// https://docs.particle.io/reference/cloud-apis/api/#get-a-variable-value
+
+const particleAPIURL = "https://api.particle.io"
+
+// particleAPI calls the Particle cloud API
+type particleAPI struct {
+	url   string
+	token string
+}
+
+type particleError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// do sends a request and decodes the JSON response into ret
+func (pa particleAPI) do(req *http.Request, ret any) error {
+	req.Header.Set("Authorization", "Bearer "+pa.token)
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var pErr particleError
+		_ = json.NewDecoder(res.Body).Decode(&pErr)
+		msg := pErr.Error
+		if pErr.ErrorDescription != "" {
+			msg += ": " + pErr.ErrorDescription
+		}
+		return fmt.Errorf("Particle API returned %v: %v", res.StatusCode, msg)
+	}
+
+	return json.NewDecoder(res.Body).Decode(ret)
+}
+
+func (pa particleAPI) deviceURL(device, name string) string {
+	return strings.TrimSuffix(pa.url, "/") + "/v1/devices/" +
+		url.PathEscape(device) + "/" + url.PathEscape(name)
+}
+
+// callFunction calls a function on a device and returns the value the
+// function returned
+func (pa particleAPI) callFunction(device, function, arg string) (int, error) {
+	form := url.Values{"arg": {arg}}
+	req, err := http.NewRequest(http.MethodPost, pa.deviceURL(device, function),
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var ret struct {
+		Connected   bool `json:"connected"`
+		ReturnValue int  `json:"return_value"`
+	}
+
+	err = pa.do(req, &ret)
+	if err != nil {
+		return 0, err
+	}
+
+	if !ret.Connected {
+		return 0, errors.New("device is not connected")
+	}
+
+	return ret.ReturnValue, nil
+}
+
+// readVariable reads a variable from a device. The result is a float64,
+// bool, or string.
+func (pa particleAPI) readVariable(device, variable string) (any, error) {
+	req, err := http.NewRequest(http.MethodGet, pa.deviceURL(device, variable), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret struct {
+		Result any `json:"result"`
+	}
+
+	err = pa.do(req, &ret)
+	return ret.Result, err
+}
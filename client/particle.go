@@ -1,8 +1,13 @@
 package client
 
 import (
+	"bytes"
 	"encoding/json"
 	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/donovanhide/eventsource"
@@ -13,7 +18,7 @@ import (
 // Get Particle.io data using their event API. See:
 // https://docs.particle.io/reference/cloud-apis/api/#get-a-stream-of-events
 
-const particleEventURL string = "https://api.particle.io/v1/devices/events/"
+const particleEventPath string = "/v1/devices/events/"
 
 // ParticleEvent from particle
 type ParticleEvent struct {
@@ -23,13 +28,46 @@ type ParticleEvent struct {
 	CoreID    string    `json:"coreid"`
 }
 
-// Particle represents the configuration for the SIOT Particle client
+// Particle represents the configuration for the SIOT Particle client.
+// APIURL defaults to https://api.particle.io. Variables are read every
+// PollPeriod ms (defaults to 60s).
 type Particle struct {
+	ID          string             `node:"id"`
+	Parent      string             `node:"parent"`
+	Description string             `point:"description"`
+	Disabled    bool               `point:"disabled"`
+	AuthToken   string             `point:"authToken"`
+	APIURL      string             `point:"apiURL"`
+	PollPeriod  int                `point:"pollPeriod"`
+	Functions   []ParticleFunction `child:"particleFunction"`
+	Variables   []ParticleVariable `child:"particleVariable"`
+}
+
+// ParticleFunction calls a cloud function on a device when a valueSet point
+// is written to the node. The value returned by the function is written to
+// the value point.
+type ParticleFunction struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	Disabled    bool   `point:"disabled"`
+	DeviceID    string `point:"deviceID"`
+	Function    string `point:"function"`
+	// Argument is a Go template. The .Value, .Text, and .Key fields of the
+	// valueSet point are available, ex: relay{{.Key}}:{{.Value}}. If blank,
+	// the point text or value is used.
+	Argument string `point:"argument"`
+}
+
+// ParticleVariable periodically reads a variable from a device into the
+// value point of the node. String variables are written to the point text.
+type ParticleVariable struct {
 	ID          string `node:"id"`
 	Parent      string `node:"parent"`
 	Description string `point:"description"`
 	Disabled    bool   `point:"disabled"`
-	AuthToken   string `point:"authToken"`
+	DeviceID    string `point:"deviceID"`
+	Variable    string `point:"variable"`
 }
 
 // ParticleClient is a SIOT particle client
@@ -81,7 +119,8 @@ func (pc *ParticleClient) Run() error {
 			readerClosed <- struct{}{}
 		}()
 
-		urlAuth := particleEventURL + "sample" + "?access_token=" + pc.config.AuthToken
+		urlAuth := pc.api().url + particleEventPath + "sample" +
+			"?access_token=" + pc.config.AuthToken
 
 		stream, err := eventsource.Subscribe(urlAuth, "")
 
@@ -148,6 +187,18 @@ func (pc *ParticleClient) Run() error {
 		}
 	}
 
+	varTicker := time.NewTicker(time.Minute)
+	defer varTicker.Stop()
+
+	setVarTicker := func() {
+		pollPeriod := pc.config.PollPeriod
+		if pollPeriod <= 0 {
+			pollPeriod = 60000
+		}
+		varTicker.Reset(time.Millisecond * time.Duration(pollPeriod))
+	}
+
+	setVarTicker()
 	startReader()
 
 done:
@@ -162,11 +213,18 @@ done:
 				log.Println("error merging new points:", err)
 			}
 
+			if pts.ID != pc.config.ID {
+				pc.childPoints(pts)
+				continue
+			}
+
 			for _, p := range pts.Points {
 				switch p.Type {
-				case data.PointTypeAuthToken:
+				case data.PointTypeAuthToken, data.PointTypeAPIURL:
 					stopReader()
 					startReader()
+				case data.PointTypePollPeriod:
+					setVarTicker()
 				case data.PointTypeDisabled:
 					if p.Value == 1 {
 						stopReader()
@@ -188,6 +246,12 @@ done:
 
 		case <-checkReader.C:
 			startReader()
+
+		case <-varTicker.C:
+			if pc.config.Disabled {
+				continue
+			}
+			go pc.readVariables(pc.api(), slices.Clone(pc.config.Variables))
 		}
 	}
 
@@ -196,6 +260,117 @@ done:
 	return nil
 }
 
+func (pc *ParticleClient) api() particleAPI {
+	url := pc.config.APIURL
+	if url == "" {
+		url = particleAPIURL
+	}
+	return particleAPI{url: strings.TrimSuffix(url, "/"), token: pc.config.AuthToken}
+}
+
+// childPoints calls functions when valueSet points are written to function
+// nodes
+func (pc *ParticleClient) childPoints(pts NewPoints) {
+	if pc.config.Disabled {
+		return
+	}
+
+	for _, f := range pc.config.Functions {
+		if f.ID != pts.ID {
+			continue
+		}
+
+		if f.Disabled || f.DeviceID == "" || f.Function == "" {
+			return
+		}
+
+		for _, p := range pts.Points {
+			if p.Type != data.PointTypeValueSet {
+				continue
+			}
+
+			arg, err := particleArgument(f.Argument, p)
+			if err != nil {
+				log.Printf("Particle function %v: error executing argument template: %v\n",
+					f.Function, err)
+				continue
+			}
+
+			go pc.callFunction(pc.api(), f, arg)
+		}
+
+		return
+	}
+}
+
+// particleArgument returns the function argument for a point
+func particleArgument(argument string, p data.Point) (string, error) {
+	if argument == "" {
+		if p.Text != "" {
+			return p.Text, nil
+		}
+		return strconv.FormatFloat(p.Value, 'f', -1, 64), nil
+	}
+
+	t, err := template.New("argument").Parse(argument)
+	if err != nil {
+		return "", err
+	}
+
+	var ret bytes.Buffer
+	err = t.Execute(&ret, p)
+	return ret.String(), err
+}
+
+func (pc *ParticleClient) callFunction(api particleAPI, f ParticleFunction, arg string) {
+	v, err := api.callFunction(f.DeviceID, f.Function, arg)
+	if err != nil {
+		log.Printf("Particle error calling function %v(%v): %v\n", f.Function, arg, err)
+		return
+	}
+
+	err = SendNodePoint(pc.nc, f.ID, data.Point{
+		Type:  data.PointTypeValue,
+		Value: float64(v),
+	}, false)
+	if err != nil {
+		log.Println("Particle error sending points:", err)
+	}
+}
+
+func (pc *ParticleClient) readVariables(api particleAPI, vars []ParticleVariable) {
+	for _, v := range vars {
+		if v.Disabled || v.DeviceID == "" || v.Variable == "" {
+			continue
+		}
+
+		result, err := api.readVariable(v.DeviceID, v.Variable)
+		if err != nil {
+			log.Printf("Particle error reading variable %v: %v\n", v.Variable, err)
+			continue
+		}
+
+		p := data.Point{Type: data.PointTypeValue}
+
+		switch r := result.(type) {
+		case float64:
+			p.Value = r
+		case bool:
+			p.Value = data.BoolToFloat(r)
+		case string:
+			p.Text = r
+		default:
+			log.Printf("Particle variable %v has unsupported type: %T\n", v.Variable, result)
+			continue
+		}
+
+		err = SendNodePoint(pc.nc, v.ID, p, false)
+		if err != nil {
+			log.Println("Particle error sending points:", err)
+		}
+	}
+}
+
 // Stop sends a signal to the Run function to exit
 func (pc *ParticleClient) Stop(_ error) {
 	close(pc.stop)
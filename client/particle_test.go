@@ -0,0 +1,178 @@
+package client_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+// particleMock is a mock of the Particle cloud API
+type particleMock struct {
+	lock  sync.Mutex
+	args  []string
+	temp  float64
+	close chan struct{}
+}
+
+func (pm *particleMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v1/devices/events/sample" {
+		if r.URL.Query().Get("access_token") != "test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		event, _ := json.Marshal(client.ParticleEvent{
+			Data:      `[{"id":"4B03089794485728","type":"temp","value":15.25}]`,
+			Timestamp: time.Now(),
+			CoreID:    "dev1",
+		})
+		fmt.Fprintf(w, "event: sample\ndata: %s\n\n", event)
+		w.(http.Flusher).Flush()
+		<-pm.close
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_token"}`))
+		return
+	}
+
+	pm.lock.Lock()
+	defer pm.lock.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/devices/dev1/relay":
+		pm.args = append(pm.args, r.FormValue("arg"))
+		_, _ = w.Write([]byte(`{"id":"dev1","name":"relay","connected":true,"return_value":1}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/devices/dev1/temp":
+		fmt.Fprintf(w, `{"name":"temp","result":%v}`, pm.temp)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/devices/dev1/version":
+		_, _ = w.Write([]byte(`{"name":"version","result":"1.2.3"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"ok":false,"error":"Variable not found"}`))
+	}
+}
+
+func TestParticle(t *testing.T) {
+	mock := &particleMock{temp: 22.5, close: make(chan struct{})}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+	defer close(mock.close)
+
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	err = client.SendNodeType(nc, client.Particle{
+		ID:         "ID-particle",
+		Parent:     root.ID,
+		AuthToken:  "test-token",
+		APIURL:     srv.URL,
+		PollPeriod: 100,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending particle node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.ParticleFunction{
+		ID:       "ID-func",
+		Parent:   "ID-particle",
+		DeviceID: "dev1",
+		Function: "relay",
+		Argument: "{{.Key}}:{{.Value}}",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending function node: ", err)
+	}
+
+	for _, v := range []client.ParticleVariable{
+		{ID: "ID-temp", Parent: "ID-particle", DeviceID: "dev1", Variable: "temp"},
+		{ID: "ID-version", Parent: "ID-particle", DeviceID: "dev1", Variable: "version"},
+	} {
+		err = client.SendNodeType(nc, v, "test")
+		if err != nil {
+			t.Fatal("Error sending variable node: ", err)
+		}
+	}
+
+	wait := func(desc string, check func() bool) {
+		t.Helper()
+		start := time.Now()
+		for !check() {
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("Timeout waiting for ", desc)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	node := func(parent, id string) data.NodeEdge {
+		nodes, err := client.GetNodes(nc, parent, id, "", false)
+		if err != nil || len(nodes) < 1 {
+			return data.NodeEdge{}
+		}
+		return nodes[0]
+	}
+
+	// events are received from the configured API URL
+	wait("event", func() bool {
+		n := node(root.ID, "ID-particle")
+		v, _ := n.Points.Value("temp", "4B03089794485728")
+		return v == 15.25
+	})
+
+	// variables are read periodically
+	wait("temp variable", func() bool {
+		n := node("ID-particle", "ID-temp")
+		v, _ := n.Points.Value(data.PointTypeValue, "")
+		return v == 22.5
+	})
+
+	wait("version variable", func() bool {
+		n := node("ID-particle", "ID-version")
+		v, _ := n.Points.Text(data.PointTypeValue, "")
+		return v == "1.2.3"
+	})
+
+	mock.lock.Lock()
+	mock.temp = 23
+	mock.lock.Unlock()
+
+	wait("temp variable update", func() bool {
+		n := node("ID-particle", "ID-temp")
+		v, _ := n.Points.Value(data.PointTypeValue, "")
+		return v == 23
+	})
+
+	// writing valueSet calls the function
+	err = client.SendNodePoint(nc, "ID-func", data.Point{
+		Type: data.PointTypeValueSet, Key: "2", Value: 1, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending valueSet: ", err)
+	}
+
+	wait("function return value", func() bool {
+		n := node("ID-particle", "ID-func")
+		v, _ := n.Points.Value(data.PointTypeValue, "")
+		return v == 1
+	})
+
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	if len(mock.args) != 1 || mock.args[0] != "2:1" {
+		t.Error("Unexpected function args: ", mock.args)
+	}
+}
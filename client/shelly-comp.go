@@ -0,0 +1,336 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// shellyCompType describes how a type of component is discovered and read
+type shellyCompType struct {
+	// points that are created for each instance when a device is discovered
+	points []string
+	// settable is true if the component can be controlled
+	settable bool
+	// gen2Status converts the Gen2 status of a component instance to points.
+	// Notifications only contain the fields that changed, so all status
+	// fields are optional.
+	gen2Status func(status json.RawMessage, t time.Time) (data.Points, error)
+}
+
+var shellyCompTypes = map[string]shellyCompType{
+	"switch": {
+		points:     []string{data.PointTypeSwitch, data.PointTypeSwitchSet},
+		settable:   true,
+		gen2Status: shellyGen2Switch,
+	},
+	"light": {
+		points:   []string{data.PointTypeLight, data.PointTypeLightSet},
+		settable: true,
+	},
+	"input": {
+		points:     []string{data.PointTypeInput},
+		gen2Status: shellyGen2Input,
+	},
+	"cover": {
+		settable:   true,
+		gen2Status: shellyGen2Cover,
+	},
+	"em":          {gen2Status: shellyGen2EM},
+	"emdata":      {gen2Status: shellyGen2EMData},
+	"temperature": {gen2Status: shellyGen2Temperature},
+	"humidity":    {gen2Status: shellyGen2Humidity},
+	"devicepower": {gen2Status: shellyGen2DevicePower},
+	"voltmeter":   {gen2Status: shellyGen2Voltmeter},
+}
+
+type shellyGen2Total struct {
+	Total *float64 `json:"total"`
+}
+
+// shellyGen2Meter is the metering status of switch and cover components.
+// Energy is in Wh.
+// Example: {"id":0, "source":"WS_in", "output":false, "apower":0.0, "voltage":123.3, "current":0.000, "pf":0.0, "freq":60.0, "aenergy":{"total":0.000,"by_minute":[0.000,0.000,0.000],"minute_ts":1680536525},"temperature":{"tC":44.4, "tF":112.0}}
+type shellyGen2Meter struct {
+	ID          int              `json:"id"`
+	Apower      *float64         `json:"apower"`
+	Voltage     *float64         `json:"voltage"`
+	Current     *float64         `json:"current"`
+	PF          *float64         `json:"pf"`
+	Freq        *float64         `json:"freq"`
+	Aenergy     *shellyGen2Total `json:"aenergy"`
+	RetAenergy  *shellyGen2Total `json:"ret_aenergy"`
+	Temperature *struct {
+		TC *float64 `json:"tC"`
+	} `json:"temperature"`
+}
+
+// shellyPoints collects points for optional status fields
+type shellyPoints struct {
+	t   time.Time
+	pts data.Points
+}
+
+func (sp *shellyPoints) add(typ, key string, v *float64) {
+	if v != nil {
+		sp.pts = append(sp.pts, data.Point{Time: sp.t, Type: typ, Key: key, Value: *v})
+	}
+}
+
+func (sp *shellyPoints) addBool(typ, key string, v *bool) {
+	if v != nil {
+		sp.pts = append(sp.pts, data.Point{Time: sp.t, Type: typ, Key: key,
+			Value: data.BoolToFloat(*v)})
+	}
+}
+
+func (sp *shellyPoints) addText(typ, key string, v *string) {
+	if v != nil {
+		sp.pts = append(sp.pts, data.Point{Time: sp.t, Type: typ, Key: key, Text: *v})
+	}
+}
+
+func (m *shellyGen2Meter) toPoints(sp *shellyPoints) {
+	key := strconv.Itoa(m.ID)
+	sp.add(data.PointTypePower, key, m.Apower)
+	sp.add(data.PointTypeVoltage, key, m.Voltage)
+	sp.add(data.PointTypeCurrent, key, m.Current)
+	sp.add(data.PointTypePowerFactor, key, m.PF)
+	sp.add(data.PointTypeFrequency, key, m.Freq)
+	if m.Aenergy != nil {
+		sp.add(data.PointTypeEnergy, key, m.Aenergy.Total)
+	}
+	if m.RetAenergy != nil {
+		sp.add(data.PointTypeEnergyReturned, key, m.RetAenergy.Total)
+	}
+	if m.Temperature != nil {
+		sp.add(data.PointTypeTemperature, key, m.Temperature.TC)
+	}
+}
+
+func shellyGen2Switch(status json.RawMessage, t time.Time) (data.Points, error) {
+	var s struct {
+		shellyGen2Meter
+		Output *bool `json:"output"`
+	}
+
+	err := json.Unmarshal(status, &s)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := shellyPoints{t: t}
+	sp.addBool(data.PointTypeSwitch, strconv.Itoa(s.ID), s.Output)
+	s.toPoints(&sp)
+	return sp.pts, nil
+}
+
+// Example: {"id":0,"state":"stopped","source":"limit_switch","current_pos":100,"apower":0.0,"voltage":231.2,"current":0.0,"pf":0.0,"freq":50.0,"aenergy":{"total":12.5},"temperature":{"tC":41.2},"pos_control":true}
+func shellyGen2Cover(status json.RawMessage, t time.Time) (data.Points, error) {
+	var c struct {
+		shellyGen2Meter
+		State      *string  `json:"state"`
+		CurrentPos *float64 `json:"current_pos"`
+	}
+
+	err := json.Unmarshal(status, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strconv.Itoa(c.ID)
+	sp := shellyPoints{t: t}
+	sp.addText(data.PointTypeCoverState, key, c.State)
+	// position is null if the cover is not calibrated
+	sp.add(data.PointTypeCoverPos, key, c.CurrentPos)
+	c.toPoints(&sp)
+	return sp.pts, nil
+}
+
+// Inputs can be digital (state), analog (percent), or count (counts)
+// Example: {"id":2,"counts":{"total":431,"xtotal":null},"freq":0.0}
+func shellyGen2Input(status json.RawMessage, t time.Time) (data.Points, error) {
+	var in struct {
+		ID      int              `json:"id"`
+		State   *bool            `json:"state"`
+		Percent *float64         `json:"percent"`
+		Counts  *shellyGen2Total `json:"counts"`
+	}
+
+	err := json.Unmarshal(status, &in)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strconv.Itoa(in.ID)
+	sp := shellyPoints{t: t}
+	// button inputs have a null state
+	sp.addBool(data.PointTypeInput, key, in.State)
+	sp.add(data.PointTypeInput, key, in.Percent)
+	if in.Counts != nil {
+		sp.add(data.PointTypeCount, key, in.Counts.Total)
+	}
+	return sp.pts, nil
+}
+
+var shellyPhases = []string{"a", "b", "c"}
+
+// shellyNumbers returns the numeric fields of a status that has a flat
+// layout, like the em and emdata components
+func shellyNumbers(status json.RawMessage) (map[string]*float64, error) {
+	var m map[string]any
+
+	err := json.Unmarshal(status, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]*float64)
+	for k, v := range m {
+		if f, ok := v.(float64); ok {
+			ret[k] = &f
+		}
+	}
+
+	return ret, nil
+}
+
+// shellyGen2EM converts 3 phase meter status to points keyed by phase (a, b,
+// c) and total.
+// Example: {"id":0,"a_current":4.029,"a_voltage":236.1,"a_act_power":951.2,"a_aprt_power":951.9,"a_pf":1,"a_freq":50,...,"total_current":4.4,"total_act_power":1039.3}
+func shellyGen2EM(status json.RawMessage, t time.Time) (data.Points, error) {
+	em, err := shellyNumbers(status)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := shellyPoints{t: t}
+	for _, ph := range shellyPhases {
+		sp.add(data.PointTypeCurrent, ph, em[ph+"_current"])
+		sp.add(data.PointTypeVoltage, ph, em[ph+"_voltage"])
+		sp.add(data.PointTypePower, ph, em[ph+"_act_power"])
+		sp.add(data.PointTypePowerFactor, ph, em[ph+"_pf"])
+		sp.add(data.PointTypeFrequency, ph, em[ph+"_freq"])
+	}
+	sp.add(data.PointTypeCurrent, "total", em["total_current"])
+	sp.add(data.PointTypePower, "total", em["total_act_power"])
+	return sp.pts, nil
+}
+
+// shellyGen2EMData converts 3 phase energy counters (Wh) to points.
+// Example: {"id":0,"a_total_act_energy":2345.6,"a_total_act_ret_energy":0,...,"total_act":7890.1,"total_act_ret":0}
+func shellyGen2EMData(status json.RawMessage, t time.Time) (data.Points, error) {
+	em, err := shellyNumbers(status)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := shellyPoints{t: t}
+	for _, ph := range shellyPhases {
+		sp.add(data.PointTypeEnergy, ph, em[ph+"_total_act_energy"])
+		sp.add(data.PointTypeEnergyReturned, ph, em[ph+"_total_act_ret_energy"])
+	}
+	sp.add(data.PointTypeEnergy, "total", em["total_act"])
+	sp.add(data.PointTypeEnergyReturned, "total", em["total_act_ret"])
+	return sp.pts, nil
+}
+
+// Example: {"id":0,"tC":22.4,"tF":72.3}
+func shellyGen2Temperature(status json.RawMessage, t time.Time) (data.Points, error) {
+	var temp struct {
+		ID int      `json:"id"`
+		TC *float64 `json:"tC"`
+	}
+
+	err := json.Unmarshal(status, &temp)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := shellyPoints{t: t}
+	sp.add(data.PointTypeTemperature, strconv.Itoa(temp.ID), temp.TC)
+	return sp.pts, nil
+}
+
+// Example: {"id":0,"rh":48.2}
+func shellyGen2Humidity(status json.RawMessage, t time.Time) (data.Points, error) {
+	var h struct {
+		ID int      `json:"id"`
+		RH *float64 `json:"rh"`
+	}
+
+	err := json.Unmarshal(status, &h)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := shellyPoints{t: t}
+	sp.add(data.PointTypeHumidity, strconv.Itoa(h.ID), h.RH)
+	return sp.pts, nil
+}
+
+// Example: {"id":0,"battery":{"V":5.9,"percent":93},"external":{"present":false}}
+func shellyGen2DevicePower(status json.RawMessage, t time.Time) (data.Points, error) {
+	var dp struct {
+		ID      int `json:"id"`
+		Battery *struct {
+			Percent *float64 `json:"percent"`
+		} `json:"battery"`
+	}
+
+	err := json.Unmarshal(status, &dp)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := shellyPoints{t: t}
+	if dp.Battery != nil {
+		sp.add(data.PointTypeBattery, strconv.Itoa(dp.ID), dp.Battery.Percent)
+	}
+	return sp.pts, nil
+}
+
+// Example: {"id":100,"voltage":3.21}
+func shellyGen2Voltmeter(status json.RawMessage, t time.Time) (data.Points, error) {
+	var vm struct {
+		ID      int      `json:"id"`
+		Voltage *float64 `json:"voltage"`
+	}
+
+	err := json.Unmarshal(status, &vm)
+	if err != nil {
+		return nil, err
+	}
+
+	sp := shellyPoints{t: t}
+	sp.add(data.PointTypeVoltage, strconv.Itoa(vm.ID), vm.Voltage)
+	return sp.pts, nil
+}
+
+// shellyGen2StatusPoints converts a Shelly.GetStatus result or NotifyStatus
+// params to points. Components that are not supported are ignored.
+func shellyGen2StatusPoints(status map[string]json.RawMessage) (data.Points, error) {
+	var ret data.Points
+	now := time.Now()
+
+	for comp, raw := range status {
+		name, _, _ := strings.Cut(comp, ":")
+		ct, ok := shellyCompTypes[name]
+		if !ok || ct.gen2Status == nil {
+			continue
+		}
+
+		pts, err := ct.gen2Status(raw, now)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %v: %w", comp, err)
+		}
+
+		ret = append(ret, pts...)
+	}
+
+	return ret, nil
+}
@@ -21,6 +21,9 @@ type ShellyIOClient struct {
 	newShellyPoints chan NewPoints
 	errorCount      int
 	comps           []shellyComp
+	wsState         chan shellyWSState
+	wsStop          chan struct{}
+	wsConnected     bool
 }
 
 // NewShellyIOClient ...
@@ -34,12 +37,13 @@ func NewShellyIOClient(nc *nats.Conn, config ShellyIo) Client {
 	return &ShellyIOClient{
 		nc:              nc,
 		config:          config,
-		comps:           shellyCompMap[config.Type],
+		comps:           shellyDevices[config.Type].comps,
 		points:          ne.Points,
 		stop:            make(chan struct{}),
 		newPoints:       make(chan NewPoints),
 		newEdgePoints:   make(chan NewPoints),
 		newShellyPoints: make(chan NewPoints),
+		wsState:         make(chan shellyWSState),
 	}
 }
 
@@ -49,18 +53,49 @@ func (sioc *ShellyIOClient) Run() error {
 
 	sampleRate := time.Second * 2
 	sampleRateOffline := time.Minute * 10
+	// status is pushed over the WebSocket, so polling only catches anything
+	// that was missed
+	sampleRateWS := time.Minute
 
 	syncConfigTicker := time.NewTicker(sampleRateOffline)
 	sampleTicker := time.NewTicker(sampleRate)
+	defer sampleTicker.Stop()
+
+	resetSampleTicker := func() {
+		switch {
+		case sioc.config.Disabled:
+			sampleTicker.Stop()
+		case sioc.config.Offline:
+			sampleTicker.Reset(sampleRateOffline)
+		case sioc.wsConnected:
+			sampleTicker.Reset(sampleRateWS)
+		default:
+			sampleTicker.Reset(sampleRate)
+		}
+	}
+
+	resetSampleTicker()
 
-	if sioc.config.Offline {
-		sampleTicker = time.NewTicker(sampleRateOffline)
+	startWS := func() {
+		if sioc.wsStop != nil || sioc.config.Disabled ||
+			sioc.config.Gen() != ShellyGen2 || sioc.config.IP == "" {
+			return
+		}
+		sioc.wsStop = make(chan struct{})
+		go sioc.runWS(sioc.config.IP, "siot-"+sioc.config.ID, sioc.wsStop)
 	}
 
-	if sioc.config.Disabled {
-		sampleTicker.Stop()
+	stopWS := func() {
+		if sioc.wsStop != nil {
+			close(sioc.wsStop)
+			sioc.wsStop = nil
+		}
+		sioc.wsConnected = false
+		resetSampleTicker()
 	}
 
+	defer stopWS()
+
 	shellyError := func() {
 		sioc.errorCount++
 		if !sioc.config.Offline && sioc.errorCount > 5 {
@@ -72,7 +107,7 @@ func (sioc *ShellyIOClient) Run() error {
 			if err != nil {
 				log.Println("ShellyIO: error sending node point:", err)
 			}
-			sampleTicker = time.NewTicker(sampleRateOffline)
+			resetSampleTicker()
 		}
 	}
 
@@ -87,7 +122,7 @@ func (sioc *ShellyIOClient) Run() error {
 			if err != nil {
 				log.Println("ShellyIO: error sending node point:", err)
 			}
-			sampleTicker = time.NewTicker(sampleRate)
+			resetSampleTicker()
 		}
 	}
 
@@ -116,7 +151,34 @@ func (sioc *ShellyIOClient) Run() error {
 		}
 	}
 
+	getStatus := func() {
+		points, err := sioc.config.GetStatus()
+		if err != nil {
+			log.Printf("Error getting status for %v: %v\n", sioc.config.Description, err)
+			shellyError()
+			return
+		}
+
+		shellyCommOK()
+		sioc.sendStatus(points)
+	}
+
+	control := func() {
+		if !sioc.config.Control || sioc.config.Disabled {
+			return
+		}
+
+		points, poll := sioc.control()
+		sioc.sendStatus(points)
+
+		// the WebSocket notifies us of the new state
+		if poll && !sioc.wsConnected {
+			getStatus()
+		}
+	}
+
 	syncConfig()
+	startWS()
 
 done:
 	for {
@@ -136,18 +198,20 @@ done:
 					syncConfig()
 				case data.PointTypeDisabled:
 					if p.Value == 0 {
-						sampleTicker = time.NewTicker(sampleRate)
+						startWS()
 					} else {
-						sampleTicker.Stop()
+						stopWS()
 					}
+					resetSampleTicker()
 				case data.PointTypeOffline:
-					if p.Value == 0 {
-						// defice is online
-						// the discovery mechanism may have set the IO back online
-						sampleTicker = time.NewTicker(sampleRate)
-					} else {
-						sampleTicker = time.NewTicker(sampleRateOffline)
-					}
+					// the discovery mechanism may have set the IO back online
+					resetSampleTicker()
+				case data.PointTypeIP:
+					stopWS()
+					startWS()
+				case data.PointTypeSwitchSet, data.PointTypeLightSet,
+					data.PointTypeCoverPosSet:
+					control()
 				}
 			}
 
@@ -157,81 +221,55 @@ done:
 				log.Println("error merging new points:", err)
 			}
 
-		case <-syncConfigTicker.C:
-			syncConfig()
+		case state := <-sioc.wsState:
+			if state.stop != sioc.wsStop {
+				// from a connection that has been stopped
+				continue
+			}
+			sioc.wsConnected = state.connected
+			if state.connected {
+				log.Println("Shelly WebSocket connected:", sioc.config.Desc())
+				shellyCommOK()
+			}
+			resetSampleTicker()
 
-		case <-sampleTicker.C:
+		case pts := <-sioc.newShellyPoints:
 			if sioc.config.Disabled {
-				fmt.Println("Shelly IO is disabled, why am I ticking?")
 				continue
 			}
-			points, err := sioc.config.GetStatus()
-			if err != nil {
-				log.Printf("Error getting status for %v: %v\n", sioc.config.Description, err)
-				shellyError()
-				break
-			}
 
-			if sioc.config.Control {
-				switchCount := min(len(sioc.config.Switch), len(sioc.config.SwitchSet))
-				for i := 0; i < switchCount; i++ {
-					if sioc.config.Switch[i] != sioc.config.SwitchSet[i] {
-						pts, err := sioc.config.SetOnOff("switch", i, sioc.config.SwitchSet[i])
-						if err != nil {
-							log.Printf("Error setting %v: %v\n", sioc.config.Description, err)
-						}
-
-						if len(pts) > 0 {
-							points = append(points, pts...)
-						} else {
-							// get current status as the set did not return status
-							points, err = sioc.config.GetStatus()
-							if err != nil {
-								log.Printf("Error getting status for %v: %v\n", sioc.config.Description, err)
-								shellyError()
-								break
-							}
-						}
-					}
-				}
+			shellyCommOK()
 
-				lightCount := min(len(sioc.config.Light), len(sioc.config.LightSet))
-				for i := 0; i < lightCount; i++ {
-					if sioc.config.Light[i] != sioc.config.LightSet[i] {
-						pts, err := sioc.config.SetOnOff("light", i, sioc.config.LightSet[i])
-						if err != nil {
-							log.Printf("Error setting %v: %v\n", sioc.config.Description, err)
-						}
-
-						if len(pts) > 0 {
-							points = append(points, pts...)
-						} else {
-							// get current status as the set did not return status
-							points, err = sioc.config.GetStatus()
-							if err != nil {
-								log.Printf("Error getting status for %v: %v\n", sioc.config.Description, err)
-								shellyError()
-								break
-							}
-						}
-					}
+			var status, events data.Points
+			for _, p := range pts.Points {
+				if p.Type == data.PointTypeInputEvent {
+					events = append(events, p)
+				} else {
+					status = append(status, p)
 				}
-
 			}
 
-			shellyCommOK()
+			sioc.sendStatus(status)
 
-			newPoints := sioc.points.Merge(points, time.Minute*15)
-			if len(newPoints) > 0 {
-				err := data.MergePoints(sioc.config.ID, newPoints, &sioc.config)
+			// every event is sent, even if it is the same as the last one
+			if len(events) > 0 {
+				err := SendNodePoints(sioc.nc, sioc.config.ID, events, false)
 				if err != nil {
-					log.Println("shelly io: error merging newPoints:", err)
-				}
-				err = SendNodePoints(sioc.nc, sioc.config.ID, newPoints, false)
-				if err != nil {
-					log.Println("shelly io: error sending newPoints:", err)
+					log.Println("shelly io: error sending events:", err)
 				}
 			}
+
+		case <-syncConfigTicker.C:
+			syncConfig()
+
+		case <-sampleTicker.C:
+			if sioc.config.Disabled {
+				fmt.Println("Shelly IO is disabled, why am I ticking?")
+				continue
+			}
+
+			getStatus()
+			control()
 		}
 	}
 
@@ -239,6 +277,70 @@ done:
 	return nil
 }
 
+// sendStatus sends status points that have changed, or have not been sent
+// for 15m
+func (sioc *ShellyIOClient) sendStatus(points data.Points) {
+	newPoints := sioc.points.Merge(points, time.Minute*15)
+	if len(newPoints) == 0 {
+		return
+	}
+
+	err := data.MergePoints(sioc.config.ID, newPoints, &sioc.config)
+	if err != nil {
+		log.Println("shelly io: error merging newPoints:", err)
+	}
+	err = SendNodePoints(sioc.nc, sioc.config.ID, newPoints, false)
+	if err != nil {
+		log.Println("shelly io: error sending newPoints:", err)
+	}
+}
+
+// control sets switches, lights, and covers that do not match the
+// switchSet, lightSet, and coverPosSet points. Any status returned by the device is returned, and poll
+// is true if the device did not return status.
+func (sioc *ShellyIOClient) control() (points data.Points, poll bool) {
+	set := func(comp string, state, stateSet []bool) {
+		count := min(len(state), len(stateSet))
+		for i := 0; i < count; i++ {
+			if state[i] == stateSet[i] {
+				continue
+			}
+
+			pts, err := sioc.config.SetOnOff(comp, i, stateSet[i])
+			if err != nil {
+				log.Printf("Error setting %v: %v\n", sioc.config.Description, err)
+				continue
+			}
+
+			if len(pts) > 0 {
+				points = append(points, pts...)
+			} else {
+				poll = true
+			}
+		}
+	}
+
+	set("switch", sioc.config.Switch, sioc.config.SwitchSet)
+	set("light", sioc.config.Light, sioc.config.LightSet)
+
+	count := min(len(sioc.config.CoverPos), len(sioc.config.CoverPosSet))
+	for i := 0; i < count; i++ {
+		if sioc.config.CoverPos[i] == sioc.config.CoverPosSet[i] {
+			continue
+		}
+
+		err := sioc.config.SetCoverPos(i, sioc.config.CoverPosSet[i])
+		if err != nil {
+			log.Printf("Error setting %v cover: %v\n", sioc.config.Description, err)
+			continue
+		}
+
+		poll = true
+	}
+
+	return points, poll
+}
+
 // Stop sends a signal to the Run function to exit
 func (sioc *ShellyIOClient) Stop(_ error) {
 	close(sioc.stop)
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -22,58 +21,10 @@ type shellyGen2SysConfig struct {
 	} `json:"device"`
 }
 
-// Example response
-// {"id":0, "source":"WS_in", "output":false, "apower":0.0, "voltage":123.3, "current":0.000, "aenergy":{"total":0.000,"by_minute":[0.000,0.000,0.000],"minute_ts":1680536525},"temperature":{"tC":44.4, "tF":112.0}}
-type shellyGen2SwitchStatus struct {
-	ID      int     `json:"id"`
-	Source  string  `json:"source"`
-	Output  bool    `json:"output"`
-	Apower  float32 `json:"apower"`
-	Voltage float32 `json:"voltage"`
-	Current float32 `json:"current"`
-	Aenergy struct {
-		Total    float32   `json:"total"`
-		ByMinute []float32 `json:"by_minute"`
-		MinuteTS int64     `json:"minute_ts"`
-	} `json:"aenergy"`
-	Temperature struct {
-		TC float32 `json:"tC"`
-		TF float32 `json:"tF"`
-	} `json:"temperature"`
-}
-
 type shellyGen2SwitchSetResp struct {
 	WasOn bool `json:"wasOn"`
 }
 
-func (swi *shellyGen2SwitchStatus) toPoints(index int) data.Points {
-	now := time.Now()
-	key := strconv.Itoa(index)
-	return data.Points{
-		{Time: now, Type: data.PointTypeSwitch, Key: key, Value: data.BoolToFloat(swi.Output)},
-		{Time: now, Type: data.PointTypePower, Key: key, Value: float64(swi.Apower)},
-		{Time: now, Type: data.PointTypeVoltage, Key: key, Value: float64(swi.Voltage)},
-		{Time: now, Type: data.PointTypeCurrent, Key: key, Value: float64(swi.Current)},
-		{Time: now, Type: data.PointTypeTemperature, Key: key, Value: float64(swi.Temperature.TC)},
-	}
-}
-
-// Example response
-// {"id":2,"state":true}
-type shellyGen2InputStatus struct {
-	ID    int  `json:"id"`
-	State bool `json:"state"`
-}
-
-func (in *shellyGen2InputStatus) toPoints() data.Points {
-	now := time.Now()
-	return data.Points{
-		{Time: now, Type: data.PointTypeInput,
-			Key:   strconv.Itoa(in.ID),
-			Value: data.BoolToFloat(in.State)},
-	}
-}
-
 type shellyGen1LightStatus struct {
 	Ison       bool `json:"ison"`
 	Brightness int  `json:"brightness"`
@@ -114,6 +65,8 @@ type ShellyIo struct {
 	Light       []bool    `point:"light"`
 	LightSet    []bool    `point:"lightSet"`
 	Input       []bool    `point:"input"`
+	CoverPos    []float64 `point:"coverPos"`
+	CoverPosSet []float64 `point:"coverPosSet"`
 	Offline     bool      `point:"offline"`
 	Control     bool      `point:"control"`
 	Disabled    bool      `point:"disabled"`
@@ -140,65 +93,76 @@ const (
 	ShellyGen2
 )
 
-var shellyGenMap = map[string]ShellyGen{
-	data.PointValueShellyTypeBulbDuo: ShellyGen1,
-	data.PointValueShellyTypeRGBW2:   ShellyGen1,
-	data.PointValueShellyType1PM:     ShellyGen1,
-	data.PointValueShellyTypePlugUS:  ShellyGen2,
-	data.PointValueShellyTypePlugUK:  ShellyGen2,
-	data.PointValueShellyTypePlugIT:  ShellyGen2,
-	data.PointValueShellyTypePlugS:   ShellyGen2,
-	data.PointValueShellyTypeI4:      ShellyGen2,
-	data.PointValueShellyTypePlus1:   ShellyGen2,
-	data.PointValueShellyTypePlus2PM: ShellyGen2,
-}
-
-// Gen 2 metadata
-
-// shellComp is used to describe shelly "components" a device may support
+// shellyComp is used to describe shelly "components" a device may support
 type shellyComp struct {
 	name  string
 	count int
 }
 
-var shellyCompMap = map[string][]shellyComp{
-	data.PointValueShellyTypeBulbDuo: {{"light", 1}},
-	data.PointValueShellyType1PM:     {{"switch", 1}},
-	data.PointValueShellyTypeI4:      {{"input", 4}},
-	data.PointValueShellyTypePlugUS:  {{"switch", 1}},
-	data.PointValueShellyTypePlugUK:  {{"switch", 1}},
-	data.PointValueShellyTypePlugIT:  {{"switch", 1}},
-	data.PointValueShellyTypePlugS:   {{"switch", 1}},
-	data.PointValueShellyTypePlus1:   {{"switch", 1}, {"input", 1}},
-	data.PointValueShellyTypePlus2PM: {{"switch", 2}, {"input", 2}},
+// shellyDevice describes a type of Shelly device. Components are described
+// in shellyCompTypes, so most new devices only need an entry here.
+type shellyDevice struct {
+	gen   ShellyGen
+	comps []shellyComp
+}
+
+var shellyDevices = map[string]shellyDevice{
+	data.PointValueShellyTypeBulbDuo: {ShellyGen1, []shellyComp{{"light", 1}}},
+	data.PointValueShellyTypeRGBW2:   {ShellyGen1, []shellyComp{{"light", 1}}},
+	data.PointValueShellyType1PM:     {ShellyGen1, []shellyComp{{"switch", 1}}},
+	data.PointValueShellyTypePlugUS:  {ShellyGen2, []shellyComp{{"switch", 1}}},
+	data.PointValueShellyTypePlugUK:  {ShellyGen2, []shellyComp{{"switch", 1}}},
+	data.PointValueShellyTypePlugIT:  {ShellyGen2, []shellyComp{{"switch", 1}}},
+	data.PointValueShellyTypePlugS:   {ShellyGen2, []shellyComp{{"switch", 1}}},
+	data.PointValueShellyTypeI4:      {ShellyGen2, []shellyComp{{"input", 4}}},
+	data.PointValueShellyTypePlus1:   {ShellyGen2, []shellyComp{{"switch", 1}, {"input", 1}}},
+	// 2PM devices are either in switch or cover mode
+	data.PointValueShellyTypePlus2PM:    {ShellyGen2, []shellyComp{{"switch", 2}, {"input", 2}, {"cover", 1}}},
+	data.PointValueShellyTypePlusPlugS:  {ShellyGen2, []shellyComp{{"switch", 1}}},
+	data.PointValueShellyTypePlusPlugUS: {ShellyGen2, []shellyComp{{"switch", 1}}},
+	data.PointValueShellyTypePlusHT: {ShellyGen2, []shellyComp{
+		{"temperature", 1}, {"humidity", 1}, {"devicepower", 1}}},
+	// input 2 is a count input, voltmeter 100 is the analog input
+	data.PointValueShellyTypePlusUni: {ShellyGen2, []shellyComp{
+		{"switch", 2}, {"input", 3}, {"voltmeter", 1}}},
+	data.PointValueShellyTypePro2PM: {ShellyGen2, []shellyComp{{"switch", 2}, {"input", 2}, {"cover", 1}}},
+	data.PointValueShellyTypePro4PM: {ShellyGen2, []shellyComp{{"switch", 4}, {"input", 4}}},
+	data.PointValueShellyTypePro3EM: {ShellyGen2, []shellyComp{{"em", 1}, {"emdata", 1}}},
 }
 
-var shellySettableOnOff = map[string]bool{
-	data.PointValueShellyTypeBulbDuo: true,
-	data.PointValueShellyTypeRGBW2:   true,
-	data.PointValueShellyType1PM:     true,
-	data.PointValueShellyTypePlugUS:  true,
-	data.PointValueShellyTypePlugUK:  true,
-	data.PointValueShellyTypePlugIT:  true,
-	data.PointValueShellyTypePlugS:   true,
-	data.PointValueShellyTypePlus1:   true,
-	data.PointValueShellyTypePlus2PM: true,
+// shellyType returns the device type that matches typ, ignoring case, as
+// the case of mDNS host names varies between devices and firmware versions.
+// typ is returned if it is not a known type.
+func shellyType(typ string) string {
+	for t := range shellyDevices {
+		if strings.EqualFold(t, typ) {
+			return t
+		}
+	}
+
+	return typ
 }
 
 // Gen returns generation of Shelly device
 func (sio *ShellyIo) Gen() ShellyGen {
-	gen, ok := shellyGenMap[sio.Type]
+	dev, ok := shellyDevices[sio.Type]
 	if !ok {
 		return ShellyGenUnknown
 	}
 
-	return gen
+	return dev.gen
 }
 
-// IsSettableOnOff returns true if the device can be turned on/off
+// IsSettableOnOff returns true if the device has components that can be
+// controlled
 func (sio *ShellyIo) IsSettableOnOff() bool {
-	settable := shellySettableOnOff[sio.Type]
-	return settable
+	for _, c := range shellyDevices[sio.Type].comps {
+		if shellyCompTypes[c.name].settable {
+			return true
+		}
+	}
+
+	return false
 }
 
 // GetConfig returns the configuration of Shelly Device
@@ -326,106 +290,63 @@ func (sio *ShellyIo) gen1GetLight(count int) (data.Points, error) {
 	return ret, nil
 }
 
-func (sio *ShellyIo) gen2GetSwitch(count int) (data.Points, error) {
-	ret := data.Points{}
-
-	for i := 0; i < count; i++ {
-
-		url := fmt.Sprintf("http://%v/rpc/Switch.GetStatus?id=%v", sio.IP, i)
-
-		res, err := httpClient.Get(url)
-		if err != nil {
-			return data.Points{}, err
-		}
-		defer res.Body.Close()
-		if res.StatusCode != http.StatusOK {
-			return data.Points{}, fmt.Errorf("Shelly GetConfig returned an error code: %v", res.StatusCode)
-		}
-
-		var status shellyGen2SwitchStatus
-
-		err = json.NewDecoder(res.Body).Decode(&status)
-		if err != nil {
-			return data.Points{}, err
-		}
-		pts := status.toPoints(i)
-		ret = append(ret, pts...)
+// gen2GetStatus reads the status of all components
+func (sio *ShellyIo) gen2GetStatus() (data.Points, error) {
+	res, err := httpClient.Get("http://" + sio.IP + "/rpc/Shelly.GetStatus")
+	if err != nil {
+		return data.Points{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return data.Points{}, fmt.Errorf("Shelly GetStatus returned an error code: %v", res.StatusCode)
 	}
 
-	return ret, nil
-}
-
-func (sio *ShellyIo) gen2GetInput(count int) (data.Points, error) {
-	var points data.Points
-	for channel := 0; channel < count; channel++ {
-		res, err := httpClient.Get("http://" + sio.IP + "/rpc/Input.GetStatus?id=" + strconv.Itoa(channel))
-		if err != nil {
-			return data.Points{}, err
-		}
-		defer res.Body.Close()
-		if res.StatusCode != http.StatusOK {
-			return data.Points{}, fmt.Errorf("Shelly GetConfig returned an error code: %v", res.StatusCode)
-		}
-
-		var status shellyGen2InputStatus
-
-		err = json.NewDecoder(res.Body).Decode(&status)
-		if err != nil {
-			return data.Points{}, err
-		}
+	var status map[string]json.RawMessage
 
-		points = append(points, status.toPoints()...)
+	err = json.NewDecoder(res.Body).Decode(&status)
+	if err != nil {
+		return data.Points{}, err
 	}
 
-	return points, nil
+	return shellyGen2StatusPoints(status)
 }
 
 // GetStatus gets the current status of the device
 func (sio *ShellyIo) GetStatus() (data.Points, error) {
-	ret := data.Points{}
-
-	// TODO: this needs clean up some to be data driven instead of all the if statements
-	gen := sio.Gen()
-
-	if cnt := sio.getCompCount("switch"); cnt > 0 {
-		if gen == ShellyGen1 {
-			_ = gen
-			// TODO: need to add gen 1 support for switch status
-		}
-		if gen == ShellyGen2 {
-			pts, err := sio.gen2GetSwitch(cnt)
-			if err != nil {
-				return nil, err
-			}
-			ret = append(ret, pts...)
+	switch sio.Gen() {
+	case ShellyGen1:
+		// TODO: need to add gen 1 support for switch and input status
+		if cnt := sio.getCompCount("light"); cnt > 0 {
+			return sio.gen1GetLight(cnt)
 		}
+		return data.Points{}, nil
+	case ShellyGen2:
+		return sio.gen2GetStatus()
+	default:
+		return data.Points{}, nil
 	}
+}
 
-	if cnt := sio.getCompCount("input"); cnt > 0 {
-		if gen == ShellyGen1 {
-			_ = gen
-			// TODO: need to add gen 1 support for input status
-		}
-		if gen == ShellyGen2 {
-			pts, err := sio.gen2GetInput(cnt)
-			if err != nil {
-				return nil, err
-			}
-			ret = append(ret, pts...)
-		}
+// SetCoverPos moves a cover to a position (0-100%). The cover must be
+// calibrated.
+func (sio *ShellyIo) SetCoverPos(index int, pos float64) error {
+	if sio.Gen() != ShellyGen2 {
+		return fmt.Errorf("Cover not supported on device: %v", sio.Type)
 	}
 
-	if cnt := sio.getCompCount("light"); cnt > 0 {
-		if gen == ShellyGen1 {
-			pts, err := sio.gen1GetLight(cnt)
-			if err != nil {
-				return nil, err
-			}
-			ret = append(ret, pts...)
-		}
+	url := fmt.Sprintf("http://%v/rpc/Cover.GoToPosition?id=%v&pos=%v", sio.IP, index, int(pos))
+	res, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var ret shellyGen2Response
+		_ = json.NewDecoder(res.Body).Decode(&ret)
+		return fmt.Errorf("Shelly Cover.GoToPosition returned an error code: %v %v", res.StatusCode, ret.Message)
 	}
 
-	return ret, nil
+	return nil
 }
 
 type shellyGen2Response struct {
@@ -476,12 +397,7 @@ func (sio *ShellyIo) SetName(name string) error {
 
 // GetCompCount returns the number of components found in the device
 func (sio *ShellyIo) getCompCount(comp string) int {
-	comps, ok := shellyCompMap[sio.Type]
-	if !ok {
-		return 0
-	}
-
-	for _, c := range comps {
+	for _, c := range shellyDevices[sio.Type].comps {
 		if c.name == comp {
 			return c.count
 		}
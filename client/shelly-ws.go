@@ -0,0 +1,238 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Gen2 devices send NotifyStatus and NotifyEvent frames to any WebSocket
+// peer that has sent an RPC request with a src field.
+// https://shelly-api-docs.shelly.cloud/gen2/General/Notifications
+
+const (
+	shellyWSPingPeriod = 30 * time.Second
+	shellyWSReadWait   = 90 * time.Second
+	shellyWSRetry      = 30 * time.Second
+)
+
+// shellyWSState is sent to the Run loop when the WebSocket connects or
+// disconnects. stop identifies the connection.
+type shellyWSState struct {
+	stop      chan struct{}
+	connected bool
+}
+
+// Example frames
+// {"src":"shellyplus1-a8032ab12345","dst":"siot","method":"NotifyStatus","params":{"ts":1680536525.12,"switch:0":{"id":0,"output":true,"source":"button"}}}
+// {"src":"shellyplusi4-a8032ab12345","dst":"siot","method":"NotifyEvent","params":{"ts":1680536525.12,"events":[{"component":"input:0","id":0,"event":"single_push","ts":1680536525.12}]}}
+type shellyGen2Frame struct {
+	ID     int                        `json:"id"`
+	Method string                     `json:"method"`
+	Params map[string]json.RawMessage `json:"params"`
+	Result map[string]json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type shellyGen2Event struct {
+	Component string  `json:"component"`
+	ID        int     `json:"id"`
+	Event     string  `json:"event"`
+	TS        float64 `json:"ts"`
+}
+
+// shellyGen2InputEvents are the input events that are sent as points
+var shellyGen2InputEvents = map[string]bool{
+	"single_push": true,
+	"double_push": true,
+	"triple_push": true,
+	"long_push":   true,
+	"btn_down":    true,
+	"btn_up":      true,
+}
+
+func shellyTime(ts float64) time.Time {
+	if ts <= 0 {
+		return time.Now()
+	}
+	sec := int64(ts)
+	return time.Unix(sec, int64((ts-float64(sec))*1e9))
+}
+
+// shellyGen2EventPoints converts NotifyEvent params to inputEvent points
+func shellyGen2EventPoints(params map[string]json.RawMessage) (data.Points, error) {
+	var events []shellyGen2Event
+	if raw, ok := params["events"]; ok {
+		err := json.Unmarshal(raw, &events)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding events: %w", err)
+		}
+	}
+
+	var ret data.Points
+	for _, e := range events {
+		if !strings.HasPrefix(e.Component, "input:") || !shellyGen2InputEvents[e.Event] {
+			continue
+		}
+		ret = append(ret, data.Point{
+			Time:  shellyTime(e.TS),
+			Type:  data.PointTypeInputEvent,
+			Key:   strconv.Itoa(e.ID),
+			Text:  e.Event,
+			Value: 1,
+		})
+	}
+
+	return ret, nil
+}
+
+// shellyGen2FramePoints returns the status and event points in a frame
+func shellyGen2FramePoints(frame []byte) (status, events data.Points, err error) {
+	var f shellyGen2Frame
+	err = json.Unmarshal(frame, &f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if f.Error != nil {
+		return nil, nil, fmt.Errorf("rpc error %v: %v", f.Error.Code, f.Error.Message)
+	}
+
+	switch f.Method {
+	case "":
+		// response to our Shelly.GetStatus request
+		status, err = shellyGen2StatusPoints(f.Result)
+	case "NotifyStatus", "NotifyFullStatus":
+		status, err = shellyGen2StatusPoints(f.Params)
+	case "NotifyEvent":
+		events, err = shellyGen2EventPoints(f.Params)
+	}
+
+	return status, events, err
+}
+
+// runWS connects to the device RPC WebSocket and forwards status and events
+// to the Run loop until stop is closed. The connection is retried if it
+// fails, and polling is used while it is down.
+func (sioc *ShellyIOClient) runWS(ip, src string, stop chan struct{}) {
+	url := "ws://" + ip + "/rpc"
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+
+	setConnected := func(connected bool) bool {
+		select {
+		case sioc.wsState <- shellyWSState{stop, connected}:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+
+	for {
+		conn, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			log.Printf("Shelly WebSocket %v: %v\n", url, err)
+		} else {
+			if !setConnected(true) {
+				conn.Close()
+				return
+			}
+
+			err = sioc.readWS(conn, src, stop)
+			conn.Close()
+			if err != nil {
+				log.Printf("Shelly WebSocket %v closed: %v\n", url, err)
+			}
+
+			if !setConnected(false) {
+				return
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(shellyWSRetry):
+		}
+	}
+}
+
+func (sioc *ShellyIOClient) readWS(conn *websocket.Conn, src string, stop chan struct{}) error {
+	// a request with a src is required before the device sends notifications
+	err := conn.WriteJSON(map[string]any{
+		"id":     1,
+		"src":    src,
+		"method": "Shelly.GetStatus",
+	})
+	if err != nil {
+		return err
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(shellyWSReadWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(shellyWSReadWait))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ping := time.NewTicker(shellyWSPingPeriod)
+		defer ping.Stop()
+		for {
+			select {
+			case <-stop:
+				// unblock ReadMessage
+				conn.Close()
+				return
+			case <-done:
+				return
+			case <-ping.C:
+				err := conn.WriteControl(websocket.PingMessage, nil,
+					time.Now().Add(10*time.Second))
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(shellyWSReadWait))
+
+		status, events, err := shellyGen2FramePoints(frame)
+		if err != nil {
+			log.Println("Shelly WebSocket: error decoding frame:", err)
+			continue
+		}
+
+		for _, pts := range []data.Points{status, events} {
+			if len(pts) == 0 {
+				continue
+			}
+			select {
+			case sioc.newShellyPoints <- NewPoints{Points: pts}:
+			case <-stop:
+				return nil
+			}
+		}
+	}
+}
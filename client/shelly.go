@@ -163,16 +163,9 @@ done:
 					}
 				}
 
-				for _, comp := range shellyCompMap[typ] {
-					switch comp.name {
-					case "input":
-						addCompPoints(data.PointTypeInput, comp.count)
-					case "switch":
-						addCompPoints(data.PointTypeSwitch, comp.count)
-						addCompPoints(data.PointTypeSwitchSet, comp.count)
-					case "light":
-						addCompPoints(data.PointTypeLight, comp.count)
-						addCompPoints(data.PointTypeLightSet, comp.count)
+				for _, comp := range shellyDevices[typ].comps {
+					for _, pType := range shellyCompTypes[comp.name].points {
+						addCompPoints(pType, comp.count)
 					}
 				}
 
@@ -214,5 +207,5 @@ func shellyScanHost(host string) (string, string) {
 		return "", ""
 	}
 
-	return m[1], m[2]
+	return shellyType(m[1]), m[2]
 }
@@ -1,7 +1,15 @@
 package client
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/simpleiot/simpleiot/data"
 )
 
 func TestShellyScanHost(t *testing.T) {
@@ -10,6 +18,8 @@ func TestShellyScanHost(t *testing.T) {
 		{"ShellyBulbDuo-6646EB.local.", "BulbDuo", "6646EB"},
 		{"shellyrgbw2-D93C00.local.", "rgbw2", "D93C00"},
 		{"shelly1pm-B91754.local.", "1pm", "B91754"},
+		{"shellypro4pm-A8032AB12345.local.", "Pro4PM", "A8032AB12345"},
+		{"shellyplusht-A8032AB12345.local.", "PlusHT", "A8032AB12345"},
 	}
 
 	for _, e := range testData {
@@ -19,3 +29,200 @@ func TestShellyScanHost(t *testing.T) {
 		}
 	}
 }
+
+func TestShellySettableOnOff(t *testing.T) {
+	exp := map[string]bool{
+		data.PointValueShellyTypeBulbDuo:    true,
+		data.PointValueShellyTypeRGBW2:      true,
+		data.PointValueShellyType1PM:        true,
+		data.PointValueShellyTypePlugUS:     true,
+		data.PointValueShellyTypePlugUK:     true,
+		data.PointValueShellyTypePlugIT:     true,
+		data.PointValueShellyTypePlugS:      true,
+		data.PointValueShellyTypeI4:         false,
+		data.PointValueShellyTypePlus1:      true,
+		data.PointValueShellyTypePlus2PM:    true,
+		data.PointValueShellyTypePlusPlugS:  true,
+		data.PointValueShellyTypePlusPlugUS: true,
+		data.PointValueShellyTypePlusHT:     false,
+		data.PointValueShellyTypePlusUni:    true,
+		data.PointValueShellyTypePro2PM:     true,
+		data.PointValueShellyTypePro3EM:     false,
+		data.PointValueShellyTypePro4PM:     true,
+	}
+
+	for typ := range shellyDevices {
+		if _, ok := exp[typ]; !ok {
+			t.Errorf("%v: missing from test", typ)
+		}
+	}
+
+	for typ, settable := range exp {
+		sio := ShellyIo{Type: typ}
+		if sio.IsSettableOnOff() != settable {
+			t.Errorf("%v: expected settable %v", typ, settable)
+		}
+	}
+}
+
+func TestShellyGen2StatusPoints(t *testing.T) {
+	var status map[string]json.RawMessage
+	err := json.Unmarshal([]byte(`{
+		"cover:0":{"id":0,"state":"opening","current_pos":40,"apower":85.2,"pf":0.92,"aenergy":{"total":12.5}},
+		"em:0":{"id":0,"a_current":4.029,"a_voltage":236.1,"a_act_power":951.2,"a_pf":1,"b_current":0.5,"total_act_power":1039.3,"user_calibrated_phase":[],"errors":["phase_sequence"]},
+		"emdata:0":{"id":0,"a_total_act_energy":2345.6,"total_act":7890.1,"total_act_ret":12.3},
+		"humidity:0":{"id":0,"rh":48.2},
+		"devicepower:0":{"id":0,"battery":{"V":5.9,"percent":93}},
+		"wifi":{"sta_ip":"10.0.0.10","status":"got ip"}
+	}`), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pts, err := shellyGen2StatusPoints(status)
+	if err != nil {
+		t.Fatal("Error getting points: ", err)
+	}
+
+	exp := data.Points{
+		{Type: data.PointTypeCoverState, Key: "0", Text: "opening"},
+		{Type: data.PointTypeCoverPos, Key: "0", Value: 40},
+		{Type: data.PointTypePower, Key: "0", Value: 85.2},
+		{Type: data.PointTypePowerFactor, Key: "0", Value: 0.92},
+		{Type: data.PointTypeEnergy, Key: "0", Value: 12.5},
+		{Type: data.PointTypeCurrent, Key: "a", Value: 4.029},
+		{Type: data.PointTypeVoltage, Key: "a", Value: 236.1},
+		{Type: data.PointTypePower, Key: "a", Value: 951.2},
+		{Type: data.PointTypePowerFactor, Key: "a", Value: 1},
+		{Type: data.PointTypeCurrent, Key: "b", Value: 0.5},
+		{Type: data.PointTypePower, Key: "total", Value: 1039.3},
+		{Type: data.PointTypeEnergy, Key: "a", Value: 2345.6},
+		{Type: data.PointTypeEnergy, Key: "total", Value: 7890.1},
+		{Type: data.PointTypeEnergyReturned, Key: "total", Value: 12.3},
+		{Type: data.PointTypeHumidity, Key: "0", Value: 48.2},
+		{Type: data.PointTypeBattery, Key: "0", Value: 93},
+	}
+
+	if len(pts) != len(exp) {
+		t.Errorf("Exp %v points, got %v: %v", len(exp), len(pts), pts)
+	}
+
+	for _, e := range exp {
+		p, ok := pts.Find(e.Type, e.Key)
+		if !ok {
+			t.Errorf("Point %v:%v not found", e.Type, e.Key)
+			continue
+		}
+		if p.Value != e.Value || p.Text != e.Text {
+			t.Errorf("Exp %v, got %v", e, p)
+		}
+	}
+}
+
+func TestShellyGen2FramePoints(t *testing.T) {
+	status, events, err := shellyGen2FramePoints([]byte(`{"src":"shellyplus2pm-a8032ab12345","dst":"siot","method":"NotifyStatus","params":{"ts":1680536525.12,"switch:1":{"id":1,"output":true,"source":"button"},"input:0":{"id":0,"state":null}}}`))
+	if err != nil {
+		t.Fatal("Error decoding status: ", err)
+	}
+
+	// only the fields in the notification are sent
+	exp := data.Points{{Type: data.PointTypeSwitch, Key: "1", Value: 1}}
+	if len(events) != 0 || len(status) != len(exp) {
+		t.Fatalf("Unexpected points, status: %v, events: %v", status, events)
+	}
+
+	for i, p := range exp {
+		if status[i].Type != p.Type || status[i].Key != p.Key || status[i].Value != p.Value {
+			t.Errorf("Exp %v, got %v", p, status[i])
+		}
+	}
+
+	status, events, err = shellyGen2FramePoints([]byte(`{"src":"shellyplusi4-a8032ab12345","dst":"siot","method":"NotifyEvent","params":{"ts":1680536525.12,"events":[{"component":"input:2","id":2,"event":"double_push","ts":1680536525.5},{"component":"sys","event":"scheduled_restart"}]}}`))
+	if err != nil {
+		t.Fatal("Error decoding event: ", err)
+	}
+
+	if len(status) != 0 || len(events) != 1 {
+		t.Fatalf("Unexpected points, status: %v, events: %v", status, events)
+	}
+
+	e := events[0]
+	if e.Type != data.PointTypeInputEvent || e.Key != "2" || e.Text != "double_push" ||
+		e.Time.UnixMilli() != 1680536525500 {
+		t.Error("Unexpected event point: ", e)
+	}
+
+	_, _, err = shellyGen2FramePoints([]byte(`{"id":1,"src":"shellyplus1-a8032ab12345","error":{"code":-103,"message":"Invalid argument"}}`))
+	if err == nil {
+		t.Error("Expected RPC error")
+	}
+}
+
+func TestShellyWS(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rpc" {
+			http.NotFound(w, r)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var req map[string]any
+		err = conn.ReadJSON(&req)
+		if err != nil || req["method"] != "Shelly.GetStatus" || req["src"] != "siot-test" {
+			t.Error("Unexpected request: ", req, err)
+			return
+		}
+
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"id":1,"src":"shellyplusi4-a8032ab12345","dst":"siot-test","result":{"input:0":{"id":0,"state":false}}}`))
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"src":"shellyplusi4-a8032ab12345","dst":"siot-test","method":"NotifyEvent","params":{"ts":1680536525.12,"events":[{"component":"input:0","id":0,"event":"long_push","ts":1680536525.12}]}}`))
+
+		// wait for the client to close
+		_, _, _ = conn.ReadMessage()
+	}))
+	defer srv.Close()
+
+	sioc := &ShellyIOClient{
+		newShellyPoints: make(chan NewPoints),
+		wsState:         make(chan shellyWSState),
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go sioc.runWS(strings.TrimPrefix(srv.URL, "http://"), "siot-test", stop)
+
+	timeout := time.After(5 * time.Second)
+
+	select {
+	case state := <-sioc.wsState:
+		if !state.connected || state.stop != stop {
+			t.Fatal("Unexpected state: ", state)
+		}
+	case <-timeout:
+		t.Fatal("Timeout waiting for connection")
+	}
+
+	for _, exp := range []data.Point{
+		{Type: data.PointTypeInput, Key: "0", Value: 0},
+		{Type: data.PointTypeInputEvent, Key: "0", Text: "long_push", Value: 1},
+	} {
+		select {
+		case pts := <-sioc.newShellyPoints:
+			if len(pts.Points) != 1 {
+				t.Fatal("Unexpected points: ", pts.Points)
+			}
+			p := pts.Points[0]
+			if p.Type != exp.Type || p.Key != exp.Key || p.Text != exp.Text || p.Value != exp.Value {
+				t.Errorf("Exp %v, got %v", exp, p)
+			}
+		case <-timeout:
+			t.Fatal("Timeout waiting for points")
+		}
+	}
+}
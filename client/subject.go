@@ -29,6 +29,28 @@ func SubjectNodeHRPoints(nodeID string) string {
 	return fmt.Sprintf("phr.%v", nodeID)
 }
 
+// SubjectModbusScan constructs a NATS subject for requesting a device scan
+// on a modbus bus node
+func SubjectModbusScan(busID string) string {
+	return fmt.Sprintf("modbus.%v.scan", busID)
+}
+
+// SubjectHistory constructs a NATS subject for sending history queries to
+// a DB client node
+func SubjectHistory(dbID string) string {
+	return fmt.Sprintf("history.%v", dbID)
+}
+
+// SubjectIngest constructs a NATS subject for sending ingest API samples
+// to the ingest node with a token hash (see HashToken). Only part of the
+// hash is used in the subject.
+func SubjectIngest(tokenHash string) string {
+	if len(tokenHash) > 16 {
+		tokenHash = tokenHash[:16]
+	}
+	return fmt.Sprintf("ingest.%v", tokenHash)
+}
+
 // Destination indicates the destination for generated points, including the
 // point type and key
 type Destination struct {
@@ -2,11 +2,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/simpleiot/simpleiot/modbus"
@@ -25,12 +27,47 @@ func main() {
 
 	flagPort := flag.String("port", "", "serial port")
 	flagBaud := flag.String("baud", "9600", "baud rate")
+	flagScan := flag.Bool("scan", false, "scan bus for devices")
+	flagScanBauds := flag.String("scanBauds", "", "comma separated baud rates to scan (default -baud)")
+	flagScanParity := flag.String("scanParity", "N", "comma separated parities to scan (N, E, O)")
+	flagScanStart := flag.Int("scanStart", 1, "first device ID to scan")
+	flagScanEnd := flag.Int("scanEnd", 247, "last device ID to scan")
+	flagScanAddress := flag.Int("scanAddress", 0, "register to read from each device")
+	flagScanInput := flag.Bool("scanInput", false, "read input register instead of holding register")
+	flagScanTimeout := flag.Duration("scanTimeout", 100*time.Millisecond, "time to wait for each device")
 	flag.Parse()
 
 	if *flagPort == "" {
 		usage()
 	}
 
+	if *flagScan {
+		bauds := []int{}
+		scanBauds := *flagScanBauds
+		if scanBauds == "" {
+			scanBauds = *flagBaud
+		}
+		for _, b := range strings.Split(scanBauds, ",") {
+			baud, err := strconv.Atoi(strings.TrimSpace(b))
+			if err != nil {
+				log.Fatal("Baud rate error: ", err)
+			}
+			bauds = append(bauds, baud)
+		}
+
+		config := modbus.ScanConfig{
+			Bauds:    bauds,
+			Parities: strings.Split(*flagScanParity, ","),
+			StartID:  *flagScanStart,
+			EndID:    *flagScanEnd,
+			Address:  *flagScanAddress,
+			Input:    *flagScanInput,
+		}
+
+		scan(*flagPort, config, *flagScanTimeout)
+		return
+	}
+
 	baud, err := strconv.Atoi(*flagBaud)
 
 	if err != nil {
@@ -69,3 +106,42 @@ func main() {
 
 	log.Printf("Reg result: 0x%x\n", regs[0])
 }
+
+func scan(portName string, config modbus.ScanConfig, timeout time.Duration) {
+	open := func(baud int, parity string) (modbus.Transport, error) {
+		mode := &serial.Mode{
+			BaudRate: baud,
+		}
+
+		switch parity {
+		case "N":
+			mode.Parity = serial.NoParity
+		case "E":
+			mode.Parity = serial.EvenParity
+		case "O":
+			mode.Parity = serial.OddParity
+		default:
+			return nil, fmt.Errorf("invalid parity: %v", parity)
+		}
+
+		log.Printf("Scanning baud: %v, parity: %v\n", baud, parity)
+
+		port, err := serial.Open(portName, mode)
+		if err != nil {
+			return nil, err
+		}
+
+		portRR := respreader.NewReadWriteCloser(port, timeout, time.Millisecond*30)
+		return modbus.NewRTU(portRR), nil
+	}
+
+	results, err := modbus.Scan(context.Background(), open, config, 0, func(r modbus.ScanResult) {
+		log.Println("Found device:", r)
+	})
+
+	if err != nil {
+		log.Fatal("Scan error: ", err)
+	}
+
+	log.Printf("Scan complete, found %v devices\n", len(results))
+}
@@ -13,14 +13,17 @@ import (
 	"os/user"
 	"path"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 	"text/template"
 	"time"
 
+	"github.com/nats-io/nats.go"
 	"github.com/oklog/run"
 	"github.com/simpleiot/simpleiot/client"
 	"github.com/simpleiot/simpleiot/install"
+	"github.com/simpleiot/simpleiot/modbus"
 	"github.com/simpleiot/simpleiot/server"
 )
 
@@ -47,6 +50,8 @@ func main() {
 		fmt.Println("  - install (install SIOT and register service)")
 		fmt.Println("  - import (import nodes from YAML file)")
 		fmt.Println("  - export (export nodes to YAML file)")
+		fmt.Println("  - modbus-profile (import/export modbus device profiles)")
+		fmt.Println("  - modbus-scan (scan a modbus bus for devices)")
 	}
 
 	_ = flags.Parse(os.Args[1:])
@@ -81,6 +86,10 @@ func main() {
 		runImport(args[1:])
 	case "export":
 		runExport(args[1:])
+	case "modbus-profile":
+		runModbusProfile(args[1:])
+	case "modbus-scan":
+		runModbusScan(args[1:])
 	default:
 		log.Fatal("Unknown command; options: serve, log, store")
 	}
@@ -535,3 +544,214 @@ func runExport(args []string) {
 	}
 
 }
+
+func runModbusProfile(args []string) {
+	flags := flag.NewFlagSet("modbus-profile", flag.ExitOnError)
+
+	flagList := flags.Bool("list", false, "List bundled profiles")
+	flagExport := flags.Bool("export", false, "Export device on bus to profile (default is import)")
+	flagBusID := flags.String("busID", "", "ID of modbus bus node")
+	flagDeviceID := flags.Int("deviceID", 1, "Modbus device ID")
+	flagProfile := flags.String("profile", "", "Name of bundled profile to import")
+	flagFile := flags.String("file", "", "Profile file to import (.csv, .yaml)")
+	flagFormat := flags.String("format", "yaml", "Export/print format (yaml, csv)")
+	flagNatsServer := flags.String("natsServer", defaultNatsServer, "NATS Server")
+	flagAuthToken := flags.String("token", "", "Auth token")
+
+	if err := flags.Parse(args); err != nil {
+		log.Fatal("error: ", err)
+	}
+
+	writeProfile := func(p client.ModbusProfile) {
+		var out []byte
+		var err error
+		switch *flagFormat {
+		case "yaml":
+			out, err = p.YAML()
+		case "csv":
+			out, err = p.CSV()
+		default:
+			log.Fatal("Unknown format: ", *flagFormat)
+		}
+		if err != nil {
+			log.Fatal("Error encoding profile: ", err)
+		}
+		_, err = os.Stdout.Write(out)
+		if err != nil {
+			log.Fatal("Error writing profile to STDOUT: ", err)
+		}
+	}
+
+	if *flagList {
+		names, err := client.ModbusProfileNames()
+		if err != nil {
+			log.Fatal("Error listing profiles: ", err)
+		}
+		for _, n := range names {
+			p, err := client.BundledModbusProfile(n)
+			if err != nil {
+				log.Fatal("Error loading profile: ", err)
+			}
+			fmt.Printf("%v: %v\n", n, p.Description)
+		}
+		return
+	}
+
+	var profile client.ModbusProfile
+
+	if !*flagExport {
+		var err error
+		switch {
+		case *flagProfile != "":
+			profile, err = client.BundledModbusProfile(*flagProfile)
+		case *flagFile != "":
+			var in []byte
+			in, err = os.ReadFile(*flagFile)
+			if err == nil {
+				profile, err = client.ParseModbusProfile(*flagFile, in)
+			}
+		default:
+			log.Fatal("Error: -profile or -file must be specified for import")
+		}
+		if err != nil {
+			log.Fatal("Error loading profile: ", err)
+		}
+	}
+
+	if *flagBusID == "" {
+		if !*flagExport {
+			// no bus specified, so just print the profile
+			writeProfile(profile)
+			return
+		}
+		log.Fatal("Error: -busID must be specified")
+	}
+
+	nc := connectNats(*flagNatsServer, *flagAuthToken)
+
+	if *flagExport {
+		name := fmt.Sprintf("device-%v", *flagDeviceID)
+		profile, err := client.ExportModbusProfile(nc, *flagBusID, *flagDeviceID, name)
+		if err != nil {
+			log.Fatal("Error exporting profile: ", err)
+		}
+		writeProfile(profile)
+		return
+	}
+
+	err := client.ImportModbusProfile(nc, *flagBusID, *flagDeviceID, profile)
+	if err != nil {
+		log.Fatal("Error importing profile: ", err)
+	}
+
+	log.Printf("Imported %v IOs from profile %v\n", len(profile.IOs), profile.Name)
+}
+
+func runModbusScan(args []string) {
+	flags := flag.NewFlagSet("modbus-scan", flag.ExitOnError)
+
+	flagBusID := flags.String("busID", "", "ID of modbus bus node")
+	flagBauds := flags.String("bauds", "", "comma separated baud rates to scan (default bus baud)")
+	flagParity := flags.String("parity", "N", "comma separated parities to scan (N, E, O)")
+	flagStart := flags.Int("start", 1, "first device ID to scan")
+	flagEnd := flags.Int("end", 247, "last device ID to scan")
+	flagAddress := flags.Int("address", 0, "register to read from each device")
+	flagInput := flags.Bool("input", false, "read input register instead of holding register")
+	flagTimeout := flags.Int("timeout", 100, "time (ms) to wait for each device")
+	flagCreate := flags.Bool("create", false, "create placeholder IO nodes for devices found")
+	flagNatsServer := flags.String("natsServer", defaultNatsServer, "NATS Server")
+	flagAuthToken := flags.String("token", "", "Auth token")
+
+	if err := flags.Parse(args); err != nil {
+		log.Fatal("error: ", err)
+	}
+
+	if *flagBusID == "" {
+		log.Fatal("Error: -busID must be specified")
+	}
+
+	req := client.ModbusScanRequest{
+		ScanConfig: modbus.ScanConfig{
+			Parities: strings.Split(*flagParity, ","),
+			StartID:  *flagStart,
+			EndID:    *flagEnd,
+			Address:  *flagAddress,
+			Input:    *flagInput,
+		},
+		Timeout:     *flagTimeout,
+		CreateNodes: *flagCreate,
+	}
+
+	if *flagBauds != "" {
+		for _, b := range strings.Split(*flagBauds, ",") {
+			baud, err := strconv.Atoi(strings.TrimSpace(b))
+			if err != nil {
+				log.Fatal("Baud rate error: ", err)
+			}
+			req.Bauds = append(req.Bauds, baud)
+		}
+	}
+
+	// allow for every probe timing out, plus some margin
+	timeout := req.MaxDuration() + 10*time.Second
+
+	nc := connectNats(*flagNatsServer, *flagAuthToken)
+
+	log.Println("Scanning, this may take a while ...")
+
+	results, err := client.ModbusScan(nc, *flagBusID, req, timeout)
+	if err != nil {
+		log.Fatal("Error scanning bus: ", err)
+	}
+
+	for _, r := range results {
+		fmt.Println(r)
+	}
+
+	log.Printf("Scan complete, found %v devices\n", len(results))
+}
+
+// connectNats connects to the NATS server, using the SIOT_NATS_SERVER and
+// SIOT_AUTH_TOKEN environment variables if the options are not set.
+func connectNats(natsServer, authToken string) *nats.Conn {
+	// only consider env if command line option is something different
+	// that default
+	if natsServer == defaultNatsServer {
+		natsServerE := os.Getenv("SIOT_NATS_SERVER")
+		if natsServerE != "" {
+			natsServer = natsServerE
+		}
+	}
+
+	if authToken == "" {
+		authTokenE := os.Getenv("SIOT_AUTH_TOKEN")
+		if authTokenE != "" {
+			authToken = authTokenE
+		}
+	}
+
+	opts := client.EdgeOptions{
+		URI:       natsServer,
+		AuthToken: authToken,
+		NoEcho:    true,
+		Disconnected: func() {
+			log.Println("NATS Disconnected")
+		},
+		Reconnected: func() {
+			log.Println("NATS Reconnected")
+		},
+		Closed: func() {
+			log.Fatal("NATS Closed")
+		},
+		Connected: func() {
+			log.Println("NATS Connected")
+		},
+	}
+
+	nc, err := client.EdgeConnect(opts)
+	if err != nil {
+		log.Fatal("Error connecting to NATS server: ", err)
+	}
+
+	return nc
+}
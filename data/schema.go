@@ -82,6 +82,27 @@ const (
 	// User Authentication
 	NodeTypeJWT    = "jwt"
 	PointTypeToken = "token"
+	// The store saves a hash in place of token points, so tokens are never
+	// stored or returned to clients
+	PointTypeTokenHash = "tokenHash"
+
+	// API tokens are long lived tokens for integrations. They are
+	// children of a user node.
+	NodeTypeAPIToken = "apiToken"
+	PointTypeScope   = "scope"
+	PointValueRead   = "read"
+	PointValueWrite  = "write"
+	PointValueAdmin  = "admin"
+	PointTypeExpires = "expires"
+
+	// OIDC nodes configure login with an OpenID Connect provider. They are
+	// children of the root node.
+	NodeTypeOIDC           = "oidc"
+	PointTypeIssuer        = "issuer"
+	PointTypeClientSecret  = "clientSecret"
+	PointTypeRedirectURI   = "redirectURI"
+	PointTypeProvision     = "provision"
+	PointTypeProvisionRole = "provisionRole"
 
 	// modbus nodes
 	// in modbus land, terminology is a big backwards, client is master,
@@ -99,6 +120,24 @@ const (
 	PointTypeProtocol = "protocol"
 	PointValueRTU     = "RTU"
 	PointValueTCP     = "TCP"
+	// PointValueModbusASCII is the Modbus ASCII serial protocol. Not to be
+	// confused with the ascii data format.
+	PointValueModbusASCII = "ASCII"
+
+	// PointTypeGatewayPort is the TCP port a serial client bus listens
+	// on to forward Modbus TCP requests to devices on the bus
+	PointTypeGatewayPort = "gatewayPort"
+	// PointTypeGatewayTimeout is the time (ms) to wait for a device to
+	// respond to a forwarded request
+	PointTypeGatewayTimeout = "gatewayTimeout"
+	// PointTypeGatewayUnitTimeout overrides the gateway timeout for the
+	// unit ID in the point key
+	PointTypeGatewayUnitTimeout = "gatewayUnitTimeout"
+
+	// PointTypeReadMaxGap is the max number of unused registers (or bits)
+	// between IOs that are coalesced into one read. Negative disables
+	// block reads.
+	PointTypeReadMaxGap = "readMaxGap"
 
 	NodeTypeModbusIO = "modbusIo"
 
@@ -115,6 +154,22 @@ const (
 	PointValueUINT32    = "uint32"
 	PointValueINT32     = "int32"
 	PointValueFLOAT32   = "float32"
+	PointValueUINT64    = "uint64"
+	PointValueINT64     = "int64"
+	PointValueFLOAT64   = "float64"
+	// PointValueASCII is a string that spans regCount registers
+	PointValueASCII = "ascii"
+	// PointValueBit is a single bit (bitIndex) in a register
+	PointValueBit = "bit"
+
+	PointTypeRegCount = "regCount"
+	PointTypeBitIndex = "bitIndex"
+
+	PointTypeByteOrder = "byteOrder"
+	PointValueABCD     = "ABCD"
+	PointValueCDAB     = "CDAB"
+	PointValueBADC     = "BADC"
+	PointValueDCBA     = "DCBA"
 
 	NodeTypeOneWire   = "oneWire"
 	NodeTypeOneWireIO = "oneWireIO"
@@ -232,6 +287,29 @@ const (
 	PointTypeMsgsRecvdDbReset    = "msgsRecvdDbReset"
 	PointTypeMsgsRecvdOther      = "msgsRecvdOther"
 	PointTypeMsgsRecvdOtherReset = "msgsRecvdOtherReset"
+	PointTypeMsgsSent            = "msgsSent"
+	PointTypeMsgsSentReset       = "msgsSentReset"
+	PointTypeKcdScale            = "kcdScale"
+
+	// CAN bus frame recording and replay
+	PointTypeRecord        = "record"
+	PointTypeRecordFile    = "recordFile"
+	PointTypeRecordMaxSize = "recordMaxSize"
+	PointTypeRecordFiles   = "recordFiles"
+	PointTypeReplay        = "replay"
+	PointTypeReplayFile    = "replayFile"
+	PointTypeReplaySpeed   = "replaySpeed"
+
+	// J1939 points are sent by CAN bus nodes with J1939 enabled
+	PointTypeJ1939 = "j1939"
+	PointTypeDtc   = "dtc"
+	PointTypeLamp  = "lamp"
+	PointTypeVIN   = "vin"
+
+	// CAN tx messages are children of CAN bus nodes
+	NodeTypeCanTx     = "canTx"
+	PointTypeMessage  = "message"
+	PointTypeOnChange = "onChange"
 
 	NodeTypeSignalGenerator = "signalGenerator"
 
@@ -305,12 +383,33 @@ const (
 	PointKeyUsed        = "used"
 	PointKeyFree        = "free"
 
+	NodeTypeParticle         = "particle"
+	NodeTypeParticleFunction = "particleFunction"
+	NodeTypeParticleVariable = "particleVariable"
+
+	PointTypeAPIURL   = "apiURL"
+	PointTypeFunction = "function"
+	PointTypeArgument = "argument"
+	PointTypeVariable = "variable"
+
+	// M-Bus (EN 13757) meter reading
+	NodeTypeMBus      = "mbus"
+	NodeTypeMBusMeter = "mbusMeter"
+
+	// PointTypeScan triggers a scan of the bus for devices and is cleared
+	// when the scan completes
+	PointTypeScan         = "scan"
+	PointTypeManufacturer = "manufacturer"
+	PointTypeMedium       = "medium"
+	PointTypeVersion      = "version"
+
 	NodeTypeShelly   = "shelly"
 	NodeTypeShellyIo = "shellyIo"
 
 	PointTypeSwitch      = "switch"
 	PointTypeSwitchSet   = "switchSet"
 	PointTypeInput       = "input"
+	PointTypeInputEvent  = "inputEvent"
 	PointTypeLight       = "light"
 	PointTypeLightSet    = "lightSet"
 	PointTypeDeviceID    = "deviceID"
@@ -324,17 +423,33 @@ const (
 	PointTypeLightTemp   = "lightTemp"
 	PointTypeTransition  = "transition"
 	PointTypeOffline     = "offline"
-
-	PointValueShellyTypeBulbDuo = "BulbDuo"
-	PointValueShellyTypeRGBW2   = "rgbw2"
-	PointValueShellyType1PM     = "1pm"
-	PointValueShellyTypePlugUS  = "PlugUS"
-	PointValueShellyTypePlugUK  = "PlugUK"
-	PointValueShellyTypePlugIT  = "PlugIT"
-	PointValueShellyTypePlugS   = "PlugS"
-	PointValueShellyTypeI4      = "PlusI4"
-	PointValueShellyTypePlus1   = "Plus1"
-	PointValueShellyTypePlus2PM = "Plus2PM"
+	// energy is in Wh
+	PointTypeEnergy         = "energy"
+	PointTypeEnergyReturned = "energyReturned"
+	PointTypePowerFactor    = "powerFactor"
+	PointTypeHumidity       = "humidity"
+	PointTypeBattery        = "battery"
+	PointTypeCoverState     = "coverState"
+	PointTypeCoverPos       = "coverPos"
+	PointTypeCoverPosSet    = "coverPosSet"
+
+	PointValueShellyTypeBulbDuo    = "BulbDuo"
+	PointValueShellyTypeRGBW2      = "rgbw2"
+	PointValueShellyType1PM        = "1pm"
+	PointValueShellyTypePlugUS     = "PlugUS"
+	PointValueShellyTypePlugUK     = "PlugUK"
+	PointValueShellyTypePlugIT     = "PlugIT"
+	PointValueShellyTypePlugS      = "PlugS"
+	PointValueShellyTypeI4         = "PlusI4"
+	PointValueShellyTypePlus1      = "Plus1"
+	PointValueShellyTypePlus2PM    = "Plus2PM"
+	PointValueShellyTypePlusPlugS  = "PlusPlugS"
+	PointValueShellyTypePlusPlugUS = "PlusPlugUS"
+	PointValueShellyTypePlusHT     = "PlusHT"
+	PointValueShellyTypePlusUni    = "PlusUni"
+	PointValueShellyTypePro2PM     = "Pro2PM"
+	PointValueShellyTypePro3EM     = "Pro3EM"
+	PointValueShellyTypePro4PM     = "Pro4PM"
 
 	PointTypeTimeSync  = "timeSync"
 	PointTypeConnected = "connected"
@@ -343,6 +458,34 @@ const (
 	NodeTypeNetworkManagerDevice = "networkManagerDevice"
 	NodeTypeNetworkManagerConn   = "networkManagerConn"
 
+	NodeTypeMQTT         = "mqtt"
+	NodeTypeMQTTSub      = "mqttSub"
+	NodeTypeMQTTPub      = "mqttPub"
+	PointTypeClientID    = "clientID"
+	PointTypeUsername    = "username"
+	PointTypeTLSCACert   = "tlsCACert"
+	PointTypeTLSCert     = "tlsCert"
+	PointTypeTLSKey      = "tlsKey"
+	PointTypeTLSInsecure = "tlsInsecure"
+	PointTypeTopic       = "topic"
+	PointTypeQOS         = "qos"
+	PointTypeJSONPath    = "jsonPath"
+	PointTypeRetain      = "retain"
+	PointTypeFormat      = "format"
+	PointValueRaw        = "raw"
+	PointValueJSON       = "json"
+
+	NodeTypeMQTTHomeAssistant  = "mqttHomeAssistant"
+	PointTypeHADiscoveryPrefix = "haDiscoveryPrefix"
+	PointTypeComponent         = "component"
+	PointTypeDeviceClass       = "deviceClass"
+	PointValueSensor           = "sensor"
+	PointValueSwitch           = "switch"
+
+	NodeTypeIngest        = "ingest"
+	PointTypeNodeTemplate = "nodeTemplate"
+	PointTypeNodeRule     = "nodeRule"
+
 	NodeTypeNTP             = "ntp"
 	PointTypeServer         = "server"
 	PointTypeFallbackServer = "fallbackServer"
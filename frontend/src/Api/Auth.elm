@@ -1,8 +1,11 @@
 module Api.Auth exposing
-    ( User
+    ( Provider
+    , User
     , decode
     , encode
     , login
+    , oidcLoginUrl
+    , oidcProviders
     )
 
 import Api.Data exposing (Data)
@@ -49,3 +52,31 @@ login options =
         , url = Url.Builder.absolute [ "v1", "auth" ] []
         , expect = Api.Data.expectJson options.onResponse decode
         }
+
+
+{-| Provider is an OIDC provider users can log in with
+-}
+type alias Provider =
+    { id : String
+    , description : String
+    }
+
+
+decodeProvider : Decode.Decoder Provider
+decodeProvider =
+    Decode.succeed Provider
+        |> required "id" Decode.string
+        |> required "description" Decode.string
+
+
+oidcProviders : { onResponse : Data (List Provider) -> msg } -> Cmd msg
+oidcProviders options =
+    Http.get
+        { url = Url.Builder.absolute [ "v1", "auth", "oidc" ] []
+        , expect = Api.Data.expectJson options.onResponse (Decode.list decodeProvider)
+        }
+
+
+oidcLoginUrl : Provider -> String
+oidcLoginUrl provider =
+    Url.Builder.absolute [ "v1", "auth", "oidc", provider.id, "login" ] []
@@ -11,17 +11,27 @@ module Api.Node exposing
     , move
     , notify
     , postPoints
+    , typeAPIToken
+    , typeOIDC
     , typeAction
     , typeActionInactive
     , typeCanBus
+    , typeCanTx
     , typeCondition
     , typeDb
     , typeDevice
     , typeFile
     , typeGroup
+    , typeMBus
+    , typeMBusMeter
     , typeMetrics
     , typeModbus
     , typeModbusIO
+    , typeIngest
+    , typeMQTT
+    , typeMQTTHomeAssistant
+    , typeMQTTPub
+    , typeMQTTSub
     , typeMsgService
     , typeNTP
     , typeNetworkManager
@@ -29,6 +39,8 @@ module Api.Node exposing
     , typeNetworkManagerDevice
     , typeOneWire
     , typeParticle
+    , typeParticleFunction
+    , typeParticleVariable
     , typeRule
     , typeSerialDev
     , typeShelly
@@ -100,6 +112,16 @@ typeParticle =
     "particle"
 
 
+typeParticleFunction : String
+typeParticleFunction =
+    "particleFunction"
+
+
+typeParticleVariable : String
+typeParticleVariable =
+    "particleVariable"
+
+
 typeShelly : String
 typeShelly =
     "shelly"
@@ -120,6 +142,16 @@ typeModbusIO =
     "modbusIo"
 
 
+typeMBus : String
+typeMBus =
+    "mbus"
+
+
+typeMBusMeter : String
+typeMBusMeter =
+    "mbusMeter"
+
+
 typeOneWire : String
 typeOneWire =
     "oneWire"
@@ -135,6 +167,11 @@ typeCanBus =
     "canBus"
 
 
+typeCanTx : String
+typeCanTx =
+    "canTx"
+
+
 typeVariable : String
 typeVariable =
     "variable"
@@ -180,6 +217,41 @@ typeNTP =
     "ntp"
 
 
+typeMQTT : String
+typeMQTT =
+    "mqtt"
+
+
+typeMQTTSub : String
+typeMQTTSub =
+    "mqttSub"
+
+
+typeMQTTPub : String
+typeMQTTPub =
+    "mqttPub"
+
+
+typeMQTTHomeAssistant : String
+typeMQTTHomeAssistant =
+    "mqttHomeAssistant"
+
+
+typeIngest : String
+typeIngest =
+    "ingest"
+
+
+typeAPIToken : String
+typeAPIToken =
+    "apiToken"
+
+
+typeOIDC : String
+typeOIDC =
+    "oidc"
+
+
 typeUpdate : String
 typeUpdate =
     "update"
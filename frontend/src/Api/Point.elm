@@ -29,19 +29,28 @@ module Api.Point exposing
     , typeAction
     , typeActive
     , typeAddress
+    , typeAPIURL
+    , typeArgument
     , typeAuthToken
     , typeAutoDownload
     , typeAutoReboot
     , typeBatchPeriod
     , typeBaud
     , typeBinary
+    , typeBitIndex
     , typeBitRate
     , typeBucket
+    , typeByteOrder
     , typeChannel
+    , typeClientID
+    , typeClientSecret
     , typeClientServer
+    , typeComponent
     , typeConditionType
     , typeConnected
     , typeControlled
+    , typeCoverPos
+    , typeCoverPosSet
     , typeData
     , typeDataFormat
     , typeDate
@@ -49,12 +58,14 @@ module Api.Point exposing
     , typeDescription
     , typeDestination
     , typeDevice
+    , typeDeviceClass
     , typeDeviceID
     , typeDirectory
     , typeDisabled
     , typeDiscardDownload
     , typeDownload
     , typeDownloadOS
+    , typeDtc
     , typeEmail
     , typeEnd
     , typeError
@@ -66,11 +77,17 @@ module Api.Point exposing
     , typeErrorCountHR
     , typeErrorCountReset
     , typeErrorCountResetHR
+    , typeExpires
     , typeFallbackServer
     , typeFilePath
     , typeFirstName
+    , typeFormat
     , typeFrequency
     , typeFrom
+    , typeFunction
+    , typeGatewayPort
+    , typeGatewayTimeout
+    , typeHADiscoveryPrefix
     , typeHRDest
     , typeHash
     , typeHrRx
@@ -79,12 +96,20 @@ module Api.Point exposing
     , typeIP
     , typeIndex
     , typeInitialValue
+    , typeIssuer
+    , typeJ1939
+    , typeJSONPath
+    , typeKcdScale
+    , typeLamp
     , typeLastName
     , typeLightSet
     , typeLog
+    , typeManufacturer
     , typeMaxIncrement
     , typeMaxMessageLength
     , typeMaxValue
+    , typeMedium
+    , typeMessage
     , typeMinActive
     , typeMinIncrement
     , typeMinValue
@@ -94,8 +119,14 @@ module Api.Point exposing
     , typeMsgsRecvdDbReset
     , typeMsgsRecvdOther
     , typeMsgsRecvdOtherReset
+    , typeMsgsSent
+    , typeMsgsSentReset
     , typeName
     , typeNodeID
+    , typeNodeRule
+    , typeNodeTemplate
+    , typeNodeType
+    , typeOnChange
     , typeOSDownloaded
     , typeOSUpdate
     , typeOffline
@@ -112,17 +143,33 @@ module Api.Point exposing
     , typePrefix
     , typeProgress
     , typeProtocol
+    , typeProvision
+    , typeProvisionRole
+    , typeQOS
     , typeRate
     , typeRateHR
+    , typeReadMaxGap
     , typeReadOnly
     , typeReboot
+    , typeRecord
+    , typeRecordFile
+    , typeRecordFiles
+    , typeRecordMaxSize
+    , typeRedirectURI
     , typeRefresh
+    , typeRegCount
+    , typeReplay
+    , typeReplayFile
+    , typeReplaySpeed
+    , typeRetain
     , typeRoundTo
     , typeRx
     , typeRxReset
+    , typeScope
     , typeSID
     , typeSampleRate
     , typeScale
+    , typeScan
     , typeServer
     , typeService
     , typeSignalType
@@ -136,33 +183,55 @@ module Api.Point exposing
     , typeSysState
     , typeTag
     , typeTagPointType
+    , typeTLSCACert
+    , typeTLSCert
+    , typeTLSInsecure
+    , typeTLSKey
+    , typeToken
+    , typeTokenHash
     , typeTombstone
+    , typeTopic
     , typeTx
     , typeTxReset
     , typeType
     , typeURI
     , typeUnits
+    , typeUsername
     , typeValue
     , typeValueSet
     , typeValueText
     , typeValueType
+    , typeVariable
     , typeVariableType
+    , typeVersion
     , typeVersionApp
     , typeVersionHW
     , typeVersionOS
+    , typeVIN
     ,  typeWeekday
        --  , keyNodeID
 
     , updatePoints
+    , valueABCD
+    , valueAdmin
     , valueApp
+    , valueASCII
+    , valueBADC
+    , valueBit
+    , valueCDAB
     , valueClient
     , valueContains
+    , valueDCBA
     , valueEqual
     , valueFLOAT32
+    , valueFLOAT64
     , valueGreaterThan
     , valueINT16
     , valueINT32
+    , valueINT64
+    , valueJSON
     , valueLessThan
+    , valueModbusASCII
     , valueModbusCoil
     , valueModbusDiscreteInput
     , valueModbusHoldingRegister
@@ -174,13 +243,17 @@ module Api.Point exposing
     , valuePlayAudio
     , valuePointValue
     , valueProcess
+    , valueRaw
+    , valueRead
     , valueRTU
     , valueRandomWalk
     , valueSchedule
+    , valueSensor
     , valueServer
     , valueSetValue
     , valueSine
     , valueSquare
+    , valueSwitch
     , valueSystem
     , valueTCP
     , valueText
@@ -188,6 +261,9 @@ module Api.Point exposing
     , valueTwilio
     , valueUINT16
     , valueUINT32
+    , valueUINT64
+    , valueUser
+    , valueWrite
     )
 
 import Iso8601
@@ -460,6 +536,86 @@ typeMsgsRecvdOther =
     "msgsRecvdOther"
 
 
+typeMsgsSent : String
+typeMsgsSent =
+    "msgsSent"
+
+
+typeMsgsSentReset : String
+typeMsgsSentReset =
+    "msgsSentReset"
+
+
+typeKcdScale : String
+typeKcdScale =
+    "kcdScale"
+
+
+typeJ1939 : String
+typeJ1939 =
+    "j1939"
+
+
+typeDtc : String
+typeDtc =
+    "dtc"
+
+
+typeLamp : String
+typeLamp =
+    "lamp"
+
+
+typeVIN : String
+typeVIN =
+    "vin"
+
+
+typeRecord : String
+typeRecord =
+    "record"
+
+
+typeRecordFile : String
+typeRecordFile =
+    "recordFile"
+
+
+typeRecordMaxSize : String
+typeRecordMaxSize =
+    "recordMaxSize"
+
+
+typeRecordFiles : String
+typeRecordFiles =
+    "recordFiles"
+
+
+typeReplay : String
+typeReplay =
+    "replay"
+
+
+typeReplayFile : String
+typeReplayFile =
+    "replayFile"
+
+
+typeReplaySpeed : String
+typeReplaySpeed =
+    "replaySpeed"
+
+
+typeMessage : String
+typeMessage =
+    "message"
+
+
+typeOnChange : String
+typeOnChange =
+    "onChange"
+
+
 typeMsgsRecvdDbReset : String
 typeMsgsRecvdDbReset =
     "msgsRecvdDbReset"
@@ -485,6 +641,11 @@ valueTCP =
     "TCP"
 
 
+valueModbusASCII : String
+valueModbusASCII =
+    "ASCII"
+
+
 typeModbusIOType : String
 typeModbusIOType =
     "modbusIoType"
@@ -525,6 +686,21 @@ typePollPeriod =
     "pollPeriod"
 
 
+typeReadMaxGap : String
+typeReadMaxGap =
+    "readMaxGap"
+
+
+typeGatewayPort : String
+typeGatewayPort =
+    "gatewayPort"
+
+
+typeGatewayTimeout : String
+typeGatewayTimeout =
+    "gatewayTimeout"
+
+
 valueUINT16 : String
 valueUINT16 =
     "uint16"
@@ -550,6 +726,66 @@ valueFLOAT32 =
     "float32"
 
 
+valueUINT64 : String
+valueUINT64 =
+    "uint64"
+
+
+valueINT64 : String
+valueINT64 =
+    "int64"
+
+
+valueFLOAT64 : String
+valueFLOAT64 =
+    "float64"
+
+
+valueASCII : String
+valueASCII =
+    "ascii"
+
+
+valueBit : String
+valueBit =
+    "bit"
+
+
+typeRegCount : String
+typeRegCount =
+    "regCount"
+
+
+typeBitIndex : String
+typeBitIndex =
+    "bitIndex"
+
+
+typeByteOrder : String
+typeByteOrder =
+    "byteOrder"
+
+
+valueABCD : String
+valueABCD =
+    "ABCD"
+
+
+valueCDAB : String
+valueCDAB =
+    "CDAB"
+
+
+valueBADC : String
+valueBADC =
+    "BADC"
+
+
+valueDCBA : String
+valueDCBA =
+    "DCBA"
+
+
 typeClientServer : String
 typeClientServer =
     "clientServer"
@@ -570,6 +806,156 @@ typeURI =
     "uri"
 
 
+typeClientID : String
+typeClientID =
+    "clientID"
+
+
+typeUsername : String
+typeUsername =
+    "username"
+
+
+typeTLSCACert : String
+typeTLSCACert =
+    "tlsCACert"
+
+
+typeTLSCert : String
+typeTLSCert =
+    "tlsCert"
+
+
+typeTLSKey : String
+typeTLSKey =
+    "tlsKey"
+
+
+typeTLSInsecure : String
+typeTLSInsecure =
+    "tlsInsecure"
+
+
+typeTopic : String
+typeTopic =
+    "topic"
+
+
+typeQOS : String
+typeQOS =
+    "qos"
+
+
+typeJSONPath : String
+typeJSONPath =
+    "jsonPath"
+
+
+typeRetain : String
+typeRetain =
+    "retain"
+
+
+typeFormat : String
+typeFormat =
+    "format"
+
+
+typeNodeTemplate : String
+typeNodeTemplate =
+    "nodeTemplate"
+
+
+typeNodeRule : String
+typeNodeRule =
+    "nodeRule"
+
+
+typeToken : String
+typeToken =
+    "token"
+
+
+typeTokenHash : String
+typeTokenHash =
+    "tokenHash"
+
+
+typeScope : String
+typeScope =
+    "scope"
+
+
+typeExpires : String
+typeExpires =
+    "expires"
+
+
+typeIssuer : String
+typeIssuer =
+    "issuer"
+
+
+typeClientSecret : String
+typeClientSecret =
+    "clientSecret"
+
+
+typeRedirectURI : String
+typeRedirectURI =
+    "redirectURI"
+
+
+typeProvision : String
+typeProvision =
+    "provision"
+
+
+typeProvisionRole : String
+typeProvisionRole =
+    "provisionRole"
+
+
+valueRead : String
+valueRead =
+    "read"
+
+
+valueWrite : String
+valueWrite =
+    "write"
+
+
+valueAdmin : String
+valueAdmin =
+    "admin"
+
+
+valueUser : String
+valueUser =
+    "user"
+
+
+typeNodeType : String
+typeNodeType =
+    "nodeType"
+
+
+typeHADiscoveryPrefix : String
+typeHADiscoveryPrefix =
+    "haDiscoveryPrefix"
+
+
+typeComponent : String
+typeComponent =
+    "component"
+
+
+typeDeviceClass : String
+typeDeviceClass =
+    "deviceClass"
+
+
 typePrefix : String
 typePrefix =
     "prefix"
@@ -700,6 +1086,46 @@ typeAuthToken =
     "authToken"
 
 
+typeAPIURL : String
+typeAPIURL =
+    "apiURL"
+
+
+typeFunction : String
+typeFunction =
+    "function"
+
+
+typeArgument : String
+typeArgument =
+    "argument"
+
+
+typeVariable : String
+typeVariable =
+    "variable"
+
+
+typeScan : String
+typeScan =
+    "scan"
+
+
+typeManufacturer : String
+typeManufacturer =
+    "manufacturer"
+
+
+typeMedium : String
+typeMedium =
+    "medium"
+
+
+typeVersion : String
+typeVersion =
+    "version"
+
+
 typeFrom : String
 typeFrom =
     "from"
@@ -915,6 +1341,26 @@ valueSystem =
     "system"
 
 
+valueRaw : String
+valueRaw =
+    "raw"
+
+
+valueJSON : String
+valueJSON =
+    "json"
+
+
+valueSensor : String
+valueSensor =
+    "sensor"
+
+
+valueSwitch : String
+valueSwitch =
+    "switch"
+
+
 switch : String
 switch =
     "switch"
@@ -930,6 +1376,16 @@ light =
     "light"
 
 
+typeCoverPos : String
+typeCoverPos =
+    "coverPos"
+
+
+typeCoverPosSet : String
+typeCoverPosSet =
+    "coverPosSet"
+
+
 typeServer : String
 typeServer =
     "server"
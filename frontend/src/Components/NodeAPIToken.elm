@@ -0,0 +1,85 @@
+module Components.NodeAPIToken exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisabled ""
+
+        scope =
+            Point.getText o.node.points Point.typeScope ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.key
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <|
+                "("
+                    ++ (if scope == "" then
+                            Point.valueRead
+
+                        else
+                            scope
+                       )
+                    ++ ")"
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            150
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        optionInput =
+                            NodeInputs.nodeOptionInput opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+
+                        -- tokens are hashed when they are saved, so the
+                        -- token can only be replaced
+                        tokenHint =
+                            if Point.getText o.node.points Point.typeTokenHash "" /= "" then
+                                "set, enter a new token to replace it"
+
+                            else
+                                "random string without dots"
+                    in
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeToken "Token" tokenHint
+                    , optionInput Point.typeScope
+                        "Scope"
+                        [ ( Point.valueRead, "Read only" )
+                        , ( Point.valueWrite, "Write points" )
+                        , ( Point.valueAdmin, "Admin" )
+                        ]
+                    , textInput Point.typeNodeID "Node ID" "all user nodes"
+                    , textInput Point.typeExpires "Expires" "2006-01-02 or RFC3339, never if blank"
+                    , checkboxInput Point.typeDisabled "Disabled"
+                    ]
+
+                else
+                    []
+               )
@@ -1,6 +1,6 @@
 module Components.NodeCanBus exposing (view)
 
-import Api.Point as Point
+import Api.Point as Point exposing (Point)
 import Components.NodeOptions exposing (NodeOptions, oToInputO)
 import Element exposing (..)
 import Element.Border as Border
@@ -16,6 +16,9 @@ view o =
     let
         disabled =
             Point.getBool o.node.points Point.typeDisabled ""
+
+        j1939 =
+            Point.getBool o.node.points Point.typeJ1939 ""
     in
     column
         [ width fill
@@ -46,6 +49,15 @@ view o =
 
                         counterWithReset =
                             NodeInputs.nodeCounterWithReset opts "0"
+
+                        numberInput =
+                            NodeInputs.nodeNumberInput opts "0"
+
+                        record =
+                            Point.getBool o.node.points Point.typeRecord ""
+
+                        replay =
+                            Point.getBool o.node.points Point.typeReplay ""
                     in
                     [ textInput Point.typeDescription "Description" ""
                     , textInput Point.typeDevice "Device" "can0"
@@ -62,6 +74,17 @@ view o =
                                     ++ String.fromFloat (Round.roundNum 2 (Point.getValue o.node.points Point.typeSignalsInDb "0"))
                     , counterWithReset Point.typeMsgsRecvdDb Point.typeMsgsRecvdDbReset "Db msgs recieved"
                     , counterWithReset Point.typeMsgsRecvdOther Point.typeMsgsRecvdOtherReset "Other msgs recvd"
+                    , counterWithReset Point.typeMsgsSent Point.typeMsgsSentReset "Msgs sent"
+                    , checkboxInput Point.typeKcdScale "Scale KCD signals"
+                    , checkboxInput Point.typeJ1939 "J1939"
+                    , viewIf j1939 <| viewJ1939 o.node.points
+                    , checkboxInput Point.typeRecord "Record frames"
+                    , viewIf record <| textInput Point.typeRecordFile "Record file" "can0.log"
+                    , viewIf record <| numberInput Point.typeRecordMaxSize "Max file size (MB)"
+                    , viewIf record <| numberInput Point.typeRecordFiles "Files to keep"
+                    , checkboxInput Point.typeReplay "Replay frames"
+                    , viewIf replay <| textInput Point.typeReplayFile "Replay file" "can0.log"
+                    , viewIf replay <| numberInput Point.typeReplaySpeed "Replay speed"
                     , checkboxInput Point.typeDisabled "Disabled"
                     , NodeInputs.nodeKeyValueInput opts Point.typeTag "Tags" "Add Tag"
                     ]
@@ -69,3 +92,38 @@ view o =
                 else
                     []
                )
+
+
+viewJ1939 : List Point -> Element msg
+viewJ1939 points =
+    let
+        vins =
+            Point.getAll points Point.typeVIN |> Point.filterTombstone
+
+        dtcs =
+            Point.getAll points Point.typeDtc |> Point.filterTombstone
+
+        dtcText p =
+            case String.split "." p.key of
+                [ sa, spn, fmi ] ->
+                    "SA "
+                        ++ sa
+                        ++ ": SPN "
+                        ++ spn
+                        ++ " FMI "
+                        ++ fmi
+                        ++ " (OC "
+                        ++ String.fromFloat p.value
+                        ++ ")"
+
+                _ ->
+                    p.key
+    in
+    column [ spacing 6 ] <|
+        List.map (\p -> text <| "VIN (SA " ++ p.key ++ "): " ++ p.text) vins
+            ++ (if List.isEmpty dtcs then
+                    [ text "No active DTCs" ]
+
+                else
+                    text "Active DTCs:" :: List.map (dtcText >> text) dtcs
+               )
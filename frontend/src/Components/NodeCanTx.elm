@@ -0,0 +1,69 @@
+module Components.NodeCanTx exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style exposing (colors)
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisabled ""
+
+        values =
+            List.filter (\p -> p.typ == Point.typeValue && p.tombstone == 0) o.node.points
+                |> List.sortBy .key
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.send
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <|
+                Point.getText o.node.points Point.typeMessage ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            180
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        numberInput =
+                            NodeInputs.nodeNumberInput opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+                    in
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeMessage "Message" "name or ID (0x123)"
+                    , numberInput Point.typePeriod "Period (ms)"
+                    , checkboxInput Point.typeOnChange "Send on change"
+                    , checkboxInput Point.typeDisabled "Disabled"
+                    , el [ paddingXY 20 0 ] <|
+                        text "Signal values are set by value points keyed by signal name"
+                    ]
+                        ++ List.map
+                            (\p -> NodeInputs.nodeNumberInput opts p.key Point.typeValue p.key)
+                            values
+
+                else
+                    []
+               )
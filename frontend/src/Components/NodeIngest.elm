@@ -0,0 +1,66 @@
+module Components.NodeIngest exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisabled ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.uploadCloud
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            150
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+
+                        -- tokens are hashed when they are saved, so the
+                        -- token can only be replaced
+                        tokenHint =
+                            if Point.getText o.node.points Point.typeTokenHash "" /= "" then
+                                "set, enter a new token to replace it"
+
+                            else
+                                "random string"
+                    in
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeToken "Token" tokenHint
+                    , textInput Point.typeNodeTemplate "Node template" "{{.Measurement}}"
+                    , textInput Point.typeNodeType "Node type" "variable"
+                    , NodeInputs.nodeKeyValueInput opts Point.typeNodeRule "Node rules (measurement pattern: node template)" "Add Rule"
+                    , checkboxInput Point.typeDisabled "Disabled"
+                    , el [ paddingXY 20 0 ] <| text "POST line protocol or JSON samples to /v1/ingest"
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,68 @@
+module Components.NodeMBus exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style exposing (colors)
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisabled ""
+
+        scanning =
+            Point.getBool o.node.points Point.typeScan ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.bus
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf scanning <| text "(scanning)"
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            180
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        numberInput =
+                            NodeInputs.nodeNumberInput opts "0"
+
+                        counterWithReset =
+                            NodeInputs.nodeCounterWithReset opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+                    in
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typePort "Port" "/dev/ttyUSB0"
+                    , textInput Point.typeBaud "Baud" "2400"
+                    , numberInput Point.typePollPeriod "Poll period (ms)"
+                    , numberInput Point.typeDebug "Debug level (0-9)"
+                    , checkboxInput Point.typeScan "Scan for meters"
+                    , checkboxInput Point.typeDisabled "Disabled"
+                    , counterWithReset Point.typeErrorCount Point.typeErrorCountReset "Error Count"
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,129 @@
+module Components.NodeMBusMeter exposing (view)
+
+import Api.Point as Point exposing (Point)
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style exposing (colors)
+import UI.ViewIf exposing (viewIf)
+
+
+
+-- points that are not meter data records
+
+
+configPoints : List String
+configPoints =
+    [ Point.typeDescription
+    , Point.typeAddress
+    , Point.typeDisabled
+    , Point.typeID
+    , Point.typeManufacturer
+    , Point.typeMedium
+    , Point.typeVersion
+    , Point.typeUnits
+    , Point.typeErrorCount
+    , Point.typeErrorCountReset
+    , Point.typeTag
+    ]
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisabled ""
+
+        records =
+            o.node.points
+                |> List.filter (\p -> not <| List.member p.typ configPoints)
+                |> Point.filterTombstone
+                |> List.sortBy (\p -> ( p.typ, p.key ))
+
+        -- current values are shown in the summary
+        current =
+            List.filter (\p -> p.key == "0") records
+
+        recordText : Point -> String
+        recordText p =
+            if p.text /= "" then
+                p.text
+
+            else
+                String.fromFloat (Round.roundNum 3 p.value)
+                    ++ " "
+                    ++ Point.getText o.node.points Point.typeUnits p.typ
+
+        recordLabel p =
+            if p.key == "0" then
+                p.typ
+
+            else
+                p.typ ++ " (" ++ p.key ++ ")"
+
+        info =
+            [ ( "ID", Point.getText o.node.points Point.typeID "" )
+            , ( "Manufacturer", Point.getText o.node.points Point.typeManufacturer "" )
+            , ( "Medium", Point.getText o.node.points Point.typeMedium "" )
+            ]
+                |> List.filter (\( _, v ) -> v /= "")
+                |> List.map (\( l, v ) -> l ++ ": " ++ v)
+                |> String.join ", "
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.io
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , el [ paddingXY 7 0 ] <|
+                text <|
+                    String.join ", " <|
+                        List.map (\p -> p.typ ++ ": " ++ recordText p) current
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            150
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        numberInput =
+                            NodeInputs.nodeNumberInput opts "0"
+
+                        counterWithReset =
+                            NodeInputs.nodeCounterWithReset opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+
+                        indent =
+                            el [ paddingEach { top = 0, right = 0, bottom = 0, left = 70 } ]
+                    in
+                    [ viewIf (info /= "") <| indent <| text info
+                    , textInput Point.typeDescription "Description" ""
+                    , numberInput Point.typeAddress "Address"
+                    , checkboxInput Point.typeDisabled "Disabled"
+                    , counterWithReset Point.typeErrorCount Point.typeErrorCountReset "Error Count"
+                    , NodeInputs.nodeKeyValueInput opts Point.typeTag "Tags" "Add Tag"
+                    ]
+                        ++ List.map
+                            (\p -> indent <| text <| recordLabel p ++ ": " ++ recordText p)
+                            records
+
+                else
+                    []
+               )
@@ -0,0 +1,73 @@
+module Components.NodeMQTT exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Background as Background
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisabled ""
+
+        connected =
+            Point.getBool o.node.points Point.typeConnected ""
+
+        summaryBackground =
+            if disabled || not connected then
+                Style.colors.ltgray
+
+            else
+                Style.colors.none
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10, Background.color summaryBackground ]
+            [ Icon.rss
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            , viewIf (not disabled && not connected) <| text "(not connected)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            150
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+                    in
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeURI "Broker URI" "tcp://localhost:1883, ssl://myserver:8883"
+                    , textInput Point.typeClientID "Client ID" ""
+                    , textInput Point.typeUsername "Username" ""
+                    , textInput Point.typePass "Password" ""
+                    , textInput Point.typeTLSCACert "TLS CA cert (PEM)" ""
+                    , textInput Point.typeTLSCert "TLS cert (PEM)" ""
+                    , textInput Point.typeTLSKey "TLS key (PEM)" ""
+                    , checkboxInput Point.typeTLSInsecure "Skip TLS verify"
+                    , textInput Point.typeHADiscoveryPrefix "Home Assistant discovery prefix" "homeassistant"
+                    , checkboxInput Point.typeDisabled "Disabled"
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,66 @@
+module Components.NodeMQTTHomeAssistant exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisabled ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.home
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            150
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        optionInput =
+                            NodeInputs.nodeOptionInput opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+                    in
+                    [ textInput Point.typeDescription "Name" "defaults to node description"
+                    , textInput Point.typeNodeID "Node ID" ""
+                    , optionInput Point.typeComponent
+                        "Component"
+                        [ ( "", "Auto" )
+                        , ( Point.valueSensor, "Sensor" )
+                        , ( Point.valueSwitch, "Switch" )
+                        ]
+                    , textInput Point.typePointType "Point type" "auto"
+                    , textInput Point.typePointKey "Point key" "0"
+                    , textInput Point.typeUnits "Units" "defaults to node units"
+                    , textInput Point.typeDeviceClass "Device class" "temperature, power, etc."
+                    , checkboxInput Point.typeDisabled "Disabled"
+                    ]
+
+                else
+                    []
+               )
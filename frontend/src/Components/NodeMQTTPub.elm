@@ -0,0 +1,69 @@
+module Components.NodeMQTTPub exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisabled ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.upload
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            150
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        numberInput =
+                            NodeInputs.nodeNumberInput opts "0"
+
+                        optionInput =
+                            NodeInputs.nodeOptionInput opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+                    in
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeNodeID "Node ID" ""
+                    , textInput Point.typePointType "Point type" "blank for all"
+                    , textInput Point.typePointKey "Point key" "blank for all"
+                    , textInput Point.typeTopic "Topic" "siot/{{.NodeID}}/{{.Type}}"
+                    , optionInput Point.typeFormat
+                        "Format"
+                        [ ( Point.valueRaw, "Raw value" )
+                        , ( Point.valueJSON, "JSON point" )
+                        ]
+                    , numberInput Point.typeQOS "QoS"
+                    , checkboxInput Point.typeRetain "Retain"
+                    , checkboxInput Point.typeDisabled "Disabled"
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,89 @@
+module Components.NodeMQTTSub exposing (view)
+
+import Api.Point as Point exposing (Point)
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisabled ""
+
+        pointType =
+            case Point.getText o.node.points Point.typePointType "" of
+                "" ->
+                    Point.typeValue
+
+                t ->
+                    t
+
+        values =
+            List.filter (\p -> p.typ == pointType) o.node.points
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.download
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , column [] <| List.map viewValue values
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            150
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        numberInput =
+                            NodeInputs.nodeNumberInput opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+                    in
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeTopic "Topic" "sensors/+/data"
+                    , numberInput Point.typeQOS "QoS"
+                    , textInput Point.typeJSONPath "JSON path" "sensors[0].temp (blank for raw payload)"
+                    , textInput Point.typePointType "Point type" Point.typeValue
+                    , textInput Point.typePointKey "Point key" "topic if wildcard, otherwise 0"
+                    , checkboxInput Point.typeDisabled "Disabled"
+                    ]
+
+                else
+                    []
+               )
+
+
+viewValue : Point -> Element msg
+viewValue p =
+    let
+        v =
+            if p.text /= "" then
+                p.text
+
+            else
+                String.fromFloat p.value
+    in
+    if p.key == "0" then
+        text v
+
+    else
+        text <| p.key ++ ": " ++ v
@@ -57,6 +57,9 @@ view o =
 
                         protocol =
                             Point.getText o.node.points Point.typeProtocol ""
+
+                        serial =
+                            protocol == Point.valueRTU || protocol == Point.valueModbusASCII
                     in
                     [ textInput Point.typeDescription "Description" ""
                     , optionInput Point.typeClientServer
@@ -68,9 +71,10 @@ view o =
                         "Protocol"
                         [ ( Point.valueRTU, "RTU" )
                         , ( Point.valueTCP, "TCP" )
+                        , ( Point.valueModbusASCII, "ASCII" )
                         ]
                     , viewIf
-                        (protocol == Point.valueRTU)
+                        serial
                       <|
                         textInput Point.typePort "Port" "/dev/ttyUSB0"
                     , viewIf
@@ -89,11 +93,24 @@ view o =
                         )
                       <|
                         textInput Point.typeURI "URI" "192.168.1.201:502"
-                    , viewIf (protocol == Point.valueRTU) <| textInput Point.typeBaud "Baud" "9600"
+                    , viewIf serial <| textInput Point.typeBaud "Baud" "9600"
                     , viewIf (clientServer == Point.valueServer) <|
                         numberInput Point.typeID "Device ID"
                     , viewIf (clientServer == Point.valueClient) <|
                         numberInput Point.typePollPeriod "Poll period (ms)"
+                    , viewIf (clientServer == Point.valueClient) <|
+                        numberInput Point.typeReadMaxGap "Block read max gap"
+                    , viewIf (clientServer == Point.valueClient && serial) <|
+                        textInput Point.typeGatewayPort "TCP gateway port" "502"
+                    , viewIf
+                        (clientServer
+                            == Point.valueClient
+                            && serial
+                            && Point.getText o.node.points Point.typeGatewayPort ""
+                            /= ""
+                        )
+                      <|
+                        numberInput Point.typeGatewayTimeout "Gateway timeout (ms)"
                     , numberInput Point.typeDebug "Debug level (0-9)"
                     , checkboxInput Point.typeDisabled "Disabled"
                     , counterWithReset Point.typeErrorCount Point.typeErrorCountReset "Error Count"
@@ -48,8 +48,23 @@ view o =
         isReadOnly =
             Point.getValue o.node.points Point.typeReadOnly "" == 1
 
+        dataFormat =
+            Point.getText o.node.points Point.typeDataFormat ""
+
+        isASCII =
+            dataFormat == Point.valueASCII
+
+        isBit =
+            dataFormat == Point.valueBit
+
+        isNumeric =
+            isRegister && not isASCII && not isBit
+
         valueText =
-            if isRegister then
+            if isASCII then
+                Point.getText o.node.points Point.typeValue ""
+
+            else if isNumeric then
                 String.fromFloat (Round.roundNum 2 value)
 
             else if value == 0 then
@@ -90,7 +105,7 @@ view o =
             , el [ paddingXY 7 0, Background.color valueBackgroundColor, Font.color valueTextColor ] <|
                 text <|
                     valueText
-                        ++ (if isRegister then
+                        ++ (if isNumeric then
                                 " " ++ Point.getText o.node.points Point.typeUnits ""
 
                             else
@@ -142,11 +157,11 @@ view o =
                         ]
                     , viewIf (isClient && isWrite) <|
                         checkboxInput Point.typeReadOnly "Read only"
-                    , viewIf isRegister <|
+                    , viewIf isNumeric <|
                         numberInput Point.typeScale "Scale factor"
-                    , viewIf isRegister <|
+                    , viewIf isNumeric <|
                         numberInput Point.typeOffset "Offset"
-                    , viewIf isRegister <|
+                    , viewIf isNumeric <|
                         textInput Point.typeUnits "Units" ""
                     , viewIf isRegister <|
                         optionInput Point.typeDataFormat
@@ -156,7 +171,24 @@ view o =
                             , ( Point.valueUINT32, "UINT32" )
                             , ( Point.valueINT32, "INT32" )
                             , ( Point.valueFLOAT32, "FLOAT32" )
+                            , ( Point.valueUINT64, "UINT64" )
+                            , ( Point.valueINT64, "INT64" )
+                            , ( Point.valueFLOAT64, "FLOAT64" )
+                            , ( Point.valueASCII, "ASCII string" )
+                            , ( Point.valueBit, "bit in register" )
+                            ]
+                    , viewIf (isRegister && not isBit) <|
+                        optionInput Point.typeByteOrder
+                            "Byte order"
+                            [ ( Point.valueABCD, "ABCD (big endian)" )
+                            , ( Point.valueCDAB, "CDAB (word swap)" )
+                            , ( Point.valueBADC, "BADC (byte swap)" )
+                            , ( Point.valueDCBA, "DCBA (little endian)" )
                             ]
+                    , viewIf (isRegister && isASCII) <|
+                        numberInput Point.typeRegCount "Register count"
+                    , viewIf (isRegister && isBit) <|
+                        numberInput Point.typeBitIndex "Bit (0-15)"
 
                     -- This can get a little confusing, but client sets the following:
                     --   * coil
@@ -171,10 +203,29 @@ view o =
                         (isClient
                             && modbusIOType
                             == Point.valueModbusHoldingRegister
+                            && isNumeric
                             && not isReadOnly
                         )
                       <|
                         numberInput Point.typeValueSet "Value"
+                    , viewIf
+                        (isClient
+                            && modbusIOType
+                            == Point.valueModbusHoldingRegister
+                            && isASCII
+                            && not isReadOnly
+                        )
+                      <|
+                        textInput Point.typeValueSet "Value" ""
+                    , viewIf
+                        (isClient
+                            && modbusIOType
+                            == Point.valueModbusHoldingRegister
+                            && isBit
+                            && not isReadOnly
+                        )
+                      <|
+                        onOffInput Point.typeValue Point.typeValueSet "Value"
                     , viewIf
                         (isClient
                             && modbusIOType
@@ -183,8 +234,12 @@ view o =
                         )
                       <|
                         onOffInput Point.typeValue Point.typeValueSet "Value"
-                    , viewIf (not isClient && modbusIOType == Point.valueModbusInputRegister) <|
+                    , viewIf (not isClient && modbusIOType == Point.valueModbusInputRegister && isNumeric) <|
                         numberInput Point.typeValue "Value"
+                    , viewIf (not isClient && modbusIOType == Point.valueModbusInputRegister && isASCII) <|
+                        textInput Point.typeValue "Value" ""
+                    , viewIf (not isClient && modbusIOType == Point.valueModbusInputRegister && isBit) <|
+                        onOffInput Point.typeValue Point.typeValue "Value"
                     , viewIf (not isClient && modbusIOType == Point.valueModbusDiscreteInput) <|
                         onOffInput Point.typeValue Point.typeValue "Value"
                     , viewIf isClient <| checkboxInput Point.typeDisabled "Disabled"
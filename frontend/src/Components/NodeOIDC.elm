@@ -0,0 +1,72 @@
+module Components.NodeOIDC exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        disabled =
+            Point.getBool o.node.points Point.typeDisabled ""
+
+        provision =
+            Point.getBool o.node.points Point.typeProvision ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.logIn
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    let
+                        labelWidth =
+                            150
+
+                        opts =
+                            oToInputO o labelWidth
+
+                        textInput =
+                            NodeInputs.nodeTextInput opts "0"
+
+                        optionInput =
+                            NodeInputs.nodeOptionInput opts "0"
+
+                        checkboxInput =
+                            NodeInputs.nodeCheckboxInput opts "0"
+                    in
+                    [ textInput Point.typeDescription "Description" "shown on sign in page"
+                    , textInput Point.typeIssuer "Issuer URL" "https://accounts.example.com"
+                    , textInput Point.typeClientID "Client ID" ""
+                    , textInput Point.typeClientSecret "Client secret" ""
+                    , textInput Point.typeRedirectURI "Redirect URI" "required"
+                    , checkboxInput Point.typeProvision "Create users"
+                    , viewIf provision <|
+                        textInput Point.typeNodeID "Group node ID" ""
+                    , viewIf provision <|
+                        optionInput Point.typeProvisionRole
+                            "Role"
+                            [ ( Point.valueUser, "User" )
+                            , ( Point.valueAdmin, "Admin" )
+                            ]
+                    , checkboxInput Point.typeDisabled "Disabled"
+                    , el [ paddingXY 20 0 ] <| text ("Redirect URI: <SIOT URL>/v1/auth/oidc/" ++ o.node.id ++ "/callback")
+                    ]
+
+                else
+                    []
+               )
@@ -15,20 +15,72 @@ import UI.ViewIf exposing (viewIf)
 view : NodeOptions msg -> Element msg
 view o =
     let
-        value =
-            Point.getValue o.node.points Point.typeValue ""
+        id =
+            Point.getText o.node.points Point.typeID ""
+
+        family =
+            String.left 2 (String.toLower id)
+
+        -- key of the temperature value, if the device measures temperature
+        tempKey =
+            case family of
+                "26" ->
+                    "temperature"
+
+                "20" ->
+                    ""
+
+                "29" ->
+                    ""
+
+                "3a" ->
+                    ""
+
+                _ ->
+                    "0"
+
+        outputCount =
+            case family of
+                "29" ->
+                    8
+
+                "3a" ->
+                    2
+
+                _ ->
+                    0
 
         units =
             Point.getText o.node.points Point.typeUnits ""
 
-        valueText =
-            String.fromFloat (Round.roundNum 2 value)
-                ++ (if units == "F" then
-                        "°F"
+        values =
+            Point.getAll o.node.points Point.typeValue
+                |> Point.filterTombstone
+                |> List.sortBy .key
 
-                    else
-                        "°C"
-                   )
+        valueText p =
+            if p.key == tempKey then
+                String.fromFloat (Round.roundNum 2 p.value)
+                    ++ (if units == "F" then
+                            "°F"
+
+                        else
+                            "°C"
+                       )
+
+            else if outputCount > 0 then
+                String.fromFloat p.value
+
+            else
+                String.fromFloat (Round.roundNum 3 p.value) ++ "V"
+
+        valuesText =
+            if tempKey == "0" then
+                String.join ", " <| List.map valueText values
+
+            else
+                String.join ", " <|
+                    List.map (\p -> p.key ++ ": " ++ valueText p) values
 
         disabled =
             Point.getBool o.node.points Point.typeDisabled ""
@@ -46,7 +98,7 @@ view o =
                 Point.getText o.node.points Point.typeDescription ""
             , el [ paddingXY 7 0 ] <|
                 text <|
-                    valueText
+                    valuesText
             , viewIf disabled <| text "(disabled)"
             ]
             :: (if o.expDetail then
@@ -69,19 +121,26 @@ view o =
                         fCheckboxInput =
                             fCheckbox opts "" Point.typeUnits "Fahrenheit?"
 
-                        id =
-                            Point.getText o.node.points Point.typeID ""
+                        outputInput i =
+                            checkbox (String.fromInt i) Point.typeValueSet <|
+                                "Output "
+                                    ++ String.fromInt i
+
+                        checkbox =
+                            NodeInputs.nodeCheckboxInput opts
                     in
                     [ el [ paddingEach { top = 0, right = 0, bottom = 0, left = 70 } ] <|
                         text <|
                             "ID: "
                                 ++ id
                     , textInput Point.typeDescription "Description" ""
-                    , fCheckboxInput
-                    , checkboxInput Point.typeDisabled "Disabled"
-                    , counterWithReset Point.typeErrorCount Point.typeErrorCountReset "Error Count"
-                    , NodeInputs.nodeKeyValueInput opts Point.typeTag "Tags" "Add Tag"
+                    , viewIf (tempKey /= "") fCheckboxInput
                     ]
+                        ++ List.map outputInput (List.range 0 (outputCount - 1))
+                        ++ [ checkboxInput Point.typeDisabled "Disabled"
+                           , counterWithReset Point.typeErrorCount Point.typeErrorCountReset "Error Count"
+                           , NodeInputs.nodeKeyValueInput opts Point.typeTag "Tags" "Add Tag"
+                           ]
 
                 else
                     []
@@ -47,10 +47,15 @@ view o =
 
                         checkboxInput =
                             NodeInputs.nodeCheckboxInput opts "0"
+
+                        numberInput =
+                            NodeInputs.nodeNumberInput opts "0"
                     in
                     [ text "Particle.io connection"
                     , textInput Point.typeDescription "Description" ""
                     , textInput Point.typeAuthToken "API Key" ""
+                    , textInput Point.typeAPIURL "API URL" "https://api.particle.io"
+                    , numberInput Point.typePollPeriod "Variable poll period (ms)"
                     , checkboxInput Point.typeDisabled "Disabled"
                     , NodeInputs.nodeKeyValueInput opts Point.typeTag "Tags" "Add Tag"
                     , viewPoints o.zone <| Point.filterSpecialPoints <| List.sortWith Point.sort o.node.points
@@ -90,6 +90,9 @@ view o =
                         onOffInput =
                             NodeInputs.nodeOnOffInput opts
 
+                        numberInput =
+                            NodeInputs.nodeNumberInput opts
+
                         deviceID =
                             Point.getText o.node.points Point.typeDeviceID ""
 
@@ -111,6 +114,7 @@ view o =
                     , textLinkDisplay "IP" ip ("http://" ++ ip)
                     , textInput Point.typeDescription "Description" ""
                     , viewIf controlled <| displayControls onOffInput o.node.points
+                    , viewIf controlled <| displayCoverControls numberInput o.node.points
                     , viewIf (isSettable o.node.points) <| checkboxInput Point.typeControlled "Enable Control"
                     , checkboxInput Point.typeDisabled "Disabled"
                     , NodeInputs.nodeKeyValueInput opts Point.typeTag "Tags" "Add Tag"
@@ -233,6 +237,22 @@ displayControls onOffInput pts =
             controlTypes
 
 
+displayCoverControls : (String -> String -> String -> Element msg) -> List Point -> Element msg
+displayCoverControls numberInput pts =
+    let
+        covers =
+            Point.getAll pts Point.typeCoverPos |> List.sortBy .key
+    in
+    column [ spacing 6 ] <|
+        List.map
+            (\p ->
+                numberInput p.key
+                    Point.typeCoverPosSet
+                    ("Cover " ++ p.key ++ " position (%)")
+            )
+            covers
+
+
 textDisplay : String -> String -> Element msg
 textDisplay label value =
     el [ paddingEach { top = 0, right = 0, bottom = 0, left = 70 } ] <|
@@ -312,6 +332,13 @@ metricFormaters _ =
         , ( "lightTemp", { desc = descS "Light Temperature", vf = toWhole } )
         , ( "transition", { desc = descS "Transition", vf = toWhole } )
         , ( "white", { desc = descS "White", vf = toWhole } )
+        , ( "energy", { desc = descS "Energy (Wh)", vf = \p -> Round.round 1 p.value } )
+        , ( "energyReturned", { desc = descS "Energy Returned (Wh)", vf = \p -> Round.round 1 p.value } )
+        , ( "powerFactor", { desc = descS "Power Factor", vf = \p -> Round.round 2 p.value } )
+        , ( "frequency", { desc = descS "Frequency", vf = \p -> Round.round 1 p.value } )
+        , ( "humidity", { desc = descS "Humidity (%)", vf = \p -> Round.round 1 p.value } )
+        , ( "battery", { desc = descS "Battery (%)", vf = toWhole } )
+        , ( "coverPos", { desc = descS "Cover Position (%)", vf = toWhole } )
         ]
 
 
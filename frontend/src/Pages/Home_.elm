@@ -7,8 +7,10 @@ import Api.Port as Port
 import Api.Response exposing (Response)
 import Auth
 import Base64.Encode
+import Components.NodeAPIToken as NodeAPIToken
 import Components.NodeAction as NodeAction
 import Components.NodeCanBus as NodeCanBus
+import Components.NodeCanTx as NodeCanTx
 import Components.NodeCondition as NodeCondition
 import Components.NodeDb as NodeDb
 import Components.NodeDevice as NodeDevice
@@ -18,14 +20,24 @@ import Components.NodeMessageService as NodeMessageService
 import Components.NodeMetrics as NodeMetrics
 import Components.NodeModbus as NodeModbus
 import Components.NodeModbusIO as NodeModbusIO
+import Components.NodeIngest as NodeIngest
+import Components.NodeMBus as NodeMBus
+import Components.NodeMBusMeter as NodeMBusMeter
+import Components.NodeMQTT as NodeMQTT
+import Components.NodeMQTTHomeAssistant as NodeMQTTHomeAssistant
+import Components.NodeMQTTPub as NodeMQTTPub
+import Components.NodeMQTTSub as NodeMQTTSub
 import Components.NodeNTP as NodeNTP
 import Components.NodeNetworkManager as NodeNetworkManager
 import Components.NodeNetworkManagerConn as NodeNetworkManagerConn
 import Components.NodeNetworkManagerDevice as NodeNetworkManagerDevice
+import Components.NodeOIDC as NodeOIDC
 import Components.NodeOneWire as NodeOneWire
 import Components.NodeOneWireIO as NodeOneWireIO
 import Components.NodeOptions exposing (CopyMove(..))
 import Components.NodeParticle as NodeParticle
+import Components.NodeParticleFunction as NodeParticleFunction
+import Components.NodeParticleVariable as NodeParticleVariable
 import Components.NodeRaw as NodeRaw
 import Components.NodeRule as NodeRule
 import Components.NodeSerialDev as NodeSerialDev
@@ -1049,6 +1061,10 @@ nodeCustomSortRules =
         , ( Node.typeNetworkManager, "R" )
         , ( Node.typeNTP, "S" )
         , ( Node.typeUpdate, "T" )
+        , ( Node.typeMQTT, "U" )
+        , ( Node.typeIngest, "V" )
+        , ( Node.typeOIDC, "W" )
+        , ( Node.typeMBus, "X" )
 
         -- rule subnodes
         , ( Node.typeCondition, "A" )
@@ -1056,6 +1072,14 @@ nodeCustomSortRules =
         , ( Node.typeActionInactive, "C" )
         , ( Node.typeNetworkManagerDevice, "D" )
         , ( Node.typeNetworkManagerConn, "E" )
+        , ( Node.typeMQTTSub, "F" )
+        , ( Node.typeMQTTPub, "G" )
+        , ( Node.typeMQTTHomeAssistant, "H" )
+        , ( Node.typeAPIToken, "I" )
+        , ( Node.typeCanTx, "J" )
+        , ( Node.typeParticleFunction, "K" )
+        , ( Node.typeParticleVariable, "L" )
+        , ( Node.typeMBusMeter, "M" )
         ]
 
 
@@ -1276,6 +1300,12 @@ viewNode model parent node children depth =
                     "oneWireIO" ->
                         NodeOneWireIO.view
 
+                    "mbus" ->
+                        NodeMBus.view
+
+                    "mbusMeter" ->
+                        NodeMBusMeter.view
+
                     "serialDev" ->
                         NodeSerialDev.view
 
@@ -1318,6 +1348,12 @@ viewNode model parent node children depth =
                     "particle" ->
                         NodeParticle.view
 
+                    "particleFunction" ->
+                        NodeParticleFunction.view
+
+                    "particleVariable" ->
+                        NodeParticleVariable.view
+
                     "shelly" ->
                         NodeShelly.view
 
@@ -1333,6 +1369,30 @@ viewNode model parent node children depth =
                     "ntp" ->
                         NodeNTP.view
 
+                    "mqtt" ->
+                        NodeMQTT.view
+
+                    "mqttSub" ->
+                        NodeMQTTSub.view
+
+                    "mqttPub" ->
+                        NodeMQTTPub.view
+
+                    "mqttHomeAssistant" ->
+                        NodeMQTTHomeAssistant.view
+
+                    "ingest" ->
+                        NodeIngest.view
+
+                    "apiToken" ->
+                        NodeAPIToken.view
+
+                    "oidc" ->
+                        NodeOIDC.view
+
+                    "canTx" ->
+                        NodeCanTx.view
+
                     "networkManagerDevice" ->
                         NodeNetworkManagerDevice.view
 
@@ -1505,10 +1565,14 @@ nodeTypesThatHaveChildNodes =
     , Node.typeGroup
     , Node.typeModbus
     , Node.typeOneWire
+    , Node.typeMBus
     , Node.typeSerialDev
     , Node.typeCanBus
     , Node.typeRule
     , Node.typeNetworkManager
+    , Node.typeMQTT
+    , Node.typeParticle
+    , Node.typeUser
     ]
 
 
@@ -1561,6 +1625,16 @@ nodeDescModbusIO =
     row [] [ Icon.io, text "Modbus IO" ]
 
 
+nodeDescMBus : Element Msg
+nodeDescMBus =
+    row [] [ Icon.bus, text "M-Bus" ]
+
+
+nodeDescMBusMeter : Element Msg
+nodeDescMBusMeter =
+    row [] [ Icon.io, text "M-Bus Meter" ]
+
+
 nodeDescSerialDev : Element Msg
 nodeDescSerialDev =
     row [] [ Icon.serialDev, text "Serial Device" ]
@@ -1571,6 +1645,11 @@ nodeDescCanBus =
     row [] [ Icon.serialDev, text "CAN Bus" ]
 
 
+nodeDescCanTx : Element Msg
+nodeDescCanTx =
+    row [] [ Icon.send, text "CAN Tx Message" ]
+
+
 nodeDescRule : Element Msg
 nodeDescRule =
     row [] [ Icon.list, text "Rule" ]
@@ -1591,6 +1670,16 @@ nodeDescParticle =
     row [] [ Icon.particle, text "Particle" ]
 
 
+nodeDescParticleFunction : Element Msg
+nodeDescParticleFunction =
+    row [] [ Icon.send, text "Particle Function" ]
+
+
+nodeDescParticleVariable : Element Msg
+nodeDescParticleVariable =
+    row [] [ Icon.variable, text "Particle Variable" ]
+
+
 nodeDescShelly : Element Msg
 nodeDescShelly =
     row [] [ Icon.shelly, text "Shelly" ]
@@ -1656,6 +1745,41 @@ nodeDescNTP =
     row [] [ Icon.clock, text "NTP" ]
 
 
+nodeDescMQTT : Element Msg
+nodeDescMQTT =
+    row [] [ Icon.rss, text "MQTT" ]
+
+
+nodeDescMQTTSub : Element Msg
+nodeDescMQTTSub =
+    row [] [ Icon.download, text "MQTT Subscription" ]
+
+
+nodeDescMQTTPub : Element Msg
+nodeDescMQTTPub =
+    row [] [ Icon.upload, text "MQTT Publish" ]
+
+
+nodeDescIngest : Element Msg
+nodeDescIngest =
+    row [] [ Icon.uploadCloud, text "Ingest" ]
+
+
+nodeDescMQTTHomeAssistant : Element Msg
+nodeDescMQTTHomeAssistant =
+    row [] [ Icon.home, text "Home Assistant Entity" ]
+
+
+nodeDescOIDC : Element Msg
+nodeDescOIDC =
+    row [] [ Icon.logIn, text "OIDC Login" ]
+
+
+nodeDescAPIToken : Element Msg
+nodeDescAPIToken =
+    row [] [ Icon.key, text "API Token" ]
+
+
 viewAddNode : String -> NodeView -> NodeToAdd -> Element Msg
 viewAddNode customNodeType parent add =
     column [ spacing 10 ]
@@ -1671,12 +1795,16 @@ viewAddNode customNodeType parent add =
                     , Input.option Node.typeNetworkManager nodeDescNetworkManager
                     , Input.option Node.typeNTP nodeDescNTP
                     , Input.option Node.typeModbus nodeDescModbus
+                    , Input.option Node.typeMBus nodeDescMBus
                     , Input.option Node.typeSerialDev nodeDescSerialDev
                     , Input.option Node.typeCanBus nodeDescCanBus
                     , Input.option Node.typeMsgService nodeDescMsgService
                     , Input.option Node.typeDb nodeDescDb
                     , Input.option Node.typeParticle nodeDescParticle
                     , Input.option Node.typeShelly nodeDescShelly
+                    , Input.option Node.typeMQTT nodeDescMQTT
+                    , Input.option Node.typeIngest nodeDescIngest
+                    , Input.option Node.typeOIDC nodeDescOIDC
                     , Input.option Node.typeVariable nodeDescVariable
                     , Input.option Node.typeSignalGenerator nodeDescSignalGenerator
                     , Input.option Node.typeFile nodeDescFile
@@ -1693,12 +1821,15 @@ viewAddNode customNodeType parent add =
                             , Input.option Node.typeGroup nodeDescGroup
                             , Input.option Node.typeRule nodeDescRule
                             , Input.option Node.typeModbus nodeDescModbus
+                            , Input.option Node.typeMBus nodeDescMBus
                             , Input.option Node.typeSerialDev nodeDescSerialDev
                             , Input.option Node.typeCanBus nodeDescCanBus
                             , Input.option Node.typeMsgService nodeDescMsgService
                             , Input.option Node.typeDb nodeDescDb
                             , Input.option Node.typeParticle nodeDescParticle
                             , Input.option Node.typeShelly nodeDescShelly
+                            , Input.option Node.typeMQTT nodeDescMQTT
+                            , Input.option Node.typeIngest nodeDescIngest
                             , Input.option Node.typeVariable nodeDescVariable
                             , Input.option Node.typeSignalGenerator nodeDescSignalGenerator
                             , Input.option Node.typeFile nodeDescFile
@@ -1710,6 +1841,12 @@ viewAddNode customNodeType parent add =
                     ++ (if parent.node.typ == Node.typeModbus then
                             [ Input.option Node.typeModbusIO nodeDescModbusIO ]
 
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeMBus then
+                            [ Input.option Node.typeMBusMeter nodeDescMBusMeter ]
+
                         else
                             []
                        )
@@ -1723,7 +1860,17 @@ viewAddNode customNodeType parent add =
                             []
                        )
                     ++ (if parent.node.typ == Node.typeCanBus then
-                            [ Input.option Node.typeFile nodeDescFile ]
+                            [ Input.option Node.typeFile nodeDescFile
+                            , Input.option Node.typeCanTx nodeDescCanTx
+                            ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeParticle then
+                            [ Input.option Node.typeParticleFunction nodeDescParticleFunction
+                            , Input.option Node.typeParticleVariable nodeDescParticleVariable
+                            ]
 
                         else
                             []
@@ -1731,12 +1878,27 @@ viewAddNode customNodeType parent add =
                     ++ (if parent.node.typ == Node.typeNetworkManager then
                             [ Input.option Node.typeNetworkManagerConn nodeDescNetworkManagerConn ]
 
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeMQTT then
+                            [ Input.option Node.typeMQTTSub nodeDescMQTTSub
+                            , Input.option Node.typeMQTTPub nodeDescMQTTPub
+                            , Input.option Node.typeMQTTHomeAssistant nodeDescMQTTHomeAssistant
+                            ]
+
                         else
                             []
                        )
                     ++ (if parent.node.typ == Node.typeSerialDev then
                             [ Input.option Node.typeFile nodeDescFile ]
 
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeUser then
+                            [ Input.option Node.typeAPIToken nodeDescAPIToken ]
+
                         else
                             []
                        )
@@ -2,6 +2,8 @@ module Pages.SignIn exposing (Model, Msg, page)
 
 import Api.Auth
 import Api.Data exposing (Data)
+import Browser.Navigation as Nav
+import Dict exposing (Dict)
 import Effect exposing (Effect)
 import Element exposing (..)
 import Element.Font as Font
@@ -13,13 +15,14 @@ import Shared
 import Storage exposing (Storage)
 import UI.Form as Form
 import UI.Style as Style
+import Url
 import View exposing (View)
 
 
 page : Shared.Model -> Request.With Params -> Page.With Model Msg
-page shared _ =
+page shared req =
     Page.advanced
-        { init = init shared
+        { init = init shared req
         , update = update shared.storage
         , view = view
         , subscriptions = subscriptions
@@ -35,24 +38,68 @@ type alias Model =
     , email : String
     , password : String
     , error : Maybe String
+    , providers : List Api.Auth.Provider
     }
 
 
-init : Shared.Model -> ( Model, Effect Msg )
-init shared =
-    ( Model
-        (case shared.storage.user of
-            Just auth ->
-                Api.Data.Success auth
+init : Shared.Model -> Request.With Params -> ( Model, Effect Msg )
+init shared req =
+    let
+        -- OIDC logins redirect back to this page with the token or an
+        -- error in the URL fragment
+        fragment =
+            fragmentParams req.url.fragment
+
+        oidcUser =
+            Maybe.map2 Api.Auth.User
+                (Dict.get "token" fragment)
+                (Dict.get "email" fragment)
+
+        getProviders =
+            Effect.fromCmd <| Api.Auth.oidcProviders { onResponse = GotProviders }
+    in
+    case oidcUser of
+        Just user ->
+            ( Model (Api.Data.Success user) "" "" Nothing []
+            , Effect.batch
+                [ Effect.fromCmd <| Storage.signIn user shared.storage
+                , getProviders
+                ]
+            )
+
+        Nothing ->
+            ( Model
+                (case shared.storage.user of
+                    Just auth ->
+                        Api.Data.Success auth
+
+                    Nothing ->
+                        Api.Data.NotAsked
+                )
+                ""
+                ""
+                (Dict.get "error" fragment)
+                []
+            , getProviders
+            )
+
 
-            Nothing ->
-                Api.Data.NotAsked
-        )
-        ""
-        ""
-        Nothing
-    , Effect.none
-    )
+fragmentParams : Maybe String -> Dict String String
+fragmentParams fragment =
+    fragment
+        |> Maybe.withDefault ""
+        |> String.split "&"
+        |> List.filterMap
+            (\param ->
+                case String.split "=" param of
+                    [ k, v ] ->
+                        Url.percentDecode (String.replace "+" " " v)
+                            |> Maybe.map (Tuple.pair k)
+
+                    _ ->
+                        Nothing
+            )
+        |> Dict.fromList
 
 
 
@@ -64,6 +111,8 @@ type Msg
     | EditPass String
     | SignIn
     | GotUser (Data Api.Auth.User)
+    | GotProviders (Data (List Api.Auth.Provider))
+    | OIDCLogin Api.Auth.Provider
     | NoOp
 
 
@@ -91,6 +140,14 @@ update storage msg model =
         NoOp ->
             ( model, Effect.none )
 
+        GotProviders providers ->
+            ( { model | providers = Api.Data.toMaybe providers |> Maybe.withDefault [] }
+            , Effect.none
+            )
+
+        OIDCLogin provider ->
+            ( model, Effect.fromCmd <| Nav.load <| Api.Auth.oidcLoginUrl provider )
+
         GotUser user ->
             let
                 error =
@@ -177,10 +234,31 @@ view model =
                                 , onPress = SignIn
                                 }
                     ]
+                , viewProviders model.providers
                 ]
     }
 
 
+viewProviders : List Api.Auth.Provider -> Element Msg
+viewProviders providers =
+    if List.isEmpty providers then
+        none
+
+    else
+        column [ spacing 16, width fill ] <|
+            el [ centerX ] (text "or")
+                :: List.map
+                    (\p ->
+                        el [ centerX ] <|
+                            Form.button
+                                { label = "Sign in with " ++ p.description
+                                , color = Style.colors.blue
+                                , onPress = OIDCLogin p
+                                }
+                    )
+                    providers
+
+
 viewError : Maybe String -> Element msg
 viewError error =
     case error of
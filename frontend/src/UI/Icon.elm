@@ -11,14 +11,19 @@ module UI.Icon exposing
     , cloudOff
     , database
     , device
+    , download
     , file
+    , home
     , io
+    , key
     , list
+    , logIn
     , network
     , oneWire
     , particle
     , power
     , radioReceiver
+    , rss
     , send
     , serialDev
     , shelly
@@ -26,6 +31,8 @@ module UI.Icon exposing
     , trendingDown
     , trendingUp
     , update
+    , uploadCloud
+    , upload
     , user
     , users
     , variable
@@ -266,3 +273,38 @@ clock =
 update : Element msg
 update =
     icon FeatherIcons.refreshCw
+
+
+rss : Element msg
+rss =
+    icon FeatherIcons.rss
+
+
+download : Element msg
+download =
+    icon FeatherIcons.download
+
+
+upload : Element msg
+upload =
+    icon FeatherIcons.upload
+
+
+home : Element msg
+home =
+    icon FeatherIcons.home
+
+
+uploadCloud : Element msg
+uploadCloud =
+    icon FeatherIcons.uploadCloud
+
+
+key : Element msg
+key =
+    icon FeatherIcons.key
+
+
+logIn : Element msg
+logIn =
+    icon FeatherIcons.logIn
@@ -0,0 +1,559 @@
+package mbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Quantities. The names match SIOT point types. Values are converted to the
+// unit listed for each quantity.
+const (
+	QuantityEnergy        = "energy"        // Wh
+	QuantityVolume        = "volume"        // m³
+	QuantityMass          = "mass"          // kg
+	QuantityOnTime        = "onTime"        // s
+	QuantityOperatingTime = "operatingTime" // s
+	QuantityPower         = "power"         // W
+	QuantityVolumeFlow    = "volumeFlow"    // m³/h
+	QuantityMassFlow      = "massFlow"      // kg/h
+	QuantityFlowTemp      = "flowTemp"      // °C
+	QuantityReturnTemp    = "returnTemp"    // °C
+	QuantityTempDiff      = "tempDiff"      // K
+	QuantityTemp          = "temp"          // °C
+	QuantityPressure      = "pressure"      // bar
+	QuantityDate          = "date"          // text, 2006-01-02
+	QuantityDateTime      = "dateTime"      // text, 2006-01-02T15:04
+	QuantityHCA           = "hca"           // heat cost allocator units
+	QuantityFabricationNo = "fabricationNo"
+	QuantityBusAddress    = "busAddress"
+	QuantityErrorFlags    = "errorFlags"
+	QuantityVoltage       = "voltage" // V
+	QuantityCurrent       = "current" // A
+)
+
+// Units returns the units of a quantity
+func Units(quantity string) string {
+	switch quantity {
+	case QuantityEnergy:
+		return "Wh"
+	case QuantityVolume:
+		return "m³"
+	case QuantityMass:
+		return "kg"
+	case QuantityOnTime, QuantityOperatingTime:
+		return "s"
+	case QuantityPower:
+		return "W"
+	case QuantityVolumeFlow:
+		return "m³/h"
+	case QuantityMassFlow:
+		return "kg/h"
+	case QuantityFlowTemp, QuantityReturnTemp, QuantityTemp:
+		return "°C"
+	case QuantityTempDiff:
+		return "K"
+	case QuantityPressure:
+		return "bar"
+	case QuantityVoltage:
+		return "V"
+	case QuantityCurrent:
+		return "A"
+	default:
+		return ""
+	}
+}
+
+// Function of a data record
+type Function int
+
+// Record functions
+const (
+	FunctionInstantaneous Function = iota
+	FunctionMax
+	FunctionMin
+	FunctionError
+)
+
+func (f Function) String() string {
+	switch f {
+	case FunctionInstantaneous:
+		return "instantaneous"
+	case FunctionMax:
+		return "max"
+	case FunctionMin:
+		return "min"
+	case FunctionError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Medium of a meter
+type Medium byte
+
+var mediums = map[Medium]string{
+	0x00: "other",
+	0x01: "oil",
+	0x02: "electricity",
+	0x03: "gas",
+	0x04: "heat",
+	0x05: "steam",
+	0x06: "warm water",
+	0x07: "water",
+	0x08: "heat cost allocator",
+	0x09: "compressed air",
+	0x0A: "cooling (outlet)",
+	0x0B: "cooling (inlet)",
+	0x0C: "heat (inlet)",
+	0x0D: "heat/cooling",
+	0x0E: "bus/system",
+	0x0F: "unknown",
+	0x15: "hot water",
+	0x16: "cold water",
+	0x17: "dual water",
+	0x18: "pressure",
+	0x19: "A/D converter",
+}
+
+func (m Medium) String() string {
+	if s, ok := mediums[m]; ok {
+		return s
+	}
+	return fmt.Sprintf("0x%02x", byte(m))
+}
+
+// Record is a decoded data record. Text is set instead of Value for dates
+// and strings.
+type Record struct {
+	Function Function
+	Storage  int
+	Tariff   int
+	Subunit  int
+	Quantity string
+	Value    float64
+	Text     string
+}
+
+// Key returns a key that identifies the record among records with the same
+// quantity. The current value (storage 0, tariff 0, subunit 0,
+// instantaneous) has a key of "0".
+func (r Record) Key() string {
+	var parts []string
+	if r.Storage > 0 {
+		parts = append(parts, fmt.Sprintf("s%v", r.Storage))
+	}
+	if r.Tariff > 0 {
+		parts = append(parts, fmt.Sprintf("t%v", r.Tariff))
+	}
+	if r.Subunit > 0 {
+		parts = append(parts, fmt.Sprintf("u%v", r.Subunit))
+	}
+	if r.Function != FunctionInstantaneous {
+		parts = append(parts, r.Function.String())
+	}
+	if len(parts) == 0 {
+		return "0"
+	}
+	return strings.Join(parts, ".")
+}
+
+// Response is a decoded variable data response (RSP_UD)
+type Response struct {
+	Address      byte
+	ID           uint32
+	Manufacturer string
+	Version      byte
+	Medium       Medium
+	AccessNo     byte
+	Status       byte
+	Records      []Record
+	// MoreRecords is set if the meter has more records in another telegram
+	MoreRecords bool
+}
+
+// decodeManufacturer decodes the 3 letter manufacturer code
+func decodeManufacturer(v uint16) string {
+	return string([]byte{
+		byte(v>>10&0x1F) + 64,
+		byte(v>>5&0x1F) + 64,
+		byte(v&0x1F) + 64,
+	})
+}
+
+// decodeBCD decodes LSB first BCD data. A high nibble of 0xF in the last
+// byte indicates a negative value.
+func decodeBCD(b []byte) (float64, error) {
+	var ret float64
+	neg := false
+	for i := len(b) - 1; i >= 0; i-- {
+		hi, lo := b[i]>>4, b[i]&0x0F
+		if i == len(b)-1 && hi == 0x0F {
+			neg = true
+			hi = 0
+		}
+		if hi > 9 || lo > 9 {
+			return 0, fmt.Errorf("invalid BCD data: % x", b)
+		}
+		ret = ret*100 + float64(hi)*10 + float64(lo)
+	}
+	if neg {
+		ret = -ret
+	}
+	return ret, nil
+}
+
+// decodeInt decodes LSB first two's complement data
+func decodeInt(b []byte) float64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	// sign extend
+	shift := 64 - 8*uint(len(b))
+	return float64(int64(v<<shift) >> shift)
+}
+
+// decodeDate decodes a type G date
+func decodeDate(b []byte) string {
+	day := b[0] & 0x1F
+	month := b[1] & 0x0F
+	year := int(b[0]>>5) | int(b[1]>>4)<<3
+	return fmt.Sprintf("%04d-%02d-%02d", 2000+year, month, day)
+}
+
+// decodeDateTime decodes a type F date and time
+func decodeDateTime(b []byte) string {
+	minute := b[0] & 0x3F
+	hour := b[1] & 0x1F
+	return decodeDate(b[2:4]) + fmt.Sprintf("T%02d:%02d", hour, minute)
+}
+
+// dataLen returns the length of the data for a DIF data field
+var dataLen = map[byte]int{
+	0x0: 0, 0x1: 1, 0x2: 2, 0x3: 3, 0x4: 4, 0x5: 4, 0x6: 6, 0x7: 8,
+	0x8: 0, 0x9: 1, 0xA: 2, 0xB: 3, 0xC: 4, 0xE: 6,
+}
+
+// vif describes how a VIF is decoded
+type vif struct {
+	quantity string
+	scale    float64
+}
+
+// primaryVIF decodes a primary VIF (extension bit cleared)
+func primaryVIF(v byte) vif {
+	n := float64(v & 0x07)
+	nn := float64(v & 0x03)
+
+	switch {
+	case v&0x78 == 0x00:
+		return vif{QuantityEnergy, math.Pow(10, n-3)}
+	case v&0x78 == 0x08:
+		// J
+		return vif{QuantityEnergy, math.Pow(10, n) / 3600}
+	case v&0x78 == 0x10:
+		return vif{QuantityVolume, math.Pow(10, n-6)}
+	case v&0x78 == 0x18:
+		return vif{QuantityMass, math.Pow(10, n-3)}
+	case v&0x7C == 0x20:
+		return vif{QuantityOnTime, durationScale(v)}
+	case v&0x7C == 0x24:
+		return vif{QuantityOperatingTime, durationScale(v)}
+	case v&0x78 == 0x28:
+		return vif{QuantityPower, math.Pow(10, n-3)}
+	case v&0x78 == 0x30:
+		// J/h
+		return vif{QuantityPower, math.Pow(10, n) / 3600}
+	case v&0x78 == 0x38:
+		return vif{QuantityVolumeFlow, math.Pow(10, n-6)}
+	case v&0x78 == 0x40:
+		// m³/min
+		return vif{QuantityVolumeFlow, math.Pow(10, n-7) * 60}
+	case v&0x78 == 0x48:
+		// m³/s
+		return vif{QuantityVolumeFlow, math.Pow(10, n-9) * 3600}
+	case v&0x78 == 0x50:
+		return vif{QuantityMassFlow, math.Pow(10, n-3)}
+	case v&0x7C == 0x58:
+		return vif{QuantityFlowTemp, math.Pow(10, nn-3)}
+	case v&0x7C == 0x5C:
+		return vif{QuantityReturnTemp, math.Pow(10, nn-3)}
+	case v&0x7C == 0x60:
+		return vif{QuantityTempDiff, math.Pow(10, nn-3)}
+	case v&0x7C == 0x64:
+		return vif{QuantityTemp, math.Pow(10, nn-3)}
+	case v&0x7C == 0x68:
+		return vif{QuantityPressure, math.Pow(10, nn-3)}
+	case v == 0x6C:
+		return vif{QuantityDate, 1}
+	case v == 0x6D:
+		return vif{QuantityDateTime, 1}
+	case v == 0x6E:
+		return vif{QuantityHCA, 1}
+	case v == 0x78:
+		return vif{QuantityFabricationNo, 1}
+	case v == 0x7A:
+		return vif{QuantityBusAddress, 1}
+	default:
+		return vif{}
+	}
+}
+
+// durationScale returns the scale to seconds of a duration VIF
+func durationScale(v byte) float64 {
+	return []float64{1, 60, 3600, 86400}[v&0x03]
+}
+
+// fbVIF decodes the first VIF extension in the 0xFB table
+func fbVIF(v byte) vif {
+	n := float64(v & 0x01)
+
+	switch v & 0x7E {
+	case 0x00:
+		// MWh
+		return vif{QuantityEnergy, math.Pow(10, n+5)}
+	case 0x08:
+		// GJ
+		return vif{QuantityEnergy, math.Pow(10, n+8) / 3600}
+	case 0x10:
+		return vif{QuantityVolume, math.Pow(10, n+2)}
+	case 0x18:
+		// t
+		return vif{QuantityMass, math.Pow(10, n+5)}
+	case 0x28:
+		// MW
+		return vif{QuantityPower, math.Pow(10, n+5)}
+	case 0x30:
+		// GJ/h
+		return vif{QuantityPower, math.Pow(10, n+8) / 3600}
+	default:
+		return vif{}
+	}
+}
+
+// fdVIF decodes the first VIF extension in the 0xFD table
+func fdVIF(v byte) vif {
+	v &= 0x7F
+
+	switch {
+	case v == 0x17:
+		return vif{QuantityErrorFlags, 1}
+	case v&0x70 == 0x40:
+		return vif{QuantityVoltage, math.Pow(10, float64(v&0x0F)-9)}
+	case v&0x70 == 0x50:
+		return vif{QuantityCurrent, math.Pow(10, float64(v&0x0F)-12)}
+	default:
+		return vif{}
+	}
+}
+
+// DecodeResponse decodes the data of a RSP_UD frame
+func DecodeResponse(f Frame) (*Response, error) {
+	ret := &Response{Address: f.A}
+	d := f.Data
+
+	switch f.CI {
+	case CIRspVariable:
+		if len(d) < 12 {
+			return nil, errors.New("variable data header too short")
+		}
+		id, err := decodeBCD(d[0:4])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID: %w", err)
+		}
+		ret.ID = uint32(id)
+		ret.Manufacturer = decodeManufacturer(binary.LittleEndian.Uint16(d[4:6]))
+		ret.Version = d[6]
+		ret.Medium = Medium(d[7])
+		ret.AccessNo = d[8]
+		ret.Status = d[9]
+		d = d[12:]
+	case CIRspVariableShort:
+		if len(d) < 4 {
+			return nil, errors.New("variable data header too short")
+		}
+		ret.AccessNo = d[0]
+		ret.Status = d[1]
+		d = d[4:]
+	default:
+		return nil, fmt.Errorf("unsupported CI field: 0x%02x", f.CI)
+	}
+
+	var err error
+	ret.Records, ret.MoreRecords, err = decodeRecords(d)
+	return ret, err
+}
+
+// decodeRecords decodes data records. Records with unsupported VIFs or
+// invalid data are skipped.
+func decodeRecords(d []byte) ([]Record, bool, error) {
+	var ret []Record
+
+	next := func() (byte, error) {
+		if len(d) < 1 {
+			return 0, errors.New("record truncated")
+		}
+		b := d[0]
+		d = d[1:]
+		return b, nil
+	}
+
+	for len(d) > 0 {
+		dif, _ := next()
+
+		switch dif {
+		case 0x2F:
+			// idle filler
+			continue
+		case 0x0F, 0x1F:
+			// manufacturer specific data follows
+			return ret, dif == 0x1F, nil
+		}
+
+		r := Record{
+			Function: Function(dif >> 4 & 0x03),
+			Storage:  int(dif >> 6 & 0x01),
+		}
+		dataField := dif & 0x0F
+
+		ext := dif&0x80 != 0
+		for i := 0; ext; i++ {
+			dife, err := next()
+			if err != nil {
+				return ret, false, err
+			}
+			r.Storage |= int(dife&0x0F) << (1 + 4*i)
+			r.Tariff |= int(dife>>4&0x03) << (2 * i)
+			r.Subunit |= int(dife>>6&0x01) << i
+			ext = dife&0x80 != 0
+		}
+
+		v, err := next()
+		if err != nil {
+			return ret, false, err
+		}
+
+		var vifs []byte
+		if v&0x7F == 0x7C {
+			// plain text unit, not supported but must be skipped
+			l, err := next()
+			if err != nil {
+				return ret, false, err
+			}
+			if len(d) < int(l) {
+				return ret, false, errors.New("record truncated")
+			}
+			d = d[l:]
+		}
+
+		ext = v&0x80 != 0
+		for ext {
+			vife, err := next()
+			if err != nil {
+				return ret, false, err
+			}
+			vifs = append(vifs, vife)
+			ext = vife&0x80 != 0
+		}
+
+		var info vif
+		switch {
+		case v == 0xFB && len(vifs) > 0:
+			info = fbVIF(vifs[0])
+			vifs = vifs[1:]
+		case v == 0xFD && len(vifs) > 0:
+			info = fdVIF(vifs[0])
+			vifs = vifs[1:]
+		default:
+			info = primaryVIF(v & 0x7F)
+		}
+
+		// combinable extensions that scale the value
+		for _, vife := range vifs {
+			switch {
+			case vife&0x78 == 0x70:
+				info.scale *= math.Pow(10, float64(vife&0x07)-6)
+			case vife&0x7F == 0x7D:
+				info.scale *= 1000
+			}
+		}
+
+		var raw []byte
+		if dataField == 0x0D {
+			l, err := next()
+			if err != nil {
+				return ret, false, err
+			}
+			// only strings are supported, other types are skipped
+			n := int(l)
+			switch {
+			case l >= 0xC0 && l <= 0xDF:
+				n = int(l&0x0F) * 2
+			case l >= 0xE0 && l <= 0xEF:
+				n = int(l & 0x0F)
+			case l >= 0xF0:
+				n = 8
+			}
+			if len(d) < n {
+				return ret, false, errors.New("record truncated")
+			}
+			raw = d[:n]
+			d = d[n:]
+			if info.quantity == "" || l >= 0xC0 {
+				continue
+			}
+			// strings are sent last character first
+			text := make([]byte, n)
+			for i := range raw {
+				text[n-1-i] = raw[i]
+			}
+			r.Quantity = info.quantity
+			r.Text = string(text)
+			ret = append(ret, r)
+			continue
+		}
+
+		n, ok := dataLen[dataField]
+		if !ok {
+			return ret, false, fmt.Errorf("unsupported DIF: 0x%02x", dif)
+		}
+		if len(d) < n {
+			return ret, false, errors.New("record truncated")
+		}
+		raw = d[:n]
+		d = d[n:]
+
+		if info.quantity == "" || n == 0 {
+			continue
+		}
+
+		r.Quantity = info.quantity
+
+		switch {
+		case info.quantity == QuantityDate && n == 2:
+			r.Text = decodeDate(raw)
+		case info.quantity == QuantityDateTime && n == 4:
+			r.Text = decodeDateTime(raw)
+		case dataField == 0x5:
+			r.Value = float64(math.Float32frombits(binary.LittleEndian.Uint32(raw))) * info.scale
+		case dataField >= 0x9:
+			value, err := decodeBCD(raw)
+			if err != nil {
+				// meters send invalid BCD data for values that are not
+				// available
+				continue
+			}
+			r.Value = value * info.scale
+		default:
+			r.Value = decodeInt(raw) * info.scale
+		}
+
+		ret = append(ret, r)
+	}
+
+	return ret, false, nil
+}
@@ -0,0 +1,133 @@
+package mbus
+
+import (
+	"math"
+	"testing"
+)
+
+// heat meter response with a header, several record types, and a trailer
+// indicating more records follow
+var testData = []byte{
+	// ID 12345678, manufacturer KAM, version 1, medium heat,
+	// access number 5, status 0, signature
+	0x78, 0x56, 0x34, 0x12, 0x2D, 0x2C, 0x01, 0x04, 0x05, 0x00, 0x00, 0x00,
+	// energy, 32 bit int, Wh
+	0x04, 0x03, 0x39, 0x30, 0x00, 0x00,
+	// volume, 8 digit BCD, 0.001 m³
+	0x0C, 0x13, 0x56, 0x34, 0x12, 0x00,
+	// flow temp, 16 bit int, 0.1 °C
+	0x02, 0x5A, 0xFE, 0x00,
+	// temp difference, 16 bit int, 0.01 K
+	0x02, 0x61, 0x6A, 0xFF,
+	// storage 1 date
+	0x42, 0x6C, 0xFF, 0x2C,
+	// tariff 1 energy
+	0x84, 0x10, 0x03, 0x64, 0x00, 0x00, 0x00,
+	// max power, 32 bit real, W
+	0x15, 0x2B, 0x00, 0x00, 0xC0, 0x3F,
+	// error flags
+	0x01, 0xFD, 0x17, 0x00,
+	// value not available, invalid BCD is skipped
+	0x0A, 0x5B, 0xFF, 0xFF,
+	// unsupported VIF is skipped
+	0x01, 0x7F, 0x00,
+	// filler
+	0x2F,
+	// more records follow
+	0x1F,
+}
+
+func TestDecodeResponse(t *testing.T) {
+	r, err := DecodeResponse(Frame{C: CRspUD, A: 5, CI: CIRspVariable,
+		Data: testData, Long: true})
+	if err != nil {
+		t.Fatal("Decode error: ", err)
+	}
+
+	if r.Address != 5 || r.ID != 12345678 || r.Manufacturer != "KAM" ||
+		r.Version != 1 || r.Medium.String() != "heat" || r.AccessNo != 5 {
+		t.Errorf("Header not decoded correctly: %+v", r)
+	}
+
+	if !r.MoreRecords {
+		t.Error("Expected more records")
+	}
+
+	exp := []Record{
+		{Quantity: QuantityEnergy, Value: 12345},
+		{Quantity: QuantityVolume, Value: 123.456},
+		{Quantity: QuantityFlowTemp, Value: 25.4},
+		{Quantity: QuantityTempDiff, Value: -1.5},
+		{Quantity: QuantityDate, Storage: 1, Text: "2023-12-31"},
+		{Quantity: QuantityEnergy, Tariff: 1, Value: 100},
+		{Quantity: QuantityPower, Function: FunctionMax, Value: 1.5},
+		{Quantity: QuantityErrorFlags, Value: 0},
+	}
+
+	if len(r.Records) != len(exp) {
+		t.Fatalf("Expected %v records, got %v: %+v", len(exp), len(r.Records), r.Records)
+	}
+
+	for i, e := range exp {
+		rec := r.Records[i]
+		if rec.Quantity != e.Quantity || rec.Function != e.Function ||
+			rec.Storage != e.Storage || rec.Tariff != e.Tariff ||
+			rec.Text != e.Text || math.Abs(rec.Value-e.Value) > 1e-9 {
+			t.Errorf("Record %v: expected %+v, got %+v", i, e, rec)
+		}
+	}
+
+	keys := []string{"0", "0", "0", "0", "s1", "t1", "max", "0"}
+	for i, k := range keys {
+		if r.Records[i].Key() != k {
+			t.Errorf("Record %v: expected key %v, got %v", i, k, r.Records[i].Key())
+		}
+	}
+}
+
+func TestDecodeResponseShort(t *testing.T) {
+	r, err := DecodeResponse(Frame{C: CRspUD, A: 1, CI: CIRspVariableShort,
+		Data: []byte{0x10, 0x00, 0x00, 0x00,
+			// 6 digit BCD, negative, 0.01 m³/h
+			0x0B, 0x3C, 0x50, 0x00, 0xF0,
+			// fabrication number
+			0x0C, 0x78, 0x21, 0x43, 0x65, 0x87,
+			// voltage, 16 bit int, 0.1 V, with a 10^-1 correction VIFE
+			0x02, 0xFD, 0xC8, 0x75, 0xD2, 0x04,
+			// text
+			0x0D, 0x78, 0x02, 0x42, 0x41,
+		}, Long: true})
+	if err != nil {
+		t.Fatal("Decode error: ", err)
+	}
+
+	if r.AccessNo != 0x10 || r.MoreRecords {
+		t.Errorf("Header not decoded correctly: %+v", r)
+	}
+
+	exp := []Record{
+		{Quantity: QuantityVolumeFlow, Value: -0.5},
+		{Quantity: QuantityFabricationNo, Value: 87654321},
+		{Quantity: QuantityVoltage, Value: 12.34},
+		{Quantity: QuantityFabricationNo, Text: "AB"},
+	}
+
+	if len(r.Records) != len(exp) {
+		t.Fatalf("Expected %v records, got %v: %+v", len(exp), len(r.Records), r.Records)
+	}
+
+	for i, e := range exp {
+		rec := r.Records[i]
+		if rec.Quantity != e.Quantity || rec.Text != e.Text ||
+			math.Abs(rec.Value-e.Value) > 1e-9 {
+			t.Errorf("Record %v: expected %+v, got %+v", i, e, rec)
+		}
+	}
+}
+
+func TestDecodeResponseTruncated(t *testing.T) {
+	_, err := DecodeResponse(Frame{CI: CIRspVariable, Data: testData[:14]})
+	if err == nil {
+		t.Error("Expected error for truncated record")
+	}
+}
@@ -0,0 +1,7 @@
+// Package mbus contains a wired M-Bus (EN 13757-2/3) master that reads
+// variable data responses from meters and decodes the DIF/VIF data records.
+//
+// Like the modbus package, the Master is passed an io.ReadWriter so any
+// serial library can be used. The respreader package is a convenient way to
+// frame responses from a serial port.
+package mbus
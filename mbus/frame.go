@@ -0,0 +1,122 @@
+package mbus
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Frame delimiters
+const (
+	frameACK        = 0xE5
+	frameShortStart = 0x10
+	frameLongStart  = 0x68
+	frameStop       = 0x16
+)
+
+// C (control) field values
+const (
+	CSndNke = 0x40
+	CReqUD2 = 0x5B
+	CRspUD  = 0x08
+	// CFCB is the frame count bit. It is toggled on each REQ_UD2 to request
+	// the next telegram of a multi telegram response.
+	CFCB = 0x20
+)
+
+// CI (control information) field values
+const (
+	CIRspVariable      = 0x72
+	CIRspVariableShort = 0x7A
+)
+
+// Special addresses
+const (
+	AddressUnconfigured = 0
+	AddressMax          = 250
+	AddressNetworkLayer = 253
+	AddressBroadcast    = 254
+	AddressBroadcastAll = 255
+)
+
+// Errors
+var (
+	ErrNoResponse = errors.New("no response")
+	ErrChecksum   = errors.New("checksum error")
+)
+
+// Frame is an M-Bus telegram. Frames without a CI field or data are sent as
+// short frames.
+type Frame struct {
+	C    byte
+	A    byte
+	CI   byte
+	Data []byte
+	Long bool
+}
+
+func checksum(b []byte) byte {
+	var ret byte
+	for _, v := range b {
+		ret += v
+	}
+	return ret
+}
+
+// Encode returns the frame bytes
+func (f Frame) Encode() []byte {
+	if !f.Long {
+		return []byte{frameShortStart, f.C, f.A, checksum([]byte{f.C, f.A}), frameStop}
+	}
+
+	l := 3 + len(f.Data)
+	ret := make([]byte, 0, l+6)
+	ret = append(ret, frameLongStart, byte(l), byte(l), frameLongStart, f.C, f.A, f.CI)
+	ret = append(ret, f.Data...)
+	ret = append(ret, checksum(ret[4:]), frameStop)
+	return ret
+}
+
+// DecodeFrame decodes a short or long frame. The single character ACK is not
+// a frame and must be checked for before calling DecodeFrame.
+func DecodeFrame(b []byte) (Frame, error) {
+	if len(b) < 5 {
+		return Frame{}, fmt.Errorf("frame too short: %v bytes", len(b))
+	}
+
+	switch b[0] {
+	case frameShortStart:
+		if b[4] != frameStop {
+			return Frame{}, errors.New("missing stop character")
+		}
+		if checksum(b[1:3]) != b[3] {
+			return Frame{}, ErrChecksum
+		}
+		return Frame{C: b[1], A: b[2]}, nil
+
+	case frameLongStart:
+		l := int(b[1])
+		if b[2] != b[1] || b[3] != frameLongStart || l < 3 {
+			return Frame{}, errors.New("invalid long frame header")
+		}
+		if len(b) < l+6 {
+			return Frame{}, fmt.Errorf("frame too short, expected %v bytes, got %v",
+				l+6, len(b))
+		}
+		if b[l+5] != frameStop {
+			return Frame{}, errors.New("missing stop character")
+		}
+		if checksum(b[4:l+4]) != b[l+4] {
+			return Frame{}, ErrChecksum
+		}
+		return Frame{
+			C:    b[4],
+			A:    b[5],
+			CI:   b[6],
+			Data: append([]byte{}, b[7:l+4]...),
+			Long: true,
+		}, nil
+
+	default:
+		return Frame{}, fmt.Errorf("invalid start character: 0x%02x", b[0])
+	}
+}
@@ -0,0 +1,56 @@
+package mbus
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestShortFrame(t *testing.T) {
+	f := Frame{C: CReqUD2 | CFCB, A: 1}
+
+	b := f.Encode()
+	exp := []byte{0x10, 0x7B, 0x01, 0x7C, 0x16}
+	if !cmp.Equal(b, exp) {
+		t.Fatalf("Encode: expected % x, got % x", exp, b)
+	}
+
+	f2, err := DecodeFrame(b)
+	if err != nil {
+		t.Fatal("Decode error: ", err)
+	}
+
+	if !cmp.Equal(f, f2) {
+		t.Error("Decoded frame does not match: ", f2)
+	}
+}
+
+func TestLongFrame(t *testing.T) {
+	f := Frame{C: CRspUD, A: 5, CI: CIRspVariable, Data: []byte{1, 2, 3}, Long: true}
+
+	b := f.Encode()
+	exp := []byte{0x68, 0x06, 0x06, 0x68, 0x08, 0x05, 0x72, 0x01, 0x02, 0x03, 0x85, 0x16}
+	if !cmp.Equal(b, exp) {
+		t.Fatalf("Encode: expected % x, got % x", exp, b)
+	}
+
+	f2, err := DecodeFrame(b)
+	if err != nil {
+		t.Fatal("Decode error: ", err)
+	}
+
+	if !cmp.Equal(f, f2) {
+		t.Error("Decoded frame does not match: ", f2)
+	}
+
+	b[8]++
+	_, err = DecodeFrame(b)
+	if err != ErrChecksum {
+		t.Error("Expected checksum error, got: ", err)
+	}
+
+	_, err = DecodeFrame(b[:8])
+	if err == nil {
+		t.Error("Expected error for truncated frame")
+	}
+}
@@ -0,0 +1,226 @@
+package mbus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/simpleiot/simpleiot/test"
+)
+
+// maxTelegrams limits the number of telegrams read from a meter that
+// indicates more records are available
+const maxTelegrams = 10
+
+// Master reads meters on an M-Bus. Master methods may be called from
+// multiple goroutines, requests are sent one at a time.
+type Master struct {
+	port  io.ReadWriter
+	debug int
+	lock  sync.Mutex
+	// fcb is the frame count bit sent in the next REQ_UD2 to each address
+	fcb map[byte]bool
+}
+
+// NewMaster is used to create a new M-Bus master. port must return an entire
+// response for each Read() and io.EOF if no response is received.
+// github.com/simpleiot/simpleiot/respreader is a good way to do this.
+func NewMaster(port io.ReadWriter, debug int) *Master {
+	return &Master{
+		port:  port,
+		debug: debug,
+		fcb:   make(map[byte]bool),
+	}
+}
+
+// SetDebugLevel allows you to change debug level on the fly
+func (m *Master) SetDebugLevel(debug int) {
+	m.debug = debug
+}
+
+// portError is returned when the port fails, as opposed to a meter not
+// responding or responding with bad data
+type portError struct {
+	err error
+}
+
+func (pe portError) Error() string {
+	return pe.err.Error()
+}
+
+func (pe portError) Unwrap() error {
+	return pe.err
+}
+
+// transact sends a frame and returns the response. An ACK is returned as
+// a nil frame.
+func (m *Master) transact(req Frame) (*Frame, error) {
+	packet := req.Encode()
+
+	if m.debug >= 9 {
+		fmt.Printf("M-Bus tx: %v\n", test.HexDump(packet))
+	}
+
+	_, err := m.port.Write(packet)
+	if err != nil {
+		return nil, portError{err}
+	}
+
+	buf := make([]byte, 255+6)
+	cnt, err := m.port.Read(buf)
+	if cnt == 0 {
+		if err == nil || errors.Is(err, io.EOF) {
+			return nil, ErrNoResponse
+		}
+		return nil, portError{err}
+	}
+
+	buf = buf[:cnt]
+
+	if m.debug >= 9 {
+		fmt.Printf("M-Bus rx: %v\n", test.HexDump(buf))
+	}
+
+	if buf[0] == frameACK {
+		if len(buf) > 1 {
+			// more than one meter answered
+			return nil, errors.New("collision")
+		}
+		return nil, nil
+	}
+
+	f, err := DecodeFrame(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// Ping sends SND_NKE to a meter and waits for the ACK. This also resets the
+// meter's communication state so the next read starts with the first
+// telegram.
+func (m *Master) Ping(address byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.ping(address)
+}
+
+func (m *Master) ping(address byte) error {
+	resp, err := m.transact(Frame{C: CSndNke, A: address})
+	if err != nil {
+		return err
+	}
+
+	if resp != nil {
+		return errors.New("expected ACK")
+	}
+
+	m.fcb[address] = true
+	return nil
+}
+
+// ReadData reads all data records from a meter. If the meter splits its data
+// across several telegrams, they are requested in turn and the records
+// combined.
+func (m *Master) ReadData(address byte) (*Response, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.debug >= 1 {
+		fmt.Printf("M-Bus read data from %v\n", address)
+	}
+
+	var ret *Response
+
+	for i := 0; i < maxTelegrams; i++ {
+		c := byte(CReqUD2)
+		if m.fcb[address] {
+			c |= CFCB
+		}
+
+		resp, err := m.transact(Frame{C: c, A: address})
+		if err != nil {
+			return nil, err
+		}
+
+		if resp == nil || !resp.Long || resp.C&0x0F != CRspUD {
+			return nil, errors.New("expected RSP_UD")
+		}
+
+		if resp.A != address && address != AddressNetworkLayer {
+			return nil, fmt.Errorf("response from wrong address: %v", resp.A)
+		}
+
+		// the response was received, so the next telegram is requested
+		// with the other FCB value
+		m.fcb[address] = !m.fcb[address]
+
+		r, err := DecodeResponse(*resp)
+		if err != nil {
+			return nil, err
+		}
+
+		if ret == nil {
+			ret = r
+		} else {
+			ret.Records = append(ret.Records, r.Records...)
+		}
+
+		if !r.MoreRecords {
+			ret.MoreRecords = false
+			return ret, nil
+		}
+	}
+
+	ret.MoreRecords = true
+	return ret, nil
+}
+
+// Scan sends SND_NKE to each primary address from start to end and returns
+// the addresses that responded. found is called (if not nil) as each meter
+// is found so progress can be displayed.
+func (m *Master) Scan(start, end byte, found func(address byte)) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if end > AddressMax {
+		end = AddressMax
+	}
+
+	var ret []byte
+
+	for a := int(start); a <= int(end); a++ {
+		address := byte(a)
+		// meters may miss the first request after being idle, so try twice
+		var err error
+		for try := 0; try < 2; try++ {
+			err = m.ping(address)
+			if err != ErrNoResponse {
+				break
+			}
+		}
+
+		var pErr portError
+		switch {
+		case err == ErrNoResponse:
+			continue
+		case errors.As(err, &pErr):
+			return ret, err
+		case err != nil:
+			// something answered, even if it was garbled
+			if m.debug >= 1 {
+				fmt.Printf("M-Bus scan address %v: %v\n", address, err)
+			}
+		}
+
+		ret = append(ret, address)
+		if found != nil {
+			found(address)
+		}
+	}
+
+	return ret, nil
+}
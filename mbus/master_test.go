@@ -0,0 +1,124 @@
+package mbus
+
+import (
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testMeter simulates meters on a bus. Each Write is a request and the
+// response is returned by the next Read.
+type testMeter struct {
+	// telegrams sent by the meter at address 5 in turn
+	telegrams [][]byte
+	next      int
+	fcb       bool
+	resp      []byte
+	requests  []byte
+}
+
+func (tm *testMeter) Write(b []byte) (int, error) {
+	f, err := DecodeFrame(b)
+	if err != nil {
+		return 0, err
+	}
+
+	tm.requests = append(tm.requests, f.C)
+	tm.resp = nil
+
+	switch {
+	case f.A == 7 && f.C == CSndNke:
+		// meter with a bad line that garbles its ACK
+		tm.resp = []byte{0xE5, 0x00}
+	case f.A != 5:
+		// no meter
+	case f.C == CSndNke:
+		tm.next = 0
+		tm.fcb = true
+		tm.resp = []byte{frameACK}
+	case f.C&^CFCB == CReqUD2:
+		// a new telegram is only sent if the FCB toggled, otherwise the
+		// master did not receive the last one
+		fcb := f.C&CFCB != 0
+		if fcb != tm.fcb && tm.next > 0 {
+			tm.next--
+		}
+		tm.fcb = !fcb
+		tm.resp = Frame{C: CRspUD, A: 5, CI: CIRspVariable,
+			Data: tm.telegrams[tm.next], Long: true}.Encode()
+		if tm.next < len(tm.telegrams)-1 {
+			tm.next++
+		}
+	}
+
+	return len(b), nil
+}
+
+func (tm *testMeter) Read(b []byte) (int, error) {
+	if tm.resp == nil {
+		return 0, io.EOF
+	}
+	n := copy(b, tm.resp)
+	tm.resp = nil
+	return n, nil
+}
+
+var testHeader = []byte{0x78, 0x56, 0x34, 0x12, 0x2D, 0x2C, 0x01, 0x04, 0x05, 0x00, 0x00, 0x00}
+
+func TestMasterReadData(t *testing.T) {
+	meter := &testMeter{
+		telegrams: [][]byte{
+			append(append([]byte{}, testHeader...), 0x04, 0x03, 0x01, 0x00, 0x00, 0x00, 0x1F),
+			append(append([]byte{}, testHeader...), 0x04, 0x13, 0x02, 0x00, 0x00, 0x00, 0x0F),
+		},
+	}
+
+	m := NewMaster(meter, 0)
+
+	err := m.Ping(5)
+	if err != nil {
+		t.Fatal("Ping error: ", err)
+	}
+
+	r, err := m.ReadData(5)
+	if err != nil {
+		t.Fatal("ReadData error: ", err)
+	}
+
+	if len(r.Records) != 2 || r.MoreRecords {
+		t.Fatalf("Expected records from both telegrams, got: %+v", r)
+	}
+
+	if r.Records[0].Quantity != QuantityEnergy || r.Records[1].Quantity != QuantityVolume {
+		t.Errorf("Unexpected records: %+v", r.Records)
+	}
+
+	exp := []byte{CSndNke, CReqUD2 | CFCB, CReqUD2}
+	if !cmp.Equal(meter.requests, exp) {
+		t.Errorf("Expected requests % x, got % x", exp, meter.requests)
+	}
+
+	_, err = m.ReadData(6)
+	if err != ErrNoResponse {
+		t.Error("Expected no response, got: ", err)
+	}
+}
+
+func TestMasterScan(t *testing.T) {
+	meter := &testMeter{}
+	m := NewMaster(meter, 0)
+
+	var found []byte
+	addresses, err := m.Scan(1, 10, func(a byte) {
+		found = append(found, a)
+	})
+	if err != nil {
+		t.Fatal("Scan error: ", err)
+	}
+
+	exp := []byte{5, 7}
+	if !cmp.Equal(addresses, exp) || !cmp.Equal(found, exp) {
+		t.Errorf("Expected addresses %v, got %v, %v", exp, addresses, found)
+	}
+}
@@ -2,6 +2,7 @@ package modbus
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -16,7 +17,8 @@ const (
 )
 
 // Modbus is a type that implements modbus ascii communication.
-// Currently, only "sniffing" a network is implemented
+// It is used for "sniffing" a network. See ASCII for a Transport
+// that can be used with Client and Server.
 type Modbus struct {
 	io      io.ReadWriter
 	bufRead *bufio.Reader
@@ -47,14 +49,20 @@ type ASCIIADU struct {
 
 // CheckLRC verifies the LRC is valid
 func (adu *ASCIIADU) CheckLRC() bool {
+	lrc := LRC(append([]byte{adu.Address, byte(adu.FunctionCode)}, adu.Data...))
+	return lrc == adu.LRC
+}
+
+// LRC calculates the longitudinal redundancy check used by Modbus ASCII.
+// It is the two's complement of the 8-bit sum of the binary (not hex
+// encoded) address, function code, and data bytes.
+func LRC(data []byte) byte {
 	var sum byte
-	sum += adu.Address
-	sum += byte(adu.FunctionCode)
-	for _, b := range adu.Data {
+	for _, b := range data {
 		sum += b
 	}
 
-	return byte(-int8(sum)) == adu.LRC
+	return -sum
 }
 
 // DecodeFunctionData extracts the function data from the PDU
@@ -204,3 +212,111 @@ func DecodeASCIIPDU(data []byte) (ret ASCIIADU, err error) {
 
 	return
 }
+
+// ASCII defines a Modbus ASCII connection and implements Transport
+type ASCII struct {
+	port io.ReadWriteCloser
+	// rx holds data received after the start of a frame until the end
+	// of the frame is found
+	rx []byte
+	// pending holds data read from the port that has not been processed
+	pending []byte
+}
+
+// NewASCII creates a new ASCII transport. Unlike RTU, frames are delimited
+// by start and end characters, so port reads do not have to return entire
+// packets. However, port reads should time out (respreader works well) so
+// a client does not block forever if a device does not respond.
+func NewASCII(port io.ReadWriteCloser) *ASCII {
+	return &ASCII{
+		port: port,
+	}
+}
+
+// Read returns one entire ASCII frame, including the start and end
+// characters. Any data received before a start character is discarded.
+func (a *ASCII) Read(p []byte) (int, error) {
+	for {
+		for i, b := range a.pending {
+			if b == asciiStart {
+				// a start char always begins a new frame
+				a.rx = []byte{}
+			} else if a.rx == nil {
+				// waiting for start of frame
+				continue
+			}
+
+			a.rx = append(a.rx, b)
+
+			if len(a.rx) > asciiMaxSize {
+				a.rx = nil
+				a.pending = a.pending[i+1:]
+				return 0, errors.New("ASCII frame exceeds max size")
+			}
+
+			if bytes.HasSuffix(a.rx, []byte(asciiEnd)) {
+				frame := a.rx
+				a.rx = nil
+				a.pending = a.pending[i+1:]
+				if len(frame) > len(p) {
+					return 0, fmt.Errorf("ASCII frame too large, %v bytes", len(frame))
+				}
+				return copy(p, frame), nil
+			}
+		}
+
+		buf := make([]byte, asciiMaxSize)
+		cnt, err := a.port.Read(buf)
+		if err != nil {
+			// discard partial frames so we resync on the next start
+			a.rx = nil
+			a.pending = nil
+			return 0, err
+		}
+
+		a.pending = buf[:cnt]
+	}
+}
+
+func (a *ASCII) Write(p []byte) (int, error) {
+	return a.port.Write(p)
+}
+
+// Close closes the serial port
+func (a *ASCII) Close() error {
+	return a.port.Close()
+}
+
+// Encode encodes an ASCII packet
+func (a *ASCII) Encode(id byte, pdu PDU) ([]byte, error) {
+	bin := make([]byte, 0, len(pdu.Data)+3)
+	bin = append(bin, id, byte(pdu.FunctionCode))
+	bin = append(bin, pdu.Data...)
+	bin = append(bin, LRC(bin))
+
+	ret := make([]byte, 0, 1+len(bin)*2+len(asciiEnd))
+	ret = append(ret, asciiStart)
+	ret = append(ret, bytes.ToUpper([]byte(hex.EncodeToString(bin)))...)
+	ret = append(ret, asciiEnd...)
+
+	if len(ret) > asciiMaxSize {
+		return nil, fmt.Errorf("ASCII packet too large, %v bytes", len(ret))
+	}
+
+	return ret, nil
+}
+
+// Decode decodes an ASCII packet
+func (a *ASCII) Decode(packet []byte) (byte, PDU, error) {
+	adu, err := DecodeASCIIPDU(packet)
+	if err != nil {
+		return 0, PDU{}, err
+	}
+
+	return adu.Address, PDU{FunctionCode: adu.FunctionCode, Data: adu.Data}, nil
+}
+
+// Type returns TransportType
+func (a *ASCII) Type() TransportType {
+	return TransportTypeASCII
+}
@@ -3,8 +3,14 @@ package modbus
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"log"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/respreader"
+	"github.com/simpleiot/simpleiot/test"
 )
 
 // the below data is Modbus ASCII
@@ -222,3 +228,86 @@ func TestASCIIDecode3(t *testing.T) {
 	}
 
 }
+
+func TestASCIIEncode(t *testing.T) {
+	a := NewASCII(nil)
+
+	packet, err := a.Encode(3, ReadHoldingRegs(0, 6))
+	if err != nil {
+		t.Fatal("Error encoding: ", err)
+	}
+
+	if !bytes.Equal(testData1, packet) {
+		t.Fatalf("Encoded packet is not correct, got: %q", packet)
+	}
+
+	id, pdu, err := a.Decode(packet)
+	if err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+
+	if id != 3 || pdu.FunctionCode != FuncCodeReadHoldingRegisters ||
+		!bytes.Equal(pdu.Data, []byte{0, 0, 0, 6}) {
+		t.Fatalf("Decoded packet is not correct: %v, %v", id, pdu)
+	}
+}
+
+func TestASCIIRead(t *testing.T) {
+	// frames preceded by noise and a partial frame
+	in := append([]byte("xx:0103"), testData1...)
+	in = append(in, testData2...)
+	a := NewASCII(nopCloser{bytes.NewBuffer(in)})
+
+	buf := make([]byte, MaxADUSize)
+
+	for _, exp := range [][]byte{testData1, testData2} {
+		cnt, err := a.Read(buf)
+		if err != nil {
+			t.Fatal("Error reading: ", err)
+		}
+
+		if !bytes.Equal(exp, buf[:cnt]) {
+			t.Fatalf("Wrong frame, got: %q", buf[:cnt])
+		}
+	}
+}
+
+func TestASCIIEndToEnd(t *testing.T) {
+	id := byte(1)
+
+	a, b := test.NewIoSim()
+
+	portA := respreader.NewReadWriteCloser(a, time.Second*2,
+		5*time.Millisecond)
+	regs := &Regs{}
+	slave := NewServer(id, NewASCII(portA), regs, 9)
+	regs.AddReg(2, 2)
+
+	go slave.Listen(func(err error) {
+		log.Println("modbus server listen error:", err)
+	}, func() {}, func() {})
+
+	portB := respreader.NewReadWriteCloser(b, time.Second*2,
+		5*time.Millisecond)
+	master := NewClient(NewASCII(portB), 9)
+
+	err := master.WriteMultipleRegs(id, 2, []uint16{0x1234, 0xabcd})
+	if err != nil {
+		t.Fatal("write regs returned err: ", err)
+	}
+
+	hr, err := master.ReadHoldingRegs(id, 2, 2)
+	if err != nil {
+		t.Fatal("read holding regs returned err: ", err)
+	}
+
+	if !reflect.DeepEqual(hr, []uint16{0x1234, 0xabcd}) {
+		t.Fatalf("wrong reg values: %v", hr)
+	}
+}
+
+type nopCloser struct {
+	io.ReadWriter
+}
+
+func (nopCloser) Close() error { return nil }
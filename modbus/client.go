@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/simpleiot/simpleiot/test"
 )
 
 // Client defines a Modbus client (master)
+// Client methods may be called from multiple goroutines, transactions are
+// sent one at a time.
 type Client struct {
 	transport Transport
 	debug     int
+	lock      sync.Mutex
 }
 
 // NewClient is used to create a new modbus client
@@ -35,96 +39,88 @@ func (c *Client) Close() error {
 	return c.transport.Close()
 }
 
-// ReadCoils is used to read modbus coils
-func (c *Client) ReadCoils(id byte, coil, count uint16) ([]bool, error) {
-	ret := []bool{}
-	req := ReadCoils(coil, count)
+// transact sends a request to a device and returns the response. If the
+// device responds with an exception, the ExceptionCode is returned as the
+// error. name is only used for debug output.
+func (c *Client) transact(name string, id byte, req PDU) (PDU, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	if c.debug >= 1 {
-		fmt.Printf("Modbus client Readcoils ID:0x%x req:%v\n", id, req)
+		fmt.Printf("Modbus client %v ID:0x%x req:%v\n", name, id, req)
 	}
 	packet, err := c.transport.Encode(id, req)
 	if err != nil {
-		return ret, err
+		return PDU{}, err
 	}
 
 	if c.debug >= 9 {
-		fmt.Println("Modbus client ReadCoils tx: ", test.HexDump(packet))
+		fmt.Printf("Modbus client %v tx: %v\n", name, test.HexDump(packet))
 	}
 
 	_, err = c.transport.Write(packet)
 	if err != nil {
-		return ret, err
+		return PDU{}, err
 	}
 
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
+	buf := make([]byte, MaxADUSize)
 	cnt, err := c.transport.Read(buf)
 	if err != nil {
-		return ret, err
+		return PDU{}, err
 	}
 
 	buf = buf[:cnt]
 
 	if c.debug >= 9 {
-		fmt.Println("Modbus client ReadCoils rx: ", test.HexDump(buf))
+		fmt.Printf("Modbus client %v rx: %v\n", name, test.HexDump(buf))
 	}
 
 	_, resp, err := c.transport.Decode(buf)
 	if err != nil {
-		return ret, err
+		return PDU{}, err
 	}
 
 	if c.debug >= 1 {
-		fmt.Printf("Modbus client Readcoils ID:0x%x resp:%v\n", id, resp)
+		fmt.Printf("Modbus client %v ID:0x%x resp:%v\n", name, id, resp)
 	}
 
-	return resp.RespReadBits()
-}
-
-// WriteSingleCoil is used to read modbus coils
-func (c *Client) WriteSingleCoil(id byte, coil uint16, v bool) error {
-	req := WriteSingleCoil(coil, v)
-	if c.debug >= 1 {
-		fmt.Printf("Modbus client WriteSingleCoil ID:0x%x req:%v\n", id, req)
-	}
-	packet, err := c.transport.Encode(id, req)
-	if err != nil {
-		return fmt.Errorf("RtuEncode error: %w", err)
+	if resp.FunctionCode == req.FunctionCode|0x80 {
+		if len(resp.Data) < 1 {
+			return PDU{}, errors.New("exception response is missing code")
+		}
+		return PDU{}, ExceptionCode(resp.Data[0])
 	}
 
-	if c.debug >= 9 {
-		fmt.Println("Modbus client WriteSingleCoil tx: ", test.HexDump(packet))
-	}
-
-	_, err = c.transport.Write(packet)
-	if err != nil {
-		return err
-	}
-
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
-	cnt, err := c.transport.Read(buf)
-	if err != nil {
-		return err
+	if resp.FunctionCode != req.FunctionCode {
+		return PDU{}, errors.New("resp contains wrong function code")
 	}
 
-	buf = buf[:cnt]
+	return resp, nil
+}
 
-	if c.debug >= 9 {
-		fmt.Println("Modbus client WriteSingleCoil rx: ", test.HexDump(buf))
-	}
+// Transact sends a raw request to a device and returns the response. If the
+// device responds with an exception, the ExceptionCode is returned as the
+// error.
+func (c *Client) Transact(id byte, req PDU) (PDU, error) {
+	return c.transact(fmt.Sprintf("FC%v", int(req.FunctionCode)), id, req)
+}
 
-	_, resp, err := c.transport.Decode(buf)
+// ReadCoils is used to read modbus coils
+func (c *Client) ReadCoils(id byte, coil, count uint16) ([]bool, error) {
+	resp, err := c.transact("ReadCoils", id, ReadCoils(coil, count))
 	if err != nil {
-		return fmt.Errorf("RtuDecode error: %w", err)
+		return []bool{}, err
 	}
 
-	if c.debug >= 1 {
-		fmt.Printf("Modbus client WriteSingleCoil ID:0x%x resp:%v\n", id, resp)
-	}
+	return resp.respReadBits(int(count))
+}
 
-	if resp.FunctionCode != req.FunctionCode {
-		return errors.New("resp contains wrong function code")
+// WriteSingleCoil is used to write a modbus coil
+func (c *Client) WriteSingleCoil(id byte, coil uint16, v bool) error {
+	req := WriteSingleCoil(coil, v)
+	resp, err := c.transact("WriteSingleCoil", id, req)
+	if err != nil {
+		return err
 	}
 
 	if !bytes.Equal(req.Data, resp.Data) {
@@ -134,151 +130,51 @@ func (c *Client) WriteSingleCoil(id byte, coil uint16, v bool) error {
 	return nil
 }
 
-// ReadDiscreteInputs is used to read modbus discrete inputs
-func (c *Client) ReadDiscreteInputs(id byte, input, count uint16) ([]bool, error) {
-	ret := []bool{}
-	req := ReadDiscreteInputs(input, count)
-	if c.debug >= 1 {
-		fmt.Printf("Modbus client ReadDiscreteInputs ID:0x%x req:%v\n", id, req)
-	}
-	packet, err := c.transport.Encode(id, req)
-	if err != nil {
-		return ret, err
-	}
-
-	if c.debug >= 9 {
-		fmt.Println("Modbus client ReadDiscreteInputs tx: ", test.HexDump(packet))
+// WriteMultipleCoils is used to write a sequence of modbus coils
+// in one transaction (function code 15)
+func (c *Client) WriteMultipleCoils(id byte, coil uint16, values []bool) error {
+	if len(values) < 1 || len(values) > MaxWriteCoils {
+		return fmt.Errorf("invalid coil count: %v", len(values))
 	}
 
-	_, err = c.transport.Write(packet)
+	req := WriteMultipleCoils(coil, values)
+	resp, err := c.transact("WriteMultipleCoils", id, req)
 	if err != nil {
-		return ret, err
+		return err
 	}
 
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
-	cnt, err := c.transport.Read(buf)
-	if err != nil {
-		return ret, err
+	if !bytes.Equal(req.Data[:4], resp.Data) {
+		return errors.New("Did not get the correct response data")
 	}
 
-	buf = buf[:cnt]
-
-	if c.debug >= 9 {
-		fmt.Println("Modbus client ReadDiscreteInputs rx: ", test.HexDump(buf))
-	}
+	return nil
+}
 
-	_, resp, err := c.transport.Decode(buf)
+// ReadDiscreteInputs is used to read modbus discrete inputs
+func (c *Client) ReadDiscreteInputs(id byte, input, count uint16) ([]bool, error) {
+	resp, err := c.transact("ReadDiscreteInputs", id, ReadDiscreteInputs(input, count))
 	if err != nil {
-		return ret, err
-	}
-
-	if c.debug >= 1 {
-		fmt.Printf("Modbus client ReadDiscreteInputs ID:0x%x resp:%v\n", id, resp)
-	}
-
-	if resp.FunctionCode != req.FunctionCode {
-		return []bool{}, errors.New("resp contains wrong function code")
+		return []bool{}, err
 	}
 
-	return resp.RespReadBits()
+	return resp.respReadBits(int(count))
 }
 
-// ReadHoldingRegs is used to read modbus coils
+// ReadHoldingRegs is used to read modbus holding registers
 func (c *Client) ReadHoldingRegs(id byte, reg, count uint16) ([]uint16, error) {
-	ret := []uint16{}
-	req := ReadHoldingRegs(reg, count)
-	if c.debug >= 1 {
-		fmt.Printf("Modbus client ReadHoldingRegs ID:0x%x req:%v\n", id, req)
-	}
-	packet, err := c.transport.Encode(id, req)
+	resp, err := c.transact("ReadHoldingRegs", id, ReadHoldingRegs(reg, count))
 	if err != nil {
-		return ret, err
-	}
-
-	if c.debug >= 9 {
-		fmt.Println("Modbus client ReadHoldingRegs tx: ", test.HexDump(packet))
-	}
-
-	_, err = c.transport.Write(packet)
-	if err != nil {
-		return ret, err
-	}
-
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
-	cnt, err := c.transport.Read(buf)
-	if err != nil {
-		return ret, err
-	}
-
-	buf = buf[:cnt]
-
-	if c.debug >= 9 {
-		fmt.Println("Modbus client ReadHoldingRegs rx: ", test.HexDump(buf))
-	}
-
-	_, resp, err := c.transport.Decode(buf)
-	if err != nil {
-		return ret, err
-	}
-
-	if c.debug >= 1 {
-		fmt.Printf("Modbus client ReadHoldingRegs ID:0x%x resp:%v\n", id, resp)
-	}
-
-	if resp.FunctionCode != req.FunctionCode {
-		return []uint16{}, errors.New("resp contains wrong function code")
+		return []uint16{}, err
 	}
 
 	return resp.RespReadRegs()
 }
 
-// ReadInputRegs is used to read modbus coils
+// ReadInputRegs is used to read modbus input registers
 func (c *Client) ReadInputRegs(id byte, reg, count uint16) ([]uint16, error) {
-	ret := []uint16{}
-	req := ReadInputRegs(reg, count)
-	if c.debug >= 1 {
-		fmt.Printf("Modbus client ReadInputRegs ID:0x%x req:%v\n", id, req)
-	}
-	packet, err := c.transport.Encode(id, req)
-	if err != nil {
-		return ret, err
-	}
-
-	if c.debug >= 9 {
-		fmt.Println("Modbus client ReadInputRegs tx: ", test.HexDump(packet))
-	}
-
-	_, err = c.transport.Write(packet)
-	if err != nil {
-		return ret, err
-	}
-
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
-	cnt, err := c.transport.Read(buf)
+	resp, err := c.transact("ReadInputRegs", id, ReadInputRegs(reg, count))
 	if err != nil {
-		return ret, err
-	}
-
-	buf = buf[:cnt]
-
-	if c.debug >= 9 {
-		fmt.Println("Modbus client ReadInputRegs rx: ", test.HexDump(buf))
-	}
-
-	_, resp, err := c.transport.Decode(buf)
-	if err != nil {
-		return ret, err
-	}
-
-	if c.debug >= 1 {
-		fmt.Printf("Modbus client ReadInputRegs ID:0x%x resp:%v\n", id, resp)
-	}
-
-	if resp.FunctionCode != req.FunctionCode {
-		return []uint16{}, errors.New("resp contains wrong function code")
+		return []uint16{}, err
 	}
 
 	return resp.RespReadRegs()
@@ -287,52 +183,74 @@ func (c *Client) ReadInputRegs(id byte, reg, count uint16) ([]uint16, error) {
 // WriteSingleReg writes to a single holding register
 func (c *Client) WriteSingleReg(id byte, reg, value uint16) error {
 	req := WriteSingleReg(reg, value)
-	if c.debug >= 1 {
-		fmt.Printf("Modbus client WriteSingleReg ID:0x%x req:%v\n", id, req)
-	}
-	packet, err := c.transport.Encode(id, req)
+	resp, err := c.transact("WriteSingleReg", id, req)
 	if err != nil {
 		return err
 	}
 
-	if c.debug >= 9 {
-		fmt.Println("Modbus client WriteSingleReg tx: ", test.HexDump(packet))
+	if !bytes.Equal(req.Data, resp.Data) {
+		return errors.New("Did not get the correct response data")
 	}
 
-	_, err = c.transport.Write(packet)
-	if err != nil {
-		return err
+	return nil
+}
+
+// WriteMultipleRegs writes a sequence of holding registers in one
+// transaction (function code 16). This should be used for values that span
+// more than one register so the device sees the update atomically.
+func (c *Client) WriteMultipleRegs(id byte, reg uint16, values []uint16) error {
+	if len(values) < 1 || len(values) > MaxWriteRegs {
+		return fmt.Errorf("invalid register count: %v", len(values))
 	}
 
-	// FIXME, what is max modbus packet size?
-	buf := make([]byte, 200)
-	cnt, err := c.transport.Read(buf)
+	req := WriteMultipleRegs(reg, values)
+	resp, err := c.transact("WriteMultipleRegs", id, req)
 	if err != nil {
 		return err
 	}
 
-	buf = buf[:cnt]
-
-	if c.debug >= 9 {
-		fmt.Println("Modbus client WriteSingleReg rx: ", test.HexDump(buf))
+	if !bytes.Equal(req.Data[:4], resp.Data) {
+		return errors.New("Did not get the correct response data")
 	}
 
-	_, resp, err := c.transport.Decode(buf)
+	return nil
+}
+
+// MaskWriteReg changes bits in a holding register in one transaction
+// (function code 22). Bits that are cleared in andMask are set to the bits in
+// orMask, the other bits are not changed.
+func (c *Client) MaskWriteReg(id byte, reg, andMask, orMask uint16) error {
+	req := MaskWriteReg(reg, andMask, orMask)
+	resp, err := c.transact("MaskWriteReg", id, req)
 	if err != nil {
 		return err
 	}
 
-	if c.debug >= 1 {
-		fmt.Printf("Modbus client WriteSingleReg ID:0x%x resp:%v\n", id, resp)
+	if !bytes.Equal(req.Data, resp.Data) {
+		return errors.New("Did not get the correct response data")
 	}
 
-	if resp.FunctionCode != req.FunctionCode {
-		return errors.New("resp contains wrong function code")
+	return nil
+}
+
+// ReadWriteMultipleRegs writes a sequence of holding registers and then
+// reads a sequence of holding registers in one transaction
+// (function code 23).
+func (c *Client) ReadWriteMultipleRegs(id byte, readReg, readCount,
+	writeReg uint16, values []uint16) ([]uint16, error) {
+	if readCount < 1 || readCount > MaxReadWriteReadRegs {
+		return []uint16{}, fmt.Errorf("invalid read register count: %v", readCount)
 	}
 
-	if !bytes.Equal(req.Data, resp.Data) {
-		return errors.New("Did not get the correct response data")
+	if len(values) < 1 || len(values) > MaxReadWriteWriteRegs {
+		return []uint16{}, fmt.Errorf("invalid write register count: %v", len(values))
 	}
 
-	return nil
+	resp, err := c.transact("ReadWriteMultipleRegs", id,
+		ReadWriteMultipleRegs(readReg, readCount, writeReg, values))
+	if err != nil {
+		return []uint16{}, err
+	}
+
+	return resp.RespReadRegs()
 }
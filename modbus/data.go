@@ -195,3 +195,134 @@ func Float32ToRegsSwapWords(in []float32) []uint16 {
 
 	return ret
 }
+
+// ByteOrder describes how the bytes of a multi-register value are
+// arranged in the registers. For a 32-bit value with bytes A (most
+// significant) through D (least significant), the name is the order
+// the bytes appear on the wire. For 64-bit values the same pattern is
+// extended across four registers.
+type ByteOrder string
+
+// define valid byte orders
+const (
+	// ByteOrderABCD is big endian, the modbus default
+	ByteOrderABCD ByteOrder = "ABCD"
+	// ByteOrderCDAB is big endian bytes with the word order swapped
+	ByteOrderCDAB ByteOrder = "CDAB"
+	// ByteOrderBADC is big endian word order with bytes in each word swapped
+	ByteOrderBADC ByteOrder = "BADC"
+	// ByteOrderDCBA is little endian
+	ByteOrderDCBA ByteOrder = "DCBA"
+)
+
+// ReorderRegs converts the registers for a single value between the
+// given byte order and big endian (ABCD). The conversion is its own
+// inverse, so the same function is used for reading and writing.
+func ReorderRegs(in []uint16, order ByteOrder) []uint16 {
+	ret := make([]uint16, len(in))
+	copy(ret, in)
+
+	switch order {
+	case ByteOrderCDAB, ByteOrderDCBA:
+		for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+			ret[i], ret[j] = ret[j], ret[i]
+		}
+	}
+
+	switch order {
+	case ByteOrderBADC, ByteOrderDCBA:
+		for i := range ret {
+			ret[i] = ret[i]<<8 | ret[i]>>8
+		}
+	}
+
+	return ret
+}
+
+// RegsToUint64 converts modbus regs to uint64 values
+func RegsToUint64(in []uint16) []uint64 {
+	count := len(in) / 4
+	ret := make([]uint64, count)
+	for i := range ret {
+		ret[i] = binary.BigEndian.Uint64(PutUint16Array(in[i*4 : i*4+4]...))
+	}
+
+	return ret
+}
+
+// Uint64ToRegs converts uint64 values to modbus regs
+func Uint64ToRegs(in []uint64) []uint16 {
+	ret := make([]uint16, 0, len(in)*4)
+	for _, v := range in {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, v)
+		ret = append(ret, Uint16Array(buf)...)
+	}
+
+	return ret
+}
+
+// RegsToInt64 converts modbus regs to int64 values
+func RegsToInt64(in []uint16) []int64 {
+	v := RegsToUint64(in)
+	ret := make([]int64, len(v))
+	for i := range v {
+		ret[i] = int64(v[i])
+	}
+
+	return ret
+}
+
+// Int64ToRegs converts int64 values to modbus regs
+func Int64ToRegs(in []int64) []uint16 {
+	v := make([]uint64, len(in))
+	for i := range in {
+		v[i] = uint64(in[i])
+	}
+
+	return Uint64ToRegs(v)
+}
+
+// RegsToFloat64 converts modbus regs to float64 values
+func RegsToFloat64(in []uint16) []float64 {
+	v := RegsToUint64(in)
+	ret := make([]float64, len(v))
+	for i := range v {
+		ret[i] = math.Float64frombits(v[i])
+	}
+
+	return ret
+}
+
+// Float64ToRegs converts float64 values to modbus regs
+func Float64ToRegs(in []float64) []uint16 {
+	v := make([]uint64, len(in))
+	for i := range in {
+		v[i] = math.Float64bits(in[i])
+	}
+
+	return Uint64ToRegs(v)
+}
+
+// RegsToString converts modbus regs to an ASCII string. Each register
+// holds two characters with the first character in the high byte. The
+// string is terminated at the first NUL character.
+func RegsToString(in []uint16) string {
+	buf := PutUint16Array(in...)
+	for i, c := range buf {
+		if c == 0 {
+			return string(buf[:i])
+		}
+	}
+
+	return string(buf)
+}
+
+// StringToRegs converts an ASCII string to count modbus regs. The string
+// is truncated if it is too long, and padded with NUL characters if it
+// is too short.
+func StringToRegs(in string, count int) []uint16 {
+	buf := make([]byte, count*2)
+	copy(buf, in)
+	return Uint16Array(buf)
+}
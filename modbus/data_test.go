@@ -1,6 +1,7 @@
 package modbus
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -49,3 +50,89 @@ func TestRegsToFloat32SwapWords(t *testing.T) {
 		t.Error("Failed: ", exp, f)
 	}
 }
+
+func TestReorderRegs(t *testing.T) {
+	in := []uint16{0x0102, 0x0304}
+
+	for _, test := range []struct {
+		order ByteOrder
+		exp   []uint16
+	}{
+		{ByteOrderABCD, []uint16{0x0102, 0x0304}},
+		{ByteOrderCDAB, []uint16{0x0304, 0x0102}},
+		{ByteOrderBADC, []uint16{0x0201, 0x0403}},
+		{ByteOrderDCBA, []uint16{0x0403, 0x0201}},
+	} {
+		out := ReorderRegs(in, test.order)
+		if !reflect.DeepEqual(out, test.exp) {
+			t.Errorf("%v: expected %x, got %x", test.order, test.exp, out)
+		}
+
+		back := ReorderRegs(out, test.order)
+		if !reflect.DeepEqual(back, in) {
+			t.Errorf("%v: round trip failed, got %x", test.order, back)
+		}
+	}
+
+	f := RegsToFloat32(ReorderRegs([]uint16{0xd70a, 0x3c23}, ByteOrderCDAB))
+	if f[0] != 0.01 {
+		t.Error("CDAB float failed: ", f)
+	}
+}
+
+func TestUint64(t *testing.T) {
+	v := uint64(0x0102030405060708)
+
+	regs := Uint64ToRegs([]uint64{v})
+
+	if !reflect.DeepEqual(regs, []uint16{0x0102, 0x0304, 0x0506, 0x0708}) {
+		t.Errorf("Uint64ToRegs wrong: %x", regs)
+	}
+
+	v2 := RegsToUint64(regs)
+
+	if v != v2[0] {
+		t.Error("Failed: ", v, v2[0])
+	}
+
+	regs = ReorderRegs(regs, ByteOrderDCBA)
+	if !reflect.DeepEqual(regs, []uint16{0x0807, 0x0605, 0x0403, 0x0201}) {
+		t.Errorf("DCBA reorder wrong: %x", regs)
+	}
+}
+
+func TestInt64(t *testing.T) {
+	v := int64(-41234562312345)
+
+	v2 := RegsToInt64(Int64ToRegs([]int64{v}))
+
+	if v != v2[0] {
+		t.Error("Failed: ", v, v2[0])
+	}
+}
+
+func TestFloat64(t *testing.T) {
+	v := 2124.23e118
+
+	v2 := RegsToFloat64(Float64ToRegs([]float64{v}))
+
+	if v != v2[0] {
+		t.Error("Failed: ", v, v2[0])
+	}
+}
+
+func TestString(t *testing.T) {
+	regs := StringToRegs("SIOT1", 4)
+
+	if !reflect.DeepEqual(regs, []uint16{0x5349, 0x4f54, 0x3100, 0}) {
+		t.Errorf("StringToRegs wrong: %x", regs)
+	}
+
+	if s := RegsToString(regs); s != "SIOT1" {
+		t.Error("RegsToString failed: ", s)
+	}
+
+	if s := RegsToString(StringToRegs("too long string", 2)); s != "too " {
+		t.Error("truncate failed: ", s)
+	}
+}
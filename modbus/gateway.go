@@ -0,0 +1,163 @@
+package modbus
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// gatewayRequest is a request waiting in the gateway queue
+type gatewayRequest struct {
+	id       byte
+	req      PDU
+	deadline time.Time
+	resp     chan PDU
+}
+
+// Gateway forwards requests received by a server (typically a TCPServer
+// created with NewTCPGateway) to devices on a serial bus through a Client.
+// Requests are queued and sent one at a time as only one transaction can
+// be in progress on a serial bus. If a device does not respond within the
+// timeout for its unit ID (this includes time spent in the queue), a
+// GATEWAY TARGET DEVICE FAILED TO RESPOND exception is returned.
+type Gateway struct {
+	client       *Client
+	timeout      time.Duration
+	unitTimeouts map[byte]time.Duration
+	queue        chan gatewayRequest
+	debug        int
+
+	lock   sync.Mutex
+	chDone chan struct{}
+	closed bool
+}
+
+// NewGateway creates a new gateway that forwards requests to client.
+// timeout is the default time to wait for a response from a device and
+// queueSize the max number of requests that can be waiting for the bus.
+func NewGateway(client *Client, timeout time.Duration, queueSize int,
+	debug int) *Gateway {
+	g := &Gateway{
+		client:       client,
+		timeout:      timeout,
+		unitTimeouts: make(map[byte]time.Duration),
+		queue:        make(chan gatewayRequest, queueSize),
+		debug:        debug,
+		chDone:       make(chan struct{}),
+	}
+
+	go g.run()
+
+	return g
+}
+
+// SetUnitTimeout overrides the default timeout for a unit ID
+func (g *Gateway) SetUnitTimeout(id byte, timeout time.Duration) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.unitTimeouts[id] = timeout
+}
+
+func (g *Gateway) unitTimeout(id byte) time.Duration {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if t, ok := g.unitTimeouts[id]; ok {
+		return t
+	}
+	return g.timeout
+}
+
+// exception returns an exception response for a request
+func exception(req PDU, code ExceptionCode) PDU {
+	return PDU{
+		FunctionCode: req.FunctionCode | 0x80,
+		Data:         []byte{byte(code)},
+	}
+}
+
+// Forward sends a request to a device on the bus and returns the response.
+// Errors are returned as exception responses so this function always
+// returns a response that can be sent back to the requester.
+func (g *Gateway) Forward(id byte, req PDU) PDU {
+	// broadcast and reserved addresses can't be forwarded to a serial bus
+	// as they do not return a response.
+	if id == 0 || id > 247 {
+		return exception(req, ExcGatewayPathUnavilable)
+	}
+
+	timeout := g.unitTimeout(id)
+
+	r := gatewayRequest{
+		id:       id,
+		req:      req,
+		deadline: time.Now().Add(timeout),
+		// buffered so the run routine never blocks if we time out
+		resp: make(chan PDU, 1),
+	}
+
+	select {
+	case <-g.chDone:
+		return exception(req, ExcGatewayPathUnavilable)
+	case g.queue <- r:
+	default:
+		if g.debug > 0 {
+			log.Println("Modbus gateway: queue full, dropping request for unit", id)
+		}
+		return exception(req, ExcGatewayPathUnavilable)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-r.resp:
+		return resp
+	case <-timer.C:
+		if g.debug > 0 {
+			log.Println("Modbus gateway: timeout waiting for unit", id)
+		}
+		return exception(req, ExcGatewayTargetFailedToRespond)
+	case <-g.chDone:
+		return exception(req, ExcGatewayPathUnavilable)
+	}
+}
+
+func (g *Gateway) run() {
+	for {
+		select {
+		case <-g.chDone:
+			return
+		case r := <-g.queue:
+			if time.Now().After(r.deadline) {
+				// requester has already given up, don't tie up the bus
+				continue
+			}
+
+			resp, err := g.client.Transact(r.id, r.req)
+			if err != nil {
+				if code, ok := err.(ExceptionCode); ok {
+					resp = exception(r.req, code)
+				} else {
+					if g.debug > 0 {
+						log.Printf("Modbus gateway: unit %v error: %v\n", r.id, err)
+					}
+					resp = exception(r.req, ExcGatewayTargetFailedToRespond)
+				}
+			}
+
+			r.resp <- resp
+		}
+	}
+}
+
+// Close stops the gateway. Requests that are waiting return a
+// GATEWAY PATH UNAVAILABLE exception. The client is not closed.
+func (g *Gateway) Close() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if !g.closed {
+		g.closed = true
+		close(g.chDone)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package modbus
+
+import (
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/respreader"
+	"github.com/simpleiot/simpleiot/test"
+)
+
+func TestGateway(t *testing.T) {
+	id := byte(1)
+
+	// RTU device on simulated serial bus
+	a, b := test.NewIoSim()
+
+	portA := respreader.NewReadWriteCloser(a, time.Second*2,
+		5*time.Millisecond)
+	regs := &Regs{}
+	regs.AddReg(2, 1)
+	_ = regs.WriteReg(2, 0x1234)
+	slave := NewServer(id, NewRTU(portA), regs, 0)
+
+	go slave.Listen(func(err error) {
+		log.Println("modbus server listen error:", err)
+	}, func() {}, func() {})
+
+	portB := respreader.NewReadWriteCloser(b, time.Millisecond*100,
+		5*time.Millisecond)
+	gw := NewGateway(NewClient(NewRTU(portB), 0), time.Second, 10, 0)
+	defer gw.Close()
+
+	resp := gw.Forward(id, ReadHoldingRegs(2, 1))
+	regValues, err := resp.RespReadRegs()
+	if err != nil {
+		t.Fatal("Error reading regs through gateway: ", err)
+	}
+
+	if len(regValues) != 1 || regValues[0] != 0x1234 {
+		t.Fatal("Wrong reg value: ", regValues)
+	}
+
+	// device exceptions are passed through
+	resp = gw.Forward(id, ReadHoldingRegs(10, 1))
+	if resp.FunctionCode != FuncCodeReadHoldingRegisters|0x80 ||
+		ExceptionCode(resp.Data[0]) != ExcIllegalAddress {
+		t.Fatal("Expected illegal address exception, got: ", resp)
+	}
+
+	// no device at this address
+	resp = gw.Forward(2, ReadHoldingRegs(2, 1))
+	if ExceptionCode(resp.Data[0]) != ExcGatewayTargetFailedToRespond {
+		t.Fatal("Expected target failed to respond, got: ", resp)
+	}
+
+	// per unit timeout shorter than the serial timeout
+	gw.SetUnitTimeout(3, 20*time.Millisecond)
+	start := time.Now()
+	resp = gw.Forward(3, ReadHoldingRegs(2, 1))
+	if ExceptionCode(resp.Data[0]) != ExcGatewayTargetFailedToRespond {
+		t.Fatal("Expected target failed to respond, got: ", resp)
+	}
+	if time.Since(start) > 80*time.Millisecond {
+		t.Fatal("Unit timeout not applied")
+	}
+
+	resp = gw.Forward(0, ReadHoldingRegs(2, 1))
+	if ExceptionCode(resp.Data[0]) != ExcGatewayPathUnavilable {
+		t.Fatal("Expected path unavailable for broadcast, got: ", resp)
+	}
+
+	// wait for the bus to be free again after the unit 3 timeout
+	time.Sleep(150 * time.Millisecond)
+
+	// end to end through TCP
+	ts, err := NewTCPGateway(2, "0", gw, 0)
+	if err != nil {
+		t.Fatal("Error starting TCP gateway: ", err)
+	}
+	defer ts.Close()
+
+	go ts.Listen(func(err error) {
+		log.Println("modbus TCP gateway error:", err)
+	}, func() {}, func() {})
+
+	sock, err := net.Dial("tcp", ts.listener.Addr().String())
+	if err != nil {
+		t.Fatal("Error connecting to TCP gateway: ", err)
+	}
+
+	client := NewClient(NewTCP(sock, time.Second, TransportClient), 0)
+	defer client.Close()
+
+	regValues, err = client.ReadHoldingRegs(id, 2, 1)
+	if err != nil {
+		t.Fatal("Error reading regs through TCP gateway: ", err)
+	}
+
+	if len(regValues) != 1 || regValues[0] != 0x1234 {
+		t.Fatal("Wrong reg value over TCP: ", regValues)
+	}
+
+	_, err = client.ReadHoldingRegs(2, 2, 1)
+	if err != ExcGatewayTargetFailedToRespond {
+		t.Fatal("Expected target failed to respond error, got: ", err)
+	}
+}
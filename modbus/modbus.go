@@ -45,6 +45,22 @@ const (
 	WriteCoilValueOff uint16 = 0
 )
 
+// Limits defined by the modbus spec for the number of items that can be
+// transferred in a single request.
+const (
+	MaxReadBits           = 2000
+	MaxReadRegs           = 125
+	MaxWriteCoils         = 1968
+	MaxWriteRegs          = 123
+	MaxReadWriteReadRegs  = 125
+	MaxReadWriteWriteRegs = 121
+)
+
+// MaxADUSize is the largest packet size of any of the supported transports
+// (ASCII: start char + 255 hex encoded bytes (address, 253 byte PDU, LRC)
+// + CR LF)
+const MaxADUSize = asciiMaxSize
+
 // minRequestLen is the minimum number of PDU bytes for a request with
 // the given function code (not including slave address or checksum,
 // which are part of the ADU).
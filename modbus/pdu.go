@@ -21,14 +21,20 @@ func (p PDU) String() string {
 
 // handleError translates an error into a PDU, if possible.
 func (p *PDU) handleError(err error) (bool, PDU, error) {
+	resp := PDU{}
+	resp.FunctionCode = p.FunctionCode | 0x80
+	resp.Data = []byte{byte(toExceptionCode(err))}
+	return false, resp, nil
+}
+
+// toExceptionCode returns the modbus exception code for an error. Errors
+// that are not exception codes are reported as a device failure.
+func toExceptionCode(err error) ExceptionCode {
 	if err, ok := err.(ExceptionCode); ok {
-		resp := PDU{}
-		resp.FunctionCode = p.FunctionCode | 0x80
-		resp.Data = []byte{byte(err)}
-		return false, resp, nil
+		return err
 	}
 	// TODO: Wrap the underlying error?
-	return p.handleError(ExcServerDeviceFailure)
+	return ExcServerDeviceFailure
 }
 
 // ProcessRequest a modbus request. Registers are read and written
@@ -153,6 +159,53 @@ func (p *PDU) ProcessRequest(regs RegProvider) (bool, PDU, error) {
 		binary.BigEndian.PutUint16(resp.Data[2:4], quantity)
 		regsChanged = true
 
+	case FuncCodeReadWriteMultipleRegisters:
+		readAddress := binary.BigEndian.Uint16(p.Data[:2])
+		readCount := binary.BigEndian.Uint16(p.Data[2:4])
+		writeAddress := binary.BigEndian.Uint16(p.Data[4:6])
+		writeCount := binary.BigEndian.Uint16(p.Data[6:8])
+		if len(p.Data) != 9+(int(writeCount)*2) ||
+			readCount < 1 || readCount > MaxReadWriteReadRegs {
+			return p.handleError(ExcIllegalValue)
+		}
+		// the write operation is performed before the read
+		for i := 0; i < int(writeCount); i++ {
+			value := binary.BigEndian.Uint16(p.Data[9+i*2 : 9+i*2+2])
+			if err := regs.WriteReg(int(writeAddress)+i, value); err != nil {
+				return p.handleError(err)
+			}
+		}
+		regsChanged = writeCount > 0
+		resp.Data = make([]byte, 1+2*readCount)
+		resp.Data[0] = uint8(readCount * 2)
+		for i := 0; i < int(readCount); i++ {
+			v, err := regs.ReadReg(int(readAddress) + i)
+			if err != nil {
+				// writes may already be applied, so still report changes
+				_, resp, err := p.handleError(err)
+				return regsChanged, resp, err
+			}
+			binary.BigEndian.PutUint16(resp.Data[1+i*2:], v)
+		}
+
+	case FuncCodeMaskWriteRegister:
+		if len(p.Data) != 6 {
+			return p.handleError(ExcIllegalValue)
+		}
+		address := binary.BigEndian.Uint16(p.Data[:2])
+		andMask := binary.BigEndian.Uint16(p.Data[2:4])
+		orMask := binary.BigEndian.Uint16(p.Data[4:6])
+		v, err := regs.ReadReg(int(address))
+		if err != nil {
+			return p.handleError(err)
+		}
+		v = (v & andMask) | (orMask &^ andMask)
+		if err := regs.WriteReg(int(address), v); err != nil {
+			return p.handleError(err)
+		}
+		resp.Data = p.Data
+		regsChanged = true
+
 	default:
 		return p.handleError(ExcIllegalFunction)
 	}
@@ -166,6 +219,17 @@ func (p *PDU) RespReadBits() ([]bool, error) {
 	if len(p.Data) < 2 {
 		return []bool{}, errors.New("not enough data")
 	}
+
+	return p.respReadBits(int(p.Data[0]))
+}
+
+// respReadBits extracts count bits from a read coils or discrete
+// inputs response. The response only contains a byte count, so the
+// number of requested bits must be supplied.
+func (p *PDU) respReadBits(count int) ([]bool, error) {
+	if len(p.Data) < 2 {
+		return []bool{}, errors.New("not enough data")
+	}
 	switch p.FunctionCode {
 	case FuncCodeReadCoils, FuncCodeReadDiscreteInputs:
 		// ok
@@ -173,18 +237,15 @@ func (p *PDU) RespReadBits() ([]bool, error) {
 		return []bool{}, errors.New("invalid function code to read bits")
 	}
 
-	count := p.Data[0]
+	byteCount := int(p.Data[0])
+	if count > byteCount*8 || len(p.Data) < 1+byteCount {
+		return []bool{}, errors.New("RespReadBits not enough data")
+	}
+
 	ret := make([]bool, count)
-	byteIndex := 0
-	bitIndex := uint(0)
-
-	for i := byte(0); i < count; i++ {
-		ret[i] = ((p.Data[byteIndex+1] >> bitIndex) & 0x1) == 0x1
-		bitIndex++
-		if bitIndex >= 8 {
-			byteIndex++
-			bitIndex = 0
-		}
+
+	for i := 0; i < count; i++ {
+		ret[i] = ((p.Data[1+i/8] >> (i % 8)) & 0x1) == 0x1
 	}
 
 	return ret, nil
@@ -197,7 +258,8 @@ func (p *PDU) RespReadRegs() ([]uint16, error) {
 		return []uint16{}, errors.New("not enough data")
 	}
 	switch p.FunctionCode {
-	case FuncCodeReadHoldingRegisters, FuncCodeReadInputRegisters:
+	case FuncCodeReadHoldingRegisters, FuncCodeReadInputRegisters,
+		FuncCodeReadWriteMultipleRegisters:
 		// ok
 	default:
 		return []uint16{}, errors.New("invalid function code to read regs")
@@ -258,6 +320,66 @@ func WriteSingleReg(address, value uint16) PDU {
 	}
 }
 
+// WriteMultipleCoils creates PDU to write multiple coils
+func WriteMultipleCoils(address uint16, values []bool) PDU {
+	byteCount := (len(values) + 7) / 8
+	data := make([]byte, 5+byteCount)
+	binary.BigEndian.PutUint16(data[0:], address)
+	binary.BigEndian.PutUint16(data[2:], uint16(len(values)))
+	data[4] = byte(byteCount)
+	for i, v := range values {
+		if v {
+			data[5+i/8] |= 1 << (i % 8)
+		}
+	}
+
+	return PDU{
+		FunctionCode: FuncCodeWriteMultipleCoils,
+		Data:         data,
+	}
+}
+
+// WriteMultipleRegs creates PDU to write multiple holding regs
+func WriteMultipleRegs(address uint16, values []uint16) PDU {
+	data := make([]byte, 5+2*len(values))
+	binary.BigEndian.PutUint16(data[0:], address)
+	binary.BigEndian.PutUint16(data[2:], uint16(len(values)))
+	data[4] = byte(2 * len(values))
+	copy(data[5:], PutUint16Array(values...))
+
+	return PDU{
+		FunctionCode: FuncCodeWriteMultipleRegisters,
+		Data:         data,
+	}
+}
+
+// ReadWriteMultipleRegs creates PDU to write and then read holding regs
+// in a single transaction
+func ReadWriteMultipleRegs(readAddress, readCount, writeAddress uint16,
+	values []uint16) PDU {
+	data := make([]byte, 9+2*len(values))
+	binary.BigEndian.PutUint16(data[0:], readAddress)
+	binary.BigEndian.PutUint16(data[2:], readCount)
+	binary.BigEndian.PutUint16(data[4:], writeAddress)
+	binary.BigEndian.PutUint16(data[6:], uint16(len(values)))
+	data[8] = byte(2 * len(values))
+	copy(data[9:], PutUint16Array(values...))
+
+	return PDU{
+		FunctionCode: FuncCodeReadWriteMultipleRegisters,
+		Data:         data,
+	}
+}
+
+// MaskWriteReg creates a PDU to change bits in a holding reg. The register
+// is set to (current AND andMask) OR (orMask AND NOT andMask).
+func MaskWriteReg(address, andMask, orMask uint16) PDU {
+	return PDU{
+		FunctionCode: FuncCodeMaskWriteRegister,
+		Data:         PutUint16Array(address, andMask, orMask),
+	}
+}
+
 // ReadHoldingRegs creates a PDU to read a holding regs
 func ReadHoldingRegs(address uint16, count uint16) PDU {
 	return PDU{
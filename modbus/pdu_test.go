@@ -149,6 +149,15 @@ func TestProcessRequest(t *testing.T) {
 		{"WriteMultipleRegisters/missing", []byte{0x10, 0, 7, 0, 2, 4, 9, 10, 11, 12}, []byte{0x90, 2}},
 		{"WriteMultipleRegisters/wronglen", []byte{0x10, 0, 7, 0, 2, 4, 9, 10}, []byte{0x90, 3}},
 		{"WriteMultipleRegisters/readback", []byte{3, 0, 8, 0, 2}, []byte{3, 4, 0, 8, 10, 15}},
+		{"ReadWriteMultipleRegisters/present", []byte{23, 0, 8, 0, 2, 0, 8, 0, 1, 2, 1, 2}, []byte{23, 4, 1, 2, 10, 15}},
+		{"ReadWriteMultipleRegisters/missing", []byte{23, 0, 7, 0, 2, 0, 8, 0, 1, 2, 0, 3}, []byte{0x97, 2}},
+		{"ReadWriteMultipleRegisters/wronglen", []byte{23, 0, 8, 0, 2, 0, 8, 0, 2, 4, 0, 3}, []byte{0x97, 3}},
+		{"ReadWriteMultipleRegisters/readback", []byte{3, 0, 8, 0, 2}, []byte{3, 4, 0, 3, 10, 15}},
+		{"MaskWriteRegister/set", []byte{22, 0, 8, 0xFF, 0xFB, 0, 4}, []byte{22, 0, 8, 0xFF, 0xFB, 0, 4}},
+		{"MaskWriteRegister/clear", []byte{22, 0, 8, 0xFF, 0xFE, 0, 0}, []byte{22, 0, 8, 0xFF, 0xFE, 0, 0}},
+		{"MaskWriteRegister/missing", []byte{22, 0, 7, 0xFF, 0xFE, 0, 0}, []byte{0x96, 2}},
+		{"MaskWriteRegister/wronglen", []byte{22, 0, 8, 0xFF, 0xFE, 0, 0, 0}, []byte{0x96, 3}},
+		{"MaskWriteRegister/readback", []byte{3, 0, 8, 0, 1}, []byte{3, 2, 0, 6}},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			pdu := &PDU{
@@ -173,3 +182,56 @@ func TestProcessRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestPduWriteMultiple(t *testing.T) {
+	regs := Regs{}
+	regs.AddReg(8, 3)
+	regs.AddCoil(128)
+
+	pdu := WriteMultipleRegs(8, []uint16{1, 2, 3})
+	_, resp, err := pdu.ProcessRequest(&regs)
+	if err != nil {
+		t.Fatal("Error processing request: ", err)
+	}
+
+	if diff := cmp.Diff(resp.Data, []byte{0, 8, 0, 3}); diff != "" {
+		t.Errorf("unexpected write regs reply: %v", diff)
+	}
+
+	pdu = ReadHoldingRegs(8, 3)
+	_, resp, err = pdu.ProcessRequest(&regs)
+	if err != nil {
+		t.Fatal("Error processing request: ", err)
+	}
+
+	values, err := resp.RespReadRegs()
+	if err != nil {
+		t.Fatal("Error reading regs: ", err)
+	}
+
+	if diff := cmp.Diff(values, []uint16{1, 2, 3}); diff != "" {
+		t.Errorf("unexpected reg values: %v", diff)
+	}
+
+	coils := []bool{true, false, true, true, false, false, false, false, true}
+	pdu = WriteMultipleCoils(128, coils)
+	_, _, err = pdu.ProcessRequest(&regs)
+	if err != nil {
+		t.Fatal("Error processing request: ", err)
+	}
+
+	pdu = ReadCoils(128, uint16(len(coils)))
+	_, resp, err = pdu.ProcessRequest(&regs)
+	if err != nil {
+		t.Fatal("Error processing request: ", err)
+	}
+
+	bits, err := resp.respReadBits(len(coils))
+	if err != nil {
+		t.Fatal("Error reading bits: ", err)
+	}
+
+	if diff := cmp.Diff(bits, coils); diff != "" {
+		t.Errorf("unexpected coil values: %v", diff)
+	}
+}
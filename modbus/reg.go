@@ -279,3 +279,68 @@ func (r *Regs) WriteRegFloat32(address int, value float32) error {
 
 	return nil
 }
+
+// ReadRegs reads count consecutive regs. All regs are read under one
+// lock so multi-register values are consistent.
+func (r *Regs) ReadRegs(address int, count int) ([]uint16, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	ret := make([]uint16, count)
+
+	for i := range ret {
+		var err error
+		ret[i], err = r.readReg(address + i)
+		if err != nil {
+			return []uint16{}, err
+		}
+	}
+
+	return ret, nil
+}
+
+// WriteRegs writes consecutive regs. All regs are written under one
+// lock so multi-register values are updated atomically.
+func (r *Regs) WriteRegs(address int, values []uint16) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i, v := range values {
+		err := r.writeReg(address+i, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadRegBit reads a single bit (0-15) from a register
+func (r *Regs) ReadRegBit(address int, bit int) (bool, error) {
+	v, err := r.ReadReg(address)
+	if err != nil {
+		return false, err
+	}
+
+	return (v & (1 << uint16(bit))) != 0, nil
+}
+
+// WriteRegBit sets or clears a single bit (0-15) in a register
+// without modifying the other bits
+func (r *Regs) WriteRegBit(address int, bit int, value bool) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	regValue, err := r.readReg(address)
+	if err != nil {
+		return err
+	}
+
+	if value {
+		regValue |= 1 << uint16(bit)
+	} else {
+		regValue &= ^(1 << uint16(bit))
+	}
+
+	return r.writeReg(address, regValue)
+}
@@ -74,3 +74,47 @@ func TestRegValidator(t *testing.T) {
 		t.Errorf("Expected no error, but got: %v", err)
 	}
 }
+
+func TestRegsMultiple(t *testing.T) {
+	regs := Regs{}
+	regs.AddReg(20, 4)
+
+	err := regs.WriteRegs(20, Uint64ToRegs([]uint64{0x1122334455667788}))
+	if err != nil {
+		t.Fatal("Error writing regs: ", err)
+	}
+
+	v, err := regs.ReadRegs(20, 4)
+	if err != nil {
+		t.Fatal("Error reading regs: ", err)
+	}
+
+	if RegsToUint64(v)[0] != 0x1122334455667788 {
+		t.Errorf("wrong value: %x", v)
+	}
+
+	_, err = regs.ReadRegs(22, 4)
+	if !errors.Is(err, ExcIllegalAddress) {
+		t.Error("expected illegal address reading past end")
+	}
+
+	err = regs.WriteRegBit(21, 15, false)
+	if err != nil {
+		t.Fatal("Error writing reg bit: ", err)
+	}
+
+	err = regs.WriteRegBit(21, 0, true)
+	if err != nil {
+		t.Fatal("Error writing reg bit: ", err)
+	}
+
+	reg, _ := regs.ReadReg(21)
+	if reg != 0x3345 {
+		t.Errorf("wrong reg value after bit write: 0x%x", reg)
+	}
+
+	b, err := regs.ReadRegBit(21, 2)
+	if err != nil || !b {
+		t.Error("expected bit 2 to be set")
+	}
+}
@@ -82,4 +82,47 @@ func TestRtuEndToEnd(t *testing.T) {
 	if hr[0] != 0x1234 {
 		t.Fatalf("read holding reg returned wrong value: 0x%x", hr[0])
 	}
+
+	regs.AddReg(3, 2)
+	err = master.WriteMultipleRegs(id, 2, []uint16{0x1111, 0x2222, 0x3333})
+	if err != nil {
+		t.Fatal("write multiple regs returned err: ", err)
+	}
+
+	hr, err = master.ReadHoldingRegs(id, 2, 3)
+	if err != nil {
+		t.Fatal("read holding regs returned err: ", err)
+	}
+
+	if len(hr) != 3 || hr[0] != 0x1111 || hr[1] != 0x2222 || hr[2] != 0x3333 {
+		t.Fatalf("read holding regs returned wrong values: %v", hr)
+	}
+
+	hr, err = master.ReadWriteMultipleRegs(id, 3, 2, 2, []uint16{0x4444})
+	if err != nil {
+		t.Fatal("read/write multiple regs returned err: ", err)
+	}
+
+	if len(hr) != 2 || hr[0] != 0x2222 || hr[1] != 0x3333 {
+		t.Fatalf("read/write regs returned wrong values: %v", hr)
+	}
+
+	err = master.WriteMultipleCoils(id, 128, []bool{true, false, true})
+	if err != nil {
+		t.Fatal("write multiple coils returned err: ", err)
+	}
+
+	coils, err = master.ReadCoils(id, 128, 3)
+	if err != nil {
+		t.Fatal("read coils returned err: ", err)
+	}
+
+	if len(coils) != 3 || !coils[0] || coils[1] || !coils[2] {
+		t.Fatalf("read coils returned wrong values: %v", coils)
+	}
+
+	_, err = master.ReadHoldingRegs(id, 40, 1)
+	if err != ExcIllegalAddress {
+		t.Fatalf("expected illegal address exception, got: %v", err)
+	}
 }
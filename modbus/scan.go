@@ -0,0 +1,136 @@
+package modbus
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ScanConfig describes a scan of a serial bus for devices
+type ScanConfig struct {
+	// Bauds to try, defaults to 9600
+	Bauds []int `json:"bauds"`
+	// Parities to try (N, E, O), defaults to N
+	Parities []string `json:"parities"`
+	// range of unit IDs to probe, defaults to 1-247
+	StartID int `json:"startID"`
+	EndID   int `json:"endID"`
+	// Address is the register read from each device
+	Address int `json:"address"`
+	// Input reads an input register instead of a holding register
+	Input bool `json:"input"`
+}
+
+// ScanResult describes a device that responded during a scan
+type ScanResult struct {
+	ID           int           `json:"id"`
+	Baud         int           `json:"baud"`
+	Parity       string        `json:"parity"`
+	ResponseTime time.Duration `json:"responseTime"`
+	// Value is the value of the register that was probed
+	Value uint16 `json:"value"`
+	// Exception is set if the device responded with an exception. This
+	// still tells us there is a device at this ID.
+	Exception string `json:"exception,omitempty"`
+}
+
+func (r ScanResult) String() string {
+	ret := fmt.Sprintf("ID: %v, baud: %v, parity: %v, time: %v",
+		r.ID, r.Baud, r.Parity, r.ResponseTime.Round(time.Millisecond))
+	if r.Exception != "" {
+		return ret + ", exception: " + r.Exception
+	}
+	return ret + fmt.Sprintf(", value: 0x%x", r.Value)
+}
+
+// SerialOpener opens a transport with the given serial port settings. The
+// transport read timeout determines how long we wait for each device.
+type SerialOpener func(baud int, parity string) (Transport, error)
+
+// Scan sweeps the unit IDs, baud rates, and parities in config, reading one
+// register from each ID. found is called (if not nil) as each device is
+// found so progress can be displayed. All devices found are returned. If ctx
+// is done, the scan stops and the devices found so far are returned with the
+// context error.
+func Scan(ctx context.Context, open SerialOpener, config ScanConfig, debug int,
+	found func(ScanResult)) ([]ScanResult, error) {
+	bauds := config.Bauds
+	if len(bauds) == 0 {
+		bauds = []int{9600}
+	}
+
+	parities := config.Parities
+	if len(parities) == 0 {
+		parities = []string{"N"}
+	}
+
+	start, end := config.StartID, config.EndID
+	if start <= 0 {
+		start = 1
+	}
+	if end <= 0 || end > 247 {
+		end = 247
+	}
+
+	if config.Address < 0 || config.Address > 0xffff {
+		return nil, fmt.Errorf("invalid address: %v", config.Address)
+	}
+
+	var ret []ScanResult
+
+	for _, baud := range bauds {
+		for _, parity := range parities {
+			transport, err := open(baud, parity)
+			if err != nil {
+				return ret, err
+			}
+
+			client := NewClient(transport, debug)
+
+			for id := start; id <= end; id++ {
+				if ctx.Err() != nil {
+					_ = client.Close()
+					return ret, ctx.Err()
+				}
+
+				begin := time.Now()
+				var regs []uint16
+				if config.Input {
+					regs, err = client.ReadInputRegs(byte(id), uint16(config.Address), 1)
+				} else {
+					regs, err = client.ReadHoldingRegs(byte(id), uint16(config.Address), 1)
+				}
+
+				r := ScanResult{
+					ID:           id,
+					Baud:         baud,
+					Parity:       parity,
+					ResponseTime: time.Since(begin),
+				}
+
+				if err != nil {
+					exc, ok := err.(ExceptionCode)
+					if !ok {
+						// no response or garbled response
+						continue
+					}
+					r.Exception = exc.Error()
+				} else if len(regs) > 0 {
+					r.Value = regs[0]
+				}
+
+				ret = append(ret, r)
+				if found != nil {
+					found(r)
+				}
+			}
+
+			err = client.Close()
+			if err != nil {
+				return ret, err
+			}
+		}
+	}
+
+	return ret, nil
+}
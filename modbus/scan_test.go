@@ -0,0 +1,103 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/respreader"
+	"github.com/simpleiot/simpleiot/test"
+)
+
+func TestScan(t *testing.T) {
+	a, b := test.NewIoSim()
+
+	portA := respreader.NewReadWriteCloser(a, time.Second*2,
+		5*time.Millisecond)
+	regs := &Regs{}
+	regs.AddReg(0, 1)
+	_ = regs.WriteReg(0, 0x55)
+	slave := NewServer(5, NewRTU(portA), regs, 0)
+
+	go slave.Listen(func(err error) {
+		log.Println("modbus server listen error:", err)
+	}, func() {}, func() {})
+
+	// one reader for the port as each reader consumes data in the background
+	portB := nopCloser{respreader.NewReadWriteCloser(b,
+		time.Millisecond*200, 5*time.Millisecond)}
+
+	// the device only talks at 19200, other bauds are a dead bus
+	open := func(baud int, _ string) (Transport, error) {
+		switch baud {
+		case 19200:
+			return NewRTU(portB), nil
+		case 9600:
+			dead, _ := test.NewIoSim()
+			return NewRTU(nopCloser{respreader.NewReadWriteCloser(dead,
+				time.Millisecond*20, 5*time.Millisecond)}), nil
+		default:
+			return nil, errors.New("unsupported baud")
+		}
+	}
+
+	var found []ScanResult
+
+	results, err := Scan(context.Background(), open, ScanConfig{
+		Bauds:   []int{9600, 19200},
+		StartID: 4,
+		EndID:   6,
+	}, 0, func(r ScanResult) {
+		found = append(found, r)
+	})
+
+	if err != nil {
+		t.Fatal("Scan error: ", err)
+	}
+
+	if len(results) != 1 || len(found) != 1 {
+		t.Fatal("Expected 1 device, got: ", results)
+	}
+
+	r := results[0]
+	if r.ID != 5 || r.Baud != 19200 || r.Parity != "N" || r.Value != 0x55 {
+		t.Fatal("Wrong scan result: ", r)
+	}
+
+	// register not implemented by device still finds the device
+	results, err = Scan(context.Background(), open, ScanConfig{
+		Bauds:   []int{19200},
+		StartID: 5,
+		EndID:   5,
+		Address: 100,
+	}, 0, nil)
+
+	if err != nil {
+		t.Fatal("Scan error: ", err)
+	}
+
+	if len(results) != 1 || results[0].Exception == "" {
+		t.Fatal("Expected device with exception, got: ", results)
+	}
+
+	_, err = Scan(context.Background(), open, ScanConfig{Bauds: []int{38400}}, 0, nil)
+	if err == nil {
+		t.Fatal("Expected error opening port")
+	}
+
+	// scans stop when the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err = Scan(ctx, open, ScanConfig{
+		Bauds:   []int{19200},
+		StartID: 5,
+		EndID:   6,
+	}, 0, func(ScanResult) {
+		cancel()
+	})
+
+	if !errors.Is(err, context.Canceled) || len(results) != 1 {
+		t.Fatalf("Expected canceled scan with 1 device, got %v, %v", results, err)
+	}
+}
@@ -10,12 +10,13 @@ import (
 )
 
 // Server defines a server (slave)
-// Current Server only supports Modbus RTU,
-// but could be expanded to do ASCII and TCP.
+// Server is used with the RTU and ASCII transports. TCPServer
+// creates a Server for each TCP connection.
 type Server struct {
 	id        byte
 	transport Transport
 	regs      *Regs
+	gateway   *Gateway
 	chDone    chan bool
 	debug     int
 }
@@ -34,6 +35,17 @@ func NewServer(id byte, transport Transport, regs *Regs, debug int) *Server {
 	}
 }
 
+// NewGatewayServer creates a server that forwards all requests, regardless
+// of unit ID, through a Gateway.
+func NewGatewayServer(transport Transport, gateway *Gateway, debug int) *Server {
+	return &Server{
+		transport: transport,
+		gateway:   gateway,
+		chDone:    make(chan bool),
+		debug:     debug,
+	}
+}
+
 // Close stops the listening channel
 func (s *Server) Close() error {
 	s.transport.Close()
@@ -58,12 +70,12 @@ func (s *Server) Listen(errorCallback func(error),
 			return
 		default:
 		}
-		buf := make([]byte, 200)
+		buf := make([]byte, MaxADUSize)
 		cnt, err := s.transport.Read(buf)
 		if err != nil {
-			if err != io.EOF && s.transport.Type() == TransportTypeRTU {
-				// only print errors for RTU for now as we get timeout
-				// errors with TCP
+			if err != io.EOF && s.transport.Type() != TransportTypeTCP {
+				// only print errors for serial transports for now as
+				// we get timeout errors with TCP
 				log.Println("Error reading modbus port:", err)
 			}
 
@@ -100,6 +112,21 @@ func (s *Server) Listen(errorCallback func(error),
 			continue
 		}
 
+		if s.gateway != nil {
+			if s.debug >= 2 {
+				fmt.Printf("Modbus gateway req ID:0x%x %v\n", id, req)
+			}
+
+			resp := s.gateway.Forward(id, req)
+
+			if s.debug >= 2 {
+				fmt.Printf("Modbus gateway resp ID:0x%x %v\n", id, resp)
+			}
+
+			s.write(id, resp, errorCallback)
+			continue
+		}
+
 		if id != s.id {
 			// packet is not for this device
 			// for RTU this is normal as the devices are all listening
@@ -128,20 +155,23 @@ func (s *Server) Listen(errorCallback func(error),
 			fmt.Println("Modbus server resp: ", resp)
 		}
 
-		respRtu, err := s.transport.Encode(s.id, resp)
-		if err != nil {
-			errorCallback(err)
-			continue
-		}
+		s.write(s.id, resp, errorCallback)
+	}
+}
 
-		if s.debug >= 9 {
-			fmt.Println("Modbus server tx: ", test.HexDump(respRtu))
-		}
+func (s *Server) write(id byte, resp PDU, errorCallback func(error)) {
+	packet, err := s.transport.Encode(id, resp)
+	if err != nil {
+		errorCallback(err)
+		return
+	}
 
-		_, err = s.transport.Write(respRtu)
-		if err != nil {
-			errorCallback(err)
-			continue
-		}
+	if s.debug >= 9 {
+		fmt.Println("Modbus server tx: ", test.HexDump(packet))
+	}
+
+	_, err = s.transport.Write(packet)
+	if err != nil {
+		errorCallback(err)
 	}
 }
@@ -121,6 +121,7 @@ type TCPServer struct {
 	maxClients int
 	port       string
 	regs       *Regs
+	gateway    *Gateway
 	debug      int
 
 	// state
@@ -147,6 +148,24 @@ func NewTCPServer(id, maxClients int, port string, regs *Regs, debug int) (*TCPS
 	}, nil
 }
 
+// NewTCPGateway starts a TCP modbus server that forwards requests to the
+// devices on a serial bus through gateway. The unit ID in each request
+// selects the device.
+func NewTCPGateway(maxClients int, port string, gateway *Gateway, debug int) (*TCPServer, error) {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TCPServer{
+		maxClients: maxClients,
+		port:       port,
+		gateway:    gateway,
+		listener:   listener,
+		debug:      debug,
+	}, nil
+}
+
 // Listen starts the server and listens for modbus requests
 // this function does not return unless an error occurs
 // The listen function supports various debug levels:
@@ -165,6 +184,7 @@ func (ts *TCPServer) Listen(errorCallback func(error),
 				return
 			}
 			log.Println("Modbus TCP server: failed to accept connection:", err)
+			continue
 		}
 
 		if ts.debug > 0 {
@@ -174,7 +194,12 @@ func (ts *TCPServer) Listen(errorCallback func(error),
 		ts.lock.Lock()
 		if len(ts.servers) < ts.maxClients {
 			transport := NewTCP(sock, 500*time.Millisecond, TransportServer)
-			server := NewServer(byte(ts.id), transport, ts.regs, ts.debug)
+			var server *Server
+			if ts.gateway != nil {
+				server = NewGatewayServer(transport, ts.gateway, ts.debug)
+			} else {
+				server = NewServer(byte(ts.id), transport, ts.regs, ts.debug)
+			}
 			ts.servers = append(ts.servers, server)
 			go server.Listen(errorCallback,
 				changesCallback, func() {
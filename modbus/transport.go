@@ -9,8 +9,9 @@ type TransportType string
 
 // define valid transport types
 const (
-	TransportTypeTCP TransportType = "tcp"
-	TransportTypeRTU TransportType = "rtu"
+	TransportTypeTCP   TransportType = "tcp"
+	TransportTypeRTU   TransportType = "rtu"
+	TransportTypeASCII TransportType = "ascii"
 )
 
 // TransportClientServer defines if transport is being used for a client or server
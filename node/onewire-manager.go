@@ -12,19 +12,21 @@ import (
 	"github.com/simpleiot/simpleiot/data"
 )
 
-// oneWireManager is responsible for finding new busses and sync database state
-// with what is here
+// oneWireManager is responsible for finding new busses and creating nodes
+// for them. The busses are run by the 1-wire client.
 type oneWireManager struct {
 	nc         *nats.Conn
-	busses     map[string]*oneWire
 	rootNodeID string
+	root       string
 }
 
-func newOneWireManager(nc *nats.Conn, rootNodeID string) *oneWireManager {
+// newOneWireManager creates a new manager. root is the sysfs directory that
+// contains the 1-wire bus masters.
+func newOneWireManager(nc *nats.Conn, rootNodeID, root string) *oneWireManager {
 	return &oneWireManager{
 		nc:         nc,
-		busses:     make(map[string]*oneWire),
 		rootNodeID: rootNodeID,
+		root:       root,
 	}
 }
 
@@ -36,35 +38,8 @@ func (owm *oneWireManager) update() error {
 		return err
 	}
 
-	found := make(map[string]bool)
-
-	for _, node := range nodes {
-		found[node.ID] = true
-		_, ok := owm.busses[node.ID]
-		if !ok {
-			var err error
-			bus, err := newOneWire(owm.nc, node)
-			if err != nil {
-				log.Println("Error creating new modbus:", err)
-				continue
-			}
-			owm.busses[node.ID] = bus
-		}
-	}
-
-	// remove busses that have been deleted
-	for id, bus := range owm.busses {
-		_, ok := found[id]
-		if !ok {
-			// bus was deleted so close and clear it
-			log.Println("removing onewire bus:", bus.owNode.description)
-			bus.stop()
-			delete(owm.busses, id)
-		}
-	}
-
 	// detect one wire busses
-	dirs, _ := filepath.Glob("/sys/bus/w1/devices/w1_bus_master*")
+	dirs, _ := filepath.Glob(filepath.Join(owm.root, "w1_bus_master*"))
 
 	for _, dir := range dirs {
 		f, _ := os.Stat(dir)
@@ -82,8 +57,9 @@ func (owm *oneWireManager) update() error {
 
 			// loop through busses and make sure it exists
 			found := false
-			for _, b := range owm.busses {
-				if b.owNode.index == index {
+			for _, n := range nodes {
+				i, _ := n.Points.ValueInt(data.PointTypeIndex, "")
+				if i == index {
 					found = true
 					break
 				}
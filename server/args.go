@@ -6,8 +6,10 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/simpleiot/simpleiot/assets/files"
+	"github.com/simpleiot/simpleiot/data"
 	"github.com/simpleiot/simpleiot/system"
 )
 
@@ -34,6 +36,8 @@ func Args(args []string, flags *flag.FlagSet) (Options, error) {
 	flagDev := flags.Bool("dev", false, "run server in development mode")
 	flagCustomUIDir := flags.String("customUIDir", "", "pass custom UI directory")
 	flagUIAssetsDebug := flags.Bool("UIAssetsDebug", false, "Dump asset files for debugging")
+	flagMetricsPoints := flags.String("metricsPoints", "", "comma separated point types exported by /metrics (default value)")
+	flagMetricsTags := flags.String("metricsTags", "", "comma separated point types added as labels to /metrics (default tag)")
 
 	if err := flags.Parse(args); err != nil {
 		return Options{}, err
@@ -150,6 +154,22 @@ func Args(args []string, flags *flag.FlagSet) (Options, error) {
 	// todo -- move this to a node
 	particleAPIKey := os.Getenv("SIOT_PARTICLE_API_KEY")
 
+	metricsPoints := os.Getenv("SIOT_METRICS_POINTS")
+	if *flagMetricsPoints != "" {
+		metricsPoints = *flagMetricsPoints
+	}
+	if metricsPoints == "" {
+		metricsPoints = data.PointTypeValue
+	}
+
+	metricsTags := os.Getenv("SIOT_METRICS_TAGS")
+	if *flagMetricsTags != "" {
+		metricsTags = *flagMetricsTags
+	}
+	if metricsTags == "" {
+		metricsTags = data.PointTypeTag
+	}
+
 	// TODO, convert this to builder pattern
 	o := Options{
 		StoreFile:         storeFilePath,
@@ -171,8 +191,23 @@ func Args(args []string, flags *flag.FlagSet) (Options, error) {
 		Dev:               *flagDev,
 		CustomUIDir:       *flagCustomUIDir,
 		UIAssetsDebug:     *flagUIAssetsDebug,
+
+		MetricsPointTypes:    splitList(metricsPoints),
+		MetricsTagPointTypes: splitList(metricsTags),
 	}
 
 	return o, nil
 
 }
+
+// splitList splits a comma separated list and drops empty entries
+func splitList(s string) []string {
+	var ret []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
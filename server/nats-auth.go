@@ -0,0 +1,116 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// natsAuth authenticates NATS clients with the server auth token or an API
+// token. API token clients get permissions based on the token scope and
+// subtree.
+type natsAuth struct {
+	token string
+	nc    *nats.Conn
+}
+
+// Check is called by the NATS server when a client connects
+func (a *natsAuth) Check(c server.ClientAuthentication) bool {
+	token := c.GetOpts().Token
+	if token == "" {
+		return false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1 {
+		return true
+	}
+
+	// the server connection uses the auth token, so API tokens can't be
+	// looked up until it is connected
+	if a.nc == nil || !a.nc.IsConnected() {
+		return false
+	}
+
+	t, err := client.CheckAPIToken(a.nc, token)
+	if err != nil {
+		return false
+	}
+
+	perms, err := natsPermissions(a.nc, t)
+	if err != nil {
+		log.Println("NATS auth: error getting token permissions:", err)
+		return false
+	}
+
+	expires, _ := t.ExpiresAt()
+
+	c.RegisterUser(&server.User{
+		Username:           "apiToken-" + t.ID,
+		Permissions:        perms,
+		ConnectionDeadline: expires,
+	})
+
+	return true
+}
+
+// natsPermissions returns the subjects an API token can publish and
+// subscribe to. Node requests and point subjects are limited to the token
+// subtree when it is set. Tokens that are not admin can only send points to
+// nodes allowed by APIToken.AllowsPoints. Permissions are computed on
+// connect, so clients must reconnect to see nodes added to the tree later.
+func natsPermissions(nc *nats.Conn, t client.APIToken) (*server.Permissions, error) {
+	admin := t.Allows(data.PointValueAdmin)
+	write := t.Allows(data.PointValueWrite)
+
+	if admin && t.NodeID == "" {
+		return nil, nil
+	}
+
+	pub := []string{}
+	// responses to requests are received on inbox subjects
+	sub := []string{"_INBOX.>"}
+
+	if t.NodeID == "" {
+		pub = append(pub, "nodes.*.*", "history.*")
+		sub = append(sub, "p.>", "up.>")
+	}
+
+	if t.NodeID != "" || write {
+		subtreeID := t.NodeID
+		if subtreeID == "" {
+			root, err := client.GetRootNode(nc)
+			if err != nil {
+				return nil, err
+			}
+			subtreeID = root.ID
+		}
+
+		nodes, err := client.GetSubtreeTypes(nc, subtreeID)
+		if err != nil {
+			return nil, err
+		}
+
+		for id, typ := range nodes {
+			if t.NodeID != "" {
+				pub = append(pub, "nodes.*."+id, "nodes."+id+".*")
+				sub = append(sub, "p."+id, "p."+id+".*", "up."+id+".>")
+			}
+			if write && t.AllowsPoints(typ) {
+				pub = append(pub, "p."+id, "phr."+id)
+			}
+			if admin {
+				// edge points create, delete, and move child nodes
+				pub = append(pub, "p.*."+id)
+			}
+		}
+	}
+
+	return &server.Permissions{
+		Publish:   &server.SubjectPermission{Allow: pub},
+		Subscribe: &server.SubjectPermission{Allow: sub},
+	}, nil
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestNatsAuthAPIToken(t *testing.T) {
+	opts := TestServerOptions2
+	opts.StoreFile = "test-nats-auth.sqlite"
+	opts.AuthToken = "secret"
+
+	s, nc, err := NewServer(opts)
+	if err != nil {
+		t.Fatal("Error creating server: ", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		_ = s.Run()
+		close(stopped)
+	}()
+
+	defer func() {
+		s.Stop(nil)
+		<-stopped
+		os.Remove(opts.StoreFile)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = s.WaitStart(ctx)
+	cancel()
+	if err != nil {
+		t.Fatal("Error starting server: ", err)
+	}
+
+	root, err := client.GetRootNode(nc)
+	if err != nil {
+		t.Fatal("Error getting root node: ", err)
+	}
+
+	users, err := client.GetNodes(nc, root.ID, "all", data.NodeTypeUser, false)
+	if err != nil || len(users) < 1 {
+		t.Fatal("Error getting user: ", err)
+	}
+
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "ID-var",
+		Type:   data.NodeTypeVariable,
+		Parent: root.ID,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	for _, tok := range []client.APIToken{
+		{ID: "ID-read", Parent: users[0].ID, Token: "read-token",
+			Scope: data.PointValueRead},
+		{ID: "ID-write", Parent: users[0].ID, Token: "write-token",
+			Scope: data.PointValueWrite, NodeID: "ID-var"},
+		{ID: "ID-write-all", Parent: users[0].ID, Token: "write-all-token",
+			Scope: data.PointValueWrite},
+		{ID: "ID-expired", Parent: users[0].ID, Token: "expired-token",
+			Scope: data.PointValueAdmin, Expires: "2020-01-01"},
+	} {
+		err = client.SendNodeType(nc, tok, "test")
+		if err != nil {
+			t.Fatal("Error sending token: ", err)
+		}
+	}
+
+	connect := func(token string) (*nats.Conn, chan error, error) {
+		errs := make(chan error, 10)
+		c, err := nats.Connect(opts.NatsServer, nats.Token(token),
+			nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+				errs <- err
+			}))
+		return c, errs, err
+	}
+
+	expectViolation := func(errs chan error, exp bool) {
+		t.Helper()
+		select {
+		case err := <-errs:
+			if !exp {
+				t.Error("Unexpected error: ", err)
+			} else if !strings.Contains(strings.ToLower(err.Error()), nats.PERMISSIONS_ERR) {
+				t.Error("Expected permission violation, got: ", err)
+			}
+		case <-time.After(200 * time.Millisecond):
+			if exp {
+				t.Error("Expected permission violation")
+			}
+		}
+	}
+
+	for _, tok := range []string{"bad-token", "expired-token"} {
+		_, _, err = connect(tok)
+		if err == nil {
+			t.Errorf("%v: expected connection error", tok)
+		}
+	}
+
+	// read token can get nodes but not write points
+	rc, errs, err := connect("read-token")
+	if err != nil {
+		t.Fatal("Error connecting with read token: ", err)
+	}
+	defer rc.Close()
+
+	nodes, err := client.GetNodes(rc, root.ID, "ID-var", "", false)
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Read token can't get nodes: ", err)
+	}
+
+	err = rc.Publish(client.SubjectNodePoints("ID-var"), nil)
+	if err != nil {
+		t.Fatal("Error publishing: ", err)
+	}
+	_ = rc.Flush()
+	expectViolation(errs, true)
+
+	// write token is restricted to its subtree
+	wc, errs, err := connect("write-token")
+	if err != nil {
+		t.Fatal("Error connecting with write token: ", err)
+	}
+	defer wc.Close()
+
+	err = client.SendNodePoint(wc, "ID-var", data.Point{Type: data.PointTypeValue,
+		Key: "0", Value: 2}, true)
+	if err != nil {
+		t.Fatal("Write token can't send points: ", err)
+	}
+	expectViolation(errs, false)
+
+	_ = wc.Publish(client.SubjectNodePoints(root.ID), nil)
+	_ = wc.Flush()
+	expectViolation(errs, true)
+
+	// write tokens can't change users or tokens
+	ac, errs, err := connect("write-all-token")
+	if err != nil {
+		t.Fatal("Error connecting with write all token: ", err)
+	}
+	defer ac.Close()
+
+	err = client.SendNodePoint(ac, "ID-var", data.Point{Type: data.PointTypeValue,
+		Key: "0", Value: 3}, true)
+	if err != nil {
+		t.Fatal("Write all token can't send points: ", err)
+	}
+	expectViolation(errs, false)
+
+	for _, id := range []string{"ID-write-all", users[0].ID} {
+		_ = ac.Publish(client.SubjectNodePoints(id), nil)
+		_ = ac.Flush()
+		expectViolation(errs, true)
+	}
+}
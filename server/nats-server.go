@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
 )
 
 type natsServerOptions struct {
@@ -16,6 +17,8 @@ type natsServerOptions struct {
 	TLSCert    string
 	TLSKey     string
 	TLSTimeout float64
+	// Nc is used to look up API tokens
+	Nc *nats.Conn
 }
 
 // newNatsServer creates a new nats server instance
@@ -27,6 +30,12 @@ func newNatsServer(o natsServerOptions) (*server.Server, error) {
 		NoSigs:        true,
 	}
 
+	if o.Auth != "" {
+		// accept API tokens in addition to the auth token
+		opts.Authorization = ""
+		opts.CustomClientAuthentication = &natsAuth{token: o.Auth, nc: o.Nc}
+	}
+
 	if o.TLSCert != "" && o.TLSKey != "" {
 		log.Println("Setting up NATS TLS ...")
 		opts.TLS = true
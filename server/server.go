@@ -51,6 +51,10 @@ type Options struct {
 	CustomUIDir       string
 	CustomUIFS        fs.FS
 	UIAssetsDebug     bool
+	// point types exported by the Prometheus /metrics endpoint
+	MetricsPointTypes []string
+	// point types added as labels to /metrics
+	MetricsTagPointTypes []string
 	// optional ID (must be unique) for this instance, otherwise, a UUID will be used
 	ID string
 }
@@ -156,6 +160,7 @@ func (s *Server) Run() error {
 		TLSCert:    o.NatsTLSCert,
 		TLSKey:     o.NatsTLSKey,
 		TLSTimeout: o.NatsTLSTimeout,
+		Nc:         s.nc,
 	}
 
 	if !o.NatsDisableServer {
@@ -378,6 +383,9 @@ func (s *Server) Run() error {
 		JwtAuth:    siotStore.GetAuthorizer(),
 		AuthToken:  o.AuthToken,
 		Nc:         s.nc,
+
+		MetricsPointTypes:    o.MetricsPointTypes,
+		MetricsTagPointTypes: o.MetricsTagPointTypes,
 	})
 
 	g.Add(func() error {
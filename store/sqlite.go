@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/simpleiot/simpleiot/client"
 	"github.com/simpleiot/simpleiot/data"
 
 	// tell sql to use sqlite
@@ -135,6 +136,13 @@ func NewSqliteDb(dbFile string, rootID string) (*DbSqlite, error) {
 		return nil, err
 	}
 
+	// API tokens are looked up by hash on every request
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS nodePointTokenHash ON node_points(text)
+				WHERE type='` + data.PointTypeTokenHash + `'`)
+	if err != nil {
+		return nil, err
+	}
+
 	err = ret.initMeta()
 	if err != nil {
 		return nil, fmt.Errorf("Error initializing db meta: %v", err)
@@ -1061,11 +1069,36 @@ func (sdb *DbSqlite) queryPoints(tx *sql.Tx, query string, args ...any) (map[str
 // userCheck checks user authentication
 // returns nil, nil if user is not found
 func (sdb *DbSqlite) userCheck(email, password string) (data.Nodes, error) {
+	// users without a password (ex: provisioned by an OIDC login) can't log
+	// in with a password
+	if password == "" {
+		return nil, nil
+	}
+
+	return sdb.userFind(func(u data.User) bool {
+		return u.Email == email && u.Pass == password
+	})
+}
+
+// userFindEmail returns the user nodes with an email. The email match is
+// case insensitive.
+func (sdb *DbSqlite) userFindEmail(email string) (data.Nodes, error) {
+	if email == "" {
+		return nil, nil
+	}
+
+	return sdb.userFind(func(u data.User) bool {
+		return strings.EqualFold(u.Email, email)
+	})
+}
+
+// userFind returns the living user nodes that match
+func (sdb *DbSqlite) userFind(match func(u data.User) bool) (data.Nodes, error) {
 	var users []data.NodeEdge
 
 	rows, err := sdb.db.Query("SELECT down FROM edges WHERE type=?", data.NodeTypeUser)
 	if err != nil {
-		return nil, fmt.Errorf("userCheck, error query error: %v", err)
+		return nil, fmt.Errorf("userFind, error query error: %v", err)
 	}
 	defer rows.Close()
 
@@ -1097,8 +1130,7 @@ func (sdb *DbSqlite) userCheck(email, password string) (data.Nodes, error) {
 		}
 
 		n := ne[0].ToNode()
-		u := n.ToUser()
-		if u.Email == email && u.Pass == password {
+		if match(n.ToUser()) {
 			users = append(users, ne...)
 		}
 	}
@@ -1106,55 +1138,110 @@ func (sdb *DbSqlite) userCheck(email, password string) (data.Nodes, error) {
 	// make sure all these user nodes are still alive and have path to root
 	var ret []data.NodeEdge
 
-	var checkUserPathRoot func(string) (bool, error)
+	for _, u := range users {
+		ok, err := sdb.pathToRoot(u.ID)
+		if err != nil {
+			return nil, err
+		}
 
-	checkUserPathRoot = func(id string) (bool, error) {
-		edges, err := sdb.edges(nil, "SELECT * FROM edges WHERE down=?", id)
+		if ok {
+			ret = append(ret, u)
+		}
+	}
+
+	return ret, nil
+}
+
+// pathToRoot returns true if none of the edges of a node are deleted and
+// the node has a path to the root node
+func (sdb *DbSqlite) pathToRoot(id string) (bool, error) {
+	edges, err := sdb.edges(nil, "SELECT * FROM edges WHERE down=?", id)
+	if err != nil {
+		return false, err
+	}
+
+	for _, e := range edges {
+		// make sure edge is not tombstone
+		for _, p := range e.Points {
+			if p.Type == data.PointTypeTombstone && p.Value != 0 {
+				return false, nil
+			}
+		}
+
+		if e.Up == "root" {
+			return true, nil
+		}
+
+		// continue walking upstream
+		ok, err := sdb.pathToRoot(e.Up)
 		if err != nil {
 			return false, err
 		}
 
-		for _, e := range edges {
-			// make sure edge is not tombstone
-			for _, p := range e.Points {
-				if p.Type == data.PointTypeTombstone && p.Value != 0 {
-					return false, nil
-				}
-			}
+		if ok {
+			// found a path, return
+			return ok, nil
+		}
 
-			if e.Up == "root" {
-				return true, nil
-			}
+		// look at the next edge
+	}
 
-			// continue walking upstream
-			ok, err := checkUserPathRoot(e.Up)
-			if err != nil {
-				return false, err
-			}
+	return false, nil
+}
 
-			if ok {
-				// found a path, return
-				return ok, nil
-			}
+// apiTokenCheck returns the API token node with token. Tokens are found
+// by their hash. The token node and its user must have a path to the root
+// node.
+func (sdb *DbSqlite) apiTokenCheck(token string) (data.NodeEdge, bool, error) {
+	hash := client.HashToken(token)
 
-			// look at the next edge
+	rows, err := sdb.db.Query("SELECT node_id FROM node_points WHERE type=? AND text=?",
+		data.PointTypeTokenHash, hash)
+	if err != nil {
+		return data.NodeEdge{}, false, fmt.Errorf("apiTokenCheck, query error: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			log.Println("Error scanning api token id:", id)
+			continue
 		}
 
-		return false, nil
+		ids = append(ids, id)
 	}
 
-	for _, u := range users {
-		ok, err := checkUserPathRoot(u.ID)
+	if err := rows.Close(); err != nil {
+		return data.NodeEdge{}, false, err
+	}
+
+	for _, id := range ids {
+		ne, err := sdb.getNodes(nil, "all", id, data.NodeTypeAPIToken, false)
 		if err != nil {
-			return nil, err
+			log.Println("Error getting api token node for id:", id)
+			continue
 		}
 
-		if ok {
-			ret = append(ret, u)
+		for _, n := range ne {
+			t, ok := n.Points.Find(data.PointTypeTokenHash, "")
+			if !ok || !client.CheckTokenHash(t.Text, token) {
+				continue
+			}
+
+			ok, err := sdb.pathToRoot(n.ID)
+			if err != nil || !ok {
+				return data.NodeEdge{}, false, err
+			}
+
+			return n, true, nil
 		}
 	}
 
-	return ret, nil
+	return data.NodeEdge{}, false, nil
 }
 
 // up returns upstream ids for a node
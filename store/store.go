@@ -125,6 +125,14 @@ func (st *Store) Run() error {
 		return fmt.Errorf("Subscribe auth error: %w", err)
 	}
 
+	if st.subscriptions["auth.apiToken"], err = nc.Subscribe("auth.apiToken", st.handleAuthAPIToken); err != nil {
+		return fmt.Errorf("Subscribe auth error: %w", err)
+	}
+
+	if st.subscriptions["auth.userEmail"], err = nc.Subscribe("auth.userEmail", st.handleAuthUserEmail); err != nil {
+		return fmt.Errorf("Subscribe auth error: %w", err)
+	}
+
 	if st.subscriptions["auth.getNatsURI"], err = nc.Subscribe("auth.getNatsURI", st.handleAuthGetNatsURI); err != nil {
 		return fmt.Errorf("Subscribe auth error: %w", err)
 	}
@@ -260,6 +268,8 @@ func (st *Store) handleNodePoints(msg *nats.Msg) {
 		return
 	}
 
+	points = hashTokens(points)
+
 	// write points to database
 	err = st.db.nodePoints(nodeID, points)
 
@@ -281,6 +291,29 @@ func (st *Store) handleNodePoints(msg *nats.Msg) {
 	st.reply(msg.Reply, nil)
 }
 
+// hashTokens replaces token points with a hash of the token. Tokens are
+// only used to authenticate requests to this instance, so they are never
+// written to the database or sent upstream. Hashes can only be set by the
+// store, so token hash points from clients are dropped.
+func hashTokens(points data.Points) data.Points {
+	ret := points[:0]
+
+	for _, p := range points {
+		switch p.Type {
+		case data.PointTypeTokenHash:
+			continue
+		case data.PointTypeToken:
+			p.Type = data.PointTypeTokenHash
+			if p.Text != "" {
+				p.Text = client.HashToken(p.Text)
+			}
+		}
+		ret = append(ret, p)
+	}
+
+	return ret
+}
+
 func (st *Store) handleEdgePoints(msg *nats.Msg) {
 	start := time.Now()
 	defer func() {
@@ -474,6 +507,75 @@ func (st *Store) handleAuthUser(msg *nats.Msg) {
 	}
 }
 
+// handleAuthAPIToken returns the API token node for a token point, or no
+// nodes if the token is not found
+func (st *Store) handleAuthAPIToken(msg *nats.Msg) {
+	resp := &pb.NodesRequest{}
+
+	points, err := data.PbDecodePoints(msg.Data)
+	if err != nil {
+		resp.Error = fmt.Sprintf("Error decoding points: %v", err)
+	}
+
+	tokenP, ok := points.Find(data.PointTypeToken, "")
+	if err == nil && ok && tokenP.Text != "" {
+		node, found, err := st.db.apiTokenCheck(tokenP.Text)
+		if err != nil {
+			resp.Error = fmt.Sprintf("Error checking api token: %v", err)
+		} else if found {
+			nodes := data.Nodes{node}
+			resp.Nodes, err = nodes.ToPbNodes()
+			if err != nil {
+				resp.Error = fmt.Sprintf("Error pb encoding node: %v", err)
+			}
+		}
+	}
+
+	out, err := proto.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding api token response:", err)
+	}
+
+	err = st.nc.Publish(msg.Reply, out)
+	if err != nil {
+		log.Println("NATS: Error publishing response to auth.apiToken:", err)
+	}
+}
+
+// handleAuthUserEmail returns the user nodes with an email. It is used by
+// login methods that authenticate the user elsewhere (ex: OIDC).
+func (st *Store) handleAuthUserEmail(msg *nats.Msg) {
+	resp := &pb.NodesRequest{}
+
+	points, err := data.PbDecodePoints(msg.Data)
+	if err != nil {
+		resp.Error = fmt.Sprintf("Error decoding points: %v", err)
+	}
+
+	emailP, ok := points.Find(data.PointTypeEmail, "")
+	if err == nil && ok {
+		nodes, err := st.db.userFindEmail(emailP.Text)
+		if err != nil {
+			resp.Error = fmt.Sprintf("Error finding user: %v", err)
+		} else if len(nodes) > 0 {
+			resp.Nodes, err = nodes.ToPbNodes()
+			if err != nil {
+				resp.Error = fmt.Sprintf("Error pb encoding node: %v", err)
+			}
+		}
+	}
+
+	out, err := proto.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding user email response:", err)
+	}
+
+	err = st.nc.Publish(msg.Reply, out)
+	if err != nil {
+		log.Println("NATS: Error publishing response to auth.userEmail:", err)
+	}
+}
+
 func (st *Store) handleAuthGetNatsURI(msg *nats.Msg) {
 	points := data.Points{
 		{Type: data.PointTypeURI, Text: st.params.Server},